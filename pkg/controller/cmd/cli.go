@@ -35,6 +35,7 @@ func Run(argv []string) error {
 			schemaCommand(),
 			enqueueCommand(),
 			migrateCommand(),
+			policyCommand(),
 		},
 	}
 
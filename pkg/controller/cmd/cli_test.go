@@ -15,6 +15,8 @@ func TestFlags(t *testing.T) {
 		{"ingest"},
 		{"serve"},
 		{"client"},
+		{"policy"},
+		{"schema"},
 	}
 
 	for _, tc := range testCases {
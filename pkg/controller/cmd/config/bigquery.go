@@ -2,35 +2,249 @@ package config
 
 import (
 	"context"
+	"io"
 	"log/slog"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 	"github.com/secmon-lab/swarm/pkg/infra/bq"
+	"github.com/secmon-lab/swarm/pkg/infra/lake"
+	"github.com/secmon-lab/swarm/pkg/infra/memory"
 	"github.com/urfave/cli/v2"
 )
 
 type BigQuery struct {
+	backend   string
 	projectID types.GoogleProjectID
+
+	lakeDir    string
+	lakeFormat string
+
+	datasetAllow                  cli.StringSlice
+	datasetLocation               string
+	datasetDefaultTableExpiration time.Duration
+	datasetLabels                 cli.StringSlice
+	datasetKMSKey                 string
+
+	maxColumns      int
+	maxDepth        int
+	limitAction     string
+	fieldNameAction string
+	growthWarning   int
+
+	writer        string
+	loadJobFormat string
 }
 
 func (x *BigQuery) Flags() []cli.Flag {
 	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "bigquery",
+			Usage:       "BigQuery backend [gcp|memory|lake]. memory keeps tables and rows in memory and discards them at exit, for local demos. lake writes rows to Hive partitioned files in lake-dir instead of BigQuery",
+			EnvVars:     []string{"SWARM_BIGQUERY"},
+			Value:       bigQueryBackendGCP,
+			Destination: &x.backend,
+		},
+		&cli.StringFlag{
+			Name:        "lake-dir",
+			Usage:       "Root directory of data lake for lake backend",
+			EnvVars:     []string{"SWARM_LAKE_DIR"},
+			Destination: &x.lakeDir,
+		},
+		&cli.StringFlag{
+			Name:        "lake-format",
+			Usage:       "File format of data lake for lake backend [parquet|ndjson]",
+			EnvVars:     []string{"SWARM_LAKE_FORMAT"},
+			Value:       string(types.ParquetFormat),
+			Destination: &x.lakeFormat,
+		},
 		&cli.StringFlag{
 			Name:        "bigquery-project-id",
 			Usage:       "Google Cloud project ID for BigQuery",
 			EnvVars:     []string{"SWARM_BIGQUERY_PROJECT_ID"},
 			Destination: (*string)(&x.projectID),
 		},
+		&cli.StringSliceFlag{
+			Name:        "bigquery-dataset-allow",
+			Usage:       "Glob patterns of dataset name that is created automatically if not exists (e.g. 'logs_*'). Automatic creation is disabled if not set",
+			EnvVars:     []string{"SWARM_BIGQUERY_DATASET_ALLOW"},
+			Destination: &x.datasetAllow,
+		},
+		&cli.StringFlag{
+			Name:        "bigquery-dataset-location",
+			Usage:       "Location of automatically created dataset (e.g. 'US', 'asia-northeast1')",
+			EnvVars:     []string{"SWARM_BIGQUERY_DATASET_LOCATION"},
+			Destination: &x.datasetLocation,
+		},
+		&cli.DurationFlag{
+			Name:        "bigquery-dataset-default-table-expiration",
+			Usage:       "Default table expiration of automatically created dataset. 0 means no expiration",
+			EnvVars:     []string{"SWARM_BIGQUERY_DATASET_DEFAULT_TABLE_EXPIRATION"},
+			Destination: &x.datasetDefaultTableExpiration,
+		},
+		&cli.StringSliceFlag{
+			Name:        "bigquery-dataset-label",
+			Usage:       "Label of automatically created dataset in format of 'key=value'",
+			EnvVars:     []string{"SWARM_BIGQUERY_DATASET_LABEL"},
+			Destination: &x.datasetLabels,
+		},
+		&cli.StringFlag{
+			Name:        "bigquery-dataset-kms-key",
+			Usage:       "Cloud KMS key name for default encryption of automatically created dataset",
+			EnvVars:     []string{"SWARM_BIGQUERY_DATASET_KMS_KEY"},
+			Destination: &x.datasetKMSKey,
+		},
+		&cli.IntFlag{
+			Name:        "bigquery-max-columns",
+			Usage:       "Maximum number of columns including nested fields in a table. 0 means no limit",
+			EnvVars:     []string{"SWARM_BIGQUERY_MAX_COLUMNS"},
+			Destination: &x.maxColumns,
+		},
+		&cli.IntFlag{
+			Name:        "bigquery-max-depth",
+			Usage:       "Maximum nesting depth of columns (e.g. 'data.user.name' is 3). 0 means no limit",
+			EnvVars:     []string{"SWARM_BIGQUERY_MAX_DEPTH"},
+			Destination: &x.maxDepth,
+		},
+		&cli.StringFlag{
+			Name:        "bigquery-limit-action",
+			Usage:       "Action when max columns or max depth is exceeded [reject|json]",
+			EnvVars:     []string{"SWARM_BIGQUERY_LIMIT_ACTION"},
+			Value:       string(types.GuardReject),
+			Destination: &x.limitAction,
+		},
+		&cli.StringFlag{
+			Name:        "bigquery-field-name-action",
+			Usage:       "Action for field name that can not be used as column name [reject|rename|json]. Field name is not checked if not set",
+			EnvVars:     []string{"SWARM_BIGQUERY_FIELD_NAME_ACTION"},
+			Destination: &x.fieldNameAction,
+		},
+		&cli.IntFlag{
+			Name:        "bigquery-schema-growth-warning",
+			Usage:       "Report a warning when number of columns of a table grows beyond the value. 0 means no warning",
+			EnvVars:     []string{"SWARM_BIGQUERY_SCHEMA_GROWTH_WARNING"},
+			Destination: &x.growthWarning,
+		},
+		&cli.StringFlag{
+			Name:        "bigquery-writer",
+			Aliases:     []string{"writer"},
+			Usage:       "Method to insert records [storage-write|pooled-stream|load-job]. pooled-stream is suitable for many small objects, and load-job is suitable for bulk backfill",
+			EnvVars:     []string{"SWARM_BIGQUERY_WRITER"},
+			Value:       string(types.StorageWriteWriter),
+			Destination: &x.writer,
+		},
+		&cli.StringFlag{
+			Name:        "bigquery-load-job-format",
+			Usage:       "File format to stage records for load-job writer [ndjson|avro]. avro requires field names that are valid in Avro, and does not support INTERVAL and RANGE",
+			EnvVars:     []string{"SWARM_BIGQUERY_LOAD_JOB_FORMAT"},
+			Value:       string(types.NDJSONLoadJobFormat),
+			Destination: &x.loadJobFormat,
+		},
 	}
 }
 
-func (x *BigQuery) Configure(ctx context.Context) (*bq.Client, error) {
+const (
+	bigQueryBackendGCP    = "gcp"
+	bigQueryBackendMemory = "memory"
+	bigQueryBackendLake   = "lake"
+)
+
+// BigQueryClient is a BigQuery client that should be closed after use.
+type BigQueryClient interface {
+	interfaces.BigQuery
+	io.Closer
+}
+
+func (x *BigQuery) Configure(ctx context.Context) (BigQueryClient, error) {
+	switch x.backend {
+	case bigQueryBackendGCP, "":
+	case bigQueryBackendMemory:
+		return memory.New(memory.WithImplicitDataset()), nil
+	case bigQueryBackendLake:
+		if x.lakeDir == "" {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "lake-dir is required for lake backend")
+		}
+		format := types.LakeFormat(x.lakeFormat)
+		if err := format.Validate(); err != nil {
+			return nil, err
+		}
+		return lake.New(x.lakeDir, lake.WithFormat(format)), nil
+	default:
+		return nil, goerr.Wrap(types.ErrInvalidOption, "invalid bigquery backend", goerr.V("bigquery", x.backend))
+	}
+
 	if x.projectID == "" {
 		return nil, goerr.Wrap(types.ErrInvalidOption, "bigquery-project-id is required")
 	}
 
-	return bq.New(ctx, x.projectID)
+	writer := types.BQWriter(x.writer)
+	if err := writer.Validate(); err != nil {
+		return nil, err
+	}
+
+	loadJobFormat := types.LoadJobFormat(x.loadJobFormat)
+	if err := loadJobFormat.Validate(); err != nil {
+		return nil, err
+	}
+
+	return bq.New(ctx, x.projectID, bq.WithWriter(writer), bq.WithLoadJobFormat(loadJobFormat))
+}
+
+// DatasetConfig returns configuration of automatic dataset creation. It returns nil if no allow pattern is specified.
+func (x *BigQuery) DatasetConfig() (*model.DatasetConfig, error) {
+	patterns := x.datasetAllow.Value()
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "invalid bigquery-dataset-allow pattern", goerr.V("pattern", pattern))
+		}
+	}
+
+	var labels map[string]string
+	for _, v := range x.datasetLabels.Value() {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "bigquery-dataset-label must be 'key=value'", goerr.V("label", v))
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[key] = value
+	}
+
+	return &model.DatasetConfig{
+		AllowPatterns:          patterns,
+		Location:               x.datasetLocation,
+		DefaultTableExpiration: x.datasetDefaultTableExpiration,
+		Labels:                 labels,
+		KMSKeyName:             x.datasetKMSKey,
+	}, nil
+}
+
+// SchemaGuard returns configuration of schema guardrails. It returns nil if no guardrail is enabled.
+func (x *BigQuery) SchemaGuard() (*model.SchemaGuard, error) {
+	if x.maxColumns == 0 && x.maxDepth == 0 && x.fieldNameAction == "" && x.growthWarning == 0 {
+		return nil, nil
+	}
+
+	guard := &model.SchemaGuard{
+		MaxColumns:      x.maxColumns,
+		MaxDepth:        x.maxDepth,
+		LimitAction:     types.GuardAction(x.limitAction),
+		FieldNameAction: types.GuardAction(x.fieldNameAction),
+		GrowthWarning:   x.growthWarning,
+	}
+	if err := guard.Validate(); err != nil {
+		return nil, err
+	}
+	return guard, nil
 }
 
 func (x *BigQuery) ProjectID() types.GoogleProjectID {
@@ -39,6 +253,21 @@ func (x *BigQuery) ProjectID() types.GoogleProjectID {
 
 func (x *BigQuery) LogValue() slog.Value {
 	return slog.GroupValue(
+		slog.String("backend", x.backend),
 		slog.Any("projectID", x.projectID),
+		slog.String("lakeDir", x.lakeDir),
+		slog.String("lakeFormat", x.lakeFormat),
+		slog.Any("datasetAllow", x.datasetAllow.Value()),
+		slog.String("datasetLocation", x.datasetLocation),
+		slog.Duration("datasetDefaultTableExpiration", x.datasetDefaultTableExpiration),
+		slog.Any("datasetLabels", x.datasetLabels.Value()),
+		slog.String("datasetKMSKey", x.datasetKMSKey),
+		slog.Int("maxColumns", x.maxColumns),
+		slog.Int("maxDepth", x.maxDepth),
+		slog.String("limitAction", x.limitAction),
+		slog.String("fieldNameAction", x.fieldNameAction),
+		slog.Int("growthWarning", x.growthWarning),
+		slog.String("writer", x.writer),
+		slog.String("loadJobFormat", x.loadJobFormat),
 	)
 }
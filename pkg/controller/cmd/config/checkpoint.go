@@ -0,0 +1,71 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/checkpoint"
+	"github.com/secmon-lab/swarm/pkg/infra/firestore"
+	"github.com/secmon-lab/swarm/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+const firestoreCheckpointScheme = "firestore://"
+
+// Checkpoint is configuration of the store of enqueue checkpoint. It is a local file path or `firestore://{project}/{database}`.
+type Checkpoint struct {
+	location string
+	client   *firestore.Client
+}
+
+func (x *Checkpoint) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "checkpoint",
+			Usage:       "Store of checkpoint to resume enqueue, local file path or 'firestore://{project}/{database}'",
+			EnvVars:     []string{"SWARM_ENQUEUE_CHECKPOINT"},
+			Destination: &x.location,
+		},
+	}
+}
+
+// Configure returns the checkpoint store. It returns nil if checkpoint is not configured. The client should be closed by Close after use.
+func (x *Checkpoint) Configure(ctx context.Context) (interfaces.CheckpointStore, error) {
+	if x.location == "" {
+		return nil, nil
+	}
+
+	path, ok := strings.CutPrefix(x.location, firestoreCheckpointScheme)
+	if !ok {
+		return checkpoint.NewFile(x.location), nil
+	}
+
+	projectID, databaseID, ok := strings.Cut(path, "/")
+	if !ok || projectID == "" || databaseID == "" || strings.Contains(databaseID, "/") {
+		return nil, goerr.Wrap(types.ErrInvalidOption, "checkpoint of Firestore must be 'firestore://{project}/{database}'", goerr.V("checkpoint", x.location))
+	}
+
+	client, err := firestore.New(ctx, projectID, databaseID)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to configure Firestore client for checkpoint")
+	}
+	x.client = client
+	return client, nil
+}
+
+// Close implements io.Closer. It closes the client created by Configure.
+func (x *Checkpoint) Close() error {
+	if x.client != nil {
+		utils.SafeClose(x.client)
+		x.client = nil
+	}
+	return nil
+}
+
+func (x *Checkpoint) LogValue() slog.Value {
+	return slog.StringValue(x.location)
+}
@@ -0,0 +1,64 @@
+package config_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/controller/cmd/config"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/checkpoint"
+	"github.com/urfave/cli/v2"
+)
+
+func TestCheckpoint(t *testing.T) {
+	testCases := map[string]struct {
+		args    []string
+		file    bool
+		wantErr bool
+	}{
+		"not configured": {
+			args: []string{},
+		},
+		"local file": {
+			args: []string{"--checkpoint", filepath.Join(t.TempDir(), "checkpoint.json")},
+			file: true,
+		},
+		"firestore without database": {
+			args:    []string{"--checkpoint", "firestore://my-project"},
+			wantErr: true,
+		},
+		"firestore with extra path": {
+			args:    []string{"--checkpoint", "firestore://my-project/my-db/extra"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var cfg config.Checkpoint
+			app := cli.App{
+				Name:  "test",
+				Flags: cfg.Flags(),
+				Action: func(c *cli.Context) error {
+					store, err := cfg.Configure(context.Background())
+					switch {
+					case tc.wantErr:
+						gt.Error(t, err).Is(types.ErrInvalidOption)
+					case tc.file:
+						gt.NoError(t, err)
+						_, ok := store.(*checkpoint.File)
+						gt.True(t, ok)
+					default:
+						gt.NoError(t, err)
+						gt.Nil(t, store)
+					}
+					return nil
+				},
+			}
+
+			gt.NoError(t, app.Run(append([]string{"cmd"}, tc.args...)))
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/urfave/cli/v2"
+)
+
+// EnqueueFilter is configuration of filter of objects to enqueue for targeted backfill.
+type EnqueueFilter struct {
+	startOffset    string
+	endOffset      string
+	glob           string
+	regex          string
+	minSize        string
+	maxSize        string
+	createdAfter   string
+	createdBefore  string
+	updatedAfter   string
+	updatedBefore  string
+	storageClasses cli.StringSlice
+}
+
+func (x *EnqueueFilter) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "start-offset",
+			Usage:       "List objects whose names are lexicographically equal to or after the value (e.g. 'logs/2024/01/')",
+			Destination: &x.startOffset,
+		},
+		&cli.StringFlag{
+			Name:        "end-offset",
+			Usage:       "List objects whose names are lexicographically before the value (e.g. 'logs/2024/02/')",
+			Destination: &x.endOffset,
+		},
+		&cli.StringFlag{
+			Name:        "glob",
+			Usage:       "Glob pattern of object name evaluated by Cloud Storage (e.g. 'logs/**/*.json.gz')",
+			Destination: &x.glob,
+		},
+		&cli.StringFlag{
+			Name:        "regex",
+			Usage:       "Regular expression of object name",
+			Destination: &x.regex,
+		},
+		&cli.StringFlag{
+			Name:        "min-size",
+			Usage:       "Minimum size of object (e.g. 1KiB)",
+			Destination: &x.minSize,
+		},
+		&cli.StringFlag{
+			Name:        "max-size",
+			Usage:       "Maximum size of object (e.g. 1GiB)",
+			Destination: &x.maxSize,
+		},
+		&cli.StringFlag{
+			Name:        "created-after",
+			Usage:       "Enqueue objects created at or after the time in RFC3339 (e.g. 2024-01-01T00:00:00Z)",
+			Destination: &x.createdAfter,
+		},
+		&cli.StringFlag{
+			Name:        "created-before",
+			Usage:       "Enqueue objects created before the time in RFC3339",
+			Destination: &x.createdBefore,
+		},
+		&cli.StringFlag{
+			Name:        "updated-after",
+			Usage:       "Enqueue objects updated at or after the time in RFC3339",
+			Destination: &x.updatedAfter,
+		},
+		&cli.StringFlag{
+			Name:        "updated-before",
+			Usage:       "Enqueue objects updated before the time in RFC3339",
+			Destination: &x.updatedBefore,
+		},
+		&cli.StringSliceFlag{
+			Name:        "storage-class",
+			Usage:       "Storage class of object (e.g. STANDARD, NEARLINE). Multiple classes can be specified",
+			Destination: &x.storageClasses,
+		},
+	}
+}
+
+// Configure returns filter of objects to enqueue. It returns nil if no filter is specified.
+func (x *EnqueueFilter) Configure() (*model.EnqueueFilter, error) {
+	filter := &model.EnqueueFilter{
+		StartOffset:    x.startOffset,
+		EndOffset:      x.endOffset,
+		Glob:           x.glob,
+		StorageClasses: x.storageClasses.Value(),
+	}
+	configured := x.startOffset != "" || x.endOffset != "" || x.glob != "" || len(filter.StorageClasses) > 0
+
+	if x.regex != "" {
+		re, err := regexp.Compile(x.regex)
+		if err != nil {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "invalid regex of object name", goerr.V("regex", x.regex), goerr.V("error", err))
+		}
+		filter.Regex = re
+		configured = true
+	}
+
+	sizes := []struct {
+		name  string
+		value string
+		dst   *int64
+	}{
+		{"min-size", x.minSize, &filter.MinSize},
+		{"max-size", x.maxSize, &filter.MaxSize},
+	}
+	for _, size := range sizes {
+		if size.value == "" {
+			continue
+		}
+		v, err := humanize.ParseBytes(size.value)
+		if err != nil {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "invalid size of object", goerr.V(size.name, size.value), goerr.V("error", err))
+		}
+		*size.dst = int64(v)
+		configured = true
+	}
+
+	times := []struct {
+		name  string
+		value string
+		dst   *time.Time
+	}{
+		{"created-after", x.createdAfter, &filter.CreatedAfter},
+		{"created-before", x.createdBefore, &filter.CreatedBefore},
+		{"updated-after", x.updatedAfter, &filter.UpdatedAfter},
+		{"updated-before", x.updatedBefore, &filter.UpdatedBefore},
+	}
+	for _, t := range times {
+		if t.value == "" {
+			continue
+		}
+		v, err := time.Parse(time.RFC3339, t.value)
+		if err != nil {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "time must be RFC3339", goerr.V(t.name, t.value))
+		}
+		*t.dst = v
+		configured = true
+	}
+
+	if !configured {
+		return nil, nil
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+func (x *EnqueueFilter) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("start-offset", x.startOffset),
+		slog.String("end-offset", x.endOffset),
+		slog.String("glob", x.glob),
+		slog.String("regex", x.regex),
+		slog.String("min-size", x.minSize),
+		slog.String("max-size", x.maxSize),
+		slog.String("created-after", x.createdAfter),
+		slog.String("created-before", x.createdBefore),
+		slog.String("updated-after", x.updatedAfter),
+		slog.String("updated-before", x.updatedBefore),
+		slog.Any("storage-class", x.storageClasses.Value()),
+	)
+}
@@ -0,0 +1,90 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/controller/cmd/config"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/urfave/cli/v2"
+)
+
+func TestEnqueueFilter(t *testing.T) {
+	testCases := map[string]struct {
+		args    []string
+		wantErr bool
+		test    func(t *testing.T, filter *model.EnqueueFilter)
+	}{
+		"no filter": {
+			args: []string{},
+			test: func(t *testing.T, filter *model.EnqueueFilter) {
+				gt.Nil(t, filter)
+			},
+		},
+		"all filters": {
+			args: []string{
+				"--start-offset", "logs/2024/01/",
+				"--end-offset", "logs/2024/02/",
+				"--glob", "**/*.json",
+				"--regex", `\.json$`,
+				"--min-size", "1KiB",
+				"--max-size", "1MiB",
+				"--created-after", "2024-01-01T00:00:00Z",
+				"--updated-before", "2024-02-01T00:00:00Z",
+				"--storage-class", "STANDARD",
+			},
+			test: func(t *testing.T, filter *model.EnqueueFilter) {
+				gt.NotNil(t, filter)
+				gt.Equal(t, filter.StartOffset, "logs/2024/01/")
+				gt.Equal(t, filter.EndOffset, "logs/2024/02/")
+				gt.Equal(t, filter.Glob, "**/*.json")
+				gt.True(t, filter.Regex.MatchString("a.json"))
+				gt.Equal(t, filter.MinSize, 1024)
+				gt.Equal(t, filter.MaxSize, 1024*1024)
+				gt.Equal(t, filter.CreatedAfter, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+				gt.Equal(t, filter.UpdatedBefore, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC))
+				gt.Equal(t, filter.StorageClasses, []string{"STANDARD"})
+			},
+		},
+		"invalid regex": {
+			args:    []string{"--regex", "("},
+			wantErr: true,
+		},
+		"invalid size": {
+			args:    []string{"--min-size", "large"},
+			wantErr: true,
+		},
+		"invalid time": {
+			args:    []string{"--created-after", "2024-01-01"},
+			wantErr: true,
+		},
+		"reversed range": {
+			args:    []string{"--created-after", "2024-02-01T00:00:00Z", "--created-before", "2024-01-01T00:00:00Z"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var filterCfg config.EnqueueFilter
+			app := cli.App{
+				Name:  "test",
+				Flags: filterCfg.Flags(),
+				Action: func(c *cli.Context) error {
+					filter, err := filterCfg.Configure()
+					if tc.wantErr {
+						gt.Error(t, err).Is(types.ErrInvalidOption)
+						return nil
+					}
+					gt.NoError(t, err)
+					tc.test(t, filter)
+					return nil
+				},
+			}
+
+			gt.NoError(t, app.Run(append([]string{"cmd"}, tc.args...)))
+		})
+	}
+}
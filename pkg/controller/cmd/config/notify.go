@@ -0,0 +1,119 @@
+package config
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/pubsub"
+	"github.com/secmon-lab/swarm/pkg/usecase"
+	"github.com/secmon-lab/swarm/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// Notify is configuration of Pub/Sub topics to publish log records after insertion. A topic is specified in format of `name=projects/{project}/topics/{topic}`, and selected by `notify.topic` field of log output.
+type Notify struct {
+	topics  cli.StringSlice
+	closers []io.Closer
+}
+
+type notifyTopic struct {
+	name      types.NotifyTopic
+	projectID types.GoogleProjectID
+	topicID   types.PubSubTopicID
+}
+
+func (x *Notify) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:        "notify-topic",
+			Usage:       "Pub/Sub topic to publish log records selected by `notify.topic` field of log output, in format of 'name=projects/{project}/topics/{topic}'",
+			EnvVars:     []string{"SWARM_NOTIFY_TOPIC"},
+			Destination: &x.topics,
+		},
+	}
+}
+
+func (x *Notify) parse() ([]notifyTopic, error) {
+	var topics []notifyTopic
+	for _, spec := range x.topics.Value() {
+		name, target, ok := strings.Cut(spec, "=")
+		if !ok || name == "" {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "notify topic must be 'name=projects/{project}/topics/{topic}'", goerr.V("topic", spec))
+		}
+		for _, t := range topics {
+			if t.name == types.NotifyTopic(name) {
+				return nil, goerr.Wrap(types.ErrInvalidOption, "notify topic name is duplicated", goerr.V("topic", spec))
+			}
+		}
+
+		projectID, topicID, ok := parseTopicPath(target)
+		if !ok {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "notify topic must be 'name=projects/{project}/topics/{topic}'", goerr.V("topic", spec))
+		}
+		topics = append(topics, notifyTopic{
+			name:      types.NotifyTopic(name),
+			projectID: projectID,
+			topicID:   topicID,
+		})
+	}
+	return topics, nil
+}
+
+// Configure creates Pub/Sub clients of notify topics and returns options of usecase to add them. Clients should be closed by Close after use.
+func (x *Notify) Configure(ctx context.Context) ([]usecase.Option, error) {
+	topics, err := x.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var options []usecase.Option
+	for _, t := range topics {
+		client, err := pubsub.NewTopic(ctx, t.projectID, t.topicID)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to create Pub/Sub client for notify topic", goerr.V("name", t.name))
+		}
+		x.closers = append(x.closers, client)
+		options = append(options, usecase.WithNotifyTopic(t.name, client))
+	}
+	return options, nil
+}
+
+// Dump returns options of usecase to write messages of notify topics to files in outDir instead of publishing them. It is for dry run.
+func (x *Notify) Dump(outDir string) ([]usecase.Option, error) {
+	topics, err := x.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var options []usecase.Option
+	for _, t := range topics {
+		options = append(options, usecase.WithNotifyTopic(t.name, pubsub.NewDumper(outDir)))
+	}
+	return options, nil
+}
+
+// Close implements io.Closer. It closes clients created by Configure.
+func (x *Notify) Close() error {
+	for _, c := range x.closers {
+		utils.SafeClose(c)
+	}
+	x.closers = nil
+	return nil
+}
+
+func (x *Notify) LogValue() slog.Value {
+	return slog.AnyValue(x.topics.Value())
+}
+
+// parseTopicPath parses Pub/Sub topic path in format of `projects/{project}/topics/{topic}`.
+func parseTopicPath(path string) (types.GoogleProjectID, types.PubSubTopicID, bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 4 || parts[0] != "projects" || parts[2] != "topics" || parts[1] == "" || parts[3] == "" {
+		return "", "", false
+	}
+	return types.GoogleProjectID(parts[1]), types.PubSubTopicID(parts[3]), true
+}
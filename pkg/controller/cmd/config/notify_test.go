@@ -0,0 +1,60 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/controller/cmd/config"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/urfave/cli/v2"
+)
+
+func TestNotify(t *testing.T) {
+	testCases := map[string]struct {
+		args    []string
+		count   int
+		wantErr bool
+	}{
+		"no args": {
+			args: []string{},
+		},
+		"topics": {
+			args:  []string{"--notify-topic", "alerts=projects/my-project/topics/alerts", "--notify-topic", "audit=projects/my-project/topics/audit"},
+			count: 2,
+		},
+		"missing name": {
+			args:    []string{"--notify-topic", "projects/my-project/topics/alerts"},
+			wantErr: true,
+		},
+		"duplicated name": {
+			args:    []string{"--notify-topic", "alerts=projects/my-project/topics/a", "--notify-topic", "alerts=projects/my-project/topics/b"},
+			wantErr: true,
+		},
+		"invalid topic path": {
+			args:    []string{"--notify-topic", "alerts=my-project/alerts"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var notify config.Notify
+			app := cli.App{
+				Name:  "test",
+				Flags: notify.Flags(),
+				Action: func(c *cli.Context) error {
+					options, err := notify.Dump(t.TempDir())
+					if tc.wantErr {
+						gt.Error(t, err).Is(types.ErrInvalidOption)
+					} else {
+						gt.NoError(t, err)
+						gt.A(t, options).Length(tc.count)
+					}
+					return nil
+				},
+			}
+
+			gt.NoError(t, app.Run(append([]string{"cmd"}, tc.args...)))
+		})
+	}
+}
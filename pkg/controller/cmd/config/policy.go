@@ -2,13 +2,23 @@ package config
 
 import (
 	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
 
 	"github.com/secmon-lab/swarm/pkg/infra/policy"
 	"github.com/urfave/cli/v2"
 )
 
 type Policy struct {
-	dir cli.StringSlice
+	dir         cli.StringSlice
+	dataFile    cli.StringSlice
+	dataRefresh time.Duration
+	hmacKey     cli.StringSlice
+	printLimit  int
+	printSample int
 }
 
 func (x *Policy) Flags() []cli.Flag {
@@ -21,6 +31,38 @@ func (x *Policy) Flags() []cli.Flag {
 			Destination: &x.dir,
 			Required:    true,
 		},
+		&cli.StringSliceFlag{
+			Name:        "policy-data-file",
+			Usage:       "File path of JSON/YAML data document for policy. The document is available as data.<file name without extension>",
+			EnvVars:     []string{"SWARM_POLICY_DATA_FILE"},
+			Destination: &x.dataFile,
+		},
+		&cli.DurationFlag{
+			Name:        "policy-data-refresh",
+			Usage:       "Interval to reload data documents of policy. 0 disables reload",
+			EnvVars:     []string{"SWARM_POLICY_DATA_REFRESH"},
+			Destination: &x.dataRefresh,
+		},
+		&cli.StringSliceFlag{
+			Name:        "policy-hmac-key",
+			Usage:       "Key of swarm.hmac built-in function in format of 'name=secret'",
+			EnvVars:     []string{"SWARM_POLICY_HMAC_KEY"},
+			Destination: &x.hmacKey,
+		},
+		&cli.IntFlag{
+			Name:        "policy-print-limit",
+			Usage:       "Max number of print() output lines of policy for each object. 0 means unlimited",
+			EnvVars:     []string{"SWARM_POLICY_PRINT_LIMIT"},
+			Destination: &x.printLimit,
+			Value:       100,
+		},
+		&cli.IntFlag{
+			Name:        "policy-print-sample",
+			Usage:       "Sampling interval of print() output of policy. Only 1 of every N lines is logged",
+			EnvVars:     []string{"SWARM_POLICY_PRINT_SAMPLE"},
+			Destination: &x.printSample,
+			Value:       1,
+		},
 	}
 }
 
@@ -29,12 +71,46 @@ func (x *Policy) Configure() (*policy.Client, error) {
 	for _, dir := range x.dir.Value() {
 		options = append(options, policy.WithDir(dir))
 	}
+	for _, file := range x.dataFile.Value() {
+		options = append(options, policy.WithDataFile(file))
+	}
+	for _, v := range x.hmacKey.Value() {
+		name, key, ok := strings.Cut(v, "=")
+		if !ok || name == "" || key == "" {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "policy-hmac-key must be 'name=secret'")
+		}
+		options = append(options, policy.WithHMACKey(name, []byte(key)))
+	}
 
 	return policy.New(options...)
 }
 
+// hmacKeyNames returns only names of HMAC keys to avoid logging secrets.
+func (x *Policy) hmacKeyNames() []string {
+	var names []string
+	for _, v := range x.hmacKey.Value() {
+		name, _, _ := strings.Cut(v, "=")
+		names = append(names, name)
+	}
+	return names
+}
+
+// DataRefresh returns interval to reload data documents. Zero means data documents are not reloaded.
+func (x *Policy) DataRefresh() time.Duration { return x.dataRefresh }
+
+// PrintLimit returns max number of print() output lines for each object.
+func (x *Policy) PrintLimit() int { return x.printLimit }
+
+// PrintSample returns sampling interval of print() output.
+func (x *Policy) PrintSample() int { return x.printSample }
+
 func (x *Policy) LogValue() slog.Value {
 	return slog.GroupValue(
 		slog.Any("policyDir", x.dir.Value()),
+		slog.Any("dataFile", x.dataFile.Value()),
+		slog.Duration("dataRefresh", x.dataRefresh),
+		slog.Any("hmacKeys", x.hmacKeyNames()),
+		slog.Int("printLimit", x.printLimit),
+		slog.Int("printSample", x.printSample),
 	)
 }
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/bq"
+	"github.com/secmon-lab/swarm/pkg/infra/lake"
+	"github.com/secmon-lab/swarm/pkg/infra/pubsub"
+	"github.com/secmon-lab/swarm/pkg/infra/sink"
+	"github.com/secmon-lab/swarm/pkg/usecase"
+	"github.com/secmon-lab/swarm/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// Sink is configuration of output destinations of log records other than the BigQuery table. A sink is specified in format of `name=type:target`.
+//
+//   - `pubsub:projects/{project}/topics/{topic}` publishes each record to the Pub/Sub topic
+//   - `bigquery:{project}` writes records to BigQuery of another project with the same dataset and table
+//   - `parquet:{dir}` and `ndjson:{dir}` write records to Hive partitioned files in the directory
+type Sink struct {
+	specs   cli.StringSlice
+	closers []io.Closer
+}
+
+func (x *Sink) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:        "sink",
+			Usage:       "Output destination of log records selected by `sink` field of log output, in format of 'name=type:target'. type is one of pubsub (projects/{project}/topics/{topic}), bigquery ({project}), parquet ({dir}) and ndjson ({dir})",
+			EnvVars:     []string{"SWARM_SINK"},
+			Destination: &x.specs,
+		},
+	}
+}
+
+// Configure creates clients of sinks and returns options of usecase to add them. Clients should be closed by Close after use.
+func (x *Sink) Configure(ctx context.Context) ([]usecase.Option, error) {
+	var options []usecase.Option
+	names := make(map[types.SinkName]struct{})
+
+	for _, spec := range x.specs.Value() {
+		name, target, ok := strings.Cut(spec, "=")
+		if !ok || name == "" {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "sink must be 'name=type:target'", goerr.V("sink", spec))
+		}
+		sinkName := types.SinkName(name)
+		if sinkName == types.BigQuerySink {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "sink name is reserved for the BigQuery table", goerr.V("sink", spec))
+		}
+		if _, ok := names[sinkName]; ok {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "sink name is duplicated", goerr.V("sink", spec))
+		}
+		names[sinkName] = struct{}{}
+
+		sinkType, target, ok := strings.Cut(target, ":")
+		if !ok || target == "" {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "sink must be 'name=type:target'", goerr.V("sink", spec))
+		}
+
+		switch sinkType {
+		case "pubsub":
+			projectID, topicID, ok := parseTopicPath(target)
+			if !ok {
+				return nil, goerr.Wrap(types.ErrInvalidOption, "target of pubsub sink must be 'projects/{project}/topics/{topic}'", goerr.V("sink", spec))
+			}
+			topic, err := pubsub.NewTopic(ctx, projectID, topicID)
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to create Pub/Sub client for sink", goerr.V("sink", spec))
+			}
+			x.closers = append(x.closers, topic)
+			options = append(options, usecase.WithSink(sinkName, sink.NewPubSub(topic)))
+
+		case "bigquery":
+			client, err := bq.New(ctx, types.GoogleProjectID(target))
+			if err != nil {
+				return nil, goerr.Wrap(err, "failed to create BigQuery client for sink", goerr.V("sink", spec))
+			}
+			x.closers = append(x.closers, client)
+			options = append(options, usecase.WithTableSink(sinkName, client))
+
+		case "parquet", "ndjson":
+			client := lake.New(target, lake.WithFormat(types.LakeFormat(sinkType)))
+			options = append(options, usecase.WithTableSink(sinkName, client))
+
+		default:
+			return nil, goerr.Wrap(types.ErrInvalidOption, "unsupported sink type", goerr.V("sink", spec))
+		}
+	}
+
+	return options, nil
+}
+
+// Close implements io.Closer. It closes clients created by Configure.
+func (x *Sink) Close() error {
+	for _, c := range x.closers {
+		utils.SafeClose(c)
+	}
+	x.closers = nil
+	return nil
+}
+
+func (x *Sink) LogValue() slog.Value {
+	return slog.AnyValue(x.specs.Value())
+}
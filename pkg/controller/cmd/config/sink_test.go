@@ -0,0 +1,70 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/controller/cmd/config"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/urfave/cli/v2"
+)
+
+func TestSink(t *testing.T) {
+	dir := t.TempDir()
+
+	testCases := map[string]struct {
+		args    []string
+		count   int
+		wantErr bool
+	}{
+		"no args": {
+			args: []string{},
+		},
+		"file sinks": {
+			args:  []string{"--sink", "archive=parquet:" + dir, "--sink", "raw=ndjson:" + dir},
+			count: 2,
+		},
+		"missing name": {
+			args:    []string{"--sink", "parquet:" + dir},
+			wantErr: true,
+		},
+		"reserved name": {
+			args:    []string{"--sink", "bigquery=parquet:" + dir},
+			wantErr: true,
+		},
+		"duplicated name": {
+			args:    []string{"--sink", "archive=parquet:" + dir, "--sink", "archive=ndjson:" + dir},
+			wantErr: true,
+		},
+		"unsupported type": {
+			args:    []string{"--sink", "archive=csv:" + dir},
+			wantErr: true,
+		},
+		"invalid pubsub topic": {
+			args:    []string{"--sink", "alert=pubsub:my-topic"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var sink config.Sink
+			app := cli.App{
+				Name:  "test",
+				Flags: sink.Flags(),
+				Action: func(c *cli.Context) error {
+					options, err := sink.Configure(c.Context)
+					if tc.wantErr {
+						gt.Error(t, err).Is(types.ErrInvalidOption)
+					} else {
+						gt.NoError(t, err)
+						gt.A(t, options).Length(tc.count)
+					}
+					return sink.Close()
+				},
+			}
+
+			gt.NoError(t, app.Run(append([]string{"cmd"}, tc.args...)))
+		})
+	}
+}
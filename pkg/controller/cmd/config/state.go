@@ -0,0 +1,112 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/firestore"
+	"github.com/secmon-lab/swarm/pkg/usecase"
+	"github.com/secmon-lab/swarm/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+// State is configuration of state of message processing to prevent duplicate processing. State is stored in Firestore and shared by serve and job.
+type State struct {
+	firestoreProject  string
+	firestoreDatabase string
+	timeout           time.Duration
+	ttl               time.Duration
+	objectState       bool
+
+	client *firestore.Client
+}
+
+func (x *State) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:        "state-timeout",
+			EnvVars:     []string{"SWARM_STATE_TIMEOUT"},
+			Usage:       "Timeout duration to wait state",
+			Destination: &x.timeout,
+			Value:       30 * time.Minute,
+		},
+		&cli.DurationFlag{
+			Name:        "state-ttl",
+			EnvVars:     []string{"SWARM_STATE_TTL"},
+			Usage:       "TTL duration to keep state",
+			Destination: &x.ttl,
+			Value:       7 * 24 * time.Hour,
+		},
+		&cli.StringFlag{
+			Name:        "firestore-project-id",
+			EnvVars:     []string{"SWARM_FIRESTORE_PROJECT_ID"},
+			Usage:       "Project ID of Firestore (To manage state)",
+			Destination: &x.firestoreProject,
+		},
+		&cli.StringFlag{
+			Name:        "firestore-database-id",
+			EnvVars:     []string{"SWARM_FIRESTORE_DATABASE_ID"},
+			Usage:       "Database ID of Firestore (To manage state)",
+			Destination: &x.firestoreDatabase,
+		},
+		&cli.BoolFlag{
+			Name:        "object-state",
+			EnvVars:     []string{"SWARM_OBJECT_STATE"},
+			Usage:       "Manage state of each object in addition to each message to load the same object notified by multiple messages once. It requires Firestore",
+			Destination: &x.objectState,
+		},
+	}
+}
+
+// Configure creates Firestore client to manage state. It returns nil if Firestore is not configured, and then state is not managed. The client should be closed by Close after use.
+func (x *State) Configure(ctx context.Context) (interfaces.Database, error) {
+	if x.firestoreProject == "" && x.firestoreDatabase == "" {
+		if x.objectState {
+			return nil, goerr.Wrap(types.ErrInvalidOption, "object-state requires firestore-project-id and firestore-database-id")
+		}
+		utils.Logger().Warn("firestore is not configured")
+		return nil, nil
+	}
+	if x.firestoreProject == "" || x.firestoreDatabase == "" {
+		return nil, goerr.Wrap(types.ErrInvalidOption, "both firestore-project-id and firestore-database-id are required")
+	}
+
+	client, err := firestore.New(ctx, x.firestoreProject, x.firestoreDatabase)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to configure Firestore client")
+	}
+	x.client = client
+	return client, nil
+}
+
+// Options returns options of usecase for state management.
+func (x *State) Options() []usecase.Option {
+	return []usecase.Option{
+		usecase.WithStateTimeout(x.timeout),
+		usecase.WithStateTTL(x.ttl),
+		usecase.WithObjectState(x.objectState),
+	}
+}
+
+// Close implements io.Closer. It closes the client created by Configure.
+func (x *State) Close() error {
+	if x.client != nil {
+		utils.SafeClose(x.client)
+		x.client = nil
+	}
+	return nil
+}
+
+func (x *State) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("timeout", x.timeout.String()),
+		slog.String("ttl", x.ttl.String()),
+		slog.String("firestore-project-id", x.firestoreProject),
+		slog.String("firestore-database-id", x.firestoreDatabase),
+		slog.Bool("object-state", x.objectState),
+	)
+}
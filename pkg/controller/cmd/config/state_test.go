@@ -0,0 +1,57 @@
+package config_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/controller/cmd/config"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/urfave/cli/v2"
+)
+
+func TestState(t *testing.T) {
+	testCases := map[string]struct {
+		args    []string
+		wantErr bool
+	}{
+		"not configured": {
+			args: []string{},
+		},
+		"only project": {
+			args:    []string{"--firestore-project-id", "my-project"},
+			wantErr: true,
+		},
+		"only database": {
+			args:    []string{"--firestore-database-id", "my-database"},
+			wantErr: true,
+		},
+		"object state without firestore": {
+			args:    []string{"--object-state"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var state config.State
+			app := cli.App{
+				Name:  "test",
+				Flags: state.Flags(),
+				Action: func(c *cli.Context) error {
+					db, err := state.Configure(context.Background())
+					if tc.wantErr {
+						gt.Error(t, err).Is(types.ErrInvalidOption)
+					} else {
+						gt.NoError(t, err)
+						gt.Nil(t, db)
+					}
+					gt.A(t, state.Options()).Length(3)
+					return nil
+				},
+			}
+
+			gt.NoError(t, app.Run(append([]string{"cmd"}, tc.args...)))
+		})
+	}
+}
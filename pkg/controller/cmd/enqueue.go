@@ -18,9 +18,13 @@ import (
 func enqueueCommand() *cli.Command {
 	var (
 		pubsubCfg  config.PubSub
+		filterCfg  config.EnqueueFilter
+		ckptCfg    config.Checkpoint
 		countLimit int
 		sizeLimit  int
 		outDir     string
+		dryRun     bool
+		resume     bool
 	)
 
 	return &cli.Command{
@@ -49,15 +53,39 @@ func enqueueCommand() *cli.Command {
 				Destination: &sizeLimit,
 				Value:       4,
 			},
-		}, pubsubCfg.Flags()),
+			&cli.BoolFlag{
+				Name:        "dry-run",
+				Usage:       "List and count objects to enqueue for each URL without publishing",
+				Destination: &dryRun,
+			},
+			&cli.BoolFlag{
+				Name:        "resume",
+				Usage:       "Resume enqueue of the same arguments from checkpoint saved by --checkpoint",
+				Destination: &resume,
+			},
+		}, pubsubCfg.Flags(), filterCfg.Flags(), ckptCfg.Flags()),
 		Action: func(ctx *cli.Context) error {
 			var pubsubClient interfaces.PubSubTopic
 
-			utils.Logger().Info("Start enqueue command", "output", outDir)
+			utils.Logger().Info("Start enqueue command",
+				"output", outDir,
+				"dry-run", dryRun,
+				"resume", resume,
+				"filter", &filterCfg,
+				"checkpoint", &ckptCfg,
+			)
+
+			filter, err := filterCfg.Configure()
+			if err != nil {
+				return err
+			}
 
-			if outDir != "" {
+			switch {
+			case dryRun:
+				// Messages are not published in dry run
+			case outDir != "":
 				pubsubClient = pubsub.NewDumper(outDir)
-			} else {
+			default:
 				client, err := pubsubCfg.Configure(ctx.Context)
 				if err != nil {
 					return err
@@ -70,11 +98,25 @@ func enqueueCommand() *cli.Command {
 				return err
 			}
 
-			clients := infra.New(
+			infraOptions := []infra.Option{
 				infra.WithPubSubTopic(pubsubClient),
 				infra.WithCloudStorage(csClient),
+			}
+
+			store, err := ckptCfg.Configure(ctx.Context)
+			if err != nil {
+				return err
+			}
+			defer utils.SafeClose(&ckptCfg)
+			if store != nil {
+				infraOptions = append(infraOptions, infra.WithCheckpointStore(store))
+			}
+
+			clients := infra.New(infraOptions...)
+			uc := usecase.New(clients,
+				usecase.WithEnqueueCountLimit(countLimit),
+				usecase.WithEnqueueSizeLimit(sizeLimit),
 			)
-			uc := usecase.New(clients)
 
 			var urls []types.ObjectURL
 			for _, arg := range ctx.Args().Slice() {
@@ -82,16 +124,29 @@ func enqueueCommand() *cli.Command {
 			}
 
 			req := &model.EnqueueRequest{
-				URLs: urls,
+				URLs:   urls,
+				Filter: filter,
+				DryRun: dryRun,
+				Resume: resume,
 			}
 			resp, err := uc.Enqueue(ctx.Context, req)
 			if err != nil {
 				return err
 			}
 
+			for _, prefix := range resp.Prefixes {
+				utils.Logger().Info("Matched objects",
+					slog.Any("url", prefix.URL),
+					slog.Int64("object_count", prefix.Count),
+					slog.Int64("object_size", prefix.Size),
+				)
+			}
+
 			utils.Logger().Info("Enqueue request is completed",
+				slog.Bool("dry_run", dryRun),
 				slog.Int64("object_count", resp.Count),
 				slog.Int64("object_size", resp.Size),
+				slog.Int64("batch_count", resp.Batches),
 				slog.Any("elapsed", resp.Elapsed.String()),
 			)
 
@@ -20,6 +20,8 @@ func ingestCommand() *cli.Command {
 		bigquery config.BigQuery
 		policy   config.Policy
 		metadata config.Metadata
+		sink     config.Sink
+		notify   config.Notify
 	)
 	return &cli.Command{
 		Name:      "ingest",
@@ -30,7 +32,7 @@ func ingestCommand() *cli.Command {
 			&cli.BoolFlag{
 				Name:        "dry-run",
 				Aliases:     []string{"d"},
-				Usage:       "Dry run mode",
+				Usage:       "Dry run mode. Table schemas, rows and notify messages are written to files in the output directory instead of BigQuery and Pub/Sub",
 				EnvVars:     []string{"SWARM_DRY_RUN"},
 				Destination: &dryRun,
 			},
@@ -42,7 +44,7 @@ func ingestCommand() *cli.Command {
 				Value:       ".",
 				Destination: &output,
 			},
-		}, bigquery.Flags(), policy.Flags(), metadata.Flags()),
+		}, bigquery.Flags(), policy.Flags(), metadata.Flags(), sink.Flags(), notify.Flags()),
 
 		Action: func(c *cli.Context) error {
 			ctx := c.Context
@@ -61,6 +63,7 @@ func ingestCommand() *cli.Command {
 				if err != nil {
 					return goerr.Wrap(err, "failed to configure BigQuery client")
 				}
+				defer utils.SafeClose(client)
 				bqClient = client
 			}
 
@@ -74,13 +77,45 @@ func ingestCommand() *cli.Command {
 				return goerr.Wrap(err, "failed to configure metadata")
 			}
 
+			datasetCfg, err := bigquery.DatasetConfig()
+			if err != nil {
+				return goerr.Wrap(err, "failed to configure dataset creation")
+			}
+			guard, err := bigquery.SchemaGuard()
+			if err != nil {
+				return goerr.Wrap(err, "failed to configure schema guard")
+			}
+
+			sinkOptions, err := sink.Configure(ctx)
+			if err != nil {
+				return goerr.Wrap(err, "failed to configure sinks")
+			}
+			defer utils.SafeClose(&sink)
+
+			var notifyOptions []usecase.Option
+			if dryRun {
+				notifyOptions, err = notify.Dump(output)
+			} else {
+				notifyOptions, err = notify.Configure(ctx)
+			}
+			if err != nil {
+				return goerr.Wrap(err, "failed to configure notify topics")
+			}
+			defer utils.SafeClose(&notify)
+
 			uc := usecase.New(
 				infra.New(
 					infra.WithPolicy(policyClient),
 					infra.WithCloudStorage(csClient),
 					infra.WithBigQuery(bqClient),
 				),
-				usecase.WithMetadata(md),
+				append([]usecase.Option{
+					usecase.WithMetadata(md),
+					usecase.WithDatasetConfig(datasetCfg),
+					usecase.WithSchemaGuard(guard),
+					usecase.WithRegoPrintLimit(policy.PrintLimit()),
+					usecase.WithRegoPrintSample(policy.PrintSample()),
+				}, append(sinkOptions, notifyOptions...)...)...,
 			)
 
 			for _, url := range c.Args().Slice() {
@@ -2,9 +2,14 @@ package cmd
 
 import (
 	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/secmon-lab/swarm/pkg/controller/cmd/config"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
 	"github.com/secmon-lab/swarm/pkg/infra"
 	"github.com/secmon-lab/swarm/pkg/infra/cs"
 	"github.com/secmon-lab/swarm/pkg/infra/pubsub"
@@ -23,15 +28,27 @@ func jobCommand() *cli.Command {
 		bq       config.BigQuery
 		policy   config.Policy
 		metadata config.Metadata
+		sink     config.Sink
+		notify   config.Notify
 		sentry   config.Sentry
+		state    config.State
 
-		memoryLimit   string
-		subscriptions cli.StringSlice
+		memoryLimit     string
+		subscriptions   cli.StringSlice
+		skipPolicyCheck bool
+
+		messageConcurrency     int
+		pullSize               int
+		maxOutstandingMessages int
+		maxOutstandingBytes    string
+		idleTimeout            time.Duration
+		drainTimeout           time.Duration
+		nackDelay              time.Duration
 	)
 
 	return &cli.Command{
 		Name:  "job",
-		Usage: "Start swarm server",
+		Usage: "Run worker processing messages of Pub/Sub subscriptions",
 		Flags: mergeFlags([]cli.Flag{
 			&cli.IntFlag{
 				Name:        "read-concurrency",
@@ -60,17 +77,80 @@ func jobCommand() *cli.Command {
 				Usage:       "Memory limit for each process. If it exceeds the limit, the process return 429 too many requests error. (e.g. 1GiB)",
 				Destination: &memoryLimit,
 			},
+			&cli.BoolFlag{
+				Name:        "skip-policy-check",
+				EnvVars:     []string{"SWARM_SKIP_POLICY_CHECK"},
+				Usage:       "Skip static validation of policy files at startup",
+				Destination: &skipPolicyCheck,
+			},
 			&cli.StringSliceFlag{
 				Name:        "subscriptions",
-				Usage:       "Pub/Sub subscriptions to listen",
+				Usage:       "Pub/Sub subscriptions to listen, in format of '[cs:|swarm:]projects/{project}/subscriptions/{subscription}'. Schema of messages is detected automatically if prefix is omitted",
 				EnvVars:     []string{"SWARM_SUBSCRIPTIONS"},
 				Destination: &subscriptions,
 			},
-		}, bq.Flags(), policy.Flags(), metadata.Flags(), sentry.Flags()),
+			&cli.IntFlag{
+				Name:        "message-concurrency",
+				EnvVars:     []string{"SWARM_MESSAGE_CONCURRENCY"},
+				Usage:       "Number of messages processed concurrently for each subscription",
+				Destination: &messageConcurrency,
+				Value:       8,
+			},
+			&cli.IntFlag{
+				Name:        "pull-size",
+				EnvVars:     []string{"SWARM_PULL_SIZE"},
+				Usage:       "Max number of messages pulled at once",
+				Destination: &pullSize,
+				Value:       10,
+			},
+			&cli.IntFlag{
+				Name:        "max-outstanding-messages",
+				EnvVars:     []string{"SWARM_MAX_OUTSTANDING_MESSAGES"},
+				Usage:       "Max number of messages pulled but not acknowledged yet for each subscription",
+				Destination: &maxOutstandingMessages,
+				Value:       16,
+			},
+			&cli.StringFlag{
+				Name:        "max-outstanding-bytes",
+				EnvVars:     []string{"SWARM_MAX_OUTSTANDING_BYTES"},
+				Usage:       "Max total size of messages pulled but not acknowledged yet for each subscription (e.g. 64MiB). 0 means no limit",
+				Destination: &maxOutstandingBytes,
+				Value:       "64MiB",
+			},
+			&cli.DurationFlag{
+				Name:        "idle-timeout",
+				EnvVars:     []string{"SWARM_IDLE_TIMEOUT"},
+				Usage:       "Exit if no message is available for the duration (e.g. 60s). It is for Cloud Run Jobs. 0 means running until SIGTERM",
+				Destination: &idleTimeout,
+			},
+			&cli.DurationFlag{
+				Name:        "drain-timeout",
+				EnvVars:     []string{"SWARM_DRAIN_TIMEOUT"},
+				Usage:       "Duration to wait for in-flight messages after SIGTERM or idle timeout. 0 means waiting until all of them are completed",
+				Destination: &drainTimeout,
+				Value:       30 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:        "nack-delay",
+				EnvVars:     []string{"SWARM_NACK_DELAY"},
+				Usage:       "Delay of redelivery of a message that failed to be processed. It is doubled for each delivery attempt if dead lettering is enabled on the subscription",
+				Destination: &nackDelay,
+				Value:       10 * time.Second,
+			},
+		}, bq.Flags(), policy.Flags(), metadata.Flags(), sentry.Flags(), sink.Flags(), notify.Flags(), state.Flags()),
 
 		Action: func(c *cli.Context) error {
 			ctx := c.Context
 
+			var subs []*model.Subscription
+			for _, s := range subscriptions.Value() {
+				sub, err := model.ParseSubscription(s)
+				if err != nil {
+					return err
+				}
+				subs = append(subs, sub)
+			}
+
 			utils.Logger().Info("starting server",
 				slog.Group("config",
 					"addr", addr,
@@ -78,11 +158,22 @@ func jobCommand() *cli.Command {
 					"ingest-table-concurrency", ingestTableConcurrency,
 					"ingest-record-concurrency", ingestRecordConcurrency,
 					"memory-limit", memoryLimit,
+					"skip-policy-check", skipPolicyCheck,
+					"message-concurrency", messageConcurrency,
+					"pull-size", pullSize,
+					"max-outstanding-messages", maxOutstandingMessages,
+					"max-outstanding-bytes", maxOutstandingBytes,
+					"idle-timeout", idleTimeout.String(),
+					"drain-timeout", drainTimeout.String(),
+					"nack-delay", nackDelay.String(),
 
 					"bigquery", &bq,
 					"policy", &policy,
 					"metadata", &metadata,
+					"sink", &sink,
+					"notify", &notify,
 					"sentry", &sentry,
+					"state", &state,
 				),
 			)
 
@@ -97,11 +188,15 @@ func jobCommand() *cli.Command {
 				return goerr.Wrap(err, "failed to configure policy client")
 			}
 			infraOptions = append(infraOptions, infra.WithPolicy(policyClient))
+			if interval := policy.DataRefresh(); interval > 0 {
+				go policyClient.RunDataRefresh(ctx, interval)
+			}
 
 			bqClient, err := bq.Configure(ctx)
 			if err != nil {
 				return goerr.Wrap(err, "failed to configure BigQuery client")
 			}
+			defer utils.SafeClose(bqClient)
 			infraOptions = append(infraOptions, infra.WithBigQuery(bqClient))
 
 			csClient, err := cs.New(ctx)
@@ -110,30 +205,90 @@ func jobCommand() *cli.Command {
 			}
 			infraOptions = append(infraOptions, infra.WithCloudStorage(csClient))
 
+			dbClient, err := state.Configure(ctx)
+			if err != nil {
+				return goerr.Wrap(err, "failed to configure state")
+			}
+			defer utils.SafeClose(&state)
+			if dbClient != nil {
+				infraOptions = append(infraOptions, infra.WithDatabase(dbClient))
+			}
+
 			subClient, err := pubsub.NewSubscriptionClient(ctx)
 			if err != nil {
 				return goerr.Wrap(err, "failed to configure Pub/Sub subscription client")
 			}
 			infraOptions = append(infraOptions, infra.WithPubSubSubscription(subClient))
 
+			outstandingBytes, err := humanize.ParseBytes(maxOutstandingBytes)
+			if err != nil {
+				return goerr.Wrap(err, "invalid max outstanding bytes option", goerr.V("value", maxOutstandingBytes))
+			}
+
 			ucOptions := []usecase.Option{
 				usecase.WithIngestTableConcurrency(ingestTableConcurrency),
 				usecase.WithIngestRecordConcurrency(ingestRecordConcurrency),
+				usecase.WithRegoPrintLimit(policy.PrintLimit()),
+				usecase.WithRegoPrintSample(policy.PrintSample()),
+				usecase.WithJobConcurrency(messageConcurrency),
+				usecase.WithJobPullSize(pullSize),
+				usecase.WithJobMaxOutstandingMessages(maxOutstandingMessages),
+				usecase.WithJobMaxOutstandingBytes(int(outstandingBytes)),
+				usecase.WithJobIdleTimeout(idleTimeout),
+				usecase.WithJobDrainTimeout(drainTimeout),
+				usecase.WithJobNackDelay(nackDelay),
 			}
 
+			ucOptions = append(ucOptions, state.Options()...)
+
 			if meta, err := metadata.Configure(); err != nil {
 				return goerr.Wrap(err, "failed to configure metadata")
 			} else if meta != nil {
 				ucOptions = append(ucOptions, usecase.WithMetadata(meta))
 			}
 
+			if datasetCfg, err := bq.DatasetConfig(); err != nil {
+				return goerr.Wrap(err, "failed to configure dataset creation")
+			} else if datasetCfg != nil {
+				ucOptions = append(ucOptions, usecase.WithDatasetConfig(datasetCfg))
+			}
+			if guard, err := bq.SchemaGuard(); err != nil {
+				return goerr.Wrap(err, "failed to configure schema guard")
+			} else if guard != nil {
+				ucOptions = append(ucOptions, usecase.WithSchemaGuard(guard))
+			}
+
 			if readConcurrency > 0 {
 				ucOptions = append(ucOptions, usecase.WithReadObjectConcurrency(readConcurrency))
 			}
 
+			sinkOptions, err := sink.Configure(ctx)
+			if err != nil {
+				return goerr.Wrap(err, "failed to configure sinks")
+			}
+			defer utils.SafeClose(&sink)
+			ucOptions = append(ucOptions, sinkOptions...)
+
+			notifyOptions, err := notify.Configure(ctx)
+			if err != nil {
+				return goerr.Wrap(err, "failed to configure notify topics")
+			}
+			defer utils.SafeClose(&notify)
+			ucOptions = append(ucOptions, notifyOptions...)
+
 			uc := usecase.New(infra.New(infraOptions...), ucOptions...)
 
-			return uc.RunWithSubscriptions(ctx, subscriptions.Value())
+			if !skipPolicyCheck {
+				if _, err := uc.CheckPolicy(ctx); err != nil {
+					return err
+				}
+			}
+
+			// Stop pulling messages and drain in-flight messages by SIGTERM
+			ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, syscall.SIGINT)
+			defer stop()
+
+			return uc.RunWithSubscriptions(ctx, subs)
 		},
 	}
 }
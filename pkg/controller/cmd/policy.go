@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/secmon-lab/swarm/pkg/controller/cmd/config"
+	"github.com/secmon-lab/swarm/pkg/infra"
+	"github.com/secmon-lab/swarm/pkg/usecase"
+	"github.com/urfave/cli/v2"
+)
+
+func policyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "policy",
+		Usage: "Manage policy files",
+		Subcommands: []*cli.Command{
+			policyCheckCommand(),
+		},
+	}
+}
+
+func policyCheckCommand() *cli.Command {
+	var (
+		policy config.Policy
+	)
+
+	return &cli.Command{
+		Name:  "check",
+		Usage: "Validate policy files statically. It exits with non-zero status if any error is found",
+		Flags: policy.Flags(),
+		Action: func(c *cli.Context) error {
+			policyClient, err := policy.Configure()
+			if err != nil {
+				return err
+			}
+
+			uc := usecase.New(infra.New(infra.WithPolicy(policyClient)))
+			issues, err := uc.CheckPolicy(c.Context)
+			for _, issue := range issues {
+				_, _ = fmt.Fprintln(c.App.Writer, issue.String())
+			}
+
+			return err
+		},
+	}
+}
@@ -1,13 +1,20 @@
 package cmd
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/m-mizutani/goerr/v2"
 	"github.com/secmon-lab/swarm/pkg/controller/cmd/config"
 	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 	"github.com/secmon-lab/swarm/pkg/infra"
 	"github.com/secmon-lab/swarm/pkg/infra/cs"
 	"github.com/secmon-lab/swarm/pkg/infra/dump"
 	"github.com/secmon-lab/swarm/pkg/usecase"
+	"github.com/secmon-lab/swarm/pkg/utils"
 	"github.com/urfave/cli/v2"
 )
 
@@ -16,10 +23,14 @@ func schemaCommand() *cli.Command {
 		outputDir string
 		bq        config.BigQuery
 		policy    config.Policy
+		metadata  config.Metadata
 	)
 	return &cli.Command{
 		Name:  "schema",
 		Usage: "Infer schema from Cloud Storage object, and apply it to BigQuery table",
+		Subcommands: []*cli.Command{
+			schemaDiffCommand(),
+		},
 		Flags: mergeFlags([]cli.Flag{
 			&cli.StringFlag{
 				Name:        "output-dir",
@@ -28,7 +39,7 @@ func schemaCommand() *cli.Command {
 				EnvVars:     []string{"SWARM_OUTPUT_DIR"},
 				Destination: &outputDir,
 			},
-		}, bq.Flags(), policy.Flags()),
+		}, bq.Flags(), policy.Flags(), metadata.Flags()),
 
 		Action: func(c *cli.Context) error {
 			var bqClient interfaces.BigQuery
@@ -39,6 +50,7 @@ func schemaCommand() *cli.Command {
 				if err != nil {
 					return err
 				}
+				defer utils.SafeClose(client)
 				bqClient = client
 			}
 
@@ -57,7 +69,27 @@ func schemaCommand() *cli.Command {
 				infra.WithCloudStorage(csClient),
 				infra.WithPolicy(policyClient),
 			)
-			uc := usecase.New(clients)
+
+			datasetCfg, err := bq.DatasetConfig()
+			if err != nil {
+				return err
+			}
+			guard, err := bq.SchemaGuard()
+			if err != nil {
+				return err
+			}
+			meta, err := metadata.Configure()
+			if err != nil {
+				return err
+			}
+
+			uc := usecase.New(clients,
+				usecase.WithMetadata(meta),
+				usecase.WithDatasetConfig(datasetCfg),
+				usecase.WithSchemaGuard(guard),
+				usecase.WithRegoPrintLimit(policy.PrintLimit()),
+				usecase.WithRegoPrintSample(policy.PrintSample()),
+			)
 
 			var urls []types.CSUrl
 			for i := 0; i < c.Args().Len(); i++ {
@@ -68,3 +100,110 @@ func schemaCommand() *cli.Command {
 		},
 	}
 }
+
+func schemaDiffCommand() *cli.Command {
+	var (
+		format string
+		bq     config.BigQuery
+		policy config.Policy
+	)
+	return &cli.Command{
+		Name:      "diff",
+		Usage:     "Show difference between inferred schema and current BigQuery table without applying it. It exits with non-zero status if there is an incompatible change",
+		ArgsUsage: "[Cloud Storage URL...]",
+		Flags: mergeFlags([]cli.Flag{
+			&cli.StringFlag{
+				Name:        "format",
+				Aliases:     []string{"f"},
+				Usage:       "Output format [text|json]",
+				EnvVars:     []string{"SWARM_SCHEMA_DIFF_FORMAT"},
+				Value:       "text",
+				Destination: &format,
+			},
+		}, bq.Flags(), policy.Flags()),
+
+		Action: func(c *cli.Context) error {
+			if format != "text" && format != "json" {
+				return goerr.Wrap(types.ErrInvalidOption, "invalid format", goerr.V("format", format))
+			}
+
+			bqClient, err := bq.Configure(c.Context)
+			if err != nil {
+				return err
+			}
+			defer utils.SafeClose(bqClient)
+
+			policyClient, err := policy.Configure()
+			if err != nil {
+				return err
+			}
+
+			csClient, err := cs.New(c.Context)
+			if err != nil {
+				return err
+			}
+
+			clients := infra.New(
+				infra.WithBigQuery(bqClient),
+				infra.WithCloudStorage(csClient),
+				infra.WithPolicy(policyClient),
+			)
+
+			guard, err := bq.SchemaGuard()
+			if err != nil {
+				return err
+			}
+
+			uc := usecase.New(clients,
+				usecase.WithSchemaGuard(guard),
+				usecase.WithRegoPrintLimit(policy.PrintLimit()),
+				usecase.WithRegoPrintSample(policy.PrintSample()),
+			)
+
+			var urls []types.CSUrl
+			for i := 0; i < c.Args().Len(); i++ {
+				urls = append(urls, types.CSUrl(c.Args().Get(i)))
+			}
+
+			diffs, err := uc.DiffInferredSchema(c.Context, urls)
+			if diffs != nil {
+				if wErr := writeSchemaDiffs(c.App.Writer, format, diffs); wErr != nil {
+					return wErr
+				}
+			}
+
+			return err
+		},
+	}
+}
+
+// writeSchemaDiffs writes diffs to w in format.
+func writeSchemaDiffs(w io.Writer, format string, diffs []*model.SchemaDiff) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diffs); err != nil {
+			return goerr.Wrap(err, "failed to encode schema diff")
+		}
+		return nil
+	}
+
+	for _, diff := range diffs {
+		header := diff.DatasetID.String() + "." + diff.TableID.String()
+		switch {
+		case diff.Created:
+			header += " (new table)"
+		case !diff.HasChange():
+			header += " (no change)"
+		}
+		_, _ = fmt.Fprintln(w, header)
+
+		for _, f := range diff.Added {
+			_, _ = fmt.Fprintf(w, "  + %s %s\n", f.Field, f.NewType)
+		}
+		for _, f := range diff.Changed {
+			_, _ = fmt.Fprintf(w, "  ! %s %s -> %s (incompatible)\n", f.Field, f.OldType, f.NewType)
+		}
+	}
+	return nil
+}
@@ -14,7 +14,6 @@ import (
 	"github.com/secmon-lab/swarm/pkg/controller/server"
 	"github.com/secmon-lab/swarm/pkg/infra"
 	"github.com/secmon-lab/swarm/pkg/infra/cs"
-	"github.com/secmon-lab/swarm/pkg/infra/firestore"
 	"github.com/secmon-lab/swarm/pkg/usecase"
 	"github.com/secmon-lab/swarm/pkg/utils"
 	"github.com/urfave/cli/v2"
@@ -26,18 +25,17 @@ func serveCommand() *cli.Command {
 		readConcurrency         int
 		ingestTableConcurrency  int
 		ingestRecordConcurrency int
-		stateTimeout            time.Duration
-		stateTTL                time.Duration
 
 		bq       config.BigQuery
 		policy   config.Policy
 		metadata config.Metadata
+		sink     config.Sink
+		notify   config.Notify
 		sentry   config.Sentry
+		state    config.State
 
-		firestoreProject  string
-		firestoreDatabase string
-
-		memoryLimit string
+		memoryLimit     string
+		skipPolicyCheck bool
 	)
 
 	return &cli.Command{
@@ -73,39 +71,19 @@ func serveCommand() *cli.Command {
 				Destination: &ingestRecordConcurrency,
 				Value:       16,
 			},
-			&cli.DurationFlag{
-				Name:        "state-timeout",
-				EnvVars:     []string{"SWARM_STATE_TIMEOUT"},
-				Usage:       "Timeout duration to wait state",
-				Destination: &stateTimeout,
-				Value:       30 * time.Minute,
-			},
-			&cli.DurationFlag{
-				Name:        "state-ttl",
-				EnvVars:     []string{"SWARM_STATE_TTL"},
-				Usage:       "TTL duration to keep state",
-				Destination: &stateTTL,
-				Value:       7 * 24 * time.Hour,
-			},
-			&cli.StringFlag{
-				Name:        "firestore-project-id",
-				EnvVars:     []string{"SWARM_FIRESTORE_PROJECT_ID"},
-				Usage:       "Project ID of Firestore (To manage state)",
-				Destination: &firestoreProject,
-			},
-			&cli.StringFlag{
-				Name:        "firestore-database-id",
-				EnvVars:     []string{"SWARM_FIRESTORE_DATABASE_ID"},
-				Usage:       "Database ID of Firestore (To manage state)",
-				Destination: &firestoreDatabase,
-			},
 			&cli.StringFlag{
 				Name:        "memory-limit",
 				EnvVars:     []string{"SWARM_MEMORY_LIMIT"},
 				Usage:       "Memory limit for each process. If it exceeds the limit, the process return 429 too many requests error. (e.g. 1GiB)",
 				Destination: &memoryLimit,
 			},
-		}, bq.Flags(), policy.Flags(), metadata.Flags(), sentry.Flags()),
+			&cli.BoolFlag{
+				Name:        "skip-policy-check",
+				EnvVars:     []string{"SWARM_SKIP_POLICY_CHECK"},
+				Usage:       "Skip static validation of policy files at startup",
+				Destination: &skipPolicyCheck,
+			},
+		}, bq.Flags(), policy.Flags(), metadata.Flags(), sentry.Flags(), sink.Flags(), notify.Flags(), state.Flags()),
 		Action: func(c *cli.Context) error {
 			ctx := c.Context
 
@@ -115,16 +93,16 @@ func serveCommand() *cli.Command {
 					"read-concurrency", readConcurrency,
 					"ingest-table-concurrency", ingestTableConcurrency,
 					"ingest-record-concurrency", ingestRecordConcurrency,
-					"state-timeout", stateTimeout.String(),
-					"state-ttl", stateTTL.String(),
-					"firestore-project-id", firestoreProject,
-					"firestore-database-id", firestoreDatabase,
 					"memory-limit", memoryLimit,
+					"skip-policy-check", skipPolicyCheck,
 
 					"bigquery", &bq,
 					"policy", &policy,
 					"metadata", &metadata,
+					"sink", &sink,
+					"notify", &notify,
 					"sentry", &sentry,
+					"state", &state,
 				),
 			)
 
@@ -139,11 +117,15 @@ func serveCommand() *cli.Command {
 				return goerr.Wrap(err, "failed to configure policy client")
 			}
 			infraOptions = append(infraOptions, infra.WithPolicy(policyClient))
+			if interval := policy.DataRefresh(); interval > 0 {
+				go policyClient.RunDataRefresh(ctx, interval)
+			}
 
 			bqClient, err := bq.Configure(ctx)
 			if err != nil {
 				return goerr.Wrap(err, "failed to configure BigQuery client")
 			}
+			defer utils.SafeClose(bqClient)
 			infraOptions = append(infraOptions, infra.WithBigQuery(bqClient))
 
 			csClient, err := cs.New(ctx)
@@ -152,37 +134,67 @@ func serveCommand() *cli.Command {
 			}
 			infraOptions = append(infraOptions, infra.WithCloudStorage(csClient))
 
-			if firestoreProject != "" && firestoreDatabase != "" {
-				dbClient, err := firestore.New(ctx, firestoreProject, firestoreDatabase)
-				if err != nil {
-					return goerr.Wrap(err, "failed to configure Firestore client")
-				}
+			dbClient, err := state.Configure(ctx)
+			if err != nil {
+				return goerr.Wrap(err, "failed to configure state")
+			}
+			defer utils.SafeClose(&state)
+			if dbClient != nil {
 				infraOptions = append(infraOptions, infra.WithDatabase(dbClient))
-			} else if firestoreProject != "" || firestoreDatabase != "" {
-				return goerr.New("both firestore-project-id and firestore-database-id are required")
-			} else {
-				utils.Logger().Warn("firestore is not configured")
 			}
 
 			ucOptions := []usecase.Option{
 				usecase.WithIngestTableConcurrency(ingestTableConcurrency),
 				usecase.WithIngestRecordConcurrency(ingestRecordConcurrency),
-				usecase.WithStateTimeout(stateTimeout),
-				usecase.WithStateTTL(stateTTL),
+				usecase.WithRegoPrintLimit(policy.PrintLimit()),
+				usecase.WithRegoPrintSample(policy.PrintSample()),
 			}
 
+			ucOptions = append(ucOptions, state.Options()...)
+
 			if meta, err := metadata.Configure(); err != nil {
 				return goerr.Wrap(err, "failed to configure metadata")
 			} else if meta != nil {
 				ucOptions = append(ucOptions, usecase.WithMetadata(meta))
 			}
 
+			if datasetCfg, err := bq.DatasetConfig(); err != nil {
+				return goerr.Wrap(err, "failed to configure dataset creation")
+			} else if datasetCfg != nil {
+				ucOptions = append(ucOptions, usecase.WithDatasetConfig(datasetCfg))
+			}
+			if guard, err := bq.SchemaGuard(); err != nil {
+				return goerr.Wrap(err, "failed to configure schema guard")
+			} else if guard != nil {
+				ucOptions = append(ucOptions, usecase.WithSchemaGuard(guard))
+			}
+
 			if readConcurrency > 0 {
 				ucOptions = append(ucOptions, usecase.WithReadObjectConcurrency(readConcurrency))
 			}
 
+			sinkOptions, err := sink.Configure(ctx)
+			if err != nil {
+				return goerr.Wrap(err, "failed to configure sinks")
+			}
+			defer utils.SafeClose(&sink)
+			ucOptions = append(ucOptions, sinkOptions...)
+
+			notifyOptions, err := notify.Configure(ctx)
+			if err != nil {
+				return goerr.Wrap(err, "failed to configure notify topics")
+			}
+			defer utils.SafeClose(&notify)
+			ucOptions = append(ucOptions, notifyOptions...)
+
 			uc := usecase.New(infra.New(infraOptions...), ucOptions...)
 
+			if !skipPolicyCheck {
+				if _, err := uc.CheckPolicy(ctx); err != nil {
+					return err
+				}
+			}
+
 			var serverOptions []server.Option
 			if memoryLimit != "" {
 				limit, err := humanize.ParseBytes(memoryLimit)
@@ -28,6 +28,8 @@ type serverCfg struct {
 
 type requestHandler func(uc interfaces.UseCase, r *http.Request) error
 
+type messageHandler func(uc interfaces.UseCase, ctx context.Context, data []byte) error
+
 type Option func(*serverCfg)
 
 func WithMemoryLimit(limit uint64) Option {
@@ -97,8 +99,8 @@ func New(uc interfaces.UseCase, options ...Option) *Server {
 		}
 
 		r.Route("/pubsub", func(r chi.Router) {
-			r.Post("/cs", api(handlePubSubMessage(handleCloudStorageEvent)))
-			r.Post("/swarm", api(handlePubSubMessage(handleSwarmEvent)))
+			r.Post("/cs", api(handlePubSubMessage(interfaces.UseCase.HandleCloudStorageEvent)))
+			r.Post("/swarm", api(handlePubSubMessage(interfaces.UseCase.HandleSwarmMessage)))
 		})
 	})
 
@@ -107,9 +109,7 @@ func New(uc interfaces.UseCase, options ...Option) *Server {
 	}
 }
 
-type eventHandler func(ctx context.Context, uc interfaces.UseCase, data []byte) error
-
-func handlePubSubMessage(hdlr eventHandler) requestHandler {
+func handlePubSubMessage(hdlr messageHandler) requestHandler {
 	return func(uc interfaces.UseCase, r *http.Request) error {
 		var msg model.PubSubBody
 		body, err := io.ReadAll(r.Body)
@@ -155,7 +155,7 @@ func handlePubSubMessage(hdlr eventHandler) requestHandler {
 			return goerr.Wrap(err, "failed to decode base64", goerr.V("data", msg.Message.Data))
 		}
 
-		if err := hdlr(ctx, uc, data); err != nil {
+		if err := hdlr(uc, ctx, data); err != nil {
 			return goerr.Wrap(err, "failed to handle pubsub message")
 		}
 		msgState = types.MsgCompleted
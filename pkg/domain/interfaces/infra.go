@@ -24,6 +24,10 @@ type BigQuery interface {
 	GetMetadata(ctx context.Context, dataset types.BQDatasetID, table types.BQTableID) (*bigquery.TableMetadata, error)
 	UpdateTable(ctx context.Context, dataset types.BQDatasetID, table types.BQTableID, md bigquery.TableMetadataToUpdate, eTag string) error
 	CreateTable(ctx context.Context, dataset types.BQDatasetID, table types.BQTableID, md *bigquery.TableMetadata) error
+
+	// GetDataset returns metadata of the dataset. It returns nil without error if the dataset does not exist.
+	GetDataset(ctx context.Context, dataset types.BQDatasetID) (*bigquery.DatasetMetadata, error)
+	CreateDataset(ctx context.Context, dataset types.BQDatasetID, md *bigquery.DatasetMetadata) error
 }
 
 type BigQueryStream interface {
@@ -31,12 +35,17 @@ type BigQueryStream interface {
 	Close() error
 }
 
+// Sink is an output destination of log records other than the BigQuery table. Records in group are ones that specify the sink, and dst is the destination table of them.
+type Sink interface {
+	Write(ctx context.Context, dst model.BigQueryDest, group *model.LogRecordGroup) error
+}
+
 type PubSubTopic interface {
-	Publish(ctx context.Context, data []byte) (types.PubSubMessageID, error)
+	Publish(ctx context.Context, data []byte, options ...model.PublishOption) (types.PubSubMessageID, error)
 }
 
 type PubSubSubscription interface {
-	Pull(ctx context.Context, subName string) ([]*pubsubpb.ReceivedMessage, error)
+	Pull(ctx context.Context, subName string, maxMessages int) ([]*pubsubpb.ReceivedMessage, error)
 	ModifyAckDeadline(ctx context.Context, subName string, ackID string, deadline time.Duration) error
 	Acknowledge(ctx context.Context, subName string, ackID string) error
 	Close() error
@@ -52,6 +61,12 @@ type CloudStorage interface {
 	List(ctx context.Context, bucket types.CSBucket, query *storage.Query) CSObjectIterator
 }
 
+// CheckpointStore saves checkpoint of enqueue. GetEnqueueCheckpoint returns types.ErrCheckpointNotFound if the checkpoint does not exist.
+type CheckpointStore interface {
+	GetEnqueueCheckpoint(ctx context.Context, id string) (*model.EnqueueCheckpoint, error)
+	PutEnqueueCheckpoint(ctx context.Context, checkpoint *model.EnqueueCheckpoint) error
+}
+
 type Database interface {
 	GetOrCreateState(ctx context.Context, msgType types.MsgType, input *model.State) (*model.State, bool, error)
 	GetState(ctx context.Context, msgType types.MsgType, id string) (*model.State, error)
@@ -13,6 +13,8 @@ type UseCase interface {
 	Load(ctx context.Context, requests []*model.LoadRequest) error
 	Enqueue(ctx context.Context, req *model.EnqueueRequest) (*model.EnqueueResponse, error)
 	Authorize(ctx context.Context, input *model.AuthPolicyInput) error
+	HandleCloudStorageEvent(ctx context.Context, data []byte) error
+	HandleSwarmMessage(ctx context.Context, data []byte) error
 
 	GetOrCreateState(ctx context.Context, msgType types.MsgType, id string) (*model.State, bool, error)
 	UpdateState(ctx context.Context, msgType types.MsgType, id string, state types.MsgState) error
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"slices"
 	"time"
 
 	"github.com/secmon-lab/swarm/pkg/domain/types"
@@ -36,6 +37,79 @@ type IngestLog struct {
 	LogCount     int                `json:"log_count" bigquery:"log_count"`
 	Success      bool               `json:"success" bigquery:"success"`
 	Error        string             `json:"error" bigquery:"error"`
+	Conflicts    []*SchemaConflict  `json:"conflicts" bigquery:"conflicts"`
+	Sinks        []*SinkLog         `json:"sinks" bigquery:"sinks"`
+	NotifyCount  int                `json:"notify_count" bigquery:"notify_count"`
+
+	// SchemaChange is set if schema of the table is created or changed by the ingestion. It is stored in the schema change table instead of the load log.
+	SchemaChange *SchemaChangeLog `json:"-" bigquery:"-"`
+}
+
+// SinkLog is a result of writing records to an output destination. It is recorded only if the log output specifies sinks.
+type SinkLog struct {
+	Name     types.SinkName `json:"name" bigquery:"name"`
+	LogCount int            `json:"log_count" bigquery:"log_count"`
+	Success  bool           `json:"success" bigquery:"success"`
+	Error    string         `json:"error" bigquery:"error"`
+}
+
+// SchemaConflict is a record of type conflict resolution for a field.
+type SchemaConflict struct {
+	Field    string                 `json:"field" bigquery:"field"`
+	Strategy types.ConflictStrategy `json:"strategy" bigquery:"strategy"`
+	Count    int                    `json:"count" bigquery:"count"`
+}
+
+// SchemaChangeLog is a record of table schema change by ingestion. It is stored in the schema change table of metadata dataset to track when and why a column appeared.
+type SchemaChangeLog struct {
+	RequestID   types.RequestID   `json:"request_id" bigquery:"request_id"`
+	IngestID    types.IngestID    `json:"ingest_id" bigquery:"ingest_id"`
+	ChangedAt   time.Time         `json:"changed_at" bigquery:"changed_at"`
+	DatasetID   types.BQDatasetID `json:"dataset_id" bigquery:"dataset_id"`
+	TableID     types.BQTableID   `json:"table_id" bigquery:"table_id"`
+	Created     bool              `json:"created" bigquery:"created"`
+	OldSchema   string            `json:"old_schema" bigquery:"old_schema"`
+	NewSchema   string            `json:"new_schema" bigquery:"new_schema"`
+	AddedFields []string          `json:"added_fields" bigquery:"added_fields"`
+	Objects     []string          `json:"objects" bigquery:"objects"`
+}
+
+type SchemaChangeLogRaw struct {
+	SchemaChangeLog
+	ChangedAt int64 `json:"changed_at" bigquery:"changed_at"`
+}
+
+func (x *SchemaChangeLog) Raw() *SchemaChangeLogRaw {
+	return &SchemaChangeLogRaw{
+		SchemaChangeLog: *x,
+		ChangedAt:       x.ChangedAt.UnixMicro(),
+	}
+}
+
+// SchemaDiff is difference between schema of the current table and schema inferred from objects.
+type SchemaDiff struct {
+	DatasetID types.BQDatasetID `json:"dataset_id"`
+	TableID   types.BQTableID   `json:"table_id"`
+	Created   bool              `json:"created"`
+	Added     []*FieldDiff      `json:"added"`
+	Changed   []*FieldDiff      `json:"changed"`
+}
+
+// FieldDiff is difference of a field. Field is a dot separated path of the field. OldType is empty if the field is added. Type of repeated field is prefixed by `REPEATED `.
+type FieldDiff struct {
+	Field   string `json:"field"`
+	OldType string `json:"old_type,omitempty"`
+	NewType string `json:"new_type"`
+}
+
+// HasChange returns true if the table is created or schema of the table is changed.
+func (x *SchemaDiff) HasChange() bool {
+	return x.Created || len(x.Added) > 0 || len(x.Changed) > 0
+}
+
+// Incompatible returns true if type of an existing field is changed. Such change can not be applied to the table.
+func (x *SchemaDiff) Incompatible() bool {
+	return len(x.Changed) > 0
 }
 
 type LoadLogRaw struct {
@@ -102,6 +176,20 @@ type LogRecord struct {
 	Timestamp  time.Time      `json:"timestamp" bigquery:"timestamp"`
 	IngestedAt time.Time      `json:"ingested_at" bigquery:"ingested_at"`
 	Data       any            `json:"data" bigquery:"data"`
+
+	// Sinks is names of output destinations specified by schema policy. It is not written to the table.
+	Sinks []types.SinkName `json:"-" bigquery:"-"`
+
+	// Notify is configuration of notification specified by schema policy. It is not written to the table.
+	Notify *Notify `json:"-" bigquery:"-"`
+}
+
+// HasSink returns true if the record should be written to the sink. A record without sinks is written to only types.BigQuerySink.
+func (x *LogRecord) HasSink(name types.SinkName) bool {
+	if len(x.Sinks) == 0 {
+		return name == types.BigQuerySink
+	}
+	return slices.Contains(x.Sinks, name)
 }
 
 func (x LogRecord) Raw() *LogRecordRaw {
@@ -119,10 +207,38 @@ type LogRecordRaw struct {
 	IngestedAt int64 `json:"ingested_at" bigquery:"ingested_at"`
 }
 
-type LogRecordSet map[BigQueryDest][]*LogRecord
+// LogRecordGroup is log records and options of a destination table. Objects is a list of URLs of source objects of the records.
+type LogRecordGroup struct {
+	Options TableOptions
+	Records []*LogRecord
+	Objects []string
+}
+
+// AddObjects appends source object URLs that are not in the group yet.
+func (x *LogRecordGroup) AddObjects(objects ...string) {
+	for _, obj := range objects {
+		if !slices.Contains(x.Objects, obj) {
+			x.Objects = append(x.Objects, obj)
+		}
+	}
+}
+
+type LogRecordSet map[BigQueryDest]*LogRecordGroup
+
+// Add appends records to the destination group and merges table options.
+func (x LogRecordSet) Add(dst BigQueryDest, opts TableOptions, records ...*LogRecord) {
+	group, ok := x[dst]
+	if !ok {
+		group = &LogRecordGroup{}
+		x[dst] = group
+	}
+	group.Options.Merge(opts)
+	group.Records = append(group.Records, records...)
+}
 
 func (x LogRecordSet) Merge(src LogRecordSet) {
-	for srcKey, srcRecords := range src {
-		x[srcKey] = append(x[srcKey], srcRecords...)
+	for srcKey, srcGroup := range src {
+		x.Add(srcKey, srcGroup.Options, srcGroup.Records...)
+		x[srcKey].AddObjects(srcGroup.Objects...)
 	}
 }
@@ -1,6 +1,13 @@
 package model
 
-import "github.com/secmon-lab/swarm/pkg/domain/types"
+import (
+	"path"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+)
 
 type MetadataConfig struct {
 	dataset types.BQDatasetID
@@ -12,3 +19,83 @@ func NewMetadataConfig(dataset types.BQDatasetID, table types.BQTableID) *Metada
 }
 func (x *MetadataConfig) Dataset() types.BQDatasetID { return x.dataset }
 func (x *MetadataConfig) Table() types.BQTableID     { return x.table }
+
+// SchemaChangeTable returns table ID to record schema changes of destination tables. It is placed next to the load log table.
+func (x *MetadataConfig) SchemaChangeTable() types.BQTableID {
+	return x.table + "_schema_change"
+}
+
+// DatasetConfig is configuration to create BigQuery dataset automatically when it does not exist.
+type DatasetConfig struct {
+	// AllowPatterns is a list of glob patterns (e.g. `logs_*`) of dataset name that can be created. A dataset not matched with any pattern is never created.
+	AllowPatterns []string
+
+	Location               string
+	DefaultTableExpiration time.Duration
+	Labels                 map[string]string
+
+	// KMSKeyName is Cloud KMS key name for default encryption (CMEK) of tables in the dataset.
+	KMSKeyName string
+}
+
+// IsAllowed returns true if the dataset matches one of AllowPatterns.
+func (x *DatasetConfig) IsAllowed(dataset types.BQDatasetID) bool {
+	for _, pattern := range x.AllowPatterns {
+		if ok, err := path.Match(pattern, dataset.String()); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Metadata returns metadata to create dataset.
+func (x *DatasetConfig) Metadata() *bigquery.DatasetMetadata {
+	md := &bigquery.DatasetMetadata{
+		Location:               x.Location,
+		DefaultTableExpiration: x.DefaultTableExpiration,
+		Labels:                 x.Labels,
+	}
+	if x.KMSKeyName != "" {
+		md.DefaultEncryptionConfig = &bigquery.EncryptionConfig{
+			KMSKeyName: x.KMSKeyName,
+		}
+	}
+	return md
+}
+
+// SchemaGuard is configuration of guardrails for table schema inferred from logs.
+type SchemaGuard struct {
+	// MaxColumns is maximum number of columns including nested fields in a table. 0 means no limit.
+	MaxColumns int
+	// MaxDepth is maximum nesting depth of columns. A top level column is depth 1, and `data.user.name` is depth 3. 0 means no limit.
+	MaxDepth int
+	// LimitAction is an action when MaxColumns or MaxDepth is exceeded. GuardReject or GuardJSON.
+	LimitAction types.GuardAction
+	// FieldNameAction is an action for field name that can not be used as BigQuery column name. Field name is not checked if GuardNone.
+	FieldNameAction types.GuardAction
+	// GrowthWarning is number of columns. A warning is reported when table schema grows beyond it. 0 means no warning.
+	GrowthWarning int
+}
+
+func (x *SchemaGuard) Validate() error {
+	if x.MaxColumns < 0 {
+		return goerr.Wrap(types.ErrInvalidOption, "max columns must not be negative", goerr.V("max_columns", x.MaxColumns))
+	}
+	if x.MaxDepth < 0 || x.MaxDepth == 1 {
+		return goerr.Wrap(types.ErrInvalidOption, "max depth must be 0 or more than 1", goerr.V("max_depth", x.MaxDepth))
+	}
+	switch x.LimitAction {
+	case types.GuardReject, types.GuardJSON:
+	default:
+		return goerr.Wrap(types.ErrInvalidOption, "limit action must be reject or json", goerr.V("action", x.LimitAction))
+	}
+	switch x.FieldNameAction {
+	case types.GuardNone, types.GuardReject, types.GuardJSON, types.GuardRename:
+	default:
+		return goerr.Wrap(types.ErrInvalidOption, "field name action must be reject, json or rename", goerr.V("action", x.FieldNameAction))
+	}
+	if x.GrowthWarning < 0 {
+		return goerr.Wrap(types.ErrInvalidOption, "growth warning must not be negative", goerr.V("growth_warning", x.GrowthWarning))
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+)
+
+// EnqueueFilter is a filter of objects to enqueue. Zero value of each field means no filter. StartOffset, EndOffset and Glob are evaluated by Cloud Storage on listing, and others are evaluated for each listed object.
+type EnqueueFilter struct {
+	// StartOffset and EndOffset are range of object name. Objects whose names are lexicographically equal to or after StartOffset and before EndOffset are listed.
+	StartOffset string
+	EndOffset   string
+
+	// Glob is a glob pattern of object name, such as `logs/**/*.json.gz`. See https://cloud.google.com/storage/docs/json_api/v1/objects/list#list-object-glob for syntax.
+	Glob string
+	// Regex is a regular expression of object name.
+	Regex *regexp.Regexp
+
+	// MinSize and MaxSize are range of object size in bytes. Both ends are inclusive.
+	MinSize int64
+	MaxSize int64
+
+	// CreatedAfter and CreatedBefore are range of creation time of object. UpdatedAfter and UpdatedBefore are range of update time. After is inclusive and before is exclusive.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+
+	// StorageClasses are storage classes of object, such as STANDARD and NEARLINE.
+	StorageClasses []string
+}
+
+func (x *EnqueueFilter) Validate() error {
+	if x.MinSize < 0 || x.MaxSize < 0 {
+		return goerr.Wrap(types.ErrInvalidOption, "size of enqueue filter must not be negative", goerr.V("min", x.MinSize), goerr.V("max", x.MaxSize))
+	}
+	if x.MaxSize > 0 && x.MinSize > x.MaxSize {
+		return goerr.Wrap(types.ErrInvalidOption, "min size of enqueue filter is larger than max size", goerr.V("min", x.MinSize), goerr.V("max", x.MaxSize))
+	}
+	if x.EndOffset != "" && x.StartOffset >= x.EndOffset {
+		return goerr.Wrap(types.ErrInvalidOption, "start offset of enqueue filter must be before end offset", goerr.V("start", x.StartOffset), goerr.V("end", x.EndOffset))
+	}
+	if !x.CreatedAfter.IsZero() && !x.CreatedBefore.IsZero() && !x.CreatedAfter.Before(x.CreatedBefore) {
+		return goerr.Wrap(types.ErrInvalidOption, "created after of enqueue filter must be before created before", goerr.V("after", x.CreatedAfter), goerr.V("before", x.CreatedBefore))
+	}
+	if !x.UpdatedAfter.IsZero() && !x.UpdatedBefore.IsZero() && !x.UpdatedAfter.Before(x.UpdatedBefore) {
+		return goerr.Wrap(types.ErrInvalidOption, "updated after of enqueue filter must be before updated before", goerr.V("after", x.UpdatedAfter), goerr.V("before", x.UpdatedBefore))
+	}
+	return nil
+}
+
+// Query returns storage.Query to list objects with the prefix. Filters evaluated by Cloud Storage are set to the query.
+func (x *EnqueueFilter) Query(prefix types.CSObjectID) *storage.Query {
+	query := &storage.Query{
+		Prefix: prefix.String(),
+	}
+	if x == nil {
+		return query
+	}
+
+	query.StartOffset = x.StartOffset
+	query.EndOffset = x.EndOffset
+	query.MatchGlob = x.Glob
+	return query
+}
+
+// Match returns true if the listed object matches with the filter. Offsets are checked again in case they are not evaluated on listing, but Glob is evaluated only by Cloud Storage.
+func (x *EnqueueFilter) Match(attrs *storage.ObjectAttrs) bool {
+	if x == nil {
+		return true
+	}
+
+	if x.StartOffset != "" && attrs.Name < x.StartOffset {
+		return false
+	}
+	if x.EndOffset != "" && attrs.Name >= x.EndOffset {
+		return false
+	}
+	if x.Regex != nil && !x.Regex.MatchString(attrs.Name) {
+		return false
+	}
+
+	if x.MinSize > 0 && attrs.Size < x.MinSize {
+		return false
+	}
+	if x.MaxSize > 0 && attrs.Size > x.MaxSize {
+		return false
+	}
+
+	if !inTimeRange(attrs.Created, x.CreatedAfter, x.CreatedBefore) ||
+		!inTimeRange(attrs.Updated, x.UpdatedAfter, x.UpdatedBefore) {
+		return false
+	}
+
+	if len(x.StorageClasses) > 0 && !slices.ContainsFunc(x.StorageClasses, func(class string) bool {
+		return strings.EqualFold(class, attrs.StorageClass)
+	}) {
+		return false
+	}
+
+	return true
+}
+
+func inTimeRange(t, after, before time.Time) bool {
+	if !after.IsZero() && t.Before(after) {
+		return false
+	}
+	if !before.IsZero() && !t.Before(before) {
+		return false
+	}
+	return true
+}
+
+// CheckpointID returns ID of checkpoint of the request. It is digest of URLs and filter, so that a checkpoint is resumed only by the same request.
+func (x *EnqueueRequest) CheckpointID() string {
+	h := sha256.New()
+	for _, url := range x.URLs {
+		fmt.Fprintf(h, "url:%s\n", url)
+	}
+	h.Write([]byte(x.Filter.Fingerprint()))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Fingerprint returns a text that identifies conditions of the filter. It is empty for nil filter.
+func (x *EnqueueFilter) Fingerprint() string {
+	if x == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "offset:%s:%s\n", x.StartOffset, x.EndOffset)
+	fmt.Fprintf(&b, "glob:%s\n", x.Glob)
+	if x.Regex != nil {
+		fmt.Fprintf(&b, "regex:%s\n", x.Regex.String())
+	}
+	fmt.Fprintf(&b, "size:%d:%d\n", x.MinSize, x.MaxSize)
+	fmt.Fprintf(&b, "created:%s:%s\n", x.CreatedAfter.Format(time.RFC3339Nano), x.CreatedBefore.Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "updated:%s:%s\n", x.UpdatedAfter.Format(time.RFC3339Nano), x.UpdatedBefore.Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "class:%s\n", strings.Join(x.StorageClasses, ","))
+	return b.String()
+}
+
+// EnqueueCheckpoint is progress of enqueue. It is saved after each publish to resume enqueue that is interrupted midway.
+type EnqueueCheckpoint struct {
+	ID       string                     `json:"id" firestore:"id"`
+	Prefixes []*EnqueueCheckpointPrefix `json:"prefixes" firestore:"prefixes"`
+	// Filter is fingerprint of filter of the request. See EnqueueFilter.Fingerprint.
+	Filter string `json:"filter" firestore:"filter"`
+	// BatchCount is total number of published messages including previous runs.
+	BatchCount int64     `json:"batch_count" firestore:"batch_count"`
+	Completed  bool      `json:"completed" firestore:"completed"`
+	UpdatedAt  time.Time `json:"updated_at" firestore:"updated_at"`
+}
+
+// EnqueueCheckpointPrefix is progress of enqueue for a URL of the request.
+type EnqueueCheckpointPrefix struct {
+	URL types.ObjectURL `json:"url" firestore:"url"`
+	// LastObject is name of the last object that is published. Objects are listed in lexicographical order, so listing is resumed after it.
+	LastObject types.CSObjectID `json:"last_object" firestore:"last_object"`
+	Completed  bool             `json:"completed" firestore:"completed"`
+}
+
+func NewEnqueueCheckpoint(req *EnqueueRequest) *EnqueueCheckpoint {
+	checkpoint := &EnqueueCheckpoint{
+		ID:     req.CheckpointID(),
+		Filter: req.Filter.Fingerprint(),
+	}
+	for _, url := range req.URLs {
+		checkpoint.Prefixes = append(checkpoint.Prefixes, &EnqueueCheckpointPrefix{URL: url})
+	}
+	return checkpoint
+}
+
+// Match returns true if the checkpoint is saved for the request, that is, the request has the same URLs in the same order and the same filter.
+func (x *EnqueueCheckpoint) Match(req *EnqueueRequest) bool {
+	if x.ID != req.CheckpointID() || x.Filter != req.Filter.Fingerprint() || len(x.Prefixes) != len(req.URLs) {
+		return false
+	}
+	for i, prefix := range x.Prefixes {
+		if prefix.URL != req.URLs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Advance records that a message is published and objects of the i-th prefix are published up to name. Prefixes before i are completed because objects are listed in order of prefixes.
+func (x *EnqueueCheckpoint) Advance(i int, name types.CSObjectID) {
+	for j := range i {
+		x.Prefixes[j].Completed = true
+	}
+	x.Prefixes[i].LastObject = name
+	x.BatchCount++
+}
+
+// Complete records that all objects are published.
+func (x *EnqueueCheckpoint) Complete() {
+	for _, prefix := range x.Prefixes {
+		prefix.Completed = true
+	}
+	x.Completed = true
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/m-mizutani/goerr/v2"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 )
 
@@ -107,3 +109,87 @@ func (x CloudStorageEvent) ToObject() Object {
 type SwarmMessage struct {
 	Objects []*Object `json:"objects"`
 }
+
+// PublishConfig is attributes of a message published to Pub/Sub topic.
+type PublishConfig struct {
+	OrderingKey string
+	Attributes  map[string]string
+}
+
+type PublishOption func(*PublishConfig)
+
+// WithOrderingKey sets ordering key of the message. Messages with the same ordering key are delivered in order of publishing.
+func WithOrderingKey(key string) PublishOption {
+	return func(x *PublishConfig) {
+		x.OrderingKey = key
+	}
+}
+
+// WithAttributes adds attributes of the message. Later value takes precedence if the same key is given.
+func WithAttributes(attrs map[string]string) PublishOption {
+	return func(x *PublishConfig) {
+		if x.Attributes == nil {
+			x.Attributes = make(map[string]string, len(attrs))
+		}
+		for k, v := range attrs {
+			x.Attributes[k] = v
+		}
+	}
+}
+
+func NewPublishConfig(options ...PublishOption) *PublishConfig {
+	cfg := &PublishConfig{}
+	for _, opt := range options {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// LogMessage is a message of a log record published to Pub/Sub topic by sink and notification.
+type LogMessage struct {
+	Dataset    types.BQDatasetID `json:"dataset"`
+	Table      types.BQTableID   `json:"table"`
+	ID         types.LogID       `json:"id"`
+	Timestamp  time.Time         `json:"timestamp"`
+	IngestedAt time.Time         `json:"ingested_at"`
+	Data       any               `json:"data"`
+}
+
+func NewLogMessage(dst BigQueryDest, record *LogRecord) *LogMessage {
+	return &LogMessage{
+		Dataset:    dst.Dataset,
+		Table:      dst.Table,
+		ID:         record.ID,
+		Timestamp:  record.Timestamp,
+		IngestedAt: record.IngestedAt,
+		Data:       record.Data,
+	}
+}
+
+// Subscription is a Pub/Sub subscription consumed by job.
+type Subscription struct {
+	Name   string
+	Schema types.MsgSchema
+}
+
+// ParseSubscription parses subscription in format of `[schema:]projects/{project}/subscriptions/{subscription}`. Schema is `cs` or `swarm`, and it is detected from each message if omitted.
+func ParseSubscription(s string) (*Subscription, error) {
+	sub := &Subscription{Name: s}
+	if schema, name, ok := strings.Cut(s, ":"); ok {
+		sub.Schema = types.MsgSchema(schema)
+		sub.Name = name
+	}
+
+	switch sub.Schema {
+	case types.MsgSchemaAuto, types.MsgSchemaCS, types.MsgSchemaSwarm:
+	default:
+		return nil, goerr.Wrap(types.ErrInvalidOption, "subscription schema must be 'cs' or 'swarm'", goerr.V("subscription", s))
+	}
+
+	parts := strings.Split(sub.Name, "/")
+	if len(parts) != 4 || parts[0] != "projects" || parts[2] != "subscriptions" || parts[1] == "" || parts[3] == "" {
+		return nil, goerr.Wrap(types.ErrInvalidOption, "subscription must be 'projects/{project}/subscriptions/{subscription}'", goerr.V("subscription", s))
+	}
+
+	return sub, nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/m-mizutani/gt"
 	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
 )
 
 //go:embed testdata/cloud_storage_event.json
@@ -26,3 +27,49 @@ func TestCloudStorageEvent(t *testing.T) {
 		gt.Equal(t, v.Value, "eb9b8a4296628acbbd90ff20065fb9d1")
 	})
 }
+
+func TestParseSubscription(t *testing.T) {
+	testCases := map[string]struct {
+		input   string
+		name    string
+		schema  types.MsgSchema
+		wantErr bool
+	}{
+		"auto": {
+			input:  "projects/my-project/subscriptions/my-sub",
+			name:   "projects/my-project/subscriptions/my-sub",
+			schema: types.MsgSchemaAuto,
+		},
+		"swarm": {
+			input:  "swarm:projects/my-project/subscriptions/my-sub",
+			name:   "projects/my-project/subscriptions/my-sub",
+			schema: types.MsgSchemaSwarm,
+		},
+		"cs": {
+			input:  "cs:projects/my-project/subscriptions/my-sub",
+			name:   "projects/my-project/subscriptions/my-sub",
+			schema: types.MsgSchemaCS,
+		},
+		"unknown schema": {
+			input:   "s3:projects/my-project/subscriptions/my-sub",
+			wantErr: true,
+		},
+		"short name": {
+			input:   "my-sub",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sub, err := model.ParseSubscription(tc.input)
+			if tc.wantErr {
+				gt.Error(t, err).Is(types.ErrInvalidOption)
+				return
+			}
+			gt.NoError(t, err)
+			gt.Equal(t, sub.Name, tc.name)
+			gt.Equal(t, sub.Schema, tc.schema)
+		})
+	}
+}
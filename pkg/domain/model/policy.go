@@ -1,10 +1,29 @@
 package model
 
 import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 )
 
+// PolicyIssue is a problem of policy found by static validation.
+type PolicyIssue struct {
+	Severity types.PolicyIssueSeverity `json:"severity"`
+	File     string                    `json:"file"`
+	Row      int                       `json:"row"`
+	Target   string                    `json:"target"`
+	Message  string                    `json:"message"`
+}
+
+func (x PolicyIssue) String() string {
+	return fmt.Sprintf("%s: %s:%d: %s: %s", x.Severity, x.File, x.Row, x.Target, x.Message)
+}
+
 type AuthPolicyInput struct {
 	Method string              `json:"method"`
 	Path   string              `json:"path"`
@@ -61,13 +80,207 @@ type BigQueryDest struct {
 	Partition types.BQPartition `json:"partition"`
 }
 
+// TableOptions is options of BigQuery table specified by schema policy. They are applied when creating the table and reconciled when updating the table. Zero value means not specified, and the current table setting is kept.
+type TableOptions struct {
+	// Clustering is a list of column names for clustering. Up to 4 columns.
+	Clustering []string `json:"clustering,omitempty"`
+
+	// PartitionExpirationDays is lifetime of a partition in days. It works only with partitioned table.
+	PartitionExpirationDays int `json:"partition_expiration_days,omitempty"`
+
+	// RequirePartitionFilter requires a filter on partition column for queries. It is pointer to distinguish explicit false from not specified.
+	RequirePartitionFilter *bool `json:"require_partition_filter,omitempty"`
+
+	// Description is description of the table.
+	Description string `json:"description,omitempty"`
+
+	// ColumnDescriptions is a map of column path (e.g. `data.src_addr`) and its description.
+	ColumnDescriptions map[string]string `json:"column_descriptions,omitempty"`
+
+	// Labels is labels of the table.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Schema is declared schema of `data` in BigQuery JSON schema format. Declared fields are merged with inferred fields, and values are coerced to the declared type.
+	Schema []*DeclaredField `json:"schema,omitempty"`
+
+	// Conflict is a strategy to resolve type conflict of a field in `data`. Ingestion fails on conflict if not specified.
+	Conflict types.ConflictStrategy `json:"conflict,omitempty"`
+
+	// JSONColumns is a list of dot separated paths of columns written as JSON type instead of inferred type, e.g. `data.request.headers`. `data` writes whole log data as a JSON column.
+	JSONColumns []string `json:"json_columns,omitempty"`
+}
+
+// DeclaredField is a field definition in BigQuery JSON schema format, e.g. `{"name": "src_port", "type": "INTEGER"}`.
+type DeclaredField struct {
+	Name        string           `json:"name"`
+	Type        string           `json:"type"`
+	Mode        string           `json:"mode,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Fields      []*DeclaredField `json:"fields,omitempty"`
+}
+
+// declaredTypes is a map of type names in BigQuery JSON schema (including aliases of GoogleSQL) to supported field types.
+var declaredTypes = map[string]bigquery.FieldType{
+	"STRING":    bigquery.StringFieldType,
+	"INTEGER":   bigquery.IntegerFieldType,
+	"INT64":     bigquery.IntegerFieldType,
+	"FLOAT":     bigquery.FloatFieldType,
+	"FLOAT64":   bigquery.FloatFieldType,
+	"BOOLEAN":   bigquery.BooleanFieldType,
+	"BOOL":      bigquery.BooleanFieldType,
+	"TIMESTAMP": bigquery.TimestampFieldType,
+	"RECORD":    bigquery.RecordFieldType,
+	"STRUCT":    bigquery.RecordFieldType,
+	"JSON":      bigquery.JSONFieldType,
+}
+
+func (x *DeclaredField) Validate() error {
+	if x.Name == "" {
+		return goerr.Wrap(types.ErrInvalidPolicyResult, "log.schema[].name is required")
+	}
+	tpe, ok := declaredTypes[strings.ToUpper(x.Type)]
+	if !ok {
+		return goerr.Wrap(types.ErrInvalidPolicyResult, "log.schema[].type is not supported", goerr.V("name", x.Name), goerr.V("type", x.Type))
+	}
+	switch strings.ToUpper(x.Mode) {
+	case "", "NULLABLE", "REPEATED":
+		// OK
+	default:
+		return goerr.Wrap(types.ErrInvalidPolicyResult, "log.schema[].mode must be NULLABLE or REPEATED", goerr.V("name", x.Name), goerr.V("mode", x.Mode))
+	}
+
+	if tpe == bigquery.RecordFieldType {
+		if len(x.Fields) == 0 {
+			return goerr.Wrap(types.ErrInvalidPolicyResult, "log.schema[].fields is required for RECORD", goerr.V("name", x.Name))
+		}
+		for _, f := range x.Fields {
+			if err := f.Validate(); err != nil {
+				return goerr.Wrap(err, "invalid sub field", goerr.V("parent", x.Name))
+			}
+		}
+	}
+
+	return nil
+}
+
+// ToBigQuery converts the declared field to bigquery.FieldSchema. It must be validated before conversion.
+func (x *DeclaredField) ToBigQuery() *bigquery.FieldSchema {
+	field := &bigquery.FieldSchema{
+		Name:        x.Name,
+		Type:        declaredTypes[strings.ToUpper(x.Type)],
+		Repeated:    strings.ToUpper(x.Mode) == "REPEATED",
+		Description: x.Description,
+	}
+	for _, f := range x.Fields {
+		field.Schema = append(field.Schema, f.ToBigQuery())
+	}
+	return field
+}
+
+// DeclaredSchema converts declared fields to bigquery.Schema.
+func DeclaredSchema(fields []*DeclaredField) bigquery.Schema {
+	var schema bigquery.Schema
+	for _, f := range fields {
+		schema = append(schema, f.ToBigQuery())
+	}
+	return schema
+}
+
+// Merge overwrites options by src. Unspecified options in src do not overwrite, and maps are merged.
+func (x *TableOptions) Merge(src TableOptions) {
+	if len(src.Clustering) > 0 {
+		x.Clustering = src.Clustering
+	}
+	if src.PartitionExpirationDays > 0 {
+		x.PartitionExpirationDays = src.PartitionExpirationDays
+	}
+	if src.RequirePartitionFilter != nil {
+		x.RequirePartitionFilter = src.RequirePartitionFilter
+	}
+	if src.Description != "" {
+		x.Description = src.Description
+	}
+	for k, v := range src.ColumnDescriptions {
+		if x.ColumnDescriptions == nil {
+			x.ColumnDescriptions = make(map[string]string)
+		}
+		x.ColumnDescriptions[k] = v
+	}
+	for k, v := range src.Labels {
+		if x.Labels == nil {
+			x.Labels = make(map[string]string)
+		}
+		x.Labels[k] = v
+	}
+	if len(src.Schema) > 0 {
+		x.Schema = src.Schema
+	}
+	if src.Conflict != types.ConflictNone {
+		x.Conflict = src.Conflict
+	}
+	for _, path := range src.JSONColumns {
+		if !slices.Contains(x.JSONColumns, path) {
+			x.JSONColumns = append(x.JSONColumns, path)
+		}
+	}
+}
+
+func (x *TableOptions) Validate() error {
+	if len(x.Clustering) > 4 {
+		return goerr.Wrap(types.ErrInvalidPolicyResult, "log.clustering must have up to 4 columns", goerr.V("clustering", x.Clustering))
+	}
+	if x.PartitionExpirationDays < 0 {
+		return goerr.Wrap(types.ErrInvalidPolicyResult, "log.partition_expiration_days must not be negative", goerr.V("days", x.PartitionExpirationDays))
+	}
+	for _, f := range x.Schema {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+	if err := x.Conflict.Validate(); err != nil {
+		return goerr.Wrap(types.ErrInvalidPolicyResult, "log.conflict is invalid", goerr.V("conflict", x.Conflict))
+	}
+	for _, path := range x.JSONColumns {
+		if path != "data" && (!strings.HasPrefix(path, "data.") || strings.Contains(path, "..") || strings.HasSuffix(path, ".")) {
+			return goerr.Wrap(types.ErrInvalidPolicyResult, "log.json_columns must be `data` or a path under `data.`", goerr.V("path", path))
+		}
+		if path == "data" && len(x.Schema) > 0 {
+			return goerr.Wrap(types.ErrInvalidPolicyResult, "log.schema can not be used when whole data is JSON column")
+		}
+	}
+	return nil
+}
+
 type Log struct {
 	// Destination BigQuery table information
 	BigQueryDest
 
+	// Options of destination BigQuery table
+	TableOptions
+
 	ID        types.LogID    `json:"id"`
 	Timestamp float64        `json:"timestamp"`
 	Data      map[string]any `json:"data"`
+
+	// Sinks is names of output destinations of the log. The log is sent to only the BigQuery table if not specified.
+	Sinks []types.SinkName `json:"sink"`
+
+	// Notify is configuration to publish the log to Pub/Sub topic after insertion. The log is not published if not specified.
+	Notify *Notify `json:"notify"`
+}
+
+// Notify is configuration of notification of a log to Pub/Sub topic.
+type Notify struct {
+	Topic       types.NotifyTopic `json:"topic"`
+	OrderingKey string            `json:"ordering_key"`
+	Attributes  map[string]string `json:"attributes"`
+}
+
+func (x *Notify) Validate() error {
+	if x.Topic == "" {
+		return goerr.Wrap(types.ErrInvalidPolicyResult, "log.notify.topic is required")
+	}
+	return nil
 }
 
 func (x *Log) Validate() error {
@@ -84,6 +297,23 @@ func (x *Log) Validate() error {
 	if x.Data == nil {
 		return goerr.Wrap(types.ErrInvalidPolicyResult, "log.data is required")
 	}
+	for _, sink := range x.Sinks {
+		if sink == "" {
+			return goerr.Wrap(types.ErrInvalidPolicyResult, "log.sink must not have empty name")
+		}
+	}
+	if x.Notify != nil {
+		if err := x.Notify.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := x.TableOptions.Validate(); err != nil {
+		return err
+	}
+	if x.PartitionExpirationDays > 0 && x.Partition == types.BQPartitionNone {
+		return goerr.Wrap(types.ErrInvalidPolicyResult, "log.partition_expiration_days requires log.partition")
+	}
 
 	return nil
 }
@@ -19,12 +19,31 @@ type LoadRequest struct {
 
 type EnqueueRequest struct {
 	URLs []types.ObjectURL
+
+	// Filter selects objects to enqueue. If nil, all objects under URLs are enqueued.
+	Filter *EnqueueFilter
+	// DryRun lists and counts objects matched with Filter without publishing.
+	DryRun bool
+	// Resume continues enqueue from the checkpoint saved by the previous run of the same request.
+	Resume bool
 }
 
 type EnqueueResponse struct {
 	Elapsed time.Duration
 	Count   int64
 	Size    int64
+	// Batches is number of messages published by this run.
+	Batches int64
+
+	// Prefixes is number and total size of matched objects for each URL of the request.
+	Prefixes []*EnqueuePrefix
+}
+
+// EnqueuePrefix is a result of enqueue for a URL.
+type EnqueuePrefix struct {
+	URL   types.ObjectURL
+	Count int64
+	Size  int64
 }
 
 type Object struct {
@@ -12,13 +12,25 @@ var (
 	// Configuration error
 	ErrNoSourceMatched = goerr.New("no source matched")
 	ErrNoPolicyData    = goerr.New("no policy data")
+	ErrInvalidPolicy   = goerr.New("invalid policy")
 
 	// Runtime error
 	ErrDataInsertion       = goerr.New("failed to insert data to bigquery")
 	ErrNoPolicyResult      = goerr.New("no policy result")
 	ErrInvalidPolicyResult = goerr.New("invalid policy result")
 	ErrStateNotFound       = goerr.New("state not found")
+	ErrCheckpointNotFound  = goerr.New("checkpoint not found")
+	ErrCheckpointMismatch  = goerr.New("checkpoint does not match with the request")
 	ErrTableNotFound       = goerr.New("table not found")
+	ErrDatasetNotAllowed   = goerr.New("dataset is not allowed to be created")
+	ErrSchemaLimitExceeded = goerr.New("schema limit exceeded")
+	ErrInvalidFieldName    = goerr.New("invalid field name")
+	ErrIncompatibleSchema  = goerr.New("incompatible schema change")
+	ErrDatasetNotFound     = goerr.New("dataset not found")
+	ErrTableAlreadyExists  = goerr.New("table already exists")
+	ErrETagMismatch        = goerr.New("etag mismatch")
+	ErrInvalidSchemaChange = goerr.New("invalid schema change")
+	ErrUnsupportedQuery    = goerr.New("unsupported query")
 
 	// Assertion error
 	ErrAssertion = goerr.New("assertion error")
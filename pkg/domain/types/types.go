@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/google/uuid"
@@ -70,6 +71,133 @@ func (x BQPartition) Type() bigquery.TimePartitioningType {
 	return ""
 }
 
+// BQUnpartitioned is name of partition for rows of a table without time partitioning or rows without value of the partitioning field. It is same as the name in BigQuery.
+const BQUnpartitioned = "__UNPARTITIONED__"
+
+// PartitionName returns name of time partition that ts belongs to, e.g. "2024-01-02" for DAY. It is used for Hive style partitioning of files.
+func PartitionName(tp bigquery.TimePartitioningType, ts time.Time) string {
+	ts = ts.UTC()
+	switch tp {
+	case bigquery.HourPartitioningType:
+		return ts.Format("2006-01-02-15")
+	case bigquery.MonthPartitioningType:
+		return ts.Format("2006-01")
+	case bigquery.YearPartitioningType:
+		return ts.Format("2006")
+	default:
+		return ts.Format("2006-01-02")
+	}
+}
+
+// ConflictStrategy is a strategy to resolve type conflict of a field between logs, or between logs and the table.
+type ConflictStrategy string
+
+const (
+	// ConflictNone fails ingestion if type conflict is found.
+	ConflictNone ConflictStrategy = ""
+	// ConflictWiden converts conflicted values to STRING.
+	ConflictWiden ConflictStrategy = "widen"
+	// ConflictRename moves conflicted values to a new field with type suffix, e.g. `field__str`.
+	ConflictRename ConflictStrategy = "rename"
+	// ConflictOverflow moves conflicted values to `_overflow` JSON column.
+	ConflictOverflow ConflictStrategy = "overflow"
+)
+
+func (x ConflictStrategy) Validate() error {
+	switch x {
+	case ConflictNone, ConflictWiden, ConflictRename, ConflictOverflow:
+		return nil
+	default:
+		return goerr.Wrap(ErrInvalidOption, "unsupported conflict strategy", goerr.V("strategy", x))
+	}
+}
+
+// GuardAction is an action for data that violates schema guardrails.
+type GuardAction string
+
+const (
+	// GuardNone does nothing.
+	GuardNone GuardAction = ""
+	// GuardReject fails ingestion into the table.
+	GuardReject GuardAction = "reject"
+	// GuardJSON stores violating values in JSON instead of new columns.
+	GuardJSON GuardAction = "json"
+	// GuardRename replaces invalid characters of field name.
+	GuardRename GuardAction = "rename"
+)
+
+// BQWriter is a method to insert records into BigQuery table.
+type BQWriter string
+
+const (
+	// StorageWriteWriter inserts records by pending stream of BigQuery Storage Write API.
+	StorageWriteWriter BQWriter = "storage-write"
+	// PooledStreamWriter inserts records by default stream of BigQuery Storage Write API. Streams are reused across insertions while schema of the table is not changed. It reduces latency and API quota for many small insertions.
+	PooledStreamWriter BQWriter = "pooled-stream"
+	// LoadJobWriter inserts records by BigQuery load job of NDJSON or Avro file. It is suitable for bulk backfill because it is not affected by delay of schema propagation.
+	LoadJobWriter BQWriter = "load-job"
+)
+
+func (x BQWriter) Validate() error {
+	switch x {
+	case StorageWriteWriter, PooledStreamWriter, LoadJobWriter:
+		return nil
+	default:
+		return goerr.Wrap(ErrInvalidOption, "unsupported BigQuery writer", goerr.V("writer", x))
+	}
+}
+
+// LoadJobFormat is a file format to stage records for LoadJobWriter.
+type LoadJobFormat string
+
+const (
+	// NDJSONLoadJobFormat stages records as newline delimited JSON.
+	NDJSONLoadJobFormat LoadJobFormat = "ndjson"
+	// AvroLoadJobFormat stages records as Avro. It is smaller and faster to load than NDJSON, but field names must be valid Avro names and INTERVAL and RANGE are not supported.
+	AvroLoadJobFormat LoadJobFormat = "avro"
+)
+
+func (x LoadJobFormat) Validate() error {
+	switch x {
+	case NDJSONLoadJobFormat, AvroLoadJobFormat:
+		return nil
+	default:
+		return goerr.Wrap(ErrInvalidOption, "unsupported load job format", goerr.V("format", x))
+	}
+}
+
+// LakeFormat is a file format of data lake sink.
+type LakeFormat string
+
+const (
+	// ParquetFormat writes rows to Parquet files.
+	ParquetFormat LakeFormat = "parquet"
+	// NDJSONFormat writes rows to gzip compressed NDJSON files.
+	NDJSONFormat LakeFormat = "ndjson"
+)
+
+func (x LakeFormat) Validate() error {
+	switch x {
+	case ParquetFormat, NDJSONFormat:
+		return nil
+	default:
+		return goerr.Wrap(ErrInvalidOption, "unsupported lake format", goerr.V("format", x))
+	}
+}
+
+// SinkName is a name of output destination of log records. It is specified by `sink` field of log output in schema policy.
+type SinkName string
+
+// BigQuerySink is the name of the default destination, the BigQuery table specified by dataset and table of log output.
+const BigQuerySink SinkName = "bigquery"
+
+func (x SinkName) String() string { return string(x) }
+
+// NotifyTopic is a name of Pub/Sub topic to notify log records. It is specified by `notify.topic` field of log output in schema policy.
+type NotifyTopic string
+
+func (x NotifyTopic) String() string { return string(x) }
+
 type CSBucket string
 type CSObjectID string
 type CSUrl string
@@ -156,13 +284,33 @@ const (
 
 func (x EventSchema) Query() string { return "data.event." + string(x) }
 
+// PolicyIssueSeverity is a severity of an issue found by static validation of policy.
+type PolicyIssueSeverity string
+
+const (
+	PolicyIssueError   PolicyIssueSeverity = "error"
+	PolicyIssueWarning PolicyIssueSeverity = "warning"
+)
+
 type (
 	MsgType  string
 	MsgState string
 )
 
+// MsgSchema is a schema of data of Pub/Sub message consumed by job.
+type MsgSchema string
+
+const (
+	// MsgSchemaAuto detects schema from each message.
+	MsgSchemaAuto  MsgSchema = ""
+	MsgSchemaCS    MsgSchema = "cs"
+	MsgSchemaSwarm MsgSchema = "swarm"
+)
+
 const (
 	MsgPubSub MsgType = "pubsub"
+	// MsgObject is a state of an object to load. It prevents loading the same object notified by multiple messages.
+	MsgObject MsgType = "object"
 
 	MsgFailed    MsgState = "failed"
 	MsgRunning   MsgState = "running"
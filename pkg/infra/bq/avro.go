@@ -0,0 +1,626 @@
+package bq
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr/v2"
+)
+
+// Avro Object Container File is written without external library because only encoding of types converted from BigQuery schema is required. See https://avro.apache.org/docs/1.11.1/specification/ for the format.
+
+const (
+	// avroBlockRows is number of rows in a data block of Avro file.
+	avroBlockRows = 1000
+	avroSyncSize  = 16
+)
+
+var (
+	avroMagic     = []byte{'O', 'b', 'j', 1}
+	avroNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// avroSchema converts BigQuery schema to Avro schema of a record. Logical types are used for TIMESTAMP, DATE, TIME, DATETIME, NUMERIC and BIGNUMERIC, so the load job must enable UseAvroLogicalTypes.
+func avroSchema(schema bigquery.Schema) (map[string]any, error) {
+	return avroRecordSchema("root", schema)
+}
+
+func avroRecordSchema(name string, schema bigquery.Schema) (map[string]any, error) {
+	fields := make([]any, 0, len(schema))
+	for _, f := range schema {
+		if !avroNameRegex.MatchString(f.Name) {
+			return nil, goerr.New("field name can not be used in Avro", goerr.V("field", f.Name))
+		}
+
+		t, err := avroFieldType(name+"_"+f.Name, f)
+		if err != nil {
+			return nil, err
+		}
+
+		field := map[string]any{"name": f.Name, "type": t}
+		switch {
+		case f.Repeated:
+			field["type"] = map[string]any{"type": "array", "items": t}
+		case !f.Required:
+			field["type"] = []any{"null", t}
+			field["default"] = nil
+		}
+		fields = append(fields, field)
+	}
+
+	return map[string]any{"type": "record", "name": name, "fields": fields}, nil
+}
+
+func avroFieldType(name string, f *bigquery.FieldSchema) (any, error) {
+	switch f.Type {
+	case bigquery.StringFieldType:
+		return "string", nil
+	case bigquery.BytesFieldType:
+		return "bytes", nil
+	case bigquery.IntegerFieldType:
+		return "long", nil
+	case bigquery.FloatFieldType:
+		return "double", nil
+	case bigquery.BooleanFieldType:
+		return "boolean", nil
+	case bigquery.TimestampFieldType:
+		return map[string]any{"type": "long", "logicalType": "timestamp-micros"}, nil
+	case bigquery.DateFieldType:
+		return map[string]any{"type": "int", "logicalType": "date"}, nil
+	case bigquery.TimeFieldType:
+		return map[string]any{"type": "long", "logicalType": "time-micros"}, nil
+	case bigquery.DateTimeFieldType:
+		return map[string]any{"type": "string", "logicalType": "datetime"}, nil
+	case bigquery.NumericFieldType:
+		return map[string]any{"type": "bytes", "logicalType": "decimal", "precision": 38, "scale": 9}, nil
+	case bigquery.BigNumericFieldType:
+		return map[string]any{"type": "bytes", "logicalType": "decimal", "precision": 77, "scale": 38}, nil
+	case bigquery.JSONFieldType:
+		return map[string]any{"type": "string", "sqlType": "JSON"}, nil
+	case bigquery.GeographyFieldType:
+		return map[string]any{"type": "string", "sqlType": "GEOGRAPHY"}, nil
+	case bigquery.RecordFieldType:
+		return avroRecordSchema(name, f.Schema)
+	default:
+		return nil, goerr.New("field type is not supported by Avro staging, use ndjson format", goerr.V("field", f.Name), goerr.V("type", f.Type))
+	}
+}
+
+// writeAvro writes data as Avro Object Container File for load job. Values are converted from the format of Storage Write API.
+func writeAvro(w io.Writer, schema bigquery.Schema, data []any) error {
+	as, err := avroSchema(schema)
+	if err != nil {
+		return err
+	}
+	rawSchema, err := json.Marshal(as)
+	if err != nil {
+		return goerr.Wrap(err, "failed to marshal Avro schema")
+	}
+
+	sync := make([]byte, avroSyncSize)
+	if _, err := rand.Read(sync); err != nil {
+		return goerr.Wrap(err, "failed to generate sync marker")
+	}
+
+	header := append([]byte{}, avroMagic...)
+	header = appendAvroLong(header, 2)
+	header = appendAvroBytes(header, []byte("avro.schema"))
+	header = appendAvroBytes(header, rawSchema)
+	header = appendAvroBytes(header, []byte("avro.codec"))
+	header = appendAvroBytes(header, []byte("null"))
+	header = appendAvroLong(header, 0)
+	header = append(header, sync...)
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(header); err != nil {
+		return goerr.Wrap(err, "failed to write staging file")
+	}
+
+	var block []byte
+	var count int64
+	flush := func() error {
+		if count == 0 {
+			return nil
+		}
+		b := appendAvroLong(nil, count)
+		b = appendAvroLong(b, int64(len(block)))
+		b = append(b, block...)
+		b = append(b, sync...)
+		if _, err := bw.Write(b); err != nil {
+			return goerr.Wrap(err, "failed to write staging file")
+		}
+		block, count = block[:0], 0
+		return nil
+	}
+
+	for _, v := range data {
+		row, err := toLoadJobRow(v)
+		if err != nil {
+			return err
+		}
+		if block, err = appendAvroRecord(block, schema, row, ""); err != nil {
+			return goerr.Wrap(err, "failed to encode row to Avro", goerr.V("row", row))
+		}
+
+		if count++; count >= avroBlockRows {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return goerr.Wrap(err, "failed to flush staging file")
+	}
+	return nil
+}
+
+func appendAvroLong(b []byte, n int64) []byte {
+	return binary.AppendUvarint(b, uint64((n<<1)^(n>>63)))
+}
+
+func appendAvroBytes(b []byte, v []byte) []byte {
+	b = appendAvroLong(b, int64(len(v)))
+	return append(b, v...)
+}
+
+func appendAvroRecord(b []byte, schema bigquery.Schema, row map[string]any, prefix string) ([]byte, error) {
+	fields := make(map[string]struct{}, len(schema))
+	for _, f := range schema {
+		fields[f.Name] = struct{}{}
+	}
+	for key := range row {
+		if _, ok := fields[key]; !ok {
+			return nil, goerr.New("field is not in schema", goerr.V("field", prefix+key))
+		}
+	}
+
+	for _, f := range schema {
+		path := prefix + f.Name
+		v := row[f.Name]
+
+		switch {
+		case f.Repeated:
+			if v == nil {
+				b = appendAvroLong(b, 0)
+				continue
+			}
+			arr, ok := v.([]any)
+			if !ok {
+				return nil, goerr.New("repeated field must be array", goerr.V("field", path))
+			}
+			if len(arr) > 0 {
+				b = appendAvroLong(b, int64(len(arr)))
+				for _, elem := range arr {
+					if elem == nil {
+						return nil, goerr.New("array element must not be null", goerr.V("field", path))
+					}
+					var err error
+					if b, err = appendAvroValue(b, f, elem, path); err != nil {
+						return nil, err
+					}
+				}
+			}
+			b = appendAvroLong(b, 0)
+
+		case v == nil:
+			if f.Required {
+				return nil, goerr.New("required field is not set", goerr.V("field", path))
+			}
+			b = appendAvroLong(b, 0) // index of "null" in union
+
+		default:
+			if !f.Required {
+				b = appendAvroLong(b, 1) // index of the type in union
+			}
+			var err error
+			if b, err = appendAvroValue(b, f, v, path); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b, nil
+}
+
+func appendAvroValue(b []byte, f *bigquery.FieldSchema, v any, path string) ([]byte, error) {
+	invalid := func() ([]byte, error) {
+		return nil, goerr.New("invalid value for field type", goerr.V("field", path), goerr.V("type", f.Type), goerr.V("value", v))
+	}
+
+	switch f.Type {
+	case bigquery.StringFieldType, bigquery.DateTimeFieldType, bigquery.GeographyFieldType:
+		s, ok := v.(string)
+		if !ok {
+			return invalid()
+		}
+		return appendAvroBytes(b, []byte(s)), nil
+
+	case bigquery.BytesFieldType:
+		s, ok := v.(string)
+		if !ok {
+			return invalid()
+		}
+		raw, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return invalid()
+		}
+		return appendAvroBytes(b, raw), nil
+
+	case bigquery.IntegerFieldType:
+		n, err := loadJobInt(v)
+		if err != nil {
+			return invalid()
+		}
+		return appendAvroLong(b, n), nil
+
+	case bigquery.FloatFieldType:
+		var s string
+		switch t := v.(type) {
+		case json.Number:
+			s = t.String()
+		case string:
+			s = t
+		default:
+			return invalid()
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return invalid()
+		}
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(n)), nil
+
+	case bigquery.BooleanFieldType:
+		t, ok := v.(bool)
+		if !ok {
+			return invalid()
+		}
+		if t {
+			return append(b, 1), nil
+		}
+		return append(b, 0), nil
+
+	case bigquery.TimestampFieldType:
+		if s, ok := v.(string); ok {
+			ts, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return invalid()
+			}
+			return appendAvroLong(b, ts.UnixMicro()), nil
+		}
+		n, err := loadJobInt(v)
+		if err != nil {
+			return invalid()
+		}
+		return appendAvroLong(b, n), nil
+
+	case bigquery.DateFieldType:
+		if s, ok := v.(string); ok {
+			d, err := time.Parse(time.DateOnly, s)
+			if err != nil {
+				return invalid()
+			}
+			return appendAvroLong(b, d.Unix()/(24*60*60)), nil
+		}
+		n, err := loadJobInt(v)
+		if err != nil {
+			return invalid()
+		}
+		return appendAvroLong(b, n), nil
+
+	case bigquery.TimeFieldType:
+		s, ok := v.(string)
+		if !ok {
+			return invalid()
+		}
+		t, err := time.Parse("15:04:05.999999999", s)
+		if err != nil {
+			return invalid()
+		}
+		micros := int64(t.Hour())*int64(time.Hour/time.Microsecond) +
+			int64(t.Minute())*int64(time.Minute/time.Microsecond) +
+			int64(t.Second())*int64(time.Second/time.Microsecond) +
+			int64(t.Nanosecond()/1000)
+		return appendAvroLong(b, micros), nil
+
+	case bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		scale := 9
+		if f.Type == bigquery.BigNumericFieldType {
+			scale = 38
+		}
+		var s string
+		switch t := v.(type) {
+		case json.Number:
+			s = t.String()
+		case string:
+			s = t
+		default:
+			return invalid()
+		}
+		unscaled, ok := decimalUnscaled(s, scale)
+		if !ok {
+			return invalid()
+		}
+		return appendAvroBytes(b, twosComplement(unscaled)), nil
+
+	case bigquery.JSONFieldType:
+		if s, ok := v.(string); ok && json.Valid([]byte(s)) {
+			return appendAvroBytes(b, []byte(s)), nil
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return invalid()
+		}
+		return appendAvroBytes(b, raw), nil
+
+	case bigquery.RecordFieldType:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return invalid()
+		}
+		return appendAvroRecord(b, f.Schema, obj, path+".")
+	}
+
+	return invalid()
+}
+
+func loadJobInt(v any) (int64, error) {
+	switch t := v.(type) {
+	case json.Number:
+		return t.Int64()
+	case string:
+		return strconv.ParseInt(t, 10, 64)
+	}
+	return 0, goerr.New("not an integer")
+}
+
+// decimalUnscaled returns s multiplied by 10^scale. It returns false if s has more fractional digits than scale.
+func decimalUnscaled(s string, scale int) (*big.Int, bool) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, false
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	if !r.IsInt() {
+		return nil, false
+	}
+	return r.Num(), true
+}
+
+// twosComplement returns big-endian two's complement representation of n for Avro decimal.
+func twosComplement(n *big.Int) []byte {
+	size := n.BitLen()/8 + 1
+	if n.Sign() >= 0 {
+		b := n.Bytes()
+		return append(make([]byte, size-len(b)), b...)
+	}
+
+	m := new(big.Int).Lsh(big.NewInt(1), uint(size*8))
+	return m.Add(m, n).Bytes()
+}
+
+// readAvro decodes rows of Avro Object Container File written by writeAvro. Values are decoded as Avro types without logical types, e.g. timestamp-micros is int64 and decimal is []byte.
+func readAvro(r io.Reader) ([]map[string]any, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to read Avro file")
+	}
+	if !bytes.HasPrefix(raw, avroMagic) {
+		return nil, goerr.New("not an Avro file")
+	}
+	d := &avroDecoder{buf: raw[len(avroMagic):]}
+
+	meta := map[string][]byte{}
+	for {
+		count, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			break
+		}
+		if count < 0 {
+			count = -count
+			if _, err := d.long(); err != nil {
+				return nil, err
+			}
+		}
+		for range count {
+			key, err := d.bytes()
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.bytes()
+			if err != nil {
+				return nil, err
+			}
+			meta[string(key)] = value
+		}
+	}
+	if codec, ok := meta["avro.codec"]; ok && string(codec) != "null" {
+		return nil, goerr.New("unsupported Avro codec", goerr.V("codec", string(codec)))
+	}
+	var schema any
+	if err := json.Unmarshal(meta["avro.schema"], &schema); err != nil {
+		return nil, goerr.Wrap(err, "failed to parse Avro schema")
+	}
+	sync, err := d.fixed(avroSyncSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]any
+	for len(d.buf) > 0 {
+		count, err := d.long()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := d.long(); err != nil {
+			return nil, err
+		}
+		for range count {
+			v, err := d.value(schema)
+			if err != nil {
+				return nil, err
+			}
+			row, ok := v.(map[string]any)
+			if !ok {
+				return nil, goerr.New("Avro row is not record")
+			}
+			rows = append(rows, row)
+		}
+		marker, err := d.fixed(avroSyncSize)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(marker, sync) {
+			return nil, goerr.New("sync marker mismatch")
+		}
+	}
+
+	return rows, nil
+}
+
+type avroDecoder struct {
+	buf []byte
+}
+
+var errAvroShort = goerr.New("unexpected end of Avro data")
+
+func (x *avroDecoder) long() (int64, error) {
+	u, n := binary.Uvarint(x.buf)
+	if n <= 0 {
+		return 0, errAvroShort
+	}
+	x.buf = x.buf[n:]
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (x *avroDecoder) fixed(size int) ([]byte, error) {
+	if size < 0 || len(x.buf) < size {
+		return nil, errAvroShort
+	}
+	v := x.buf[:size]
+	x.buf = x.buf[size:]
+	return v, nil
+}
+
+func (x *avroDecoder) bytes() ([]byte, error) {
+	size, err := x.long()
+	if err != nil {
+		return nil, err
+	}
+	return x.fixed(int(size))
+}
+
+func (x *avroDecoder) value(schema any) (any, error) {
+	switch t := schema.(type) {
+	case string:
+		return x.primitive(t)
+
+	case []any:
+		idx, err := x.long()
+		if err != nil {
+			return nil, err
+		}
+		if idx < 0 || int(idx) >= len(t) {
+			return nil, goerr.New("invalid union index", goerr.V("index", idx))
+		}
+		return x.value(t[idx])
+
+	case map[string]any:
+		switch t["type"] {
+		case "record":
+			fields, _ := t["fields"].([]any)
+			obj := make(map[string]any, len(fields))
+			for _, field := range fields {
+				f, _ := field.(map[string]any)
+				name, _ := f["name"].(string)
+				v, err := x.value(f["type"])
+				if err != nil {
+					return nil, err
+				}
+				obj[name] = v
+			}
+			return obj, nil
+
+		case "array":
+			arr := []any{}
+			for {
+				count, err := x.long()
+				if err != nil {
+					return nil, err
+				}
+				if count == 0 {
+					return arr, nil
+				}
+				if count < 0 {
+					count = -count
+					if _, err := x.long(); err != nil {
+						return nil, err
+					}
+				}
+				for range count {
+					v, err := x.value(t["items"])
+					if err != nil {
+						return nil, err
+					}
+					arr = append(arr, v)
+				}
+			}
+
+		default:
+			return x.value(t["type"])
+		}
+	}
+
+	return nil, goerr.New("unsupported Avro schema", goerr.V("schema", schema))
+}
+
+func (x *avroDecoder) primitive(name string) (any, error) {
+	switch name {
+	case "null":
+		return nil, nil
+	case "boolean":
+		v, err := x.fixed(1)
+		if err != nil {
+			return nil, err
+		}
+		return v[0] != 0, nil
+	case "int", "long":
+		return x.long()
+	case "double":
+		v, err := x.fixed(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(v)), nil
+	case "string":
+		v, err := x.bytes()
+		if err != nil {
+			return nil, err
+		}
+		return string(v), nil
+	case "bytes":
+		v, err := x.bytes()
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, v...), nil
+	}
+	return nil, goerr.New("unsupported Avro type", goerr.V("type", name))
+}
@@ -1,6 +1,7 @@
 package bq
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"time"
@@ -26,11 +27,39 @@ type Client struct {
 	mwClient  *mw.Client
 	bqClient  *bigquery.Client
 	projectID types.GoogleProjectID
+
+	writer     types.BQWriter
+	loader     JobLoader
+	loadFormat types.LoadJobFormat
+	pool       *streamPool
 }
 
 var _ interfaces.BigQuery = &Client{}
 
-func New(ctx context.Context, projectID types.GoogleProjectID) (*Client, error) {
+type Option func(*Client)
+
+// WithWriter sets method to insert records by Insert. Default is types.StorageWriteWriter.
+func WithWriter(writer types.BQWriter) Option {
+	return func(x *Client) {
+		x.writer = writer
+	}
+}
+
+// WithLoadJobFormat sets file format to stage records for types.LoadJobWriter. Default is types.NDJSONLoadJobFormat.
+func WithLoadJobFormat(format types.LoadJobFormat) Option {
+	return func(x *Client) {
+		x.loadFormat = format
+	}
+}
+
+// WithJobLoader replaces JobLoader for types.LoadJobWriter. It is mainly for testing.
+func WithJobLoader(loader JobLoader) Option {
+	return func(x *Client) {
+		x.loader = loader
+	}
+}
+
+func New(ctx context.Context, projectID types.GoogleProjectID, options ...Option) (*Client, error) {
 	mwClient, err := mw.NewClient(ctx, projectID.String())
 	if err != nil {
 		return nil, goerr.Wrap(err, "failed to create bigquery client", goerr.V("projectID", projectID))
@@ -44,11 +73,20 @@ func New(ctx context.Context, projectID types.GoogleProjectID) (*Client, error)
 		return nil, goerr.Wrap(err, "failed to create bigquery client", goerr.V("projectID", projectID))
 	}
 
-	return &Client{
-		mwClient:  mwClient,
-		bqClient:  bqClient,
-		projectID: projectID,
-	}, nil
+	client := &Client{
+		mwClient:   mwClient,
+		bqClient:   bqClient,
+		projectID:  projectID,
+		writer:     types.StorageWriteWriter,
+		loader:     &jobLoader{bqClient: bqClient},
+		loadFormat: types.NDJSONLoadJobFormat,
+		pool:       newStreamPool(mwClient, projectID),
+	}
+	for _, opt := range options {
+		opt(client)
+	}
+
+	return client, nil
 }
 
 // Query implements interfaces.BigQuery.
@@ -89,11 +127,23 @@ func backoff(ctx context.Context, callback func(n int) (done bool, err error)) e
 	}
 }
 
+// NewStream implements interfaces.BigQuery. A managed stream is shared with other streams and insertions of the same table and schema.
 func (x *Client) NewStream(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema) (interfaces.BigQueryStream, error) {
-	return newStream(ctx, x.mwClient, x.projectID, datasetID, tableID, schema)
+	s, err := x.pool.get(ctx, datasetID, tableID, schema)
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{stream: s}, nil
+}
+
+// Close closes pooled streams.
+func (x *Client) Close() error {
+	return x.pool.Close()
 }
 
-func convertDataToBytes(md protoreflect.MessageDescriptor, data []any) ([][]byte, error) {
+func convertDataToBytes(schema bigquery.Schema, md protoreflect.MessageDescriptor, data []any) ([][]byte, error) {
+	hasJSON := hasJSONField(schema)
+
 	var rows [][]byte
 	for _, v := range data {
 		message := dynamicpb.NewMessage(md)
@@ -103,6 +153,12 @@ func convertDataToBytes(md protoreflect.MessageDescriptor, data []any) ([][]byte
 			return nil, goerr.Wrap(err, "failed to Marshal json message", goerr.V("v", v))
 		}
 
+		if hasJSON {
+			if raw, err = encodeJSONColumns(schema, raw); err != nil {
+				return nil, err
+			}
+		}
+
 		// First, json->proto message
 		err = protojson.Unmarshal(raw, message)
 		if err != nil {
@@ -120,10 +176,118 @@ func convertDataToBytes(md protoreflect.MessageDescriptor, data []any) ([][]byte
 	return rows, nil
 }
 
+func hasJSONField(schema bigquery.Schema) bool {
+	for _, f := range schema {
+		if f.Type == bigquery.JSONFieldType || hasJSONField(f.Schema) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeJSONColumns encodes values of JSON columns in the row to JSON string. A JSON column is STRING in the proto message of Storage Write API, so an object or an array for the column fails to convert. A string value that is valid JSON is regarded as already encoded.
+func encodeJSONColumns(schema bigquery.Schema, raw []byte) ([]byte, error) {
+	var row map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&row); err != nil {
+		return nil, goerr.Wrap(err, "failed to decode json message", goerr.V("raw", string(raw)))
+	}
+
+	if err := encodeJSONFields(schema, row); err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(row)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to Marshal json message")
+	}
+	return encoded, nil
+}
+
+func encodeJSONFields(schema bigquery.Schema, row map[string]any) error {
+	for _, f := range schema {
+		v, ok := row[f.Name]
+		if !ok || v == nil {
+			continue
+		}
+
+		switch f.Type {
+		case bigquery.JSONFieldType:
+			if !f.Repeated {
+				encoded, err := encodeJSONValue(v)
+				if err != nil {
+					return goerr.Wrap(err, "failed to encode JSON column", goerr.V("field", f.Name))
+				}
+				row[f.Name] = encoded
+				continue
+			}
+
+			arr, ok := v.([]any)
+			if !ok {
+				continue
+			}
+			for i := range arr {
+				encoded, err := encodeJSONValue(arr[i])
+				if err != nil {
+					return goerr.Wrap(err, "failed to encode JSON column", goerr.V("field", f.Name))
+				}
+				arr[i] = encoded
+			}
+
+		case bigquery.RecordFieldType:
+			switch t := v.(type) {
+			case map[string]any:
+				if err := encodeJSONFields(f.Schema, t); err != nil {
+					return err
+				}
+			case []any:
+				for _, elem := range t {
+					if obj, ok := elem.(map[string]any); ok {
+						if err := encodeJSONFields(f.Schema, obj); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func encodeJSONValue(v any) (string, error) {
+	if s, ok := v.(string); ok && json.Valid([]byte(s)) {
+		return s, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
 var errAppendCountMismatch = goerr.New("append count mismatch")
 var errSchemaMismatch = goerr.New("schema mismatch")
 
 func (x *Client) Insert(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema, data []any) error {
+	switch x.writer {
+	case types.LoadJobWriter:
+		return insertByLoadJob(ctx, x.loader, x.loadFormat, datasetID, tableID, schema, data)
+
+	case types.PooledStreamWriter:
+		s, err := x.pool.get(ctx, datasetID, tableID, schema)
+		if err != nil {
+			return err
+		}
+		defer s.release()
+
+		if err := s.insert(ctx, data); err != nil {
+			return goerr.Wrap(err, "failed to insert data", goerr.V("dataset", datasetID), goerr.V("table", tableID))
+		}
+		return nil
+	}
+
 	convertedSchema, err := adapt.BQSchemaToStorageTableSchema(schema)
 	if err != nil {
 		return goerr.Wrap(err, "failed to convert schema")
@@ -155,7 +319,7 @@ func (x *Client) Insert(ctx context.Context, datasetID types.BQDatasetID, tableI
 	)
 
 	if err := backoff(ctx, func(n int) (bool, error) {
-		if err := insert(ctx, x.mwClient, tableParent, data, descriptorProto, messageDescriptor); err != nil {
+		if err := insert(ctx, x.mwClient, tableParent, schema, data, descriptorProto, messageDescriptor); err != nil {
 			if err == errAppendCountMismatch {
 				utils.CtxLogger(ctx).Warn("append count mismatch, retry", "n", n)
 				return false, nil
@@ -184,7 +348,7 @@ func isSchemaMismatchError(err error) bool {
 	return false
 }
 
-func insert(ctx context.Context, mwClient *mw.Client, tableParent string, data []any, dp *descriptorpb.DescriptorProto, md protoreflect.MessageDescriptor) error {
+func insert(ctx context.Context, mwClient *mw.Client, tableParent string, schema bigquery.Schema, data []any, dp *descriptorpb.DescriptorProto, md protoreflect.MessageDescriptor) error {
 	logger := utils.CtxLogger(ctx)
 
 	logger.Info("starting data ingestion", "count", len(data))
@@ -213,7 +377,7 @@ func insert(ctx context.Context, mwClient *mw.Client, tableParent string, data [
 	logger.Info("converting data to bytes", "count", len(data))
 	for s := 0; s < len(data); s += maxRows {
 		e := min(s+maxRows, len(data))
-		rows, err := convertDataToBytes(md, data[s:e])
+		rows, err := convertDataToBytes(schema, md, data[s:e])
 		if err != nil {
 			return goerr.Wrap(err, "failed to convert data to bytes")
 		}
@@ -287,6 +451,31 @@ func (x *Client) UpdateTable(ctx context.Context, dataset types.BQDatasetID, tab
 	return nil
 }
 
+// GetDataset implements interfaces.BigQuery.
+func (x *Client) GetDataset(ctx context.Context, dataset types.BQDatasetID) (*bigquery.DatasetMetadata, error) {
+	md, err := x.bqClient.Dataset(dataset.String()).Metadata(ctx)
+	if err != nil {
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == 404 {
+			return nil, nil
+		}
+		return nil, goerr.Wrap(err, "failed to get dataset metadata", goerr.V("dataset", dataset))
+	}
+
+	return md, nil
+}
+
+// CreateDataset implements interfaces.BigQuery. It does not return error if the dataset has been created by another process.
+func (x *Client) CreateDataset(ctx context.Context, dataset types.BQDatasetID, md *bigquery.DatasetMetadata) error {
+	if err := x.bqClient.Dataset(dataset.String()).Create(ctx, md); err != nil {
+		if gErr, ok := err.(*googleapi.Error); ok && gErr.Code == 409 {
+			return nil
+		}
+		return goerr.Wrap(err, "failed to create dataset", goerr.V("dataset", dataset))
+	}
+
+	return nil
+}
+
 // CreateTable implements interfaces.BigQuery.
 func (x *Client) CreateTable(ctx context.Context, dataset types.BQDatasetID, table types.BQTableID, md *bigquery.TableMetadata) error {
 	if err := x.bqClient.Dataset(dataset.String()).Table(table.String()).Create(ctx, md); err != nil {
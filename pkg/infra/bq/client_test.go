@@ -2,12 +2,15 @@ package bq_test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 	"sync"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
 	"github.com/google/uuid"
 	"github.com/m-mizutani/bqs"
 	"github.com/m-mizutani/gt"
@@ -15,6 +18,10 @@ import (
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 	"github.com/secmon-lab/swarm/pkg/infra/bq"
 	"github.com/secmon-lab/swarm/pkg/utils"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
 func TestInsert(t *testing.T) {
@@ -190,3 +197,255 @@ func TestConcurrency(t *testing.T) {
 	wg.Wait()
 	gt.NoError(t, s.Close())
 }
+
+func TestConvertDataToBytes_JSON(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "data", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "user", Type: bigquery.StringFieldType},
+			{Name: "headers", Type: bigquery.JSONFieldType},
+			{Name: "events", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+				{Name: "payload", Type: bigquery.JSONFieldType},
+			}},
+		}},
+		{Name: "raw", Type: bigquery.JSONFieldType},
+	}
+	storageSchema := gt.R1(adapt.BQSchemaToStorageTableSchema(schema)).NoError(t)
+	descriptor := gt.R1(adapt.StorageSchemaToProto2Descriptor(storageSchema, "root")).NoError(t)
+	md := descriptor.(protoreflect.MessageDescriptor)
+
+	data := []any{
+		map[string]any{
+			"id": "log-1",
+			"data": map[string]any{
+				"user":    "alice",
+				"headers": map[string]any{"host": "example.com"},
+				"events": []any{
+					map[string]any{"payload": []any{1, "a"}},
+					map[string]any{"payload": "plain text"},
+				},
+			},
+			"raw": `{"already":"encoded"}`,
+		},
+	}
+
+	rows := gt.R1(bq.ConvertDataToBytes(schema, md, data)).NoError(t)
+	gt.A(t, rows).Length(1)
+
+	message := dynamicpb.NewMessage(md)
+	gt.NoError(t, proto.Unmarshal(rows[0], message))
+	raw := gt.R1(protojson.Marshal(message)).NoError(t)
+
+	var row map[string]any
+	gt.NoError(t, json.Unmarshal(raw, &row))
+	dataField := row["data"].(map[string]any)
+	gt.V(t, dataField["user"]).Equal("alice")
+	gt.V(t, dataField["headers"]).Equal(`{"host":"example.com"}`)
+	events := dataField["events"].([]any)
+	gt.V(t, events[0].(map[string]any)["payload"]).Equal(`[1,"a"]`)
+	gt.V(t, events[1].(map[string]any)["payload"]).Equal(`"plain text"`)
+	gt.V(t, row["raw"]).Equal(`{"already":"encoded"}`)
+}
+
+func TestInsertByLoadJob(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "timestamp", Type: bigquery.TimestampFieldType},
+		{Name: "data", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "headers", Type: bigquery.JSONFieldType},
+			{Name: "note", Type: bigquery.JSONFieldType},
+			{Name: "events", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+				{Name: "at", Type: bigquery.TimestampFieldType},
+			}},
+		}},
+	}
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 678000, time.UTC)
+	data := []any{
+		&model.LogRecordRaw{
+			LogRecord: model.LogRecord{
+				ID: "log-1",
+				Data: map[string]any{
+					"headers": `{"host":"example.com"}`,
+					"note":    "plain text",
+					"events": []any{
+						map[string]any{"at": ts.UnixMicro()},
+					},
+				},
+			},
+			Timestamp: ts.UnixMicro(),
+		},
+		map[string]any{"id": "log-2"},
+	}
+
+	loader := &bq.MockJobLoader{}
+	gt.NoError(t, bq.InsertByLoadJob(context.Background(), loader, types.NDJSONLoadJobFormat, "test-dataset", "test-table", schema, data))
+
+	gt.A(t, loader.Jobs).Length(1).At(0, func(t testing.TB, job *bq.MockLoadJob) {
+		gt.Equal(t, job.DatasetID, "test-dataset")
+		gt.Equal(t, job.TableID, "test-table")
+		gt.A(t, job.Rows).Length(2)
+
+		row := job.Rows[0]
+		gt.V(t, row["id"]).Equal("log-1")
+		gt.V(t, row["timestamp"]).Equal("2024-01-02T03:04:05.000678Z")
+
+		dataField := row["data"].(map[string]any)
+		gt.V(t, dataField["headers"]).Equal(map[string]any{"host": "example.com"})
+		gt.V(t, dataField["note"]).Equal("plain text")
+		events := dataField["events"].([]any)
+		gt.V(t, events[0].(map[string]any)["at"]).Equal("2024-01-02T03:04:05.000678Z")
+
+		gt.V(t, job.Rows[1]["id"]).Equal("log-2")
+	})
+}
+
+func TestInsertByLoadJob_Avro(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "timestamp", Type: bigquery.TimestampFieldType},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+		{Name: "score", Type: bigquery.FloatFieldType},
+		{Name: "ok", Type: bigquery.BooleanFieldType},
+		{Name: "day", Type: bigquery.DateFieldType},
+		{Name: "price", Type: bigquery.NumericFieldType},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "data", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "headers", Type: bigquery.JSONFieldType},
+			{Name: "note", Type: bigquery.JSONFieldType},
+			{Name: "events", Type: bigquery.RecordFieldType, Repeated: true, Schema: bigquery.Schema{
+				{Name: "at", Type: bigquery.TimestampFieldType},
+			}},
+		}},
+	}
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 678000, time.UTC)
+	data := []any{
+		map[string]any{
+			"id":        "log-1",
+			"timestamp": ts.UnixMicro(),
+			"count":     int64(1) << 60,
+			"score":     1.5,
+			"ok":        true,
+			"day":       "2024-01-02",
+			"price":     "-1.25",
+			"tags":      []string{"a", "b"},
+			"data": map[string]any{
+				"headers": `{"host":"example.com"}`,
+				"note":    "plain text",
+				"events":  []any{map[string]any{"at": ts.UnixMicro()}},
+			},
+		},
+		map[string]any{"id": "log-2"},
+	}
+
+	loader := &bq.MockJobLoader{}
+	gt.NoError(t, bq.InsertByLoadJob(context.Background(), loader, types.AvroLoadJobFormat, "test-dataset", "test-table", schema, data))
+
+	gt.A(t, loader.Jobs).Length(1).At(0, func(t testing.TB, job *bq.MockLoadJob) {
+		gt.Equal(t, job.Format, types.AvroLoadJobFormat)
+		gt.A(t, job.Rows).Length(2)
+
+		row := job.Rows[0]
+		gt.V(t, row["id"]).Equal("log-1")
+		gt.V(t, row["timestamp"]).Equal(ts.UnixMicro())
+		gt.V(t, row["count"]).Equal(int64(1) << 60)
+		gt.V(t, row["score"]).Equal(1.5)
+		gt.V(t, row["ok"]).Equal(true)
+		gt.V(t, row["day"]).Equal(int64(19724))
+		// -1.25 * 10^9 in two's complement
+		gt.V(t, row["price"]).Equal([]byte{0xb5, 0x7e, 0x83, 0x80})
+		gt.V(t, row["tags"]).Equal([]any{"a", "b"})
+
+		dataField := row["data"].(map[string]any)
+		gt.V(t, dataField["headers"]).Equal(`{"host":"example.com"}`)
+		gt.V(t, dataField["note"]).Equal(`"plain text"`)
+		gt.V(t, dataField["events"]).Equal([]any{map[string]any{"at": ts.UnixMicro()}})
+
+		gt.V(t, job.Rows[1]).Equal(map[string]any{
+			"id": "log-2", "timestamp": nil, "count": nil, "score": nil, "ok": nil,
+			"day": nil, "price": nil, "tags": []any{}, "data": nil,
+		})
+	})
+
+	t.Run("required field is not set", func(t *testing.T) {
+		err := bq.InsertByLoadJob(context.Background(), &bq.MockJobLoader{}, types.AvroLoadJobFormat, "test-dataset", "test-table", schema, []any{
+			map[string]any{"count": 1},
+		})
+		gt.Error(t, err)
+	})
+
+	t.Run("field not in schema", func(t *testing.T) {
+		err := bq.InsertByLoadJob(context.Background(), &bq.MockJobLoader{}, types.AvroLoadJobFormat, "test-dataset", "test-table", schema, []any{
+			map[string]any{"id": "log-3", "unknown": 1},
+		})
+		gt.Error(t, err)
+	})
+
+	t.Run("many rows are split into blocks", func(t *testing.T) {
+		var rows []any
+		for i := range 2500 {
+			rows = append(rows, map[string]any{"id": fmt.Sprintf("log-%d", i)})
+		}
+		loader := &bq.MockJobLoader{}
+		gt.NoError(t, bq.InsertByLoadJob(context.Background(), loader, types.AvroLoadJobFormat, "test-dataset", "test-table", schema, rows))
+		gt.A(t, loader.Jobs[0].Rows).Length(2500).At(2499, func(t testing.TB, v map[string]any) {
+			gt.V(t, v["id"]).Equal("log-2499")
+		})
+	})
+}
+
+func TestSchemaFingerprint(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "data", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "user", Type: bigquery.StringFieldType},
+		}},
+	}
+	same := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "data", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "user", Type: bigquery.StringFieldType},
+		}},
+	}
+	added := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "data", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "user", Type: bigquery.StringFieldType},
+			{Name: "email", Type: bigquery.StringFieldType},
+		}},
+	}
+
+	fp := gt.R1(bq.SchemaFingerprint(schema)).NoError(t)
+	gt.Equal(t, gt.R1(bq.SchemaFingerprint(same)).NoError(t), fp)
+	gt.NotEqual(t, gt.R1(bq.SchemaFingerprint(added)).NoError(t), fp)
+}
+
+func TestInsertByPooledStream(t *testing.T) {
+	var (
+		projectID = types.GoogleProjectID(utils.LoadEnv(t, "TEST_BIGQUERY_PROJECT_ID"))
+		datasetID = types.BQDatasetID(utils.LoadEnv(t, "TEST_BIGQUERY_DATASET_ID"))
+	)
+
+	tableID := types.BQTableID(time.Now().Format("pooled_20060102_150405"))
+
+	ctx := context.Background()
+	client := gt.R1(bq.New(ctx, projectID, bq.WithWriter(types.PooledStreamWriter))).NoError(t)
+	defer func() { gt.NoError(t, client.Close()) }()
+
+	log1 := model.LogRecord{ID: "p1", Timestamp: time.Now(), Data: map[string]any{"red": uuid.NewString()}}
+	log2 := model.LogRecord{ID: "p2", Timestamp: time.Now(), Data: map[string]any{"red": uuid.NewString(), "blue": uuid.NewString()}}
+
+	schema1 := gt.R1(bqs.Infer(log1)).NoError(t)
+	gt.NoError(t, client.CreateTable(ctx, datasetID, tableID, &bigquery.TableMetadata{Schema: schema1}))
+
+	// Insertions with the same schema reuse the stream
+	for i := 0; i < 3; i++ {
+		gt.NoError(t, client.Insert(ctx, datasetID, tableID, schema1, []any{log1.Raw()}))
+	}
+
+	schema2 := gt.R1(bqs.Merge(schema1, gt.R1(bqs.Infer(log2)).NoError(t))).NoError(t)
+	md := gt.R1(client.GetMetadata(ctx, datasetID, tableID)).NoError(t)
+	gt.NoError(t, client.UpdateTable(ctx, datasetID, tableID, bigquery.TableMetadataToUpdate{Schema: schema2}, md.ETag))
+	gt.NoError(t, client.Insert(ctx, datasetID, tableID, schema2, []any{log2.Raw()}))
+}
@@ -0,0 +1,45 @@
+package bq
+
+import (
+	"context"
+	"io"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+)
+
+var (
+	ConvertDataToBytes = convertDataToBytes
+	InsertByLoadJob    = insertByLoadJob
+	SchemaFingerprint  = schemaFingerprint
+)
+
+// StreamPool is streamPool whose streams are created by a function of test instead of BigQuery Storage Write API.
+type StreamPool struct {
+	pool *streamPool
+}
+
+func NewStreamPool(create func(ctx context.Context, tableID types.BQTableID, schema bigquery.Schema) (io.Closer, error)) *StreamPool {
+	pool := newStreamPool(nil, "")
+	pool.create = func(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema, fingerprint string) (*pooledStream, error) {
+		closer, err := create(ctx, tableID, schema)
+		if err != nil {
+			return nil, err
+		}
+		return &pooledStream{fingerprint: fingerprint, schema: schema, closer: closer}, nil
+	}
+	return &StreamPool{pool: pool}
+}
+
+// Get returns schema of the stream for the table and a function to release the stream.
+func (x *StreamPool) Get(ctx context.Context, tableID types.BQTableID, schema bigquery.Schema) (bigquery.Schema, func(), error) {
+	s, err := x.pool.get(ctx, "dataset", tableID, schema)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.schema, s.release, nil
+}
+
+func (x *StreamPool) Close() error {
+	return x.pool.Close()
+}
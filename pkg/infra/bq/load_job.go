@@ -0,0 +1,174 @@
+package bq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/utils"
+)
+
+// JobLoader runs a BigQuery load job that appends rows of src in format to the table. New fields in schema are added to the table by the job.
+type JobLoader interface {
+	Load(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema, format types.LoadJobFormat, src io.Reader) error
+}
+
+type jobLoader struct {
+	bqClient *bigquery.Client
+}
+
+var _ JobLoader = &jobLoader{}
+
+func (x *jobLoader) Load(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema, format types.LoadJobFormat, src io.Reader) error {
+	source := bigquery.NewReaderSource(src)
+	switch format {
+	case types.AvroLoadJobFormat:
+		// Schema is embedded in Avro file
+		source.SourceFormat = bigquery.Avro
+		source.AvroOptions = &bigquery.AvroOptions{UseAvroLogicalTypes: true}
+	default:
+		source.SourceFormat = bigquery.JSON
+		source.Schema = schema
+	}
+
+	loader := x.bqClient.Dataset(datasetID.String()).Table(tableID.String()).LoaderFrom(source)
+	loader.WriteDisposition = bigquery.WriteAppend
+	loader.CreateDisposition = bigquery.CreateNever
+	loader.SchemaUpdateOptions = []string{"ALLOW_FIELD_ADDITION", "ALLOW_FIELD_RELAXATION"}
+
+	job, err := loader.Run(ctx)
+	if err != nil {
+		return goerr.Wrap(err, "failed to run load job", goerr.V("dataset", datasetID), goerr.V("table", tableID))
+	}
+
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return goerr.Wrap(err, "failed to wait load job", goerr.V("jobID", job.ID()))
+	}
+	if err := status.Err(); err != nil {
+		return goerr.Wrap(err, "load job failed", goerr.V("jobID", job.ID()), goerr.V("errors", status.Errors))
+	}
+
+	return nil
+}
+
+// insertByLoadJob stages data to a local NDJSON or Avro file and loads it into the table by loader.
+func insertByLoadJob(ctx context.Context, loader JobLoader, format types.LoadJobFormat, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema, data []any) error {
+	f, err := os.CreateTemp("", "swarm-load-*."+string(format))
+	if err != nil {
+		return goerr.Wrap(err, "failed to create staging file")
+	}
+	defer func() {
+		utils.SafeClose(f)
+		if err := os.Remove(f.Name()); err != nil {
+			utils.CtxLogger(ctx).Warn("failed to remove staging file", "path", f.Name(), "error", err)
+		}
+	}()
+
+	write := writeNDJSON
+	if format == types.AvroLoadJobFormat {
+		write = writeAvro
+	}
+	if err := write(f, schema, data); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return goerr.Wrap(err, "failed to seek staging file")
+	}
+
+	startedAt := time.Now()
+	if err := loader.Load(ctx, datasetID, tableID, schema, format, f); err != nil {
+		return err
+	}
+	utils.CtxLogger(ctx).Info("loaded data by load job", "dataset", datasetID, "table", tableID, "count", len(data), "format", format, "duration", time.Since(startedAt))
+
+	return nil
+}
+
+// writeNDJSON writes data as newline delimited JSON for load job. Values are converted from the format of Storage Write API.
+func writeNDJSON(w io.Writer, schema bigquery.Schema, data []any) error {
+	bw := bufio.NewWriter(w)
+	for _, v := range data {
+		row, err := toLoadJobRow(v)
+		if err != nil {
+			return err
+		}
+		formatLoadJobFields(schema, row)
+
+		line, err := json.Marshal(row)
+		if err != nil {
+			return goerr.Wrap(err, "failed to Marshal json message")
+		}
+		if _, err := bw.Write(append(line, '\n')); err != nil {
+			return goerr.Wrap(err, "failed to write staging file")
+		}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return goerr.Wrap(err, "failed to flush staging file")
+	}
+	return nil
+}
+
+// toLoadJobRow converts data to a row of JSON object. Numbers are kept as json.Number not to lose precision.
+func toLoadJobRow(v any) (map[string]any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to Marshal json message", goerr.V("v", v))
+	}
+
+	var row map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&row); err != nil {
+		return nil, goerr.Wrap(err, "failed to decode json message", goerr.V("raw", string(raw)))
+	}
+	return row, nil
+}
+
+// formatLoadJobFields converts values in row for load job of JSON format. TIMESTAMP in UNIX time of microseconds is converted to timestamp string, and a JSON column given as JSON string is embedded as JSON value.
+func formatLoadJobFields(schema bigquery.Schema, row map[string]any) {
+	for _, f := range schema {
+		v, ok := row[f.Name]
+		if !ok || v == nil {
+			continue
+		}
+
+		if arr, ok := v.([]any); ok && f.Repeated {
+			for i := range arr {
+				arr[i] = formatLoadJobValue(f, arr[i])
+			}
+			continue
+		}
+		row[f.Name] = formatLoadJobValue(f, v)
+	}
+}
+
+func formatLoadJobValue(f *bigquery.FieldSchema, v any) any {
+	switch f.Type {
+	case bigquery.TimestampFieldType:
+		if n, ok := v.(json.Number); ok {
+			if micro, err := n.Int64(); err == nil {
+				return time.UnixMicro(micro).UTC().Format("2006-01-02T15:04:05.999999Z")
+			}
+		}
+
+	case bigquery.JSONFieldType:
+		if s, ok := v.(string); ok && json.Valid([]byte(s)) {
+			return json.RawMessage(s)
+		}
+
+	case bigquery.RecordFieldType:
+		if obj, ok := v.(map[string]any); ok {
+			formatLoadJobFields(f.Schema, obj)
+		}
+	}
+	return v
+}
@@ -2,9 +2,12 @@ package bq
 
 import (
 	"context"
+	"encoding/json"
+	"io"
 	"sync"
 
 	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr/v2"
 	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 )
@@ -15,6 +18,25 @@ type Mock struct {
 	MockGetMetadata (func(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID) (*bigquery.TableMetadata, error))
 	MockUpdateTable (func(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, md bigquery.TableMetadataToUpdate, eTag string) error)
 	MockCreateTable (func(ctx context.Context, dataset types.BQDatasetID, table types.BQTableID, md *bigquery.TableMetadata) error)
+
+	MockGetDataset    (func(ctx context.Context, dataset types.BQDatasetID) (*bigquery.DatasetMetadata, error))
+	MockCreateDataset (func(ctx context.Context, dataset types.BQDatasetID, md *bigquery.DatasetMetadata) error)
+}
+
+// GetDataset implements interfaces.BigQuery. It returns empty metadata if MockGetDataset is not set, as if the dataset exists.
+func (x *Mock) GetDataset(ctx context.Context, dataset types.BQDatasetID) (*bigquery.DatasetMetadata, error) {
+	if x.MockGetDataset != nil {
+		return x.MockGetDataset(ctx, dataset)
+	}
+	return &bigquery.DatasetMetadata{}, nil
+}
+
+// CreateDataset implements interfaces.BigQuery.
+func (x *Mock) CreateDataset(ctx context.Context, dataset types.BQDatasetID, md *bigquery.DatasetMetadata) error {
+	if x.MockCreateDataset != nil {
+		return x.MockCreateDataset(ctx, dataset, md)
+	}
+	return nil
 }
 
 // CreateTable implements interfaces.BigQuery.
@@ -106,11 +128,46 @@ type GeneralMock struct {
 		ETag    string
 	}
 
-	Queries []string
+	// Datasets is a set of existing datasets. If nil, all datasets are regarded as existing.
+	Datasets       map[types.BQDatasetID]*bigquery.DatasetMetadata
+	CreatedDataset []struct {
+		Dataset types.BQDatasetID
+		MD      *bigquery.DatasetMetadata
+	}
+
+	Queries  []string
+	Inserted []*MockInsertedData
 
 	mutex sync.Mutex
 }
 
+// GetDataset implements interfaces.BigQuery.
+func (x *GeneralMock) GetDataset(ctx context.Context, dataset types.BQDatasetID) (*bigquery.DatasetMetadata, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if x.Datasets == nil {
+		return &bigquery.DatasetMetadata{}, nil
+	}
+	return x.Datasets[dataset], nil
+}
+
+// CreateDataset implements interfaces.BigQuery.
+func (x *GeneralMock) CreateDataset(ctx context.Context, dataset types.BQDatasetID, md *bigquery.DatasetMetadata) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	x.CreatedDataset = append(x.CreatedDataset, struct {
+		Dataset types.BQDatasetID
+		MD      *bigquery.DatasetMetadata
+	}{Dataset: dataset, MD: md})
+	if x.Datasets != nil {
+		x.Datasets[dataset] = md
+	}
+
+	return nil
+}
+
 // CreateTable implements interfaces.BigQuery.
 func (x *GeneralMock) CreateTable(ctx context.Context, dataset types.BQDatasetID, table types.BQTableID, md *bigquery.TableMetadata) error {
 	x.mutex.Lock()
@@ -178,6 +235,15 @@ func (x *GeneralMock) UpdateTable(ctx context.Context, dataset types.BQDatasetID
 }
 
 func (x *GeneralMock) Insert(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema, data []any) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	x.Inserted = append(x.Inserted, &MockInsertedData{
+		DatasetID: datasetID,
+		TableID:   tableID,
+		Schema:    schema,
+		Data:      data,
+	})
 	return nil
 }
 
@@ -189,3 +255,54 @@ type MockInsertedData struct {
 }
 
 var _ interfaces.BigQuery = &GeneralMock{}
+
+// MockJobLoader is a local fake of JobLoader. It keeps rows of load jobs in memory instead of running jobs.
+type MockJobLoader struct {
+	Jobs []*MockLoadJob
+
+	mutex sync.Mutex
+}
+
+// MockLoadJob is a load job run by MockJobLoader. Rows are decoded from the staged file. Values of Avro are decoded without logical types, e.g. TIMESTAMP is int64 of microseconds.
+type MockLoadJob struct {
+	DatasetID types.BQDatasetID
+	TableID   types.BQTableID
+	Schema    bigquery.Schema
+	Format    types.LoadJobFormat
+	Rows      []map[string]any
+}
+
+func (x *MockJobLoader) Load(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema, format types.LoadJobFormat, src io.Reader) error {
+	job := &MockLoadJob{
+		DatasetID: datasetID,
+		TableID:   tableID,
+		Schema:    schema,
+		Format:    format,
+	}
+
+	switch format {
+	case types.AvroLoadJobFormat:
+		rows, err := readAvro(src)
+		if err != nil {
+			return goerr.Wrap(err, "failed to decode staged Avro file")
+		}
+		job.Rows = rows
+
+	default:
+		decoder := json.NewDecoder(src)
+		for decoder.More() {
+			var row map[string]any
+			if err := decoder.Decode(&row); err != nil {
+				return goerr.Wrap(err, "failed to decode staged row")
+			}
+			job.Rows = append(job.Rows, row)
+		}
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.Jobs = append(x.Jobs, job)
+	return nil
+}
+
+var _ JobLoader = &MockJobLoader{}
@@ -0,0 +1,277 @@
+package bq
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	mw "cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/bq/writer"
+	"github.com/secmon-lab/swarm/pkg/utils"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// schemaFingerprint returns a hash of schema to detect schema change of a table.
+func schemaFingerprint(schema bigquery.Schema) (string, error) {
+	raw, err := schema.ToJSONFields()
+	if err != nil {
+		return "", goerr.Wrap(err, "failed to convert schema to JSON")
+	}
+	hash := sha256.Sum256(raw)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+type poolKey struct {
+	datasetID types.BQDatasetID
+	tableID   types.BQTableID
+}
+
+// streamPool keeps managed streams of default stream type per destination table. A stream and its descriptor are reused while they cover schema of the table, and renewed when the schema grows.
+type streamPool struct {
+	mwClient  *mw.Client
+	projectID types.GoogleProjectID
+	// create is newStream, and replaced in tests
+	create func(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema, fingerprint string) (*pooledStream, error)
+
+	entries map[poolKey]*poolEntry
+	mutex   sync.Mutex
+	// closing counts streams that are closed in background after release. Close waits for them.
+	closing sync.WaitGroup
+}
+
+// poolEntry holds a pooled stream of a table. mutex serializes creation of a stream for the table without blocking other tables.
+type poolEntry struct {
+	stream *pooledStream
+	mutex  sync.Mutex
+}
+
+func newStreamPool(mwClient *mw.Client, projectID types.GoogleProjectID) *streamPool {
+	pool := &streamPool{
+		mwClient:  mwClient,
+		projectID: projectID,
+		entries:   make(map[poolKey]*poolEntry),
+	}
+	pool.create = pool.newStream
+	return pool
+}
+
+// pooledStream is a managed stream and its descriptor for a schema of a table. refs counts users of the stream, and the stream is closed after all users release it.
+type pooledStream struct {
+	fingerprint   string
+	schema        bigquery.Schema
+	msgDescriptor protoreflect.MessageDescriptor
+	mgr           *writer.Manager
+	// closer closes the managed stream. It is mgr except in tests.
+	closer io.Closer
+	refs   sync.WaitGroup
+}
+
+// release must be called when the stream returned by streamPool.get is no longer used.
+func (x *pooledStream) release() {
+	x.refs.Done()
+}
+
+// closeAfterRelease closes the stream in background after it is released by all users.
+func (x *streamPool) closeAfterRelease(s *pooledStream) {
+	x.closing.Add(1)
+	go func() {
+		defer x.closing.Done()
+		s.refs.Wait()
+		utils.SafeClose(s.closer)
+	}()
+}
+
+// entry returns the entry of the table, and creates it if not exists.
+func (x *streamPool) entry(key poolKey) *poolEntry {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	e, ok := x.entries[key]
+	if !ok {
+		e = &poolEntry{}
+		x.entries[key] = e
+	}
+	return e
+}
+
+// get returns a pooled stream for the table and schema. The pooled stream is reused if its schema covers the schema. If not, a new stream is created, and it replaces the pooled one only when the schema covers the pooled schema. Otherwise, the new stream is used only by the caller and closed after release. A replaced stream is closed after it is released by all users.
+func (x *streamPool) get(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema) (*pooledStream, error) {
+	fingerprint, err := schemaFingerprint(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lock only the table, so that creating a stream of a slow table does not block other tables
+	e := x.entry(poolKey{datasetID: datasetID, tableID: tableID})
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	old := e.stream
+	if old != nil && (old.fingerprint == fingerprint || containsSchema(old.schema, schema)) {
+		old.refs.Add(1)
+		return old, nil
+	}
+
+	s, err := x.create(ctx, datasetID, tableID, schema, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	s.refs.Add(1)
+
+	if old != nil && !containsSchema(schema, old.schema) {
+		utils.CtxLogger(ctx).Info("using unpooled stream for schema not compatible with pooled one", "dataset", datasetID, "table", tableID)
+		x.closeAfterRelease(s)
+		return s, nil
+	}
+
+	e.stream = s
+	if old != nil {
+		utils.CtxLogger(ctx).Info("renewing pooled stream by schema change", "dataset", datasetID, "table", tableID)
+		x.closeAfterRelease(old)
+	}
+
+	return s, nil
+}
+
+// containsSchema returns true if all fields of sub are in schema with the same type and mode, and fields only in schema are not required. Then, rows of sub can be written by a stream of schema.
+func containsSchema(schema, sub bigquery.Schema) bool {
+	fields := make(map[string]*bigquery.FieldSchema, len(schema))
+	for _, f := range schema {
+		fields[f.Name] = f
+	}
+
+	for _, f := range sub {
+		base, ok := fields[f.Name]
+		if !ok || base.Type != f.Type || base.Repeated != f.Repeated || base.Required != f.Required {
+			return false
+		}
+		if f.Type == bigquery.RecordFieldType && !containsSchema(base.Schema, f.Schema) {
+			return false
+		}
+		delete(fields, f.Name)
+	}
+
+	for _, f := range fields {
+		if f.Required {
+			return false
+		}
+	}
+	return true
+}
+
+func (x *streamPool) newStream(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema, fingerprint string) (*pooledStream, error) {
+	convertedSchema, err := adapt.BQSchemaToStorageTableSchema(schema)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to convert schema")
+	}
+
+	descriptor, err := adapt.StorageSchemaToProto2Descriptor(convertedSchema, "root")
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to convert schema to descriptor")
+	}
+	messageDescriptor, ok := descriptor.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, goerr.Wrap(err, "adapted descriptor is not a message descriptor")
+	}
+	descriptorProto, err := adapt.NormalizeDescriptor(messageDescriptor)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to normalize descriptor")
+	}
+
+	mgr, err := writer.NewManger(ctx, x.mwClient, descriptorProto, x.projectID, datasetID, tableID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pooledStream{
+		fingerprint:   fingerprint,
+		schema:        schema,
+		msgDescriptor: messageDescriptor,
+		mgr:           mgr,
+		closer:        mgr,
+	}, nil
+}
+
+// Close closes all pooled streams after they are released by all users, and waits for streams closed in background.
+func (x *streamPool) Close() error {
+	x.mutex.Lock()
+	var streams []*pooledStream
+	for key, e := range x.entries {
+		e.mutex.Lock()
+		if e.stream != nil {
+			streams = append(streams, e.stream)
+			e.stream = nil
+		}
+		e.mutex.Unlock()
+		delete(x.entries, key)
+	}
+	x.mutex.Unlock()
+
+	var errs []error
+	for _, s := range streams {
+		// Wait for in-flight insertions not to break them
+		s.refs.Wait()
+		if err := s.closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	x.closing.Wait()
+
+	if len(errs) > 0 {
+		return goerr.Wrap(errs[0], "failed to close pooled streams", goerr.V("count", len(errs)))
+	}
+	return nil
+}
+
+// insert converts data to rows and appends them to the stream. Rows are split into chunks to keep a request size under the limit.
+func (x *pooledStream) insert(ctx context.Context, data []any) error {
+	const maxRows = 256
+
+	// After updating BigQuery schema, there is a delay for propagation of the schema change. According to the following document, it takes about 10 minutes.
+	// https://issuetracker.google.com/issues/64329577#comment3
+	// Then, we wait for 15 minutes to avoid the schema propagation delay.
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Minute)
+	defer cancel()
+
+	for s := 0; s < len(data); s += maxRows {
+		e := min(s+maxRows, len(data))
+		rows, err := convertDataToBytes(x.schema, x.msgDescriptor, data[s:e])
+		if err != nil {
+			return goerr.Wrap(err, "failed to convert data to bytes")
+		}
+
+		if err := x.append(ctx, rows); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (x *pooledStream) append(ctx context.Context, rows [][]byte) error {
+	return backoff(ctx, func(n int) (bool, error) {
+		w := x.mgr.Writer(ctx)
+		defer w.Release()
+
+		if err := w.Append(ctx, rows); err != nil {
+			if err == types.ErrSchemaNotMatched {
+				// If schema does not matched, it seems reconnection of stream is required
+				utils.CtxLogger(ctx).Warn("schema mismatch, retry", "n", n)
+				if err := x.mgr.Renew(ctx); err != nil {
+					return true, err // failed to renew stream, abort
+				}
+				return false, nil // retry
+			}
+			return true, err
+		}
+
+		return true, nil // done without error
+	})
+}
@@ -0,0 +1,207 @@
+package bq_test
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/bq"
+)
+
+// testStream is a stream created by bq.StreamPool in tests. closed is closed when the stream is closed.
+type testStream struct {
+	closed chan struct{}
+}
+
+func (x *testStream) Close() error {
+	close(x.closed)
+	return nil
+}
+
+func waitClosed(t *testing.T, s *testStream) {
+	t.Helper()
+	select {
+	case <-s.closed:
+	case <-time.After(time.Second):
+		t.Error("stream is not closed")
+	}
+}
+
+func isClosed(s *testStream) bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+type testStreamFactory struct {
+	streams []*testStream
+	// block is waited before creating a stream of the table
+	block map[types.BQTableID]chan struct{}
+	mutex sync.Mutex
+}
+
+func (x *testStreamFactory) create(ctx context.Context, tableID types.BQTableID, schema bigquery.Schema) (io.Closer, error) {
+	if ch, ok := x.block[tableID]; ok {
+		<-ch
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	s := &testStream{closed: make(chan struct{})}
+	x.streams = append(x.streams, s)
+	return s, nil
+}
+
+func (x *testStreamFactory) created() []*testStream {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return append([]*testStream{}, x.streams...)
+}
+
+func TestStreamPool_Schema(t *testing.T) {
+	ctx := context.Background()
+	var (
+		schemaA  = bigquery.Schema{{Name: "a", Type: bigquery.StringFieldType}}
+		schemaAB = bigquery.Schema{
+			{Name: "a", Type: bigquery.StringFieldType},
+			{Name: "b", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "c", Type: bigquery.IntegerFieldType},
+			}},
+		}
+		schemaC = bigquery.Schema{{Name: "c", Type: bigquery.IntegerFieldType}}
+	)
+
+	factory := &testStreamFactory{}
+	pool := bq.NewStreamPool(factory.create)
+	defer pool.Close()
+
+	_, release, err := pool.Get(ctx, "t1", schemaA)
+	gt.NoError(t, err)
+	release()
+	gt.A(t, factory.created()).Length(1)
+
+	t.Run("stream is renewed by superset schema", func(t *testing.T) {
+		schema, release := gt.R2(pool.Get(ctx, "t1", schemaAB)).NoError(t)
+		release()
+		gt.Equal(t, schema, schemaAB)
+		streams := factory.created()
+		gt.A(t, streams).Length(2)
+		waitClosed(t, streams[0])
+	})
+
+	t.Run("pooled stream is reused for subset schema", func(t *testing.T) {
+		schema, release := gt.R2(pool.Get(ctx, "t1", schemaA)).NoError(t)
+		release()
+		gt.Equal(t, schema, schemaAB)
+		gt.A(t, factory.created()).Length(2)
+	})
+
+	t.Run("incompatible schema does not replace pooled stream", func(t *testing.T) {
+		schema, release := gt.R2(pool.Get(ctx, "t1", schemaC)).NoError(t)
+		gt.Equal(t, schema, schemaC)
+		streams := factory.created()
+		gt.A(t, streams).Length(3)
+		gt.False(t, isClosed(streams[2]))
+		release()
+		waitClosed(t, streams[2])
+
+		schema, release = gt.R2(pool.Get(ctx, "t1", schemaA)).NoError(t)
+		release()
+		gt.Equal(t, schema, schemaAB)
+		gt.A(t, factory.created()).Length(3)
+		gt.False(t, isClosed(streams[1]))
+	})
+}
+
+func TestStreamPool_SlowTable(t *testing.T) {
+	ctx := context.Background()
+	schema := bigquery.Schema{{Name: "a", Type: bigquery.StringFieldType}}
+
+	unblock := make(chan struct{})
+	factory := &testStreamFactory{block: map[types.BQTableID]chan struct{}{"slow": unblock}}
+	pool := bq.NewStreamPool(factory.create)
+	defer pool.Close()
+
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		_, release, err := pool.Get(ctx, "slow", schema)
+		gt.NoError(t, err)
+		release()
+	}()
+
+	// Creating a stream of the slow table does not block other tables
+	fastDone := make(chan struct{})
+	go func() {
+		defer close(fastDone)
+		_, release, err := pool.Get(ctx, "fast", schema)
+		gt.NoError(t, err)
+		release()
+	}()
+
+	select {
+	case <-fastDone:
+	case <-time.After(time.Second):
+		t.Error("stream of fast table is blocked by slow table")
+	}
+
+	close(unblock)
+	<-slowDone
+	<-fastDone
+	gt.A(t, factory.created()).Length(2)
+}
+
+func TestStreamPool_Close(t *testing.T) {
+	ctx := context.Background()
+	var (
+		schemaA  = bigquery.Schema{{Name: "a", Type: bigquery.StringFieldType}}
+		schemaAB = bigquery.Schema{
+			{Name: "a", Type: bigquery.StringFieldType},
+			{Name: "b", Type: bigquery.StringFieldType},
+		}
+	)
+
+	factory := &testStreamFactory{}
+	pool := bq.NewStreamPool(factory.create)
+
+	// The first stream is replaced and closed in background after release
+	_, releaseOld := gt.R2(pool.Get(ctx, "t1", schemaA)).NoError(t)
+	_, releaseNew := gt.R2(pool.Get(ctx, "t1", schemaAB)).NoError(t)
+	streams := factory.created()
+	gt.A(t, streams).Length(2)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		gt.NoError(t, pool.Close())
+	}()
+
+	// Streams in use are not closed
+	select {
+	case <-closed:
+		t.Fatal("Close returned before streams are released")
+	case <-time.After(100 * time.Millisecond):
+	}
+	gt.False(t, isClosed(streams[0]))
+	gt.False(t, isClosed(streams[1]))
+
+	releaseNew()
+	releaseOld()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close does not return after streams are released")
+	}
+
+	// All streams are closed when Close returns
+	gt.True(t, isClosed(streams[0]))
+	gt.True(t, isClosed(streams[1]))
+}
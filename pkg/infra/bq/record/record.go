@@ -0,0 +1,162 @@
+// Package record converts data to a row of BigQuery table in the same way as bq.Client. It is shared by the backends that store rows by themselves, e.g. memory and lake.
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+)
+
+// Convert converts data to a row of schema by JSON encoding. A field that is not in schema, a value that does not match the field type and a missing REQUIRED field are rejected with types.ErrSchemaNotMatched. TIMESTAMP is given in UNIX time of microseconds as the format of Storage Write API, and converted to time.Time.
+func Convert(schema bigquery.Schema, v any) (map[string]any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to marshal data", goerr.V("data", v))
+	}
+
+	var obj map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&obj); err != nil {
+		return nil, goerr.Wrap(err, "data is not an object", goerr.V("raw", string(raw)))
+	}
+
+	return convertRecord(schema, obj, "")
+}
+
+func convertRecord(schema bigquery.Schema, obj map[string]any, prefix string) (map[string]any, error) {
+	row := make(map[string]any, len(obj))
+	for key, v := range obj {
+		idx := slices.IndexFunc(schema, func(f *bigquery.FieldSchema) bool { return f.Name == key })
+		if idx < 0 {
+			return nil, goerr.Wrap(types.ErrSchemaNotMatched, "field does not exist in table", goerr.V("field", prefix+key))
+		}
+		f := schema[idx]
+
+		if v == nil {
+			continue
+		}
+
+		if f.Repeated {
+			arr, ok := v.([]any)
+			if !ok {
+				return nil, goerr.Wrap(types.ErrSchemaNotMatched, "value of REPEATED field is not array", goerr.V("field", prefix+key))
+			}
+			values := make([]any, 0, len(arr))
+			for _, elem := range arr {
+				converted, err := convertValue(f, elem, prefix+key)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, converted)
+			}
+			row[key] = values
+			continue
+		}
+
+		converted, err := convertValue(f, v, prefix+key)
+		if err != nil {
+			return nil, err
+		}
+		row[key] = converted
+	}
+
+	for _, f := range schema {
+		if _, ok := row[f.Name]; !ok && f.Required {
+			return nil, goerr.Wrap(types.ErrSchemaNotMatched, "REQUIRED field is missing", goerr.V("field", prefix+f.Name))
+		}
+	}
+
+	return row, nil
+}
+
+func convertValue(f *bigquery.FieldSchema, v any, path string) (any, error) {
+	mismatch := func() error {
+		return goerr.Wrap(types.ErrSchemaNotMatched, "value does not match field type",
+			goerr.V("field", path),
+			goerr.V("type", f.Type),
+			goerr.V("value", v),
+		)
+	}
+
+	switch f.Type {
+	case bigquery.StringFieldType:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return nil, mismatch()
+
+	case bigquery.IntegerFieldType:
+		switch t := v.(type) {
+		case json.Number:
+			if n, err := t.Int64(); err == nil {
+				return n, nil
+			}
+		case string:
+			if n, err := json.Number(t).Int64(); err == nil {
+				return n, nil
+			}
+		}
+		return nil, mismatch()
+
+	case bigquery.FloatFieldType, bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		switch t := v.(type) {
+		case json.Number:
+			if n, err := t.Float64(); err == nil {
+				return n, nil
+			}
+		case string:
+			if n, err := json.Number(t).Float64(); err == nil {
+				return n, nil
+			}
+		}
+		return nil, mismatch()
+
+	case bigquery.BooleanFieldType:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		return nil, mismatch()
+
+	case bigquery.TimestampFieldType:
+		switch t := v.(type) {
+		case json.Number:
+			if n, err := t.Int64(); err == nil {
+				return time.UnixMicro(n).UTC(), nil
+			}
+		case string:
+			if ts, err := time.Parse(time.RFC3339Nano, t); err == nil {
+				return ts.UTC(), nil
+			}
+		}
+		return nil, mismatch()
+
+	case bigquery.JSONFieldType:
+		if s, ok := v.(string); ok && json.Valid([]byte(s)) {
+			return s, nil
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, mismatch()
+		}
+		return string(raw), nil
+
+	case bigquery.RecordFieldType:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, mismatch()
+		}
+		return convertRecord(f.Schema, obj, path+".")
+
+	default:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return nil, mismatch()
+	}
+}
@@ -0,0 +1,58 @@
+package record_test
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/bq/record"
+)
+
+func TestConvert(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "timestamp", Type: bigquery.TimestampFieldType},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+		{Name: "attrs", Type: bigquery.JSONFieldType},
+		{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType, Required: true},
+		}},
+	}
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("convert values", func(t *testing.T) {
+		row := gt.R1(record.Convert(schema, map[string]any{
+			"id":        "a",
+			"timestamp": ts.UnixMicro(),
+			"count":     "5",
+			"tags":      []string{"x", "y"},
+			"attrs":     map[string]any{"k": 1},
+			"user":      map[string]any{"name": "alice"},
+		})).NoError(t)
+
+		gt.Equal(t, row["id"], any("a"))
+		gt.Equal(t, row["timestamp"], any(ts))
+		gt.Equal(t, row["count"], any(int64(5)))
+		gt.Equal(t, row["tags"], any([]any{"x", "y"}))
+		gt.Equal(t, row["attrs"], any(`{"k":1}`))
+		gt.Equal(t, row["user"], any(map[string]any{"name": "alice"}))
+	})
+
+	testCases := map[string]any{
+		"unknown field":                 map[string]any{"id": "a", "unknown": 1},
+		"missing REQUIRED field":        map[string]any{"count": 1},
+		"missing REQUIRED nested field": map[string]any{"id": "a", "user": map[string]any{}},
+		"number for STRING":             map[string]any{"id": 1},
+		"invalid INTEGER":               map[string]any{"id": "a", "count": "x"},
+		"non array for REPEATED":        map[string]any{"id": "a", "tags": "x"},
+	}
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := record.Convert(schema, data)
+			gt.Error(t, err).Is(types.ErrSchemaNotMatched)
+		})
+	}
+}
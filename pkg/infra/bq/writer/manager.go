@@ -109,6 +109,8 @@ func (x *Manager) Renew(ctx context.Context) error {
 func (x *Manager) Close() error {
 	x.mutex.Lock()
 	defer x.mutex.Unlock()
+	// Wait for in-flight appends of the current writer
+	x.currentWriter.wg.Wait()
 	if err := x.currentWriter.s.Close(); err != nil && err != io.EOF {
 		return goerr.Wrap(err, "failed to close managed stream", goerr.V("writer_id", x.currentWriter.id))
 	}
@@ -0,0 +1,67 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+)
+
+// File saves a checkpoint of enqueue to a local JSON file. The file keeps only the latest checkpoint, and a checkpoint of another request is reported as types.ErrCheckpointMismatch not to overwrite it by a fresh start.
+type File struct {
+	path string
+}
+
+func NewFile(path string) *File {
+	return &File{path: filepath.Clean(path)}
+}
+
+func (x *File) GetEnqueueCheckpoint(ctx context.Context, id string) (*model.EnqueueCheckpoint, error) {
+	raw, err := os.ReadFile(x.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, goerr.Wrap(types.ErrCheckpointNotFound, "checkpoint file not found", goerr.V("path", x.path))
+		}
+		return nil, goerr.Wrap(err, "failed to read checkpoint file", goerr.V("path", x.path))
+	}
+
+	var checkpoint model.EnqueueCheckpoint
+	if err := json.Unmarshal(raw, &checkpoint); err != nil {
+		return nil, goerr.Wrap(err, "failed to unmarshal checkpoint file", goerr.V("path", x.path))
+	}
+	if checkpoint.ID != id {
+		return nil, goerr.Wrap(types.ErrCheckpointMismatch, "checkpoint file is for another request",
+			goerr.V("path", x.path),
+			goerr.V("id", id),
+			goerr.V("saved", checkpoint.ID),
+		)
+	}
+
+	return &checkpoint, nil
+}
+
+// PutEnqueueCheckpoint writes the checkpoint to a temporary file and renames it, so that the file is not broken by interruption.
+func (x *File) PutEnqueueCheckpoint(ctx context.Context, checkpoint *model.EnqueueCheckpoint) error {
+	raw, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return goerr.Wrap(err, "failed to marshal checkpoint")
+	}
+
+	tmp := x.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return goerr.Wrap(err, "failed to write checkpoint file", goerr.V("path", tmp))
+	}
+	if err := os.Rename(tmp, x.path); err != nil {
+		return goerr.Wrap(err, "failed to rename checkpoint file", goerr.V("path", x.path))
+	}
+	return nil
+}
+
+var _ interfaces.CheckpointStore = &File{}
@@ -0,0 +1,36 @@
+package checkpoint_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/checkpoint"
+)
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	store := checkpoint.NewFile(filepath.Join(t.TempDir(), "checkpoint.json"))
+
+	_, err := store.GetEnqueueCheckpoint(ctx, "id1")
+	gt.Error(t, err).Is(types.ErrCheckpointNotFound)
+
+	req := &model.EnqueueRequest{URLs: []types.ObjectURL{"gs://bucket/a/", "gs://bucket/b/"}}
+	input := model.NewEnqueueCheckpoint(req)
+	input.Advance(1, "b/obj1")
+	gt.NoError(t, store.PutEnqueueCheckpoint(ctx, input))
+
+	saved := gt.R1(store.GetEnqueueCheckpoint(ctx, req.CheckpointID())).NoError(t)
+	gt.Equal(t, saved.BatchCount, 1)
+	gt.A(t, saved.Prefixes).Length(2)
+	gt.True(t, saved.Prefixes[0].Completed)
+	gt.False(t, saved.Prefixes[1].Completed)
+	gt.Equal(t, saved.Prefixes[1].LastObject, "b/obj1")
+
+	// Checkpoint of another request is not resumed
+	_, err = store.GetEnqueueCheckpoint(ctx, "other")
+	gt.Error(t, err).Is(types.ErrCheckpointMismatch)
+}
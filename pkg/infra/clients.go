@@ -12,6 +12,7 @@ type Clients struct {
 	sub    interfaces.PubSubSubscription
 	policy *policy.Client
 	db     interfaces.Database
+	ckpt   interfaces.CheckpointStore
 }
 
 func New(options ...Option) *Clients {
@@ -31,6 +32,9 @@ func (x *Clients) PubSubSubscription() interfaces.PubSubSubscription {
 }
 func (x *Clients) Policy() *policy.Client        { return x.policy }
 func (x *Clients) Database() interfaces.Database { return x.db }
+func (x *Clients) CheckpointStore() interfaces.CheckpointStore {
+	return x.ckpt
+}
 
 type Option func(*Clients)
 
@@ -69,3 +73,9 @@ func WithDatabase(db interfaces.Database) Option {
 		c.db = db
 	}
 }
+
+func WithCheckpointStore(store interfaces.CheckpointStore) Option {
+	return func(c *Clients) {
+		c.ckpt = store
+	}
+}
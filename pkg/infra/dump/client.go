@@ -1,11 +1,17 @@
 package dump
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/m-mizutani/goerr/v2"
@@ -13,57 +19,229 @@ import (
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 )
 
+// Client is an offline sink of BigQuery. It writes table schema and metadata to files and rows to gzip compressed NDJSON files split by partition. Schema and metadata are reloaded by GetMetadata, so schemas are merged across runs as same as BigQuery.
+//
+//	{outDir}/{dataset}.{table}.schema.json
+//	{outDir}/{dataset}.{table}.metadata.json
+//	{outDir}/{dataset}.{table}/dt={partition}.ndjson.gz
 type Client struct {
 	outDir string
+	mutex  sync.Mutex
 }
 
-// CreateTable implements interfaces.BigQuery. Nothing to do in dumper.
+// tableMetadata is metadata of table other than schema that is saved in "{dataset}.{table}.metadata.json".
+type tableMetadata struct {
+	Description      string                     `json:"description,omitempty"`
+	TimePartitioning *bigquery.TimePartitioning `json:"time_partitioning,omitempty"`
+	Clustering       *bigquery.Clustering       `json:"clustering,omitempty"`
+}
+
+func (x *Client) schemaPath(dataset types.BQDatasetID, table types.BQTableID) string {
+	return filepath.Join(x.outDir, fmt.Sprintf("%s.%s.schema.json", dataset, table))
+}
+
+func (x *Client) metadataPath(dataset types.BQDatasetID, table types.BQTableID) string {
+	return filepath.Join(x.outDir, fmt.Sprintf("%s.%s.metadata.json", dataset, table))
+}
+
+func (x *Client) dataPath(dataset types.BQDatasetID, table types.BQTableID, partition string) string {
+	return filepath.Join(x.outDir, fmt.Sprintf("%s.%s", dataset, table), fmt.Sprintf("dt=%s.ndjson.gz", partition))
+}
+
+// CreateTable implements interfaces.BigQuery. It writes schema and metadata of the table to files.
 func (x *Client) CreateTable(ctx context.Context, dataset types.BQDatasetID, table types.BQTableID, md *bigquery.TableMetadata) error {
-	return dumpSchema(x.outDir, dataset, table, md.Schema)
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if err := dumpSchema(x.schemaPath(dataset, table), md.Schema); err != nil {
+		return err
+	}
+	return writeJSON(x.metadataPath(dataset, table), &tableMetadata{
+		Description:      md.Description,
+		TimePartitioning: md.TimePartitioning,
+		Clustering:       md.Clustering,
+	})
+}
+
+// GetDataset implements interfaces.BigQuery. All datasets are regarded as existing in dumper.
+func (x *Client) GetDataset(ctx context.Context, dataset types.BQDatasetID) (*bigquery.DatasetMetadata, error) {
+	return &bigquery.DatasetMetadata{}, nil
 }
 
-// GetMetadata implements interfaces.BigQuery.
+// CreateDataset implements interfaces.BigQuery. Nothing to do in dumper.
+func (x *Client) CreateDataset(ctx context.Context, dataset types.BQDatasetID, md *bigquery.DatasetMetadata) error {
+	return nil
+}
+
+// GetMetadata implements interfaces.BigQuery. It loads schema and metadata written by previous CreateTable or UpdateTable. If the schema file does not exist, it returns nil as the table does not exist.
 func (x *Client) GetMetadata(ctx context.Context, dataset types.BQDatasetID, table types.BQTableID) (*bigquery.TableMetadata, error) {
-	return &bigquery.TableMetadata{}, nil
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	return x.loadMetadata(dataset, table)
+}
+
+// loadMetadata must be called with lock.
+func (x *Client) loadMetadata(dataset types.BQDatasetID, table types.BQTableID) (*bigquery.TableMetadata, error) {
+	raw, err := os.ReadFile(x.schemaPath(dataset, table))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, goerr.Wrap(err, "failed to read schema", goerr.V("file", x.schemaPath(dataset, table)))
+	}
+
+	schema, err := bigquery.SchemaFromJSON(raw)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to parse schema", goerr.V("file", x.schemaPath(dataset, table)))
+	}
+
+	var meta tableMetadata
+	if err := readJSON(x.metadataPath(dataset, table), &meta); err != nil {
+		return nil, err
+	}
+
+	return &bigquery.TableMetadata{
+		Name:             table.String(),
+		FullID:           fmt.Sprintf("%s.%s", dataset, table),
+		Schema:           schema,
+		Description:      meta.Description,
+		TimePartitioning: meta.TimePartitioning,
+		Clustering:       meta.Clustering,
+	}, nil
 }
 
+// NewStream implements interfaces.BigQuery. Rows inserted to the stream are written in the same way as Insert.
 func (x *Client) NewStream(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema) (interfaces.BigQueryStream, error) {
-	return &Stream{}, nil
+	return &Stream{
+		client:    x,
+		datasetID: datasetID,
+		tableID:   tableID,
+		schema:    schema,
+	}, nil
 }
 
-// TODO: Implement Stream
 type Stream struct {
+	client    *Client
+	datasetID types.BQDatasetID
+	tableID   types.BQTableID
+	schema    bigquery.Schema
 }
 
 func (x *Stream) Insert(ctx context.Context, data []any) error {
-	return nil
+	return x.client.Insert(ctx, x.datasetID, x.tableID, x.schema, data)
 }
 
 func (x *Stream) Close() error {
 	return nil
 }
 
-// Insert implements interfaces.BigQuery. It writes data to a file in JSON format. The file name is "{outDir}/{dataset}.{table}.log". If the file does not exist, it creates a new file. If the file exists, it appends data to the file. The file is not uploaded to BigQuery.
+// Insert implements interfaces.BigQuery. It appends data in JSON format to "{outDir}/{dataset}.{table}/dt={partition}.ndjson.gz". The partition is decided by time partitioning of the table, e.g. "2024-01-02" for DAY. Each call appends a new gzip member to the file, and it can be read as a single gzip stream. The file is not uploaded to BigQuery.
 func (x *Client) Insert(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema, data []any) error {
-	fname := fmt.Sprintf("%s.%s.log", datasetID, tableID)
-	fpath := filepath.Join(x.outDir, fname)
-	fd, err := os.OpenFile(fpath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	md, err := x.loadMetadata(datasetID, tableID)
 	if err != nil {
-		return goerr.Wrap(err, "failed to create file", goerr.V("file", fpath))
+		return err
+	}
+	var tp *bigquery.TimePartitioning
+	if md != nil {
+		tp = md.TimePartitioning
 	}
 
-	encoder := json.NewEncoder(fd)
+	partitions := make(map[string]*bytes.Buffer)
 	for _, record := range data {
-		if err := encoder.Encode(record); err != nil {
-			_ = fd.Close()
+		raw, err := json.Marshal(record)
+		if err != nil {
 			return goerr.Wrap(err, "failed to encode record", goerr.V("record", record))
 		}
+
+		partition := partitionOf(tp, raw)
+		buf, ok := partitions[partition]
+		if !ok {
+			buf = &bytes.Buffer{}
+			partitions[partition] = buf
+		}
+		buf.Write(raw)
+		buf.WriteByte('\n')
+	}
+
+	keys := make([]string, 0, len(partitions))
+	for k := range partitions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, partition := range keys {
+		if err := appendGzip(x.dataPath(datasetID, tableID, partition), partitions[partition].Bytes()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// partitionOf returns partition name of the record. TIMESTAMP value of the partitioning field is UNIX time in microseconds as the format of Storage Write API, or RFC3339 string.
+func partitionOf(tp *bigquery.TimePartitioning, raw []byte) string {
+	if tp == nil {
+		return types.BQUnpartitioned
+	}
+	field := tp.Field
+	if field == "" {
+		return types.BQUnpartitioned
+	}
+
+	var record map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return types.BQUnpartitioned
+	}
+
+	var ts time.Time
+	switch v := record[field].(type) {
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil {
+			return types.BQUnpartitioned
+		}
+		ts = time.UnixMicro(n)
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return types.BQUnpartitioned
+		}
+		ts = t
+	default:
+		return types.BQUnpartitioned
+	}
+
+	return types.PartitionName(tp.Type, ts)
+}
+
+func appendGzip(fpath string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return goerr.Wrap(err, "failed to create directory", goerr.V("dir", filepath.Dir(fpath)))
+	}
+
+	fd, err := os.OpenFile(fpath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return goerr.Wrap(err, "failed to create file", goerr.V("file", fpath))
+	}
+
+	gw := gzip.NewWriter(fd)
+	if _, err := gw.Write(data); err != nil {
+		_ = fd.Close()
+		return goerr.Wrap(err, "failed to write data", goerr.V("file", fpath))
+	}
+	if err := gw.Close(); err != nil {
+		_ = fd.Close()
+		return goerr.Wrap(err, "failed to flush data", goerr.V("file", fpath))
 	}
 
 	if err := fd.Close(); err != nil {
 		return goerr.Wrap(err, "failed to close file", goerr.V("file", fpath))
 	}
-
 	return nil
 }
 
@@ -72,34 +250,73 @@ func (x *Client) Query(ctx context.Context, query string) (interfaces.BigQueryIt
 	panic("unimplemented, must not be called in dumper")
 }
 
-// UpdateSchema implements interfaces.BigQuery. It writes schema to a file in JSON format. The file name is "{outDir}/{dataset}.{table}.schema.json". If the file does not exist, it creates a new file. If the file exists, it overwrites the file. The file is not uploaded to BigQuery.
+// UpdateTable implements interfaces.BigQuery. It overwrites schema and metadata files with the update. The files are not uploaded to BigQuery.
 func (x *Client) UpdateTable(ctx context.Context, dataset types.BQDatasetID, table types.BQTableID, md bigquery.TableMetadataToUpdate, eTag string) error {
-	return dumpSchema(x.outDir, dataset, table, md.Schema)
-}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
 
-func dumpSchema(dir string, dataset types.BQDatasetID, table types.BQTableID, schema bigquery.Schema) error {
-	fname := fmt.Sprintf("%s.%s.schema.json", dataset, table)
-	fpath := filepath.Join(dir, fname)
-	fd, err := os.Create(fpath)
-	if err != nil {
-		return goerr.Wrap(err, "failed to create file", goerr.V("file", fpath))
+	if md.Schema != nil {
+		if err := dumpSchema(x.schemaPath(dataset, table), md.Schema); err != nil {
+			return err
+		}
 	}
 
+	var meta tableMetadata
+	if err := readJSON(x.metadataPath(dataset, table), &meta); err != nil {
+		return err
+	}
+	if md.Description != nil {
+		if s, ok := md.Description.(string); ok {
+			meta.Description = s
+		}
+	}
+	if md.TimePartitioning != nil {
+		meta.TimePartitioning = md.TimePartitioning
+	}
+	if md.Clustering != nil {
+		meta.Clustering = md.Clustering
+	}
+
+	return writeJSON(x.metadataPath(dataset, table), &meta)
+}
+
+func dumpSchema(fpath string, schema bigquery.Schema) error {
 	raw, err := schema.ToJSONFields()
 	if err != nil {
-		_ = fd.Close()
 		return goerr.Wrap(err, "failed to convert schema to JSON fields")
 	}
 
-	if _, err := fd.Write(raw); err != nil {
-		_ = fd.Close()
+	if err := os.WriteFile(fpath, raw, 0644); err != nil {
 		return goerr.Wrap(err, "failed to write schema", goerr.V("file", fpath))
 	}
 
-	if err := fd.Close(); err != nil {
-		return goerr.Wrap(err, "failed to close file", goerr.V("file", fpath))
+	return nil
+}
+
+// readJSON decodes JSON file to v. Nothing is done if the file does not exist.
+func readJSON(fpath string, v any) error {
+	raw, err := os.ReadFile(fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return goerr.Wrap(err, "failed to read file", goerr.V("file", fpath))
 	}
 
+	if err := json.Unmarshal(raw, v); err != nil {
+		return goerr.Wrap(err, "failed to decode file", goerr.V("file", fpath))
+	}
+	return nil
+}
+
+func writeJSON(fpath string, v any) error {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return goerr.Wrap(err, "failed to encode", goerr.V("file", fpath))
+	}
+
+	if err := os.WriteFile(fpath, raw, 0644); err != nil {
+		return goerr.Wrap(err, "failed to write file", goerr.V("file", fpath))
+	}
 	return nil
 }
 
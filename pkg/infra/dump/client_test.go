@@ -1,12 +1,15 @@
 package dump_test
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/bigquery"
 	"github.com/m-mizutani/gt"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 	"github.com/secmon-lab/swarm/pkg/infra/dump"
@@ -33,26 +36,110 @@ func TestClient_Insert(t *testing.T) {
 	err = client.Insert(ctx, types.BQDatasetID("my_dataset"), types.BQTableID("my_table"), nil, data)
 	gt.NoError(t, err)
 
-	// Verify the inserted data
-	fname := "my_dataset.my_table.log"
-	fpath := filepath.Join(tmpDir, fname)
+	// Verify the inserted data. The table has no time partitioning.
+	records := readRecords(t, filepath.Join(tmpDir, "my_dataset.my_table", "dt=__UNPARTITIONED__.ndjson.gz"))
+
+	expectedRecords := []interface{}{
+		map[string]interface{}{"name": "Alice", "age": float64(25)},
+		map[string]interface{}{"name": "Bob", "age": float64(30)},
+	}
+
+	gt.Equal(t, records, expectedRecords)
+}
+
+func readRecords(t *testing.T, fpath string) []interface{} {
 	fd, err := os.Open(fpath)
 	gt.NoError(t, err)
 	defer func() { _ = fd.Close() }()
 
-	decoder := json.NewDecoder(fd)
+	gr, err := gzip.NewReader(fd)
+	gt.NoError(t, err)
+
+	decoder := json.NewDecoder(gr)
 	var records []interface{}
 	for decoder.More() {
 		var record interface{}
-		err := decoder.Decode(&record)
-		gt.NoError(t, err)
+		gt.NoError(t, decoder.Decode(&record))
 		records = append(records, record)
 	}
+	return records
+}
 
-	expectedRecords := []interface{}{
-		map[string]interface{}{"name": "Alice", "age": float64(25)},
-		map[string]interface{}{"name": "Bob", "age": float64(30)},
+func TestClient_Partition(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "timestamp", Type: bigquery.TimestampFieldType},
 	}
 
-	gt.Equal(t, records, expectedRecords)
+	client := dump.New(tmpDir)
+	gt.NoError(t, client.CreateTable(ctx, "my_dataset", "my_table", &bigquery.TableMetadata{
+		Schema: schema,
+		TimePartitioning: &bigquery.TimePartitioning{
+			Field: "timestamp",
+			Type:  bigquery.DayPartitioningType,
+		},
+	}))
+
+	day1 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixMicro()
+	day2 := time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC).UnixMicro()
+	gt.NoError(t, client.Insert(ctx, "my_dataset", "my_table", schema, []any{
+		map[string]any{"id": "a", "timestamp": day1},
+		map[string]any{"id": "b", "timestamp": day2},
+	}))
+
+	// Rows inserted by stream are appended to the same files
+	stream := gt.R1(client.NewStream(ctx, "my_dataset", "my_table", schema)).NoError(t)
+	gt.NoError(t, stream.Insert(ctx, []any{
+		map[string]any{"id": "c", "timestamp": day1},
+		map[string]any{"id": "d"},
+	}))
+	gt.NoError(t, stream.Close())
+
+	gt.A(t, readRecords(t, filepath.Join(tmpDir, "my_dataset.my_table", "dt=2024-01-02.ndjson.gz"))).Length(2)
+	gt.A(t, readRecords(t, filepath.Join(tmpDir, "my_dataset.my_table", "dt=2024-01-03.ndjson.gz"))).Length(1)
+	gt.A(t, readRecords(t, filepath.Join(tmpDir, "my_dataset.my_table", "dt=__UNPARTITIONED__.ndjson.gz"))).Length(1)
+}
+
+func TestClient_Metadata(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+
+	t.Run("table does not exist", func(t *testing.T) {
+		md := gt.R1(dump.New(tmpDir).GetMetadata(ctx, "my_dataset", "my_table")).NoError(t)
+		gt.Nil(t, md)
+	})
+
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+	}
+	gt.NoError(t, dump.New(tmpDir).CreateTable(ctx, "my_dataset", "my_table", &bigquery.TableMetadata{
+		Schema: schema,
+		TimePartitioning: &bigquery.TimePartitioning{
+			Field: "timestamp",
+			Type:  bigquery.MonthPartitioningType,
+		},
+	}))
+
+	// Metadata is reloaded by another client, e.g. next run
+	client := dump.New(tmpDir)
+	md := gt.R1(client.GetMetadata(ctx, "my_dataset", "my_table")).NoError(t)
+	gt.A(t, md.Schema).Length(1)
+	gt.Equal(t, md.TimePartitioning.Type, bigquery.MonthPartitioningType)
+	gt.Equal(t, md.TimePartitioning.Field, "timestamp")
+
+	updated := append(md.Schema, &bigquery.FieldSchema{Name: "name", Type: bigquery.StringFieldType})
+	gt.NoError(t, client.UpdateTable(ctx, "my_dataset", "my_table", bigquery.TableMetadataToUpdate{Schema: updated}, md.ETag))
+
+	// Update without schema keeps the current schema
+	gt.NoError(t, client.UpdateTable(ctx, "my_dataset", "my_table", bigquery.TableMetadataToUpdate{
+		Clustering: &bigquery.Clustering{Fields: []string{"id"}},
+	}, md.ETag))
+
+	md = gt.R1(dump.New(tmpDir).GetMetadata(ctx, "my_dataset", "my_table")).NoError(t)
+	gt.A(t, md.Schema).Length(2)
+	gt.Equal(t, md.Clustering.Fields, []string{"id"})
+	gt.Equal(t, md.TimePartitioning.Type, bigquery.MonthPartitioningType)
 }
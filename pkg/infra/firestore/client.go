@@ -90,6 +90,35 @@ func (x *Client) UpdateState(ctx context.Context, msgType types.MsgType, id stri
 	return nil
 }
 
+// enqueueCheckpointCollection is a collection of checkpoints of enqueue.
+const enqueueCheckpointCollection = "enqueue_checkpoint"
+
+// GetEnqueueCheckpoint returns the checkpoint of enqueue.
+func (x *Client) GetEnqueueCheckpoint(ctx context.Context, id string) (*model.EnqueueCheckpoint, error) {
+	doc, err := x.client.Collection(enqueueCheckpointCollection).Doc(id).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, goerr.Wrap(types.ErrCheckpointNotFound, "checkpoint not found", goerr.V("id", id))
+		}
+		return nil, goerr.Wrap(err, "failed to get checkpoint", goerr.V("id", id))
+	}
+
+	var checkpoint model.EnqueueCheckpoint
+	if err := doc.DataTo(&checkpoint); err != nil {
+		return nil, goerr.Wrap(err, "failed to unmarshal checkpoint", goerr.V("id", id))
+	}
+
+	return &checkpoint, nil
+}
+
+// PutEnqueueCheckpoint saves the checkpoint of enqueue.
+func (x *Client) PutEnqueueCheckpoint(ctx context.Context, checkpoint *model.EnqueueCheckpoint) error {
+	if _, err := x.client.Collection(enqueueCheckpointCollection).Doc(checkpoint.ID).Set(ctx, checkpoint); err != nil {
+		return goerr.Wrap(err, "failed to put checkpoint", goerr.V("id", checkpoint.ID))
+	}
+	return nil
+}
+
 func New(ctx context.Context, projectID string, databaseID string) (*Client, error) {
 	client, err := firestore.NewClientWithDatabase(ctx, projectID, databaseID)
 	if err != nil {
@@ -110,4 +139,7 @@ func (x *Client) Close() error {
 	return nil
 }
 
-var _ interfaces.Database = &Client{}
+var (
+	_ interfaces.Database        = &Client{}
+	_ interfaces.CheckpointStore = &Client{}
+)
@@ -0,0 +1,413 @@
+package lake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/google/uuid"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/bq/record"
+)
+
+// Client is a data lake sink that implements interfaces.BigQuery. Instead of BigQuery tables, it writes rows to Hive style partitioned files under the root directory. Schema of a table and its history are tracked in a manifest file of the table.
+//
+//	{root}/{dataset}/{table}/_manifest.json
+//	{root}/{dataset}/{table}/dt={partition}/part-v{schema version}-{timestamp}-{id}.parquet
+//
+// Files are never appended. Each insertion creates new files, and a file is written to a temporary file and renamed, so readers never see a partially written file. A bucket of object storage can be used by mounting it to the root directory.
+type Client struct {
+	root   string
+	format types.LakeFormat
+
+	// tables has a lock of manifest for each table directory. mutex guards tables.
+	tables map[string]*sync.Mutex
+	mutex  sync.Mutex
+}
+
+var _ interfaces.BigQuery = &Client{}
+
+type Option func(*Client)
+
+// WithFormat sets file format of rows. Default is types.ParquetFormat.
+func WithFormat(format types.LakeFormat) Option {
+	return func(x *Client) {
+		x.format = format
+	}
+}
+
+// New returns a new data lake sink that writes files under root.
+func New(root string, options ...Option) *Client {
+	client := &Client{
+		root:   filepath.Clean(root),
+		format: types.ParquetFormat,
+		tables: make(map[string]*sync.Mutex),
+	}
+	for _, opt := range options {
+		opt(client)
+	}
+	return client
+}
+
+// Close implements io.Closer. Nothing to do because files are closed by each insertion.
+func (x *Client) Close() error {
+	return nil
+}
+
+func (x *Client) tableDir(datasetID types.BQDatasetID, tableID types.BQTableID) string {
+	return filepath.Join(x.root, datasetID.String(), tableID.String())
+}
+
+// lockTable locks manifest of the table directory and returns a function to unlock it. Tables are locked separately, so that writing a table does not block others.
+func (x *Client) lockTable(dir string) func() {
+	x.mutex.Lock()
+	m, ok := x.tables[dir]
+	if !ok {
+		m = &sync.Mutex{}
+		x.tables[dir] = m
+	}
+	x.mutex.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
+
+// GetDataset implements interfaces.BigQuery. All datasets are regarded as existing in data lake.
+func (x *Client) GetDataset(ctx context.Context, datasetID types.BQDatasetID) (*bigquery.DatasetMetadata, error) {
+	return &bigquery.DatasetMetadata{}, nil
+}
+
+// CreateDataset implements interfaces.BigQuery. Nothing to do in data lake.
+func (x *Client) CreateDataset(ctx context.Context, datasetID types.BQDatasetID, md *bigquery.DatasetMetadata) error {
+	return nil
+}
+
+// CreateTable implements interfaces.BigQuery. It creates manifest of the table with the first schema version.
+func (x *Client) CreateTable(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, md *bigquery.TableMetadata) error {
+	dir := x.tableDir(datasetID, tableID)
+	defer x.lockTable(dir)()
+
+	current, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	if current != nil {
+		return goerr.Wrap(types.ErrTableAlreadyExists, "table already exists", goerr.V("dataset", datasetID), goerr.V("table", tableID))
+	}
+
+	m := &manifest{
+		DatasetID:        datasetID,
+		TableID:          tableID,
+		Description:      md.Description,
+		TimePartitioning: md.TimePartitioning,
+		Clustering:       md.Clustering,
+	}
+	if err := m.addVersion(md.Schema); err != nil {
+		return err
+	}
+
+	return writeManifest(dir, m)
+}
+
+// GetMetadata implements interfaces.BigQuery. Schema is the latest version in the manifest, and ETag is the version number. If the manifest does not exist, it returns nil as the table does not exist.
+func (x *Client) GetMetadata(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID) (*bigquery.TableMetadata, error) {
+	dir := x.tableDir(datasetID, tableID)
+	defer x.lockTable(dir)()
+
+	m, err := readManifest(dir)
+	if err != nil || m == nil {
+		return nil, err
+	}
+
+	schema, err := m.schema()
+	if err != nil {
+		return nil, err
+	}
+
+	return &bigquery.TableMetadata{
+		Name:             tableID.String(),
+		FullID:           fmt.Sprintf("%s.%s", datasetID, tableID),
+		Schema:           schema,
+		Description:      m.Description,
+		TimePartitioning: m.TimePartitioning,
+		Clustering:       m.Clustering,
+		ETag:             strconv.Itoa(m.version()),
+	}, nil
+}
+
+// UpdateTable implements interfaces.BigQuery. A new schema version is added to the manifest if the schema is updated. The update is rejected if eTag is not empty and does not match the current version.
+func (x *Client) UpdateTable(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, md bigquery.TableMetadataToUpdate, eTag string) error {
+	dir := x.tableDir(datasetID, tableID)
+	defer x.lockTable(dir)()
+
+	m, err := readManifest(dir)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return goerr.Wrap(types.ErrTableNotFound, "table not found", goerr.V("dataset", datasetID), goerr.V("table", tableID))
+	}
+	if eTag != "" && eTag != strconv.Itoa(m.version()) {
+		return goerr.Wrap(types.ErrETagMismatch, "table is modified by another process",
+			goerr.V("dataset", datasetID),
+			goerr.V("table", tableID),
+			goerr.V("etag", eTag),
+			goerr.V("current", m.version()),
+		)
+	}
+
+	if md.Schema != nil {
+		if err := m.addVersion(md.Schema); err != nil {
+			return err
+		}
+	}
+	if md.Description != nil {
+		if s, ok := md.Description.(string); ok {
+			m.Description = s
+		}
+	}
+	if md.TimePartitioning != nil {
+		m.TimePartitioning = md.TimePartitioning
+	}
+	if md.Clustering != nil {
+		m.Clustering = md.Clustering
+	}
+
+	return writeManifest(dir, m)
+}
+
+// Insert implements interfaces.BigQuery. Rows are converted to types of the latest schema in the manifest, split by time partitioning of the table, and written to a new file for each partition. A field that does not exist in the schema is rejected as same as Storage Write API.
+//
+// The table is locked only while reading the manifest. Files are written without the lock because each file has a unique name with the schema version that is read.
+func (x *Client) Insert(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema, data []any) error {
+	dir := x.tableDir(datasetID, tableID)
+	m, err := x.readTableManifest(dir)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return goerr.Wrap(types.ErrTableNotFound, "table not found", goerr.V("dataset", datasetID), goerr.V("table", tableID))
+	}
+	tableSchema, err := m.schema()
+	if err != nil {
+		return err
+	}
+
+	partitions := make(map[string][]map[string]any)
+	for _, v := range data {
+		row, err := record.Convert(tableSchema, v)
+		if err != nil {
+			return goerr.Wrap(err, "failed to convert data", goerr.V("dataset", datasetID), goerr.V("table", tableID))
+		}
+
+		partition := partitionOf(m.TimePartitioning, row)
+		partitions[partition] = append(partitions[partition], row)
+	}
+
+	keys := make([]string, 0, len(partitions))
+	for k := range partitions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, partition := range keys {
+		fname := fmt.Sprintf("part-v%d-%d-%s.%s", m.version(), time.Now().UnixNano(), uuid.NewString()[:8], x.extension())
+		fpath := filepath.Join(dir, "dt="+partition, fname)
+		if err := x.writeFile(fpath, tableSchema, partitions[partition]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readTableManifest reads manifest of the table directory with the lock of the table.
+func (x *Client) readTableManifest(dir string) (*manifest, error) {
+	defer x.lockTable(dir)()
+	return readManifest(dir)
+}
+
+func (x *Client) extension() string {
+	if x.format == types.NDJSONFormat {
+		return "ndjson.gz"
+	}
+	return "parquet"
+}
+
+// writeFile writes rows to a temporary file and renames it to fpath.
+func (x *Client) writeFile(fpath string, schema bigquery.Schema, rows []map[string]any) error {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return goerr.Wrap(err, "failed to create directory", goerr.V("dir", filepath.Dir(fpath)))
+	}
+
+	tmp := filepath.Join(filepath.Dir(fpath), "."+filepath.Base(fpath)+".tmp")
+	fd, err := os.Create(tmp)
+	if err != nil {
+		return goerr.Wrap(err, "failed to create file", goerr.V("file", tmp))
+	}
+
+	var writeErr error
+	switch x.format {
+	case types.NDJSONFormat:
+		writeErr = writeNDJSON(fd, rows)
+	default:
+		writeErr = writeParquet(fd, schema, rows)
+	}
+	if writeErr != nil {
+		_ = fd.Close()
+		_ = os.Remove(tmp)
+		return goerr.Wrap(writeErr, "failed to write rows", goerr.V("file", fpath))
+	}
+
+	if err := fd.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return goerr.Wrap(err, "failed to close file", goerr.V("file", tmp))
+	}
+	if err := os.Rename(tmp, fpath); err != nil {
+		_ = os.Remove(tmp)
+		return goerr.Wrap(err, "failed to rename file", goerr.V("from", tmp), goerr.V("to", fpath))
+	}
+
+	return nil
+}
+
+// partitionOf returns partition name of the row converted by record.Convert.
+func partitionOf(tp *bigquery.TimePartitioning, row map[string]any) string {
+	if tp == nil || tp.Field == "" {
+		return types.BQUnpartitioned
+	}
+	ts, ok := row[tp.Field].(time.Time)
+	if !ok {
+		return types.BQUnpartitioned
+	}
+	return types.PartitionName(tp.Type, ts)
+}
+
+// NewStream implements interfaces.BigQuery. Rows inserted to the stream are written in the same way as Insert.
+func (x *Client) NewStream(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema) (interfaces.BigQueryStream, error) {
+	return &Stream{
+		client:    x,
+		datasetID: datasetID,
+		tableID:   tableID,
+		schema:    schema,
+	}, nil
+}
+
+type Stream struct {
+	client    *Client
+	datasetID types.BQDatasetID
+	tableID   types.BQTableID
+	schema    bigquery.Schema
+}
+
+func (x *Stream) Insert(ctx context.Context, data []any) error {
+	return x.client.Insert(ctx, x.datasetID, x.tableID, x.schema, data)
+}
+
+func (x *Stream) Close() error {
+	return nil
+}
+
+// Query implements interfaces.BigQuery. Query is not supported in data lake. Use a query engine that reads Hive partitioned files, e.g. DuckDB, instead.
+func (x *Client) Query(ctx context.Context, query string) (interfaces.BigQueryIterator, error) {
+	return nil, goerr.Wrap(types.ErrUnsupportedQuery, "query is not supported in data lake", goerr.V("query", query))
+}
+
+// manifest is metadata of a table saved in "_manifest.json" of the table directory.
+type manifest struct {
+	DatasetID        types.BQDatasetID          `json:"dataset_id"`
+	TableID          types.BQTableID            `json:"table_id"`
+	Description      string                     `json:"description,omitempty"`
+	TimePartitioning *bigquery.TimePartitioning `json:"time_partitioning,omitempty"`
+	Clustering       *bigquery.Clustering       `json:"clustering,omitempty"`
+
+	// Versions is history of table schema. The last one is the current schema.
+	Versions []*schemaVersion `json:"versions"`
+}
+
+type schemaVersion struct {
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"created_at"`
+	Schema    json.RawMessage `json:"schema"`
+}
+
+func (x *manifest) version() int {
+	if len(x.Versions) == 0 {
+		return 0
+	}
+	return x.Versions[len(x.Versions)-1].Version
+}
+
+func (x *manifest) schema() (bigquery.Schema, error) {
+	if len(x.Versions) == 0 {
+		return nil, nil
+	}
+	schema, err := bigquery.SchemaFromJSON(x.Versions[len(x.Versions)-1].Schema)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to parse schema in manifest", goerr.V("dataset", x.DatasetID), goerr.V("table", x.TableID))
+	}
+	return schema, nil
+}
+
+func (x *manifest) addVersion(schema bigquery.Schema) error {
+	raw, err := schema.ToJSONFields()
+	if err != nil {
+		return goerr.Wrap(err, "failed to convert schema to JSON fields")
+	}
+	x.Versions = append(x.Versions, &schemaVersion{
+		Version:   x.version() + 1,
+		CreatedAt: time.Now().UTC(),
+		Schema:    raw,
+	})
+	return nil
+}
+
+const manifestFile = "_manifest.json"
+
+// readManifest returns manifest in dir. It returns nil if the manifest does not exist.
+func readManifest(dir string) (*manifest, error) {
+	fpath := filepath.Join(dir, manifestFile)
+	raw, err := os.ReadFile(fpath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, goerr.Wrap(err, "failed to read manifest", goerr.V("file", fpath))
+	}
+
+	var m manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, goerr.Wrap(err, "failed to decode manifest", goerr.V("file", fpath))
+	}
+	return &m, nil
+}
+
+func writeManifest(dir string, m *manifest) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return goerr.Wrap(err, "failed to create directory", goerr.V("dir", dir))
+	}
+
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return goerr.Wrap(err, "failed to encode manifest")
+	}
+
+	fpath := filepath.Join(dir, manifestFile)
+	tmp := filepath.Join(dir, "."+manifestFile+".tmp")
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return goerr.Wrap(err, "failed to write manifest", goerr.V("file", tmp))
+	}
+	if err := os.Rename(tmp, fpath); err != nil {
+		return goerr.Wrap(err, "failed to rename manifest", goerr.V("from", tmp), goerr.V("to", fpath))
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package lake_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/gt"
+	"github.com/parquet-go/parquet-go"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/lake"
+)
+
+var testSchema = bigquery.Schema{
+	{Name: "id", Type: bigquery.StringFieldType},
+	{Name: "timestamp", Type: bigquery.TimestampFieldType},
+	{Name: "count", Type: bigquery.IntegerFieldType},
+	{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+	{Name: "data", Type: bigquery.JSONFieldType},
+	{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	}},
+}
+
+func createTable(t *testing.T, client *lake.Client) {
+	gt.NoError(t, client.CreateTable(context.Background(), "my_dataset", "my_table", &bigquery.TableMetadata{
+		Schema: testSchema,
+		TimePartitioning: &bigquery.TimePartitioning{
+			Field: "timestamp",
+			Type:  bigquery.DayPartitioningType,
+		},
+	}))
+}
+
+func findFiles(t *testing.T, dir, pattern string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, pattern))
+	gt.NoError(t, err)
+	return files
+}
+
+func TestClient_Parquet(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	client := lake.New(root)
+	createTable(t, client)
+
+	day1 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	day2 := time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC)
+	gt.NoError(t, client.Insert(ctx, "my_dataset", "my_table", testSchema, []any{
+		map[string]any{"id": "a", "timestamp": day1.UnixMicro(), "count": 1, "tags": []string{"x", "y"}, "data": `{"k":"v"}`, "user": map[string]any{"name": "alice"}},
+		map[string]any{"id": "b", "timestamp": day1.UnixMicro()},
+		map[string]any{"id": "c", "timestamp": day2.UnixMicro()},
+	}))
+
+	tableDir := filepath.Join(root, "my_dataset", "my_table")
+	files := findFiles(t, tableDir, "dt=2024-01-02/part-v1-*.parquet")
+	gt.A(t, files).Length(1)
+	gt.A(t, findFiles(t, tableDir, "dt=2024-01-03/*.parquet")).Length(1)
+
+	fd := gt.R1(os.Open(files[0])).NoError(t)
+	defer func() { _ = fd.Close() }()
+	reader := parquet.NewReader(fd)
+	gt.Equal(t, reader.NumRows(), 2)
+
+	row := map[string]any{}
+	gt.NoError(t, reader.Read(&row))
+	gt.Equal(t, row["id"], any("a"))
+	gt.Equal(t, row["count"], any(int64(1)))
+	gt.Equal(t, row["timestamp"], any(day1.UnixMicro()))
+	gt.Equal(t, row["tags"], any([]any{"x", "y"}))
+	gt.Equal(t, row["user"], any(map[string]any{"name": "alice"}))
+
+	t.Run("unknown field is rejected", func(t *testing.T) {
+		err := client.Insert(ctx, "my_dataset", "my_table", testSchema, []any{
+			map[string]any{"id": "d", "unknown": 1},
+		})
+		gt.Error(t, err).Is(types.ErrSchemaNotMatched)
+	})
+
+	t.Run("table not found", func(t *testing.T) {
+		err := client.Insert(ctx, "my_dataset", "no_table", testSchema, []any{map[string]any{"id": "d"}})
+		gt.Error(t, err).Is(types.ErrTableNotFound)
+	})
+}
+
+func TestClient_NDJSON(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	client := lake.New(root, lake.WithFormat(types.NDJSONFormat))
+	createTable(t, client)
+
+	stream := gt.R1(client.NewStream(ctx, "my_dataset", "my_table", testSchema)).NoError(t)
+	gt.NoError(t, stream.Insert(ctx, []any{
+		map[string]any{"id": "a", "count": 1},
+	}))
+	gt.NoError(t, stream.Close())
+
+	files := findFiles(t, filepath.Join(root, "my_dataset", "my_table"), "dt=__UNPARTITIONED__/part-v1-*.ndjson.gz")
+	gt.A(t, files).Length(1)
+
+	fd := gt.R1(os.Open(files[0])).NoError(t)
+	defer func() { _ = fd.Close() }()
+	gr := gt.R1(gzip.NewReader(fd)).NoError(t)
+	var row map[string]any
+	gt.NoError(t, json.NewDecoder(gr).Decode(&row))
+	gt.Equal(t, row["id"], any("a"))
+	gt.Equal(t, row["count"], any(float64(1)))
+}
+
+func TestClient_Manifest(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	client := lake.New(root)
+
+	md := gt.R1(client.GetMetadata(ctx, "my_dataset", "my_table")).NoError(t)
+	gt.Nil(t, md)
+
+	createTable(t, client)
+	gt.Error(t, client.CreateTable(ctx, "my_dataset", "my_table", &bigquery.TableMetadata{Schema: testSchema})).Is(types.ErrTableAlreadyExists)
+
+	md = gt.R1(client.GetMetadata(ctx, "my_dataset", "my_table")).NoError(t)
+	gt.Equal(t, md.ETag, "1")
+	gt.A(t, md.Schema).Length(len(testSchema))
+
+	updated := append(md.Schema, &bigquery.FieldSchema{Name: "name", Type: bigquery.StringFieldType})
+	gt.NoError(t, client.UpdateTable(ctx, "my_dataset", "my_table", bigquery.TableMetadataToUpdate{Schema: updated}, md.ETag))
+	gt.Error(t, client.UpdateTable(ctx, "my_dataset", "my_table", bigquery.TableMetadataToUpdate{Schema: updated}, md.ETag)).Is(types.ErrETagMismatch)
+
+	// Manifest is reloaded by another client
+	md = gt.R1(lake.New(root).GetMetadata(ctx, "my_dataset", "my_table")).NoError(t)
+	gt.Equal(t, md.ETag, "2")
+	gt.A(t, md.Schema).Length(len(testSchema) + 1)
+	gt.Equal(t, md.TimePartitioning.Type, bigquery.DayPartitioningType)
+
+	// New field can be inserted, and the file has the new schema version
+	gt.NoError(t, client.Insert(ctx, "my_dataset", "my_table", updated, []any{
+		map[string]any{"id": "a", "name": "blue"},
+	}))
+	gt.A(t, findFiles(t, filepath.Join(root, "my_dataset", "my_table"), "dt=__UNPARTITIONED__/part-v2-*.parquet")).Length(1)
+
+	raw := gt.R1(os.ReadFile(filepath.Join(root, "my_dataset", "my_table", "_manifest.json"))).NoError(t)
+	var manifest struct {
+		Versions []struct {
+			Version int             `json:"version"`
+			Schema  json.RawMessage `json:"schema"`
+		} `json:"versions"`
+	}
+	gt.NoError(t, json.Unmarshal(raw, &manifest))
+	gt.A(t, manifest.Versions).Length(2)
+	gt.Equal(t, manifest.Versions[1].Version, 2)
+}
+
+func TestClient_ConcurrentInsert(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	client := lake.New(root)
+
+	tables := []types.BQTableID{"table_a", "table_b"}
+	for _, tableID := range tables {
+		gt.NoError(t, client.CreateTable(ctx, "my_dataset", tableID, &bigquery.TableMetadata{Schema: testSchema}))
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	for _, tableID := range tables {
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				gt.NoError(t, client.Insert(ctx, "my_dataset", tableID, testSchema, []any{
+					map[string]any{"id": fmt.Sprintf("%s-%d", tableID, i)},
+				}))
+			}()
+		}
+	}
+
+	// Schema is updated while rows are inserted
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		updated := append(bigquery.Schema{}, testSchema...)
+		updated = append(updated, &bigquery.FieldSchema{Name: "name", Type: bigquery.StringFieldType})
+		gt.NoError(t, client.UpdateTable(ctx, "my_dataset", "table_a", bigquery.TableMetadataToUpdate{Schema: updated}, ""))
+	}()
+	wg.Wait()
+
+	for _, tableID := range tables {
+		files := findFiles(t, filepath.Join(root, "my_dataset", tableID.String()), "dt=__UNPARTITIONED__/part-v*.parquet")
+		gt.A(t, files).Length(n)
+		for _, file := range files {
+			fd := gt.R1(os.Open(file)).NoError(t)
+			gt.Equal(t, parquet.NewReader(fd).NumRows(), 1)
+			gt.NoError(t, fd.Close())
+		}
+	}
+
+	md := gt.R1(client.GetMetadata(ctx, "my_dataset", "table_a")).NoError(t)
+	gt.Equal(t, md.ETag, "2")
+}
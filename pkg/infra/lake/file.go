@@ -0,0 +1,74 @@
+package lake
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetSchema converts BigQuery schema to Parquet schema. All fields except REPEATED are OPTIONAL in Parquet, and types that have no counterpart in Parquet, e.g. DATE and GEOGRAPHY, are written as STRING.
+func parquetSchema(schema bigquery.Schema) *parquet.Schema {
+	return parquet.NewSchema("row", parquetGroup(schema))
+}
+
+func parquetGroup(schema bigquery.Schema) parquet.Group {
+	group := make(parquet.Group, len(schema))
+	for _, f := range schema {
+		group[f.Name] = parquetNode(f)
+	}
+	return group
+}
+
+func parquetNode(f *bigquery.FieldSchema) parquet.Node {
+	var node parquet.Node
+	switch f.Type {
+	case bigquery.IntegerFieldType:
+		node = parquet.Int(64)
+	case bigquery.FloatFieldType, bigquery.NumericFieldType, bigquery.BigNumericFieldType:
+		node = parquet.Leaf(parquet.DoubleType)
+	case bigquery.BooleanFieldType:
+		node = parquet.Leaf(parquet.BooleanType)
+	case bigquery.TimestampFieldType:
+		node = parquet.Timestamp(parquet.Microsecond)
+	case bigquery.JSONFieldType:
+		node = parquet.JSON()
+	case bigquery.RecordFieldType:
+		node = parquetGroup(f.Schema)
+	default:
+		node = parquet.String()
+	}
+
+	if f.Repeated {
+		return parquet.Repeated(node)
+	}
+	return parquet.Optional(node)
+}
+
+func writeParquet(w io.Writer, schema bigquery.Schema, rows []map[string]any) error {
+	pw := parquet.NewGenericWriter[map[string]any](w, parquetSchema(schema))
+	if _, err := pw.Write(rows); err != nil {
+		return goerr.Wrap(err, "failed to write parquet rows")
+	}
+	if err := pw.Close(); err != nil {
+		return goerr.Wrap(err, "failed to close parquet writer")
+	}
+	return nil
+}
+
+func writeNDJSON(w io.Writer, rows []map[string]any) error {
+	gw := gzip.NewWriter(w)
+	encoder := json.NewEncoder(gw)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return goerr.Wrap(err, "failed to encode row")
+		}
+	}
+	if err := gw.Close(); err != nil {
+		return goerr.Wrap(err, "failed to close gzip writer")
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/bq/record"
+)
+
+// Client is an in-memory implementation of interfaces.BigQuery. It keeps datasets, tables and inserted rows in memory, and rejects invalid operations in the same way as BigQuery, e.g. changing type of an existing column. It is for tests and local demos.
+type Client struct {
+	datasets map[types.BQDatasetID]*dataset
+	etag     int
+	implicit bool
+
+	mutex sync.RWMutex
+}
+
+var _ interfaces.BigQuery = &Client{}
+
+type dataset struct {
+	md     *bigquery.DatasetMetadata
+	tables map[types.BQTableID]*table
+}
+
+type table struct {
+	md   *bigquery.TableMetadata
+	rows []map[string]any
+}
+
+type Option func(*Client)
+
+// WithImplicitDataset makes datasets exist implicitly. Otherwise, a dataset must be created by CreateDataset before creating a table in it.
+func WithImplicitDataset() Option {
+	return func(x *Client) {
+		x.implicit = true
+	}
+}
+
+// WithDataset creates empty datasets in advance.
+func WithDataset(datasetIDs ...types.BQDatasetID) Option {
+	return func(x *Client) {
+		for _, id := range datasetIDs {
+			x.datasets[id] = newDataset(&bigquery.DatasetMetadata{})
+		}
+	}
+}
+
+func New(options ...Option) *Client {
+	client := &Client{
+		datasets: make(map[types.BQDatasetID]*dataset),
+	}
+	for _, opt := range options {
+		opt(client)
+	}
+	return client
+}
+
+func newDataset(md *bigquery.DatasetMetadata) *dataset {
+	return &dataset{
+		md:     md,
+		tables: make(map[types.BQTableID]*table),
+	}
+}
+
+// Close implements io.Closer. Nothing to do in memory.
+func (x *Client) Close() error {
+	return nil
+}
+
+func (x *Client) nextETag() string {
+	x.etag++
+	return strconv.Itoa(x.etag)
+}
+
+// lookupDataset returns dataset. If implicit dataset is enabled, a dataset that is not created yet is returned as an empty one without saving it, so that it can be called with read lock.
+func (x *Client) lookupDataset(datasetID types.BQDatasetID) *dataset {
+	ds, ok := x.datasets[datasetID]
+	if !ok && x.implicit {
+		return newDataset(&bigquery.DatasetMetadata{})
+	}
+	return ds
+}
+
+// ensureDataset returns dataset to add a table. If implicit dataset is enabled, a dataset is created on demand. It must be called with write lock.
+func (x *Client) ensureDataset(datasetID types.BQDatasetID) *dataset {
+	ds, ok := x.datasets[datasetID]
+	if !ok && x.implicit {
+		ds = newDataset(&bigquery.DatasetMetadata{})
+		x.datasets[datasetID] = ds
+	}
+	return ds
+}
+
+// lookupTable returns table. It must be called with lock.
+func (x *Client) lookupTable(datasetID types.BQDatasetID, tableID types.BQTableID) (*table, error) {
+	ds := x.lookupDataset(datasetID)
+	if ds == nil {
+		return nil, goerr.Wrap(types.ErrDatasetNotFound, "dataset not found", goerr.V("dataset", datasetID))
+	}
+	tbl, ok := ds.tables[tableID]
+	if !ok {
+		return nil, goerr.Wrap(types.ErrTableNotFound, "table not found", goerr.V("dataset", datasetID), goerr.V("table", tableID))
+	}
+	return tbl, nil
+}
+
+// GetDataset implements interfaces.BigQuery.
+func (x *Client) GetDataset(ctx context.Context, datasetID types.BQDatasetID) (*bigquery.DatasetMetadata, error) {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	ds := x.lookupDataset(datasetID)
+	if ds == nil {
+		return nil, nil
+	}
+	md := *ds.md
+	return &md, nil
+}
+
+// CreateDataset implements interfaces.BigQuery. It does not return error if the dataset exists, as same as bq.Client.
+func (x *Client) CreateDataset(ctx context.Context, datasetID types.BQDatasetID, md *bigquery.DatasetMetadata) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if _, ok := x.datasets[datasetID]; ok {
+		return nil
+	}
+
+	copied := bigquery.DatasetMetadata{}
+	if md != nil {
+		copied = *md
+	}
+	copied.ETag = x.nextETag()
+	copied.CreationTime = time.Now()
+	copied.LastModifiedTime = copied.CreationTime
+	x.datasets[datasetID] = newDataset(&copied)
+	return nil
+}
+
+// CreateTable implements interfaces.BigQuery.
+func (x *Client) CreateTable(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, md *bigquery.TableMetadata) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	ds := x.ensureDataset(datasetID)
+	if ds == nil {
+		return goerr.Wrap(types.ErrDatasetNotFound, "dataset not found", goerr.V("dataset", datasetID))
+	}
+	if _, ok := ds.tables[tableID]; ok {
+		return goerr.Wrap(types.ErrTableAlreadyExists, "table already exists", goerr.V("dataset", datasetID), goerr.V("table", tableID))
+	}
+
+	copied := bigquery.TableMetadata{}
+	if md != nil {
+		copied = *md
+	}
+	if err := validateNewSchema(copied.Schema, nil); err != nil {
+		return err
+	}
+	copied.Schema = copySchema(copied.Schema)
+	copied.FullID = datasetID.String() + "." + tableID.String()
+	copied.ETag = x.nextETag()
+	copied.CreationTime = time.Now()
+	copied.LastModifiedTime = copied.CreationTime
+	copied.Type = bigquery.RegularTable
+
+	ds.tables[tableID] = &table{md: &copied}
+	return nil
+}
+
+// GetMetadata implements interfaces.BigQuery. If the table does not exist, it returns nil.
+func (x *Client) GetMetadata(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID) (*bigquery.TableMetadata, error) {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	tbl, err := x.lookupTable(datasetID, tableID)
+	if err != nil {
+		return nil, nil
+	}
+
+	md := *tbl.md
+	md.Schema = copySchema(tbl.md.Schema)
+	md.NumRows = uint64(len(tbl.rows))
+	return &md, nil
+}
+
+// UpdateTable implements interfaces.BigQuery. The update is rejected if eTag is not empty and does not match, or the schema change is not allowed in BigQuery.
+func (x *Client) UpdateTable(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, md bigquery.TableMetadataToUpdate, eTag string) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	tbl, err := x.lookupTable(datasetID, tableID)
+	if err != nil {
+		return err
+	}
+	if eTag != "" && eTag != tbl.md.ETag {
+		return goerr.Wrap(types.ErrETagMismatch, "table is modified by another process",
+			goerr.V("dataset", datasetID),
+			goerr.V("table", tableID),
+			goerr.V("etag", eTag),
+			goerr.V("current", tbl.md.ETag),
+		)
+	}
+
+	updated := *tbl.md
+	if md.Schema != nil {
+		if err := validateSchemaChange(tbl.md.Schema, md.Schema, nil); err != nil {
+			return goerr.Wrap(err, "invalid schema update", goerr.V("dataset", datasetID), goerr.V("table", tableID))
+		}
+		updated.Schema = copySchema(md.Schema)
+	}
+	if md.Description != nil {
+		updated.Description = md.Description.(string)
+	}
+	if md.Clustering != nil {
+		updated.Clustering = md.Clustering
+	}
+	if md.TimePartitioning != nil {
+		updated.TimePartitioning = md.TimePartitioning
+	}
+	if md.RequirePartitionFilter != nil {
+		updated.RequirePartitionFilter = md.RequirePartitionFilter.(bool)
+	}
+	if !md.ExpirationTime.IsZero() {
+		updated.ExpirationTime = md.ExpirationTime
+	}
+	updated.Labels = updateLabels(tbl.md.Labels, md)
+
+	updated.ETag = x.nextETag()
+	updated.LastModifiedTime = time.Now()
+	tbl.md = &updated
+	return nil
+}
+
+// updateLabels applies labels set by TableMetadataToUpdate.SetLabel and DeleteLabel. They are not exported, so they are read by reflection.
+func updateLabels(current map[string]string, md bigquery.TableMetadataToUpdate) map[string]string {
+	v := reflect.ValueOf(md)
+	setLabels := v.FieldByName("setLabels")
+	deleteLabels := v.FieldByName("deleteLabels")
+	if (!setLabels.IsValid() || setLabels.Len() == 0) && (!deleteLabels.IsValid() || deleteLabels.Len() == 0) {
+		return current
+	}
+
+	labels := make(map[string]string, len(current))
+	for k, v := range current {
+		labels[k] = v
+	}
+	if setLabels.IsValid() {
+		iter := setLabels.MapRange()
+		for iter.Next() {
+			labels[iter.Key().String()] = iter.Value().String()
+		}
+	}
+	if deleteLabels.IsValid() {
+		iter := deleteLabels.MapRange()
+		for iter.Next() {
+			delete(labels, iter.Key().String())
+		}
+	}
+	return labels
+}
+
+// Insert implements interfaces.BigQuery. Rows are converted to types of the table schema. A field that does not exist in the table is rejected as same as Storage Write API.
+func (x *Client) Insert(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema, data []any) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	tbl, err := x.lookupTable(datasetID, tableID)
+	if err != nil {
+		return err
+	}
+
+	rows := make([]map[string]any, 0, len(data))
+	for _, v := range data {
+		row, err := record.Convert(tbl.md.Schema, v)
+		if err != nil {
+			return goerr.Wrap(err, "failed to convert data", goerr.V("dataset", datasetID), goerr.V("table", tableID))
+		}
+		rows = append(rows, row)
+	}
+	tbl.rows = append(tbl.rows, rows...)
+	return nil
+}
+
+// Rows returns copy of rows in the table. It is for testing.
+func (x *Client) Rows(datasetID types.BQDatasetID, tableID types.BQTableID) ([]map[string]any, error) {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	ds, ok := x.datasets[datasetID]
+	if !ok {
+		return nil, goerr.Wrap(types.ErrDatasetNotFound, "dataset not found", goerr.V("dataset", datasetID))
+	}
+	tbl, ok := ds.tables[tableID]
+	if !ok {
+		return nil, goerr.Wrap(types.ErrTableNotFound, "table not found", goerr.V("dataset", datasetID), goerr.V("table", tableID))
+	}
+
+	rows := make([]map[string]any, len(tbl.rows))
+	copy(rows, tbl.rows)
+	return rows, nil
+}
+
+// NewStream implements interfaces.BigQuery.
+func (x *Client) NewStream(ctx context.Context, datasetID types.BQDatasetID, tableID types.BQTableID, schema bigquery.Schema) (interfaces.BigQueryStream, error) {
+	return &Stream{
+		client:    x,
+		datasetID: datasetID,
+		tableID:   tableID,
+		schema:    schema,
+	}, nil
+}
+
+type Stream struct {
+	client    *Client
+	datasetID types.BQDatasetID
+	tableID   types.BQTableID
+	schema    bigquery.Schema
+}
+
+func (x *Stream) Insert(ctx context.Context, data []any) error {
+	return x.client.Insert(ctx, x.datasetID, x.tableID, x.schema, data)
+}
+
+func (x *Stream) Close() error {
+	return nil
+}
@@ -0,0 +1,234 @@
+package memory_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/memory"
+	"google.golang.org/api/iterator"
+)
+
+func TestClient_Table(t *testing.T) {
+	ctx := context.Background()
+	client := memory.New()
+
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType, Required: true},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+	}
+
+	t.Run("dataset is required", func(t *testing.T) {
+		err := client.CreateTable(ctx, "my_dataset", "my_table", &bigquery.TableMetadata{Schema: schema})
+		gt.Error(t, err).Is(types.ErrDatasetNotFound)
+	})
+
+	gt.NoError(t, client.CreateDataset(ctx, "my_dataset", &bigquery.DatasetMetadata{Location: "US"}))
+	gt.NoError(t, client.CreateTable(ctx, "my_dataset", "my_table", &bigquery.TableMetadata{Schema: schema}))
+
+	t.Run("table already exists", func(t *testing.T) {
+		err := client.CreateTable(ctx, "my_dataset", "my_table", &bigquery.TableMetadata{Schema: schema})
+		gt.Error(t, err).Is(types.ErrTableAlreadyExists)
+	})
+
+	md := gt.R1(client.GetMetadata(ctx, "my_dataset", "my_table")).NoError(t)
+	gt.NotEqual(t, md.ETag, "")
+	gt.A(t, md.Schema).Length(2)
+
+	t.Run("add nullable field", func(t *testing.T) {
+		updated := append(bigquery.Schema{}, md.Schema...)
+		updated = append(updated, &bigquery.FieldSchema{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+		}})
+		gt.NoError(t, client.UpdateTable(ctx, "my_dataset", "my_table", bigquery.TableMetadataToUpdate{Schema: updated}, md.ETag))
+
+		current := gt.R1(client.GetMetadata(ctx, "my_dataset", "my_table")).NoError(t)
+		gt.A(t, current.Schema).Length(3)
+		gt.NotEqual(t, current.ETag, md.ETag)
+
+		t.Run("stale etag is rejected", func(t *testing.T) {
+			err := client.UpdateTable(ctx, "my_dataset", "my_table", bigquery.TableMetadataToUpdate{Schema: updated}, md.ETag)
+			gt.Error(t, err).Is(types.ErrETagMismatch)
+		})
+	})
+
+	t.Run("invalid schema changes are rejected", func(t *testing.T) {
+		testCases := map[string]bigquery.Schema{
+			"remove field": {
+				{Name: "id", Type: bigquery.StringFieldType, Required: true},
+			},
+			"change type": {
+				{Name: "id", Type: bigquery.StringFieldType, Required: true},
+				{Name: "count", Type: bigquery.StringFieldType},
+			},
+			"change to repeated": {
+				{Name: "id", Type: bigquery.StringFieldType, Required: true},
+				{Name: "count", Type: bigquery.IntegerFieldType, Repeated: true},
+			},
+			"add required field": {
+				{Name: "id", Type: bigquery.StringFieldType, Required: true},
+				{Name: "count", Type: bigquery.IntegerFieldType},
+				{Name: "name", Type: bigquery.StringFieldType, Required: true},
+			},
+		}
+
+		for title, schema := range testCases {
+			t.Run(title, func(t *testing.T) {
+				current := gt.R1(client.GetMetadata(ctx, "my_dataset", "my_table")).NoError(t)
+				schema := append(schema, current.Schema[2:]...)
+				err := client.UpdateTable(ctx, "my_dataset", "my_table", bigquery.TableMetadataToUpdate{Schema: schema}, "")
+				gt.Error(t, err).Is(types.ErrInvalidSchemaChange)
+			})
+		}
+	})
+
+	t.Run("table not found", func(t *testing.T) {
+		md := gt.R1(client.GetMetadata(ctx, "my_dataset", "no_table")).NoError(t)
+		gt.Nil(t, md)
+	})
+}
+
+func TestClient_Query(t *testing.T) {
+	ctx := context.Background()
+	client := memory.New(memory.WithImplicitDataset())
+
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "timestamp", Type: bigquery.TimestampFieldType},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+		{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+		}},
+	}
+	gt.NoError(t, client.CreateTable(ctx, "src", "logs", &bigquery.TableMetadata{Schema: schema}))
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	gt.NoError(t, client.Insert(ctx, "src", "logs", schema, []any{
+		map[string]any{"id": "a", "timestamp": ts.UnixMicro(), "count": 1, "user": map[string]any{"name": "alice"}},
+		map[string]any{"id": "b", "timestamp": ts.UnixMicro(), "count": 2},
+		map[string]any{"id": "c", "timestamp": ts.UnixMicro(), "count": 2, "user": map[string]any{"name": "carol"}},
+	}))
+
+	t.Run("unknown field is rejected", func(t *testing.T) {
+		err := client.Insert(ctx, "src", "logs", schema, []any{map[string]any{"id": "x", "unknown": 1}})
+		gt.Error(t, err).Is(types.ErrSchemaNotMatched)
+	})
+
+	queryAll := func(t *testing.T, query string) []map[string]bigquery.Value {
+		iter := gt.R1(client.Query(ctx, query)).NoError(t)
+		var rows []map[string]bigquery.Value
+		for {
+			var row map[string]bigquery.Value
+			err := iter.Next(&row)
+			if err == iterator.Done {
+				break
+			}
+			gt.NoError(t, err)
+			rows = append(rows, row)
+		}
+		return rows
+	}
+
+	t.Run("select all", func(t *testing.T) {
+		rows := queryAll(t, "SELECT * FROM `my-project.src.logs`")
+		gt.A(t, rows).Length(3)
+		gt.Equal(t, rows[0]["timestamp"], bigquery.Value(ts))
+		gt.Equal(t, rows[0]["count"], bigquery.Value(int64(1)))
+	})
+
+	t.Run("select columns with condition", func(t *testing.T) {
+		rows := queryAll(t, "SELECT id, user.name AS user_name FROM src.logs WHERE count = 2 AND user.name IS NOT NULL")
+		gt.A(t, rows).Length(1).At(0, func(t testing.TB, v map[string]bigquery.Value) {
+			gt.Equal(t, v["id"], bigquery.Value("c"))
+			gt.Equal(t, v["user_name"], bigquery.Value("carol"))
+		})
+	})
+
+	t.Run("count", func(t *testing.T) {
+		rows := queryAll(t, "select count(*) as n from `src.logs` where id != 'a'")
+		gt.A(t, rows).Length(1)
+		gt.Equal(t, rows[0]["n"], bigquery.Value(int64(2)))
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		rows := queryAll(t, "SELECT id FROM `src.logs` LIMIT 2")
+		gt.A(t, rows).Length(2)
+	})
+
+	t.Run("decode to slice in column order", func(t *testing.T) {
+		next := func(t *testing.T, query string) []bigquery.Value {
+			iter := gt.R1(client.Query(ctx, query)).NoError(t)
+			var row []bigquery.Value
+			gt.NoError(t, iter.Next(&row))
+			return row
+		}
+
+		for i := 0; i < 10; i++ {
+			gt.Equal(t, next(t, "SELECT count, user.name, id FROM `src.logs` WHERE id = 'a'"), []bigquery.Value{int64(1), "alice", "a"})
+			gt.Equal(t, next(t, "SELECT * FROM `src.logs` WHERE id = 'b'"), []bigquery.Value{"b", ts, int64(2), nil})
+		}
+		gt.Equal(t, next(t, "SELECT COUNT(*) FROM `src.logs`"), []bigquery.Value{int64(3)})
+	})
+
+	t.Run("decode to struct", func(t *testing.T) {
+		iter := gt.R1(client.Query(ctx, "SELECT id, count FROM `src.logs` WHERE id = 'a'")).NoError(t)
+		var row struct {
+			ID    string `json:"id"`
+			Count int64  `json:"count"`
+		}
+		gt.NoError(t, iter.Next(&row))
+		gt.Equal(t, row.ID, "a")
+		gt.Equal(t, row.Count, 1)
+		gt.Equal(t, iter.Next(&row), iterator.Done)
+	})
+
+	t.Run("insert select", func(t *testing.T) {
+		gt.NoError(t, client.CreateTable(ctx, "dst", "logs", &bigquery.TableMetadata{Schema: schema}))
+		gt.R1(client.Query(ctx, "INSERT `my-project.dst.logs` SELECT * FROM `my-project.src.logs`")).NoError(t)
+
+		rows := gt.R1(client.Rows("dst", "logs")).NoError(t)
+		gt.A(t, rows).Length(3)
+	})
+
+	t.Run("unsupported query", func(t *testing.T) {
+		_, err := client.Query(ctx, "SELECT id FROM `src.logs` GROUP BY id")
+		gt.Error(t, err).Is(types.ErrUnsupportedQuery)
+	})
+}
+
+func TestClient_QueryConcurrentImplicitDataset(t *testing.T) {
+	ctx := context.Background()
+	client := memory.New(memory.WithImplicitDataset())
+	schema := bigquery.Schema{{Name: "id", Type: bigquery.StringFieldType}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		datasetID := types.BQDatasetID(fmt.Sprintf("ds_%d", i))
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, err := client.Query(ctx, fmt.Sprintf("SELECT id FROM `%s.logs`", datasetID))
+				if err != nil {
+					gt.Error(t, err).Is(types.ErrTableNotFound)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			gt.NoError(t, client.CreateTable(ctx, datasetID, "logs", &bigquery.TableMetadata{Schema: schema}))
+			gt.NoError(t, client.Insert(ctx, datasetID, "logs", schema, []any{map[string]any{"id": "a"}}))
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 8; i++ {
+		rows := gt.R1(client.Rows(types.BQDatasetID(fmt.Sprintf("ds_%d", i)), "logs")).NoError(t)
+		gt.A(t, rows).Length(1)
+	}
+}
@@ -0,0 +1,394 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"google.golang.org/api/iterator"
+)
+
+// Query implements interfaces.BigQuery. It supports a small subset of SQL:
+//
+//	SELECT <* | COUNT(*) | column [AS alias], ...> FROM `[project.]dataset.table` [WHERE <condition> [AND ...]] [LIMIT n]
+//	INSERT [INTO] `[project.]dataset.table` SELECT ...
+//
+// A column can be a dot separated path of RECORD fields. A condition is `column = value`, `column != value`, `column IS NULL` or `column IS NOT NULL`, and value is a quoted string, a number, TRUE or FALSE.
+func (x *Client) Query(ctx context.Context, query string) (interfaces.BigQueryIterator, error) {
+	if m := insertPattern.FindStringSubmatch(query); m != nil {
+		return x.insertSelect(m[1], m[2])
+	}
+
+	stmt, err := parseSelect(query)
+	if err != nil {
+		return nil, err
+	}
+
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	rows, columns, err := x.execSelect(stmt)
+	if err != nil {
+		return nil, err
+	}
+	return &Iterator{rows: rows, columns: columns}, nil
+}
+
+var (
+	insertPattern = regexp.MustCompile(`(?is)^\s*INSERT\s+(?:INTO\s+)?(\S+)\s+(SELECT\s.+)$`)
+	selectPattern = regexp.MustCompile(`(?is)^\s*SELECT\s+(.+?)\s+FROM\s+(\S+)(?:\s+WHERE\s+(.+?))?(?:\s+LIMIT\s+(\d+))?\s*;?\s*$`)
+	columnPattern = regexp.MustCompile(`(?i)^([A-Za-z_][A-Za-z0-9_.]*|COUNT\(\*\))(?:\s+AS\s+([A-Za-z_][A-Za-z0-9_]*))?$`)
+	condPattern   = regexp.MustCompile(`(?is)^([A-Za-z_][A-Za-z0-9_.]*)\s*(?:(=|!=|<>)\s*(.+)|IS\s+(NOT\s+)?NULL)$`)
+	andPattern    = regexp.MustCompile(`(?i)\s+AND\s+`)
+)
+
+type selectStmt struct {
+	columns    []selectColumn
+	count      bool
+	datasetID  types.BQDatasetID
+	tableID    types.BQTableID
+	conditions []condition
+	limit      int
+}
+
+type selectColumn struct {
+	path []string
+	name string
+}
+
+type condition struct {
+	path  []string
+	op    string
+	value any
+}
+
+func parseTableRef(ref string) (types.BQDatasetID, types.BQTableID, error) {
+	parts := strings.Split(strings.Trim(ref, "`"), ".")
+	switch len(parts) {
+	case 2:
+		return types.BQDatasetID(parts[0]), types.BQTableID(parts[1]), nil
+	case 3:
+		return types.BQDatasetID(parts[1]), types.BQTableID(parts[2]), nil
+	default:
+		return "", "", goerr.Wrap(types.ErrUnsupportedQuery, "invalid table reference", goerr.V("table", ref))
+	}
+}
+
+func parseSelect(query string) (*selectStmt, error) {
+	m := selectPattern.FindStringSubmatch(query)
+	if m == nil {
+		return nil, goerr.Wrap(types.ErrUnsupportedQuery, "query is not supported in memory", goerr.V("query", query))
+	}
+
+	datasetID, tableID, err := parseTableRef(m[2])
+	if err != nil {
+		return nil, err
+	}
+	stmt := &selectStmt{datasetID: datasetID, tableID: tableID}
+
+	for _, col := range strings.Split(m[1], ",") {
+		col = strings.TrimSpace(col)
+		if col == "*" {
+			stmt.columns = append(stmt.columns, selectColumn{})
+			continue
+		}
+
+		cm := columnPattern.FindStringSubmatch(col)
+		if cm == nil {
+			return nil, goerr.Wrap(types.ErrUnsupportedQuery, "unsupported column", goerr.V("column", col))
+		}
+		if strings.EqualFold(cm[1], "COUNT(*)") {
+			stmt.count = true
+			name := cm[2]
+			if name == "" {
+				name = "f0_"
+			}
+			stmt.columns = append(stmt.columns, selectColumn{name: name})
+			continue
+		}
+
+		path := strings.Split(cm[1], ".")
+		name := cm[2]
+		if name == "" {
+			name = path[len(path)-1]
+		}
+		stmt.columns = append(stmt.columns, selectColumn{path: path, name: name})
+	}
+	if stmt.count && len(stmt.columns) > 1 {
+		return nil, goerr.Wrap(types.ErrUnsupportedQuery, "COUNT(*) can not be used with other columns", goerr.V("query", query))
+	}
+
+	if m[3] != "" {
+		for _, cond := range andPattern.Split(strings.TrimSpace(m[3]), -1) {
+			c, err := parseCondition(strings.TrimSpace(cond))
+			if err != nil {
+				return nil, err
+			}
+			stmt.conditions = append(stmt.conditions, c)
+		}
+	}
+
+	if m[4] != "" {
+		limit, err := strconv.Atoi(m[4])
+		if err != nil {
+			return nil, goerr.Wrap(types.ErrUnsupportedQuery, "invalid limit", goerr.V("limit", m[4]))
+		}
+		stmt.limit = limit
+	}
+
+	return stmt, nil
+}
+
+func parseCondition(cond string) (condition, error) {
+	m := condPattern.FindStringSubmatch(cond)
+	if m == nil {
+		return condition{}, goerr.Wrap(types.ErrUnsupportedQuery, "unsupported condition", goerr.V("condition", cond))
+	}
+
+	c := condition{path: strings.Split(m[1], ".")}
+	if m[2] == "" {
+		c.op = "IS NULL"
+		if m[4] != "" {
+			c.op = "IS NOT NULL"
+		}
+		return c, nil
+	}
+
+	c.op = m[2]
+	if c.op == "<>" {
+		c.op = "!="
+	}
+
+	literal := strings.TrimSpace(m[3])
+	switch {
+	case len(literal) >= 2 && (literal[0] == '\'' || literal[0] == '"') && literal[len(literal)-1] == literal[0]:
+		c.value = literal[1 : len(literal)-1]
+	case strings.EqualFold(literal, "TRUE"):
+		c.value = true
+	case strings.EqualFold(literal, "FALSE"):
+		c.value = false
+	default:
+		n, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			return condition{}, goerr.Wrap(types.ErrUnsupportedQuery, "unsupported literal", goerr.V("literal", literal))
+		}
+		c.value = n
+	}
+	return c, nil
+}
+
+// execSelect returns result rows of stmt and their column names in the selected order. It must be called with lock.
+func (x *Client) execSelect(stmt *selectStmt) ([]map[string]bigquery.Value, []string, error) {
+	tbl, err := x.lookupTable(stmt.datasetID, stmt.tableID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var columns []string
+	for _, col := range stmt.columns {
+		switch {
+		case stmt.count:
+			columns = append(columns, col.name)
+		case col.path == nil:
+			for _, f := range tbl.md.Schema {
+				columns = append(columns, f.Name)
+			}
+		case lookupField(tbl.md.Schema, col.path) == nil:
+			return nil, nil, goerr.Wrap(types.ErrUnsupportedQuery, "column not found", goerr.V("column", strings.Join(col.path, ".")))
+		default:
+			columns = append(columns, col.name)
+		}
+	}
+	for _, c := range stmt.conditions {
+		if lookupField(tbl.md.Schema, c.path) == nil {
+			return nil, nil, goerr.Wrap(types.ErrUnsupportedQuery, "column not found", goerr.V("column", strings.Join(c.path, ".")))
+		}
+	}
+
+	var matched []map[string]any
+	for _, row := range tbl.rows {
+		if matchConditions(row, stmt.conditions) {
+			matched = append(matched, row)
+		}
+	}
+
+	if stmt.count {
+		return []map[string]bigquery.Value{{stmt.columns[0].name: int64(len(matched))}}, columns, nil
+	}
+
+	if stmt.limit > 0 && len(matched) > stmt.limit {
+		matched = matched[:stmt.limit]
+	}
+
+	results := make([]map[string]bigquery.Value, 0, len(matched))
+	for _, row := range matched {
+		result := map[string]bigquery.Value{}
+		for _, col := range stmt.columns {
+			if col.path == nil {
+				for k, v := range row {
+					result[k] = v
+				}
+				continue
+			}
+			result[col.name] = lookupValue(row, col.path)
+		}
+		results = append(results, result)
+	}
+	return results, columns, nil
+}
+
+func (x *Client) insertSelect(target, query string) (interfaces.BigQueryIterator, error) {
+	stmt, err := parseSelect(query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.count {
+		return nil, goerr.Wrap(types.ErrUnsupportedQuery, "COUNT(*) can not be inserted", goerr.V("query", query))
+	}
+	datasetID, tableID, err := parseTableRef(target)
+	if err != nil {
+		return nil, err
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	rows, _, err := x.execSelect(stmt)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := x.lookupTable(datasetID, tableID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		for key := range row {
+			if lookupField(dst.md.Schema, []string{key}) == nil {
+				return nil, goerr.Wrap(types.ErrSchemaNotMatched, "field does not exist in destination table", goerr.V("field", key))
+			}
+		}
+	}
+	for _, row := range rows {
+		inserted := make(map[string]any, len(row))
+		for k, v := range row {
+			inserted[k] = v
+		}
+		dst.rows = append(dst.rows, inserted)
+	}
+
+	return &Iterator{}, nil
+}
+
+func lookupField(schema bigquery.Schema, path []string) *bigquery.FieldSchema {
+	for _, f := range schema {
+		if f.Name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return f
+		}
+		return lookupField(f.Schema, path[1:])
+	}
+	return nil
+}
+
+func lookupValue(row map[string]any, path []string) any {
+	v, ok := row[path[0]]
+	if !ok {
+		return nil
+	}
+	if len(path) == 1 {
+		return v
+	}
+	if obj, ok := v.(map[string]any); ok {
+		return lookupValue(obj, path[1:])
+	}
+	return nil
+}
+
+func matchConditions(row map[string]any, conditions []condition) bool {
+	for _, c := range conditions {
+		v := lookupValue(row, c.path)
+		switch c.op {
+		case "IS NULL":
+			if v != nil {
+				return false
+			}
+		case "IS NOT NULL":
+			if v == nil {
+				return false
+			}
+		case "=":
+			if v == nil || !equalValue(v, c.value) {
+				return false
+			}
+		case "!=":
+			if v == nil || equalValue(v, c.value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func equalValue(v, literal any) bool {
+	switch t := v.(type) {
+	case int64:
+		n, ok := literal.(float64)
+		return ok && float64(t) == n
+	case float64:
+		n, ok := literal.(float64)
+		return ok && t == n
+	case time.Time:
+		s, ok := literal.(string)
+		if !ok {
+			return false
+		}
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		return err == nil && ts.Equal(t)
+	default:
+		return v == literal
+	}
+}
+
+// Iterator is result of Query. Next accepts *map[string]bigquery.Value, *[]bigquery.Value or a pointer of struct that is decoded by JSON. Values of *[]bigquery.Value are ordered as selected columns, and `*` is expanded in order of the table schema.
+type Iterator struct {
+	rows    []map[string]bigquery.Value
+	columns []string
+}
+
+func (x *Iterator) Next(dst interface{}) error {
+	if len(x.rows) == 0 {
+		return iterator.Done
+	}
+	row := x.rows[0]
+	x.rows = x.rows[1:]
+
+	switch t := dst.(type) {
+	case *map[string]bigquery.Value:
+		*t = row
+	case *[]bigquery.Value:
+		values := make([]bigquery.Value, 0, len(x.columns))
+		for _, name := range x.columns {
+			values = append(values, row[name])
+		}
+		*t = values
+	default:
+		raw, err := json.Marshal(row)
+		if err != nil {
+			return goerr.Wrap(err, "failed to marshal row")
+		}
+		if err := json.Unmarshal(raw, dst); err != nil {
+			return goerr.Wrap(err, "failed to unmarshal row", goerr.V("row", string(raw)))
+		}
+	}
+	return nil
+}
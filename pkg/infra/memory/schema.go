@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+)
+
+func copySchema(schema bigquery.Schema) bigquery.Schema {
+	if schema == nil {
+		return nil
+	}
+	copied := make(bigquery.Schema, len(schema))
+	for i, f := range schema {
+		field := *f
+		field.Schema = copySchema(f.Schema)
+		copied[i] = &field
+	}
+	return copied
+}
+
+// validateNewSchema checks that field names are unique and RECORD has sub fields.
+func validateNewSchema(schema bigquery.Schema, prefix []string) error {
+	names := make(map[string]struct{}, len(schema))
+	for _, f := range schema {
+		path := strings.Join(append(slices.Clone(prefix), f.Name), ".")
+		key := strings.ToLower(f.Name)
+		if _, ok := names[key]; ok {
+			return goerr.Wrap(types.ErrInvalidSchemaChange, "duplicated field name", goerr.V("field", path))
+		}
+		names[key] = struct{}{}
+
+		if f.Type == bigquery.RecordFieldType {
+			if len(f.Schema) == 0 {
+				return goerr.Wrap(types.ErrInvalidSchemaChange, "RECORD must have sub fields", goerr.V("field", path))
+			}
+			if err := validateNewSchema(f.Schema, append(slices.Clone(prefix), f.Name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateSchemaChange checks that the change from old to schema is allowed in BigQuery. Only addition of NULLABLE or REPEATED fields and relaxation from REQUIRED to NULLABLE are allowed.
+func validateSchemaChange(old, schema bigquery.Schema, prefix []string) error {
+	if err := validateNewSchema(schema, prefix); err != nil {
+		return err
+	}
+
+	for _, o := range old {
+		path := strings.Join(append(slices.Clone(prefix), o.Name), ".")
+		idx := slices.IndexFunc(schema, func(f *bigquery.FieldSchema) bool { return f.Name == o.Name })
+		if idx < 0 {
+			return goerr.Wrap(types.ErrInvalidSchemaChange, "field can not be removed", goerr.V("field", path))
+		}
+
+		f := schema[idx]
+		if f.Type != o.Type {
+			return goerr.Wrap(types.ErrInvalidSchemaChange, "type of field can not be changed",
+				goerr.V("field", path),
+				goerr.V("old", o.Type),
+				goerr.V("new", f.Type),
+			)
+		}
+		if f.Repeated != o.Repeated {
+			return goerr.Wrap(types.ErrInvalidSchemaChange, "mode of field can not be changed to or from REPEATED", goerr.V("field", path))
+		}
+		if f.Required && !o.Required {
+			return goerr.Wrap(types.ErrInvalidSchemaChange, "field can not be changed to REQUIRED", goerr.V("field", path))
+		}
+
+		if f.Type == bigquery.RecordFieldType {
+			if err := validateSchemaChange(o.Schema, f.Schema, append(slices.Clone(prefix), o.Name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, f := range schema {
+		if f.Required && !slices.ContainsFunc(old, func(o *bigquery.FieldSchema) bool { return o.Name == f.Name }) {
+			path := strings.Join(append(slices.Clone(prefix), f.Name), ".")
+			return goerr.Wrap(types.ErrInvalidSchemaChange, "REQUIRED field can not be added", goerr.V("field", path))
+		}
+	}
+
+	return nil
+}
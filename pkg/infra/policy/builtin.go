@@ -0,0 +1,375 @@
+package policy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/goerr"
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/open-policy-agent/opa/v1/types"
+)
+
+// builtin is a swarm specific built-in function for Rego.
+type builtin struct {
+	decl *rego.Function
+	impl func(x *Client, decl *rego.Function) func(*rego.Rego)
+}
+
+var builtins = []*builtin{
+	{
+		decl: &rego.Function{
+			Name:        "swarm.parse_time",
+			Description: "Parses a timestamp string with Go layout (or name of Go layout constant, `unix` and `unix_ms`) and returns UNIX time in seconds",
+			Decl:        types.NewFunction(types.Args(types.S, types.S), types.N),
+			Memoize:     true,
+		},
+		impl: func(x *Client, decl *rego.Function) func(*rego.Rego) {
+			return rego.Function2(decl, builtinParseTime)
+		},
+	},
+	{
+		decl: &rego.Function{
+			Name:        "swarm.hmac",
+			Description: "Returns hex encoded HMAC-SHA256 of a string with a key specified by name in configuration",
+			Decl:        types.NewFunction(types.Args(types.S, types.S), types.S),
+			Memoize:     true,
+		},
+		impl: func(x *Client, decl *rego.Function) func(*rego.Rego) {
+			return rego.Function2(decl, x.builtinHMAC)
+		},
+	},
+	{
+		decl: &rego.Function{
+			Name:        "swarm.cidr_lookup",
+			Description: "Returns a value of the most specific CIDR in an object (CIDR to value) that contains an IP address",
+			Decl:        types.NewFunction(types.Args(types.NewObject(nil, types.NewDynamicProperty(types.S, types.A)), types.S), types.A),
+		},
+		impl: func(x *Client, decl *rego.Function) func(*rego.Rego) {
+			return rego.Function2(decl, builtinCIDRLookup)
+		},
+	},
+	{
+		decl: &rego.Function{
+			Name:        "swarm.parse_user_agent",
+			Description: "Parses a User-Agent string and returns browser, OS and device",
+			Decl:        types.NewFunction(types.Args(types.S), types.NewObject(nil, types.NewDynamicProperty(types.S, types.A))),
+			Memoize:     true,
+		},
+		impl: func(x *Client, decl *rego.Function) func(*rego.Rego) {
+			return rego.Function1(decl, builtinParseUserAgent)
+		},
+	},
+	{
+		decl: &rego.Function{
+			Name:        "swarm.parse_url",
+			Description: "Parses a URL string and returns its components",
+			Decl:        types.NewFunction(types.Args(types.S), types.NewObject(nil, types.NewDynamicProperty(types.S, types.A))),
+			Memoize:     true,
+		},
+		impl: func(x *Client, decl *rego.Function) func(*rego.Rego) {
+			return rego.Function1(decl, builtinParseURL)
+		},
+	},
+}
+
+// builtinCapabilities returns capabilities of Rego including swarm built-in functions. It is required to compile policies that call them.
+func builtinCapabilities() *ast.Capabilities {
+	caps := ast.CapabilitiesForThisVersion()
+	for _, b := range builtins {
+		caps.Builtins = append(caps.Builtins, &ast.Builtin{
+			Name:        b.decl.Name,
+			Description: b.decl.Description,
+			Decl:        b.decl.Decl,
+		})
+	}
+	return caps
+}
+
+func (x *Client) builtinOptions() []func(*rego.Rego) {
+	options := make([]func(*rego.Rego), len(builtins))
+	for i, b := range builtins {
+		options[i] = b.impl(x, b.decl)
+	}
+	return options
+}
+
+func stringOperand(term *ast.Term, pos int) (string, error) {
+	s, ok := term.Value.(ast.String)
+	if !ok {
+		return "", goerr.New("operand must be string").With("pos", pos).With("type", ast.ValueName(term.Value))
+	}
+	return string(s), nil
+}
+
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+func builtinParseTime(_ rego.BuiltinContext, layoutTerm, valueTerm *ast.Term) (*ast.Term, error) {
+	layout, err := stringOperand(layoutTerm, 1)
+	if err != nil {
+		return nil, err
+	}
+	value, err := stringOperand(valueTerm, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	var ts time.Time
+	switch layout {
+	case "unix", "unix_ms":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, goerr.Wrap(err, "invalid UNIX time").With("value", value)
+		}
+		if layout == "unix_ms" {
+			n /= 1000
+		}
+		return ast.NumberTerm(json.Number(strconv.FormatFloat(n, 'f', -1, 64))), nil
+
+	default:
+		if named, ok := timeLayouts[layout]; ok {
+			layout = named
+		}
+		ts, err = time.Parse(layout, value)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to parse time").With("layout", layout).With("value", value)
+		}
+	}
+
+	// UnixNano overflows out of years 1678-2262, so seconds and nanoseconds are added separately
+	sec := float64(ts.Unix()) + float64(ts.Nanosecond())/float64(time.Second)
+	return ast.NumberTerm(json.Number(strconv.FormatFloat(sec, 'f', -1, 64))), nil
+}
+
+func (x *Client) builtinHMAC(_ rego.BuiltinContext, nameTerm, valueTerm *ast.Term) (*ast.Term, error) {
+	name, err := stringOperand(nameTerm, 1)
+	if err != nil {
+		return nil, err
+	}
+	value, err := stringOperand(valueTerm, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := x.hmacKeys[name]
+	if !ok {
+		return nil, goerr.New("HMAC key is not configured").With("name", name)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(value))
+	return ast.StringTerm(hex.EncodeToString(mac.Sum(nil))), nil
+}
+
+func builtinCIDRLookup(_ rego.BuiltinContext, tableTerm, ipTerm *ast.Term) (*ast.Term, error) {
+	table, ok := tableTerm.Value.(ast.Object)
+	if !ok {
+		return nil, goerr.New("operand must be object").With("pos", 1).With("type", ast.ValueName(tableTerm.Value))
+	}
+	ipStr, err := stringOperand(ipTerm, 2)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := netip.ParseAddr(ipStr)
+	if err != nil {
+		return nil, goerr.Wrap(err, "invalid IP address").With("ip", ipStr)
+	}
+	addr = addr.Unmap()
+
+	var found *ast.Term
+	bits := -1
+	if err := table.Iter(func(k, v *ast.Term) error {
+		s, ok := k.Value.(ast.String)
+		if !ok {
+			return nil
+		}
+		prefix, err := netip.ParsePrefix(string(s))
+		if err != nil {
+			return goerr.Wrap(err, "invalid CIDR").With("cidr", string(s))
+		}
+		if prefix.Contains(addr) && prefix.Bits() > bits {
+			found, bits = v, prefix.Bits()
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if found == nil {
+		return nil, nil // undefined
+	}
+	return found, nil
+}
+
+var (
+	uaProductRegex = regexp.MustCompile(`^([A-Za-z][\w.\-]*)/([\w.\-]+)`)
+	uaBotRegex     = regexp.MustCompile(`(?i)(bot|crawler|spider|slurp|curl/|wget/|python-requests|go-http-client)`)
+)
+
+// uaBrowsers is a list of browser token and name. Order matters because many browsers have tokens of other browsers, e.g. Edge has "Chrome/" and "Safari/".
+var uaBrowsers = []struct {
+	token string
+	name  string
+}{
+	{"Edg/", "Edge"},
+	{"Edge/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"Version/", "Safari"},
+	{"MSIE ", "IE"},
+	{"rv:", "IE"},
+}
+
+func uaVersion(ua, token string) string {
+	idx := strings.Index(ua, token)
+	if idx < 0 {
+		return ""
+	}
+	v := ua[idx+len(token):]
+	if end := strings.IndexAny(v, " ;)"); end >= 0 {
+		v = v[:end]
+	}
+	return v
+}
+
+func parseUserAgent(ua string) map[string]any {
+	result := map[string]any{
+		"browser":         "",
+		"browser_version": "",
+		"os":              "",
+		"os_version":      "",
+		"device":          "desktop",
+		"bot":             uaBotRegex.MatchString(ua),
+	}
+
+	for _, b := range uaBrowsers {
+		if b.name == "IE" && !strings.Contains(ua, "MSIE") && !strings.Contains(ua, "Trident/") {
+			continue
+		}
+		if strings.Contains(ua, b.token) {
+			result["browser"] = b.name
+			result["browser_version"] = uaVersion(ua, b.token)
+			break
+		}
+	}
+	if result["browser"] == "" {
+		if m := uaProductRegex.FindStringSubmatch(ua); m != nil && m[1] != "Mozilla" {
+			result["browser"] = m[1]
+			result["browser_version"] = m[2]
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "Windows NT "):
+		result["os"] = "Windows"
+		result["os_version"] = uaVersion(ua, "Windows NT ")
+	case strings.Contains(ua, "iPhone OS "), strings.Contains(ua, "CPU OS "):
+		result["os"] = "iOS"
+		v := uaVersion(ua, "iPhone OS ")
+		if v == "" {
+			v = uaVersion(ua, "CPU OS ")
+		}
+		result["os_version"] = strings.ReplaceAll(v, "_", ".")
+	case strings.Contains(ua, "Mac OS X"):
+		result["os"] = "macOS"
+		result["os_version"] = strings.ReplaceAll(uaVersion(ua, "Mac OS X "), "_", ".")
+	case strings.Contains(ua, "Android"):
+		result["os"] = "Android"
+		result["os_version"] = uaVersion(ua, "Android ")
+	case strings.Contains(ua, "CrOS"):
+		result["os"] = "ChromeOS"
+	case strings.Contains(ua, "Linux"):
+		result["os"] = "Linux"
+	}
+
+	switch {
+	case result["bot"] == true:
+		result["device"] = "bot"
+	case strings.Contains(ua, "iPad"), result["os"] == "Android" && !strings.Contains(ua, "Mobile"):
+		result["device"] = "tablet"
+	case strings.Contains(ua, "Mobile"), strings.Contains(ua, "iPhone"):
+		result["device"] = "mobile"
+	case result["os"] == "":
+		result["device"] = "other"
+	}
+
+	return result
+}
+
+func builtinParseUserAgent(_ rego.BuiltinContext, uaTerm *ast.Term) (*ast.Term, error) {
+	ua, err := stringOperand(uaTerm, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := ast.InterfaceToValue(parseUserAgent(ua))
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to convert user agent")
+	}
+	return ast.NewTerm(v), nil
+}
+
+func builtinParseURL(_ rego.BuiltinContext, urlTerm *ast.Term) (*ast.Term, error) {
+	s, err := stringOperand(urlTerm, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to parse URL").With("url", s)
+	}
+
+	query := map[string]any{}
+	for k, v := range u.Query() {
+		query[k] = v
+	}
+
+	result := map[string]any{
+		"scheme":    u.Scheme,
+		"user":      u.User.Username(),
+		"host":      u.Hostname(),
+		"port":      u.Port(),
+		"path":      u.Path,
+		"raw_query": u.RawQuery,
+		"query":     query,
+		"fragment":  u.Fragment,
+	}
+
+	v, err := ast.InterfaceToValue(result)
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to convert URL")
+	}
+	return ast.NewTerm(v), nil
+}
@@ -0,0 +1,192 @@
+package policy_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/infra/policy"
+)
+
+const builtinPolicy = `package test
+
+parse_time := swarm.parse_time(input.layout, input.time)
+
+hmac := swarm.hmac(input.key, input.value)
+
+cidr := swarm.cidr_lookup({
+	"10.0.0.0/8": "internal",
+	"10.1.0.0/16": "office",
+	"2001:db8::/32": "ipv6",
+}, input.ip)
+
+user_agent := swarm.parse_user_agent(input.ua)
+
+url := swarm.parse_url(input.url)
+`
+
+type builtinResult struct {
+	ParseTime *float64       `json:"parse_time"`
+	HMAC      *string        `json:"hmac"`
+	CIDR      *string        `json:"cidr"`
+	UserAgent map[string]any `json:"user_agent"`
+	URL       map[string]any `json:"url"`
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func queryBuiltin(t *testing.T, input map[string]any) builtinResult {
+	t.Helper()
+	client := gt.R1(policy.New(
+		policy.WithPolicyData("test.rego", builtinPolicy),
+		policy.WithHMACKey("user", []byte("secret")),
+	)).NoError(t)
+
+	var result builtinResult
+	gt.NoError(t, client.Query(context.Background(), "data.test", input, &result))
+	return result
+}
+
+func TestBuiltin_ParseTime(t *testing.T) {
+	testCases := map[string]struct {
+		layout string
+		time   string
+		expect *float64
+	}{
+		"Go layout": {
+			layout: "2006/01/02 15:04:05",
+			time:   "2024/01/02 03:04:05",
+			expect: ptr(1704164645.0),
+		},
+		"named layout with sub-second": {
+			layout: "RFC3339Nano",
+			time:   "2024-01-02T03:04:05.5Z",
+			expect: ptr(1704164645.5),
+		},
+		"unix_ms": {
+			layout: "unix_ms",
+			time:   "1704164645123",
+			expect: ptr(1704164645.123),
+		},
+		"year out of range of UnixNano": {
+			layout: "RFC3339",
+			time:   "2300-01-01T00:00:00Z",
+			expect: ptr(10413792000.0),
+		},
+		"year before range of UnixNano": {
+			layout: "RFC3339Nano",
+			time:   "1600-01-01T00:00:00.5Z",
+			expect: ptr(-11676096000 + 0.5),
+		},
+		"invalid time is undefined": {
+			layout: "RFC3339",
+			time:   "not a time",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result := queryBuiltin(t, map[string]any{"layout": tc.layout, "time": tc.time})
+			if tc.expect == nil {
+				gt.V(t, result.ParseTime).Nil()
+			} else {
+				gt.V(t, result.ParseTime).NotNil()
+				gt.N(t, *result.ParseTime).Equal(*tc.expect)
+			}
+		})
+	}
+}
+
+func TestBuiltin_HMAC(t *testing.T) {
+	result := queryBuiltin(t, map[string]any{"key": "user", "value": "alice@example.com"})
+	gt.V(t, result.HMAC).NotNil()
+	// echo -n alice@example.com | openssl dgst -sha256 -hmac secret
+	gt.V(t, *result.HMAC).Equal("a398d49ce1980b3642bc4dbd110121e3c953e1eadb497d50dea23e9611f83ee7")
+
+	unknown := queryBuiltin(t, map[string]any{"key": "unknown", "value": "alice@example.com"})
+	gt.V(t, unknown.HMAC).Nil()
+}
+
+func TestBuiltin_CIDRLookup(t *testing.T) {
+	testCases := map[string]struct {
+		ip     string
+		expect *string
+	}{
+		"most specific CIDR": {ip: "10.1.2.3", expect: ptr("office")},
+		"less specific CIDR": {ip: "10.2.0.1", expect: ptr("internal")},
+		"IPv6":               {ip: "2001:db8::1", expect: ptr("ipv6")},
+		"not found":          {ip: "192.168.0.1"},
+		"invalid IP":         {ip: "not an ip"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result := queryBuiltin(t, map[string]any{"ip": tc.ip})
+			gt.V(t, result.CIDR).Equal(tc.expect)
+		})
+	}
+}
+
+func TestBuiltin_ParseUserAgent(t *testing.T) {
+	testCases := map[string]struct {
+		ua     string
+		expect map[string]any
+	}{
+		"Chrome on Windows": {
+			ua: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			expect: map[string]any{
+				"browser": "Chrome", "browser_version": "120.0.0.0",
+				"os": "Windows", "os_version": "10.0",
+				"device": "desktop", "bot": false,
+			},
+		},
+		"Safari on iPhone": {
+			ua: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			expect: map[string]any{
+				"browser": "Safari", "browser_version": "17.1",
+				"os": "iOS", "os_version": "17.1",
+				"device": "mobile", "bot": false,
+			},
+		},
+		"Edge on macOS": {
+			ua: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.61",
+			expect: map[string]any{
+				"browser": "Edge", "browser_version": "120.0.2210.61",
+				"os": "macOS", "os_version": "10.15.7",
+				"device": "desktop", "bot": false,
+			},
+		},
+		"curl": {
+			ua: "curl/8.4.0",
+			expect: map[string]any{
+				"browser": "curl", "browser_version": "8.4.0",
+				"os": "", "os_version": "",
+				"device": "bot", "bot": true,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result := queryBuiltin(t, map[string]any{"ua": tc.ua})
+			gt.V(t, result.UserAgent).Equal(tc.expect)
+		})
+	}
+}
+
+func TestBuiltin_ParseURL(t *testing.T) {
+	result := queryBuiltin(t, map[string]any{"url": "https://user@example.com:8443/path/to?q=1&q=2&x=y#frag"})
+	gt.V(t, result.URL).Equal(map[string]any{
+		"scheme":    "https",
+		"user":      "user",
+		"host":      "example.com",
+		"port":      "8443",
+		"path":      "/path/to",
+		"raw_query": "q=1&q=2&x=y",
+		"query": map[string]any{
+			"q": []any{"1", "2"},
+			"x": []any{"y"},
+		},
+		"fragment": "frag",
+	})
+}
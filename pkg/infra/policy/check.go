@@ -0,0 +1,347 @@
+package policy
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/types"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	swarmTypes "github.com/secmon-lab/swarm/pkg/domain/types"
+)
+
+var (
+	//go:embed schema/event.json
+	eventOutputSchemaRaw []byte
+
+	//go:embed schema/schema.json
+	schemaOutputSchemaRaw []byte
+)
+
+const (
+	eventPackage  = "data.event"
+	schemaPackage = "data.schema"
+)
+
+// jsonSchema is a subset of JSON Schema that is used to type-check policy output.
+type jsonSchema struct {
+	Type                 string                 `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Items                *jsonSchema            `json:"items"`
+	Required             []string               `json:"required"`
+	Enum                 []string               `json:"enum"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+}
+
+func mustParseJSONSchema(raw []byte) *jsonSchema {
+	var s jsonSchema
+	if err := json.Unmarshal(raw, &s); err != nil {
+		panic("invalid embedded JSON schema: " + err.Error())
+	}
+	return &s
+}
+
+var (
+	eventOutputSchema  = mustParseJSONSchema(eventOutputSchemaRaw)
+	schemaOutputSchema = mustParseJSONSchema(schemaOutputSchemaRaw)
+)
+
+// Check validates loaded policies statically without evaluation. It verifies that
+//   - every schema named by event rules has a matching `schema.<name>` package
+//   - every `log` rule sets required fields
+//   - output types of event and schema rules match JSON schema of EventPolicyOutput and SchemaPolicyOutput
+func (x *Client) Check() []*model.PolicyIssue {
+	var issues []*model.PolicyIssue
+
+	schemaPkgs := map[string]struct{}{}
+	for _, mod := range x.compiler.Modules {
+		path := mod.Package.Path.String()
+		if strings.HasPrefix(path, schemaPackage+".") {
+			schemaPkgs[path] = struct{}{}
+		}
+	}
+
+	if x.hasPackage(eventPackage) {
+		issues = append(issues, x.checkOutput(eventPackage, eventOutputSchema)...)
+
+		srcRef := eventPackage + ".src"
+		for _, rule := range x.compiler.GetRules(ast.MustParseRef(srcRef)) {
+			for _, name := range literalValues(rule, "schema") {
+				query := swarmTypes.ObjectSchema(name).Query()
+				if _, ok := schemaPkgs[query]; !ok {
+					issues = append(issues, newIssue(swarmTypes.PolicyIssueError, rule.Location, srcRef,
+						fmt.Sprintf("schema %q is used, but package %q is not found", name, strings.TrimPrefix(query, "data."))))
+				}
+			}
+		}
+	}
+
+	pkgs := make([]string, 0, len(schemaPkgs))
+	for pkg := range schemaPkgs {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		issues = append(issues, x.checkOutput(pkg, schemaOutputSchema)...)
+	}
+
+	return issues
+}
+
+func (x *Client) hasPackage(pkg string) bool {
+	for _, mod := range x.compiler.Modules {
+		if mod.Package.Path.String() == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOutput type-checks rules in the package against properties of the JSON schema.
+func (x *Client) checkOutput(pkg string, schema *jsonSchema) []*model.PolicyIssue {
+	var issues []*model.PolicyIssue
+
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		target := pkg + "." + name
+		ref := ast.MustParseRef(target)
+		rules := x.compiler.GetRules(ref)
+		if len(rules) == 0 {
+			if slices.Contains(schema.Required, name) {
+				issues = append(issues, newIssue(swarmTypes.PolicyIssueError, x.packageLocation(pkg), pkg,
+					fmt.Sprintf("rule %q is required, but not defined", name)))
+			}
+			continue
+		}
+
+		loc := rules[0].Location
+		reported := map[checkMessage]struct{}{}
+		for _, msg := range typeCheck(name, schema.Properties[name], x.compiler.TypeEnv.Get(ref)) {
+			// Same message can be generated from multiple variants of the rule type
+			if _, ok := reported[msg]; ok {
+				continue
+			}
+			reported[msg] = struct{}{}
+			issues = append(issues, newIssue(msg.severity, loc, target, msg.message))
+		}
+
+		for _, rule := range rules {
+			for _, msg := range enumCheck(rule, schema.Properties[name]) {
+				issues = append(issues, newIssue(msg.severity, rule.Location, target, msg.message))
+			}
+		}
+	}
+
+	return issues
+}
+
+func (x *Client) packageLocation(pkg string) *ast.Location {
+	for _, mod := range x.compiler.Modules {
+		if mod.Package.Path.String() == pkg {
+			return mod.Package.Location
+		}
+	}
+	return nil
+}
+
+func newIssue(severity swarmTypes.PolicyIssueSeverity, loc *ast.Location, target, msg string) *model.PolicyIssue {
+	issue := &model.PolicyIssue{
+		Severity: severity,
+		Target:   target,
+		Message:  msg,
+	}
+	if loc != nil {
+		issue.File = loc.File
+		issue.Row = loc.Row
+	}
+	return issue
+}
+
+type checkMessage struct {
+	severity swarmTypes.PolicyIssueSeverity
+	message  string
+}
+
+func checkError(format string, args ...any) checkMessage {
+	return checkMessage{severity: swarmTypes.PolicyIssueError, message: fmt.Sprintf(format, args...)}
+}
+
+func checkWarning(format string, args ...any) checkMessage {
+	return checkMessage{severity: swarmTypes.PolicyIssueWarning, message: fmt.Sprintf(format, args...)}
+}
+
+// typeCheck verifies inferred type of rule against JSON schema. Types that can not be determined statically (any) are accepted.
+func typeCheck(path string, schema *jsonSchema, tpe types.Type) []checkMessage {
+	if schema == nil || tpe == nil {
+		return nil
+	}
+
+	variants := typeVariants(tpe)
+	if variants == nil {
+		return nil // any type
+	}
+
+	var msgs []checkMessage
+	for _, v := range variants {
+		switch t := v.(type) {
+		case types.String:
+			if schema.Type != "" && schema.Type != "string" {
+				msgs = append(msgs, checkError("field %q must be %s, but string", path, schema.Type))
+			}
+
+		case types.Number:
+			if schema.Type != "" && schema.Type != "number" {
+				msgs = append(msgs, checkError("field %q must be %s, but number", path, schema.Type))
+			}
+
+		case types.Boolean:
+			if schema.Type != "" && schema.Type != "boolean" {
+				msgs = append(msgs, checkError("field %q must be %s, but boolean", path, schema.Type))
+			}
+
+		case types.Null:
+			// null is treated as unset value
+
+		case *types.Array:
+			if schema.Type != "" && schema.Type != "array" {
+				msgs = append(msgs, checkError("field %q must be %s, but array", path, schema.Type))
+				continue
+			}
+			for _, elem := range append(arrayElements(t), t.Dynamic()) {
+				msgs = append(msgs, typeCheck(path+"[_]", schema.Items, elem)...)
+			}
+
+		case *types.Set:
+			if schema.Type != "" && schema.Type != "array" {
+				msgs = append(msgs, checkError("field %q must be %s, but set", path, schema.Type))
+				continue
+			}
+			msgs = append(msgs, typeCheck(path+"[_]", schema.Items, t.Of())...)
+
+		case *types.Object:
+			if schema.Type != "" && schema.Type != "object" {
+				msgs = append(msgs, checkError("field %q must be %s, but object", path, schema.Type))
+				continue
+			}
+			msgs = append(msgs, objectCheck(path, schema, t)...)
+		}
+	}
+
+	return msgs
+}
+
+func objectCheck(path string, schema *jsonSchema, obj *types.Object) []checkMessage {
+	var msgs []checkMessage
+	keys := map[string]struct{}{}
+
+	for _, prop := range obj.StaticProperties() {
+		key, ok := prop.Key.(string)
+		if !ok {
+			continue
+		}
+		keys[key] = struct{}{}
+
+		if sub, ok := schema.Properties[key]; ok {
+			msgs = append(msgs, typeCheck(path+"."+key, sub, prop.Value)...)
+		} else if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+			msgs = append(msgs, checkWarning("field %q is not supported and ignored", path+"."+key))
+		}
+	}
+
+	// If the object has dynamic properties, such as a result of object.union, required fields can not be verified.
+	if obj.DynamicProperties() != nil {
+		return msgs
+	}
+
+	for _, required := range schema.Required {
+		if _, ok := keys[required]; !ok {
+			msgs = append(msgs, checkError("required field %q is not set", path+"."+required))
+		}
+	}
+
+	return msgs
+}
+
+func arrayElements(t *types.Array) []types.Type {
+	elems := make([]types.Type, t.Len())
+	for i := range elems {
+		elems[i] = t.Select(i)
+	}
+	return elems
+}
+
+// typeVariants returns possible types of tpe. It returns nil if tpe can be any type.
+func typeVariants(tpe types.Type) []types.Type {
+	switch t := tpe.(type) {
+	case *types.NamedType:
+		return typeVariants(t.Type)
+	case types.Any:
+		if len(t) == 0 {
+			return nil
+		}
+		var variants []types.Type
+		for _, v := range t {
+			sub := typeVariants(v)
+			if sub == nil {
+				return nil
+			}
+			variants = append(variants, sub...)
+		}
+		return variants
+	default:
+		return []types.Type{tpe}
+	}
+}
+
+// literalValues returns string literals set to `key` of objects in the rule.
+func literalValues(rule *ast.Rule, key string) []string {
+	var values []string
+	ast.WalkTerms(rule, func(term *ast.Term) bool {
+		obj, ok := term.Value.(ast.Object)
+		if !ok {
+			return false
+		}
+		if v := obj.Get(ast.StringTerm(key)); v != nil {
+			if s, ok := v.Value.(ast.String); ok {
+				values = append(values, string(s))
+			}
+		}
+		return false
+	})
+	return values
+}
+
+// enumCheck verifies string literals in the rule against enum of JSON schema.
+func enumCheck(rule *ast.Rule, schema *jsonSchema) []checkMessage {
+	item := schema
+	for item != nil && item.Type == "array" {
+		item = item.Items
+	}
+	if item == nil {
+		return nil
+	}
+
+	var msgs []checkMessage
+	for key, prop := range item.Properties {
+		if len(prop.Enum) == 0 {
+			continue
+		}
+		for _, v := range literalValues(rule, key) {
+			if !slices.Contains(prop.Enum, v) {
+				msgs = append(msgs, checkError("field %q has invalid value %q, must be one of %q", key, v, prop.Enum))
+			}
+		}
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].message < msgs[j].message })
+
+	return msgs
+}
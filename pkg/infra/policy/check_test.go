@@ -0,0 +1,192 @@
+package policy_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/policy"
+)
+
+const checkEventPolicy = `package event
+
+src contains {
+	"parser": "json",
+	"schema": "access_log",
+} if {
+	input.cs.bucket == "my-bucket"
+}
+`
+
+const checkSchemaPolicy = `package schema.access_log
+
+log contains {
+	"dataset": "my_dataset",
+	"table": "access_log",
+	"timestamp": input.time,
+	"data": input,
+} if {
+	true
+}
+`
+
+func TestClient_Check(t *testing.T) {
+	testCases := map[string]struct {
+		policies map[string]string
+		errors   []string
+		warnings []string
+	}{
+		"valid policy": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": checkSchemaPolicy,
+			},
+		},
+		"schema package not found": {
+			policies: map[string]string{
+				"event.rego": checkEventPolicy,
+			},
+			errors: []string{`package "schema.access_log" is not found`},
+		},
+		"schema assigned in rule body": {
+			policies: map[string]string{
+				"event.rego": `package event
+
+src contains s if {
+	s := {"parser": "json", "schema": "unknown_log"}
+}
+`,
+			},
+			errors: []string{`schema "unknown_log" is used`},
+		},
+		"invalid parser": {
+			policies: map[string]string{
+				"event.rego":  strings.Replace(checkEventPolicy, `"json"`, `"csv"`, 1),
+				"schema.rego": checkSchemaPolicy,
+			},
+			errors: []string{`field "parser" has invalid value "csv"`},
+		},
+		"missing dataset": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": strings.Replace(checkSchemaPolicy, `"dataset": "my_dataset",`, "", 1),
+			},
+			errors: []string{`required field "log[_].dataset" is not set`},
+		},
+		"invalid timestamp type": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": strings.Replace(checkSchemaPolicy, `input.time`, `"2024-01-01"`, 1),
+			},
+			errors: []string{`field "log[_].timestamp" must be number, but string`},
+		},
+		"table options": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": strings.Replace(checkSchemaPolicy, `"data": input,`, `"data": input, "clustering": ["id"], "require_partition_filter": true, "labels": {"team": "sec"}, "json_columns": ["data.headers"],`, 1),
+			},
+		},
+		"declared schema": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": strings.Replace(checkSchemaPolicy, `"data": input,`, `"data": input, "schema": [{"name": "src_port", "type": "INTEGER"}],`, 1),
+			},
+		},
+		"sink": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": strings.Replace(checkSchemaPolicy, `"data": input,`, `"data": input, "sink": ["archive", "bigquery"],`, 1),
+			},
+		},
+		"invalid sink type": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": strings.Replace(checkSchemaPolicy, `"data": input,`, `"data": input, "sink": "archive",`, 1),
+			},
+			errors: []string{`field "log[_].sink" must be array, but string`},
+		},
+		"notify": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": strings.Replace(checkSchemaPolicy, `"data": input,`, `"data": input, "notify": {"topic": "alerts", "ordering_key": input.host, "attributes": {"severity": "high"}},`, 1),
+			},
+		},
+		"notify without topic": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": strings.Replace(checkSchemaPolicy, `"data": input,`, `"data": input, "notify": {"ordering_key": input.host},`, 1),
+			},
+			errors: []string{`required field "log[_].notify.topic" is not set`},
+		},
+		"invalid conflict strategy": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": strings.Replace(checkSchemaPolicy, `"data": input,`, `"data": input, "conflict": "merge",`, 1),
+			},
+			errors: []string{`field "conflict" has invalid value "merge"`},
+		},
+		"invalid clustering type": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": strings.Replace(checkSchemaPolicy, `"data": input,`, `"data": input, "clustering": "id",`, 1),
+			},
+			errors: []string{`field "log[_].clustering" must be array, but string`},
+		},
+		"unsupported field": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": strings.Replace(checkSchemaPolicy, `"data": input,`, `"data": input, "timeunit": "day",`, 1),
+			},
+			warnings: []string{`field "log[_].timeunit" is not supported`},
+		},
+		"no log rule": {
+			policies: map[string]string{
+				"event.rego":  checkEventPolicy,
+				"schema.rego": "package schema.access_log\n\nx := 1\n",
+			},
+			errors: []string{`rule "log" is required`},
+		},
+		"dynamic object is not verified": {
+			policies: map[string]string{
+				"event.rego": checkEventPolicy,
+				"schema.rego": `package schema.access_log
+
+log contains object.union(input.base, {"data": input}) if {
+	true
+}
+`,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var options []policy.Option
+			for name, data := range tc.policies {
+				options = append(options, policy.WithPolicyData(name, data))
+			}
+			client := gt.R1(policy.New(options...)).NoError(t)
+
+			var errors, warnings []*model.PolicyIssue
+			for _, issue := range client.Check() {
+				switch issue.Severity {
+				case types.PolicyIssueError:
+					errors = append(errors, issue)
+				case types.PolicyIssueWarning:
+					warnings = append(warnings, issue)
+				}
+			}
+
+			gt.A(t, errors).Length(len(tc.errors))
+			for i, msg := range tc.errors {
+				gt.S(t, errors[i].Message).Contains(msg)
+			}
+			gt.A(t, warnings).Length(len(tc.warnings))
+			for i, msg := range tc.warnings {
+				gt.S(t, warnings[i].Message).Contains(msg)
+			}
+		})
+	}
+}
@@ -3,26 +3,44 @@ package policy
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
 
 	"github.com/m-mizutani/goerr"
 	"github.com/open-policy-agent/opa/v1/ast"
 	"github.com/open-policy-agent/opa/v1/rego"
+	"github.com/open-policy-agent/opa/v1/storage"
+	"github.com/open-policy-agent/opa/v1/storage/inmem"
 	"github.com/open-policy-agent/opa/v1/topdown/print"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 )
 
 // Client is a policy engine client
 type Client struct {
-	dirs     []string
-	files    []string
-	policies map[string]string
+	dirs          []string
+	files         []string
+	dataFilePaths []string
+	policies      map[string]string
+
+	// dataFiles are data documents loaded into store. They are reloaded by RefreshData.
+	dataFiles []*dataFile
+	store     storage.Store
+
+	// hmacKeys are keys for swarm.hmac built-in function. The key of map is name of the key.
+	hmacKeys map[string][]byte
 
 	readFile readFile
 
 	compiler *ast.Compiler
+
+	// prepared is a cache of prepared queries. The key is query string, such as `data.event`.
+	prepared      map[string]*rego.PreparedEvalQuery
+	preparedMutex sync.RWMutex
 }
 
 type RegoPrint func(file string, row int, msg string) error
@@ -45,6 +63,20 @@ func WithFile(filePath string) Option {
 	}
 }
 
+// WithDataFile specifies file path of JSON or YAML data document. The document is mounted at `data.<file name without extension>`, e.g. `/path/to/assets.json` is available as `data.assets`.
+func WithDataFile(filePath string) Option {
+	return func(x *Client) {
+		x.dataFilePaths = append(x.dataFilePaths, filepath.Clean(filePath))
+	}
+}
+
+// WithHMACKey specifies a key for `swarm.hmac` built-in function. The key is referred by `name` in policy, e.g. `swarm.hmac("user", input.email)`.
+func WithHMACKey(name string, key []byte) Option {
+	return func(x *Client) {
+		x.hmacKeys[name] = key
+	}
+}
+
 // WithReadFile specifies file path of .rego policy. Import policy files recursively.
 func WithReadFile(fn func(string) ([]byte, error)) Option {
 	return func(x *Client) {
@@ -63,6 +95,9 @@ func WithPolicyData(name, policy string) Option {
 func New(options ...Option) (*Client, error) {
 	client := &Client{
 		policies: make(map[string]string),
+		prepared: make(map[string]*rego.PreparedEvalQuery),
+		hmacKeys: make(map[string][]byte),
+		readFile: os.ReadFile,
 	}
 	for _, opt := range options {
 		opt(client)
@@ -77,6 +112,14 @@ func New(options ...Option) (*Client, error) {
 			if d.IsDir() {
 				return nil
 			}
+			if isDataFile(path) {
+				file, err := newDataFile(dirPath, path)
+				if err != nil {
+					return err
+				}
+				client.dataFiles = append(client.dataFiles, file)
+				return nil
+			}
 			if filepath.Ext(path) != ".rego" {
 				return nil
 			}
@@ -91,8 +134,12 @@ func New(options ...Option) (*Client, error) {
 	}
 	targetFiles = append(targetFiles, client.files...)
 
+	for _, filePath := range client.dataFilePaths {
+		client.dataFiles = append(client.dataFiles, newExternalDataFile(filePath))
+	}
+
 	for _, filePath := range targetFiles {
-		raw, err := os.ReadFile(filepath.Clean(filePath))
+		raw, err := client.readFile(filepath.Clean(filePath))
 		if err != nil {
 			return nil, goerr.Wrap(err, "Failed to read policy file").With("path", filePath)
 		}
@@ -110,12 +157,21 @@ func New(options ...Option) (*Client, error) {
 
 	compiler, err := ast.CompileModulesWithOpt(client.policies, ast.CompileOpts{
 		EnablePrintStatements: true,
+		ParserOptions: ast.ParserOptions{
+			Capabilities: builtinCapabilities(),
+		},
 	})
 	if err != nil {
 		return nil, goerr.Wrap(err)
 	}
 	client.compiler = compiler
 
+	tree, err := client.loadData()
+	if err != nil {
+		return nil, err
+	}
+	client.store = inmem.NewFromObject(tree)
+
 	return client, nil
 }
 
@@ -139,36 +195,129 @@ func WithRegoPrint(callback RegoPrint) QueryOption {
 	}
 }
 
-// Query evaluates policy with `input` data. The result will be written to `out`. `out` must be pointer of instance.
-func (x *Client) Query(ctx context.Context, query string, input interface{}, output interface{}, options ...QueryOption) error {
-	cfg := newQueryConfig(options...)
+// prepare returns a prepared query for `query`. Prepared queries are cached because compiled policies are never changed after New.
+func (x *Client) prepare(ctx context.Context, query string) (*rego.PreparedEvalQuery, error) {
+	x.preparedMutex.RLock()
+	pq, ok := x.prepared[query]
+	x.preparedMutex.RUnlock()
+	if ok {
+		return pq, nil
+	}
 
-	regoOpt := []func(r *rego.Rego){
+	regoOpt := append([]func(*rego.Rego){
 		rego.Query(query),
 		rego.Compiler(x.compiler),
-		rego.Input(input),
+		rego.Store(x.store),
+		rego.EnablePrintStatements(true),
+	}, x.builtinOptions()...)
+
+	prepared, err := rego.New(regoOpt...).PrepareForEval(ctx)
+	if err != nil {
+		return nil, goerr.Wrap(err, "fail to prepare local policy").With("query", query)
+	}
+
+	x.preparedMutex.Lock()
+	defer x.preparedMutex.Unlock()
+	if pq, ok := x.prepared[query]; ok {
+		return pq, nil
+	}
+	x.prepared[query] = &prepared
+
+	return &prepared, nil
+}
+
+func (x *Client) eval(ctx context.Context, pq *rego.PreparedEvalQuery, input interface{}, cfg *queryConfig) (interface{}, error) {
+	evalOpt := []rego.EvalOption{
+		rego.EvalInput(input),
 	}
 	if cfg.regoPrint != nil {
-		regoOpt = append(regoOpt, rego.PrintHook(&regoPrintHook{
+		evalOpt = append(evalOpt, rego.EvalPrintHook(&regoPrintHook{
 			callback: cfg.regoPrint,
 		}))
 	}
 
-	rs, err := rego.New(regoOpt...).Eval(ctx)
+	rs, err := pq.Eval(ctx, evalOpt...)
 	if err != nil {
-		return goerr.Wrap(err, "fail to eval local policy").With("input", input)
+		return nil, goerr.Wrap(err, "fail to eval local policy").With("input", input)
 	}
 	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
-		return goerr.Wrap(types.ErrNoPolicyResult)
+		return nil, goerr.Wrap(types.ErrNoPolicyResult)
 	}
 
-	raw, err := json.Marshal(rs[0].Expressions[0].Value)
+	return rs[0].Expressions[0].Value, nil
+}
+
+// Query evaluates policy with `input` data. The result will be written to `out`. `out` must be pointer of instance.
+func (x *Client) Query(ctx context.Context, query string, input interface{}, output interface{}, options ...QueryOption) error {
+	cfg := newQueryConfig(options...)
+
+	pq, err := x.prepare(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	result, err := x.eval(ctx, pq, input, cfg)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(result)
 	if err != nil {
-		return goerr.Wrap(err, "fail to marshal a result of rego.Eval").With("rs", rs)
+		return goerr.Wrap(err, "fail to marshal a result of rego.Eval").With("result", result)
 	}
 	if err := json.Unmarshal(raw, output); err != nil {
-		return goerr.Wrap(err, "fail to unmarshal a result of rego.Eval to out").With("rs", rs)
+		return goerr.Wrap(err, "fail to unmarshal a result of rego.Eval to out").With("result", result)
+	}
+
+	return nil
+}
+
+// batchQuery returns a query that evaluates `query` for each element of input array in one evaluation. The result is an object of index to result, and an index is missing if its result is undefined.
+func batchQuery(query string) string {
+	return fmt.Sprintf("{i: r | some i, v in input; r := %s with input as v}", query)
+}
+
+// QueryBatch evaluates policy with `inputs` as an array by one evaluation of a single query. Results are written to `outputs` in the same order as `inputs`. `outputs` must be pointer of slice, such as *[]model.SchemaPolicyOutput. If any input has no result, it returns ErrNoPolicyResult.
+func (x *Client) QueryBatch(ctx context.Context, query string, inputs []interface{}, outputs interface{}, options ...QueryOption) error {
+	cfg := newQueryConfig(options...)
+
+	dst := reflect.ValueOf(outputs)
+	if dst.Kind() != reflect.Pointer || dst.Elem().Kind() != reflect.Slice {
+		return goerr.New("outputs must be pointer of slice").With("type", dst.Type().String())
+	}
+
+	pq, err := x.prepare(ctx, batchQuery(query))
+	if err != nil {
+		return err
+	}
+
+	result, err := x.eval(ctx, pq, inputs, cfg)
+	if err != nil {
+		return err
+	}
+	results, ok := result.(map[string]interface{})
+	if !ok {
+		return goerr.New("unexpected result of batch query").With("result", result)
+	}
+
+	// Each result is converted separately not to hold JSON of all results at once
+	slice := reflect.MakeSlice(dst.Elem().Type(), len(inputs), len(inputs))
+	for i := range inputs {
+		r, ok := results[strconv.Itoa(i)]
+		if !ok {
+			return goerr.Wrap(types.ErrNoPolicyResult, "no result of batch input").With("index", i).With("input", inputs[i])
+		}
+		delete(results, strconv.Itoa(i))
+
+		raw, err := json.Marshal(r)
+		if err != nil {
+			return goerr.Wrap(err, "fail to marshal a result of rego.Eval").With("index", i)
+		}
+		if err := json.Unmarshal(raw, slice.Index(i).Addr().Interface()); err != nil {
+			return goerr.Wrap(err, "fail to unmarshal a result of rego.Eval to outputs").With("index", i)
+		}
 	}
+	dst.Elem().Set(slice)
 
 	return nil
 }
@@ -2,10 +2,12 @@ package policy_test
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"testing"
 
 	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
 	"github.com/secmon-lab/swarm/pkg/infra/policy"
 )
 
@@ -114,3 +116,149 @@ func TestClient_Query_NoResult(t *testing.T) {
 	err = client.Query(ctx, "data", input, &output)
 	gt.Error(t, err)
 }
+
+const batchSchemaPolicy = `package schema.access_log
+
+log contains {
+	"dataset": "my_dataset",
+	"table": "access_log",
+	"id": input.id,
+	"timestamp": time.parse_rfc3339_ns(input.time) / 1000000000,
+	"data": object.remove(input, ["secret"]),
+} if {
+	input.type == "access"
+}
+`
+
+type batchOutput struct {
+	Logs []struct {
+		ID        string         `json:"id"`
+		Timestamp float64        `json:"timestamp"`
+		Data      map[string]any `json:"data"`
+	} `json:"log"`
+}
+
+func newBatchInputs(n int) []any {
+	inputs := make([]any, n)
+	for i := range inputs {
+		inputs[i] = map[string]any{
+			"id":     fmt.Sprintf("log-%d", i),
+			"type":   []string{"access", "audit"}[i%2],
+			"time":   "2024-01-02T03:04:05Z",
+			"user":   "alice",
+			"path":   "/api/v1/resource",
+			"status": 200,
+			"secret": "xxx",
+		}
+	}
+	return inputs
+}
+
+func TestClient_QueryBatch(t *testing.T) {
+	client := gt.R1(policy.New(policy.WithPolicyData("schema.rego", batchSchemaPolicy))).NoError(t)
+	ctx := context.Background()
+
+	t.Run("results are in the same order as inputs", func(t *testing.T) {
+		var outputs []batchOutput
+		gt.NoError(t, client.QueryBatch(ctx, "data.schema.access_log", newBatchInputs(4), &outputs))
+		gt.A(t, outputs).Length(4)
+
+		gt.A(t, outputs[0].Logs).Length(1)
+		gt.V(t, outputs[0].Logs[0].ID).Equal("log-0")
+		gt.V(t, outputs[0].Logs[0].Timestamp).Equal(1704164645)
+		gt.V(t, outputs[0].Logs[0].Data["secret"]).Nil()
+		gt.A(t, outputs[1].Logs).Length(0)
+		gt.A(t, outputs[2].Logs).Length(1)
+		gt.V(t, outputs[2].Logs[0].ID).Equal("log-2")
+	})
+
+	t.Run("prepared query is reused for different inputs", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			var output batchOutput
+			gt.NoError(t, client.Query(ctx, "data.schema.access_log", newBatchInputs(1)[0], &output))
+			gt.A(t, output.Logs).Length(1)
+		}
+	})
+
+	t.Run("print output is routed to hook of each call", func(t *testing.T) {
+		client := gt.R1(policy.New(policy.WithPolicyData("test.rego", `package test
+
+allow if {
+	print("role:", input.role)
+	input.role == "admin"
+}
+`))).NoError(t)
+
+		for _, role := range []string{"admin", "user"} {
+			var msgs []string
+			hook := func(file string, row int, msg string) error {
+				msgs = append(msgs, msg)
+				return nil
+			}
+			var output []examplePolicyResult
+			gt.NoError(t, client.QueryBatch(ctx, "data.test", []any{map[string]any{"role": role}}, &output, policy.WithRegoPrint(hook)))
+			gt.A(t, msgs).Length(1).At(0, func(t testing.TB, v string) {
+				gt.V(t, v).Equal("role: " + role)
+			})
+		}
+	})
+
+	t.Run("no result", func(t *testing.T) {
+		var outputs []batchOutput
+		err := client.QueryBatch(ctx, "data.schema.not_found", newBatchInputs(1), &outputs)
+		gt.Error(t, err).Is(types.ErrNoPolicyResult)
+	})
+
+	t.Run("undefined result of an input", func(t *testing.T) {
+		client := gt.R1(policy.New(policy.WithPolicyData("test.rego", `package test
+
+role := input.role
+`))).NoError(t)
+
+		var outputs []string
+		inputs := []any{map[string]any{"role": "admin"}, map[string]any{"role": "user"}}
+		gt.NoError(t, client.QueryBatch(ctx, "data.test.role", inputs, &outputs))
+		gt.Equal(t, outputs, []string{"admin", "user"})
+
+		inputs = append(inputs, map[string]any{"name": "alice"})
+		err := client.QueryBatch(ctx, "data.test.role", inputs, &outputs)
+		gt.Error(t, err).Is(types.ErrNoPolicyResult)
+	})
+}
+
+func BenchmarkClient_Query(b *testing.B) {
+	client := gt.R1(policy.New(policy.WithPolicyData("schema.rego", batchSchemaPolicy))).NoError(b)
+	ctx := context.Background()
+	inputs := newBatchInputs(1000)
+
+	b.Run("Uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, input := range inputs {
+				var output batchOutput
+				if err := client.QueryUncached(ctx, "data.schema.access_log", input, &output); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("Query", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, input := range inputs {
+				var output batchOutput
+				if err := client.Query(ctx, "data.schema.access_log", input, &output); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("QueryBatch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var outputs []batchOutput
+			if err := client.QueryBatch(ctx, "data.schema.access_log", inputs, &outputs); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
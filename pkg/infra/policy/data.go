@@ -0,0 +1,155 @@
+package policy
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/m-mizutani/goerr"
+	"github.com/open-policy-agent/opa/v1/storage"
+	"github.com/open-policy-agent/opa/v1/util"
+	"github.com/secmon-lab/swarm/pkg/utils"
+)
+
+// dataFileNames is a list of file names that are loaded as data documents from policy directories. As with OPA bundles, other JSON and YAML files, such as test fixtures, are not loaded.
+var dataFileNames = []string{"data.json", "data.yaml", "data.yml"}
+
+// dataFile is a data document file. The document is mounted at `ref` under `data`.
+type dataFile struct {
+	path string
+	ref  []string
+}
+
+// newDataFile creates dataFile of `path` in a policy directory `root`. As with OPA bundles, the document is mounted at its directory path relative to `root`, e.g. `assets/data.json` is mounted at `data.assets` and `data.yaml` at the root is mounted at `data`.
+func newDataFile(root, path string) (*dataFile, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, goerr.Wrap(err, "Failed to get relative path of data file").With("root", root).With("path", path)
+	}
+
+	var ref []string
+	if dir := filepath.Dir(rel); dir != "." {
+		ref = strings.Split(filepath.ToSlash(dir), "/")
+	}
+
+	return &dataFile{path: path, ref: ref}, nil
+}
+
+// newExternalDataFile creates dataFile of `path` specified by --policy-data-file. The document is mounted at file name without extension, e.g. `/path/to/hosts.yaml` is mounted at `data.hosts`.
+func newExternalDataFile(path string) *dataFile {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return &dataFile{path: path, ref: []string{name}}
+}
+
+func isDataFile(path string) bool {
+	return slices.Contains(dataFileNames, filepath.Base(path))
+}
+
+// loadData reads all data files and builds a data document tree.
+func (x *Client) loadData() (map[string]any, error) {
+	tree := map[string]any{}
+
+	for _, file := range x.dataFiles {
+		raw, err := x.readFile(filepath.Clean(file.path))
+		if err != nil {
+			return nil, goerr.Wrap(err, "Failed to read data file").With("path", file.path)
+		}
+
+		var doc any
+		if filepath.Ext(file.path) == ".json" {
+			err = util.UnmarshalJSON(raw, &doc)
+		} else {
+			err = util.Unmarshal(raw, &doc)
+		}
+		if err != nil {
+			return nil, goerr.Wrap(err, "Failed to parse data file").With("path", file.path)
+		}
+
+		if err := mountDocument(tree, file.ref, doc); err != nil {
+			return nil, goerr.Wrap(err).With("path", file.path)
+		}
+	}
+
+	return tree, nil
+}
+
+// mountDocument puts `doc` at `ref` of `tree`. Objects at the same path are merged recursively.
+func mountDocument(tree map[string]any, ref []string, doc any) error {
+	if len(ref) == 0 {
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return goerr.New("Data document at root must be object")
+		}
+		for k, v := range obj {
+			if err := mountDocument(tree, []string{k}, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	key := ref[0]
+	if len(ref) == 1 {
+		current, exists := tree[key]
+		if !exists {
+			tree[key] = doc
+			return nil
+		}
+
+		curObj, ok1 := current.(map[string]any)
+		docObj, ok2 := doc.(map[string]any)
+		if !ok1 || !ok2 {
+			return goerr.New("Data document conflicts with another document").With("key", key)
+		}
+		for k, v := range docObj {
+			if err := mountDocument(curObj, []string{k}, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	child, exists := tree[key]
+	if !exists {
+		child = map[string]any{}
+		tree[key] = child
+	}
+	childObj, ok := child.(map[string]any)
+	if !ok {
+		return goerr.New("Data document conflicts with another document").With("key", key)
+	}
+	return mountDocument(childObj, ref[1:], doc)
+}
+
+// RefreshData reloads data documents from files and replaces the store. If any file fails to load, the current data is kept.
+func (x *Client) RefreshData(ctx context.Context) error {
+	tree, err := x.loadData()
+	if err != nil {
+		return err
+	}
+
+	if err := storage.WriteOne(ctx, x.store, storage.ReplaceOp, storage.Path{}, tree); err != nil {
+		return goerr.Wrap(err, "Failed to write data documents to store")
+	}
+
+	return nil
+}
+
+// RunDataRefresh reloads data documents every `interval` until ctx is canceled. Errors are reported and do not stop the loop.
+func (x *Client) RunDataRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := x.RefreshData(ctx); err != nil {
+				utils.HandleError(ctx, "failed to refresh policy data", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package policy_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/policy"
+)
+
+const dataLookupPolicy = `package schema.access_log
+
+log contains {
+	"dataset": "my_dataset",
+	"table": "access_log",
+	"timestamp": 0,
+	"data": object.union(input, {
+		"owner": data.assets[input.host].owner,
+		"account": data.known.accounts[input.user],
+		"region": data.region,
+	}),
+} if {
+	true
+}
+`
+
+type dataLookupOutput struct {
+	Logs []struct {
+		Data map[string]any `json:"data"`
+	} `json:"log"`
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	gt.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	gt.NoError(t, os.WriteFile(path, []byte(data), 0644))
+}
+
+func TestClient_DataDocument(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "schema.rego"), dataLookupPolicy)
+	writeFile(t, filepath.Join(dir, "assets", "data.json"), `{"web-1": {"owner": "alice"}}`)
+	writeFile(t, filepath.Join(dir, "known", "data.yaml"), "accounts:\n  bob: service-account\n")
+	writeFile(t, filepath.Join(dir, "data.yml"), "region: asia\n")
+	// Files other than data.json and data.yaml in policy dir are not data documents
+	writeFile(t, filepath.Join(dir, "testdata", "sample.json"), `["not", "an", "object"]`)
+	writeFile(t, filepath.Join(dir, "region.yaml"), "conflict: true\n")
+
+	extFile := filepath.Join(t.TempDir(), "ext.json")
+	writeFile(t, extFile, `{"version": 1}`)
+
+	client := gt.R1(policy.New(policy.WithDir(dir), policy.WithDataFile(extFile))).NoError(t)
+	ctx := context.Background()
+
+	t.Run("lookup data documents in policy dir", func(t *testing.T) {
+		var output dataLookupOutput
+		input := map[string]any{"host": "web-1", "user": "bob"}
+		gt.NoError(t, client.Query(ctx, "data.schema.access_log", input, &output))
+		gt.A(t, output.Logs).Length(1)
+		gt.V(t, output.Logs[0].Data["owner"]).Equal("alice")
+		gt.V(t, output.Logs[0].Data["account"]).Equal("service-account")
+		gt.V(t, output.Logs[0].Data["region"]).Equal("asia")
+	})
+
+	t.Run("data file is refreshed", func(t *testing.T) {
+		var version int
+		gt.NoError(t, client.Query(ctx, "data.ext.version", nil, &version))
+		gt.V(t, version).Equal(1)
+
+		writeFile(t, extFile, `{"version": 2}`)
+		gt.NoError(t, client.RefreshData(ctx))
+		gt.NoError(t, client.Query(ctx, "data.ext.version", nil, &version))
+		gt.V(t, version).Equal(2)
+	})
+
+	t.Run("current data is kept if refresh fails", func(t *testing.T) {
+		writeFile(t, extFile, `{"version": `)
+		gt.Error(t, client.RefreshData(ctx))
+
+		var version int
+		gt.NoError(t, client.Query(ctx, "data.ext.version", nil, &version))
+		gt.V(t, version).Equal(2)
+	})
+}
+
+func TestClient_DataDocument_Conflict(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "schema.rego"), dataLookupPolicy)
+	writeFile(t, filepath.Join(dir, "assets", "data.json"), `{"web-1": {"owner": "alice"}}`)
+	writeFile(t, filepath.Join(dir, "data.json"), `{"assets": "conflict"}`)
+
+	_, err := policy.New(policy.WithDir(dir))
+	gt.Error(t, err)
+}
+
+func TestClient_DataDocument_IgnoreFixture(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "schema.rego"), checkSchemaPolicy)
+	writeFile(t, filepath.Join(dir, "testdata", "access_log.json"), `[{"host": "web-1"}]`)
+	writeFile(t, filepath.Join(dir, "sample.yaml"), "- not an object\n")
+
+	client := gt.R1(policy.New(policy.WithDir(dir))).NoError(t)
+
+	// Policy works without data documents, and fixtures are not mounted
+	var output dataLookupOutput
+	gt.NoError(t, client.Query(context.Background(), "data.schema.access_log", map[string]any{"time": 0}, &output))
+	gt.A(t, output.Logs).Length(1)
+
+	var fixture any
+	gt.Error(t, client.Query(context.Background(), "data.testdata", nil, &fixture)).Is(types.ErrNoPolicyResult)
+}
+
+const geoIPPolicy = `package schema.access_log
+
+log contains {
+	"dataset": "my_dataset",
+	"table": "access_log",
+	"timestamp": 0,
+	"data": object.union(input, {"geo": geo}),
+} if {
+	geo := swarm.cidr_lookup(data.geoip, input.remote_addr)
+}
+
+log contains {
+	"dataset": "my_dataset",
+	"table": "access_log",
+	"timestamp": 0,
+	"data": input,
+} if {
+	not swarm.cidr_lookup(data.geoip, input.remote_addr)
+}
+`
+
+func TestClient_DataDocument_GeoIP(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "schema.rego"), geoIPPolicy)
+	writeFile(t, filepath.Join(dir, "geoip", "data.json"), `{
+		"203.0.113.0/24": {"country": "JP", "city": "Tokyo", "asn": 64500},
+		"198.51.100.0/24": {"country": "US", "asn": 64501},
+		"2001:db8::/32": {"country": "DE"}
+	}`)
+
+	client := gt.R1(policy.New(policy.WithDir(dir))).NoError(t)
+
+	testCases := map[string]struct {
+		addr    string
+		country any
+	}{
+		"IPv4":         {addr: "203.0.113.10", country: "JP"},
+		"IPv6":         {addr: "2001:db8::1", country: "DE"},
+		"not in table": {addr: "192.0.2.1"},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var output dataLookupOutput
+			input := map[string]any{"remote_addr": tc.addr}
+			gt.NoError(t, client.Query(context.Background(), "data.schema.access_log", input, &output))
+			gt.A(t, output.Logs).Length(1)
+
+			geo, ok := output.Logs[0].Data["geo"].(map[string]any)
+			if tc.country == nil {
+				gt.False(t, ok)
+				return
+			}
+			gt.True(t, ok)
+			gt.V(t, geo["country"]).Equal(tc.country)
+		})
+	}
+}
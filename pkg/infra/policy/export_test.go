@@ -0,0 +1,28 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+// QueryUncached evaluates policy by building a new query for each call without cache of prepared queries. It is a baseline of benchmarks.
+func (x *Client) QueryUncached(ctx context.Context, query string, input interface{}, output interface{}) error {
+	regoOpt := append([]func(*rego.Rego){
+		rego.Query(query),
+		rego.Compiler(x.compiler),
+		rego.Store(x.store),
+		rego.Input(input),
+	}, x.builtinOptions()...)
+
+	rs, err := rego.New(regoOpt...).Eval(ctx)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(rs[0].Expressions[0].Value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, output)
+}
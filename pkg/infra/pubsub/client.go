@@ -8,6 +8,7 @@ import (
 	apiv1 "cloud.google.com/go/pubsub/v2/apiv1"
 	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
 	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 )
 
@@ -23,14 +24,25 @@ func NewTopic(ctx context.Context, projectID types.GoogleProjectID, topicID type
 	}
 
 	publisher := client.Publisher(topicID.String())
+	// Message ordering affects only messages with ordering key
+	publisher.EnableMessageOrdering = true
 	return &TopicClient{
 		client:    client,
 		publisher: publisher,
 	}, nil
 }
 
-func (x *TopicClient) Publish(ctx context.Context, data []byte) (types.PubSubMessageID, error) {
-	msgID, err := x.publisher.Publish(ctx, &pubsub.Message{Data: data}).Get(ctx)
+func (x *TopicClient) Publish(ctx context.Context, data []byte, options ...model.PublishOption) (types.PubSubMessageID, error) {
+	cfg := model.NewPublishConfig(options...)
+	msgID, err := x.publisher.Publish(ctx, &pubsub.Message{
+		Data:        data,
+		OrderingKey: cfg.OrderingKey,
+		Attributes:  cfg.Attributes,
+	}).Get(ctx)
+	if err != nil && cfg.OrderingKey != "" {
+		// Publishing with the ordering key is paused after failure until resumed
+		x.publisher.ResumePublish(cfg.OrderingKey)
+	}
 	return types.PubSubMessageID(msgID), err
 }
 
@@ -54,11 +66,11 @@ func NewSubscriptionClient(ctx context.Context) (*SubscriptionClient, error) {
 	}, nil
 }
 
-func (x *SubscriptionClient) Pull(ctx context.Context, subName string) ([]*pubsubpb.ReceivedMessage, error) {
+// Pull pulls up to maxMessages messages from the subscription. It waits for messages until ctx is done if the subscription has no message.
+func (x *SubscriptionClient) Pull(ctx context.Context, subName string, maxMessages int) ([]*pubsubpb.ReceivedMessage, error) {
 	req := pubsubpb.PullRequest{
-		Subscription:      subName,
-		MaxMessages:       1,
-		ReturnImmediately: true,
+		Subscription: subName,
+		MaxMessages:  int32(maxMessages),
 	}
 
 	res, err := x.client.Pull(ctx, &req)
@@ -81,6 +93,7 @@ func (x *SubscriptionClient) Acknowledge(ctx context.Context, subName string, ac
 	return nil
 }
 
+// ModifyAckDeadline extends lease of the message by deadline. Zero deadline makes the message available for redelivery immediately.
 func (x *SubscriptionClient) ModifyAckDeadline(ctx context.Context, subName string, ackID string, deadline time.Duration) error {
 	req := pubsubpb.ModifyAckDeadlineRequest{
 		Subscription:       subName,
@@ -2,10 +2,12 @@ package pubsub
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
 
 	"github.com/google/uuid"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 )
 
@@ -17,7 +19,13 @@ func NewDumper(outDir string) *Dumper {
 	return &Dumper{outDir: outDir}
 }
 
-func (x *Dumper) Publish(ctx context.Context, data []byte) (types.PubSubMessageID, error) {
+// dumpedAttrs is written to `{id}.attrs.json` if the message has ordering key or attributes.
+type dumpedAttrs struct {
+	OrderingKey string            `json:"ordering_key,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+}
+
+func (x *Dumper) Publish(ctx context.Context, data []byte, options ...model.PublishOption) (types.PubSubMessageID, error) {
 	id := types.PubSubMessageID(uuid.NewString())
 
 	path := filepath.Clean(filepath.Join(x.outDir, string(id)+".msg"))
@@ -25,5 +33,21 @@ func (x *Dumper) Publish(ctx context.Context, data []byte) (types.PubSubMessageI
 		return "", err
 	}
 
+	cfg := model.NewPublishConfig(options...)
+	if cfg.OrderingKey != "" || len(cfg.Attributes) > 0 {
+		raw, err := json.Marshal(dumpedAttrs{
+			OrderingKey: cfg.OrderingKey,
+			Attributes:  cfg.Attributes,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		path := filepath.Clean(filepath.Join(x.outDir, string(id)+".attrs.json"))
+		if err := os.WriteFile(path, raw, 0600); err != nil {
+			return "", err
+		}
+	}
+
 	return id, nil
 }
@@ -2,33 +2,135 @@ package pubsub
 
 import (
 	"context"
+	"strconv"
+	"sync"
+	"time"
 
+	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
 	"github.com/google/uuid"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 )
 
 type Mock struct {
-	MockPublish func(ctx context.Context, data []byte) (types.PubSubMessageID, error)
+	MockPublish func(ctx context.Context, data []byte, options ...model.PublishOption) (types.PubSubMessageID, error)
 	Results     []*MockResult
+
+	mutex sync.Mutex
 }
 
 type MockResult struct {
-	ID   types.PubSubMessageID
-	Data []byte
+	ID          types.PubSubMessageID
+	Data        []byte
+	OrderingKey string
+	Attributes  map[string]string
 }
 
 func NewMock() *Mock {
 	mock := &Mock{}
-	mock.MockPublish = func(ctx context.Context, data []byte) (types.PubSubMessageID, error) {
+	mock.MockPublish = func(ctx context.Context, data []byte, options ...model.PublishOption) (types.PubSubMessageID, error) {
+		cfg := model.NewPublishConfig(options...)
+		mock.mutex.Lock()
+		defer mock.mutex.Unlock()
 		mock.Results = append(mock.Results, &MockResult{
-			ID:   types.PubSubMessageID(uuid.NewString()),
-			Data: data,
+			ID:          types.PubSubMessageID(uuid.NewString()),
+			Data:        data,
+			OrderingKey: cfg.OrderingKey,
+			Attributes:  cfg.Attributes,
 		})
 		return mock.Results[len(mock.Results)-1].ID, nil
 	}
 	return mock
 }
 
-func (x *Mock) Publish(ctx context.Context, data []byte) (types.PubSubMessageID, error) {
-	return x.MockPublish(ctx, data)
+func (x *Mock) Publish(ctx context.Context, data []byte, options ...model.PublishOption) (types.PubSubMessageID, error) {
+	return x.MockPublish(ctx, data, options...)
+}
+
+// SubscriptionMock is an in-memory subscription. Pull returns messages in Messages, and a message that is nacked or whose lease is not extended is not redelivered.
+type SubscriptionMock struct {
+	Messages []*pubsubpb.ReceivedMessage
+	Acked    []string
+	// Deadlines is ack deadlines set by ModifyAckDeadline for each ack ID in order of calls.
+	Deadlines map[string][]time.Duration
+
+	// PullWait is a duration to wait in Pull if no message is available. Default is 10ms.
+	PullWait time.Duration
+
+	mutex sync.Mutex
+}
+
+// NewSubscriptionMock creates a subscription that has messages with data. AckID of the message is "ack-{index}".
+func NewSubscriptionMock(data ...[]byte) *SubscriptionMock {
+	mock := &SubscriptionMock{
+		Deadlines: make(map[string][]time.Duration),
+	}
+	for i, d := range data {
+		mock.Messages = append(mock.Messages, &pubsubpb.ReceivedMessage{
+			AckId: "ack-" + strconv.Itoa(i),
+			Message: &pubsubpb.PubsubMessage{
+				MessageId: strconv.Itoa(i),
+				Data:      d,
+			},
+		})
+	}
+	return mock
+}
+
+func (x *SubscriptionMock) Pull(ctx context.Context, subName string, maxMessages int) ([]*pubsubpb.ReceivedMessage, error) {
+	x.mutex.Lock()
+	n := min(maxMessages, len(x.Messages))
+	msgs := x.Messages[:n]
+	x.Messages = x.Messages[n:]
+	x.mutex.Unlock()
+
+	if len(msgs) == 0 {
+		wait := x.PullWait
+		if wait == 0 {
+			wait = 10 * time.Millisecond
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	return msgs, nil
+}
+
+// ModifyAckDeadline records the deadline. As with the actual client, it fails if ctx is already canceled.
+func (x *SubscriptionMock) ModifyAckDeadline(ctx context.Context, subName string, ackID string, deadline time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.Deadlines[ackID] = append(x.Deadlines[ackID], deadline)
+	return nil
+}
+
+// LastDeadline returns the last ack deadline set to the message. It returns false if ModifyAckDeadline is not called for the message.
+func (x *SubscriptionMock) LastDeadline(ackID string) (time.Duration, bool) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	deadlines := x.Deadlines[ackID]
+	if len(deadlines) == 0 {
+		return 0, false
+	}
+	return deadlines[len(deadlines)-1], true
+}
+
+// Acknowledge records the ack ID. As with the actual client, it fails if ctx is already canceled.
+func (x *SubscriptionMock) Acknowledge(ctx context.Context, subName string, ackID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.Acked = append(x.Acked, ackID)
+	return nil
+}
+
+func (x *SubscriptionMock) Close() error {
+	return nil
 }
@@ -0,0 +1,64 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"golang.org/x/sync/errgroup"
+)
+
+// PubSub is a sink that publishes each log record to a Pub/Sub topic as a JSON message of model.LogMessage. It is for real-time processing of logs such as alerting.
+type PubSub struct {
+	topic       interfaces.PubSubTopic
+	concurrency int
+}
+
+var _ interfaces.Sink = &PubSub{}
+
+type PubSubOption func(*PubSub)
+
+// WithPublishConcurrency sets number of messages published concurrently. Default is 16.
+func WithPublishConcurrency(n int) PubSubOption {
+	if n < 1 {
+		n = 1
+	}
+	return func(x *PubSub) {
+		x.concurrency = n
+	}
+}
+
+func NewPubSub(topic interfaces.PubSubTopic, options ...PubSubOption) *PubSub {
+	sink := &PubSub{
+		topic:       topic,
+		concurrency: 16,
+	}
+	for _, opt := range options {
+		opt(sink)
+	}
+	return sink
+}
+
+// Write implements interfaces.Sink. It returns error if publishing any of records fails.
+func (x *PubSub) Write(ctx context.Context, dst model.BigQueryDest, group *model.LogRecordGroup) error {
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(x.concurrency)
+
+	for _, record := range group.Records {
+		eg.Go(func() error {
+			raw, err := json.Marshal(model.NewLogMessage(dst, record))
+			if err != nil {
+				return goerr.Wrap(err, "failed to marshal message", goerr.V("id", record.ID))
+			}
+
+			if _, err := x.topic.Publish(ctx, raw); err != nil {
+				return goerr.Wrap(err, "failed to publish message", goerr.V("id", record.ID))
+			}
+			return nil
+		})
+	}
+
+	return eg.Wait()
+}
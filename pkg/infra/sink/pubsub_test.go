@@ -0,0 +1,51 @@
+package sink_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra/pubsub"
+	"github.com/secmon-lab/swarm/pkg/infra/sink"
+)
+
+func TestPubSub(t *testing.T) {
+	ctx := context.Background()
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	dst := model.BigQueryDest{Dataset: "my_dataset", Table: "my_table"}
+	group := &model.LogRecordGroup{
+		Records: []*model.LogRecord{
+			{ID: "log-1", Timestamp: ts, IngestedAt: ts, Data: map[string]any{"color": "blue"}},
+			{ID: "log-2", Timestamp: ts, IngestedAt: ts, Data: map[string]any{"color": "red"}},
+		},
+	}
+
+	t.Run("publish each record", func(t *testing.T) {
+		topic := pubsub.NewMock()
+		gt.NoError(t, sink.NewPubSub(topic, sink.WithPublishConcurrency(1)).Write(ctx, dst, group))
+		gt.A(t, topic.Results).Length(2)
+
+		var msg model.LogMessage
+		gt.NoError(t, json.Unmarshal(topic.Results[0].Data, &msg))
+		gt.Equal(t, msg.Dataset, "my_dataset")
+		gt.Equal(t, msg.Table, "my_table")
+		gt.Equal(t, msg.ID, "log-1")
+		gt.True(t, msg.Timestamp.Equal(ts))
+		gt.Equal(t, msg.Data, any(map[string]any{"color": "blue"}))
+	})
+
+	t.Run("publish error", func(t *testing.T) {
+		errPublish := errors.New("publish failed")
+		topic := &pubsub.Mock{
+			MockPublish: func(ctx context.Context, data []byte, options ...model.PublishOption) (types.PubSubMessageID, error) {
+				return "", errPublish
+			},
+		}
+		gt.Error(t, sink.NewPubSub(topic).Write(ctx, dst, group)).Is(errPublish)
+	})
+}
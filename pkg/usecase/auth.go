@@ -3,12 +3,10 @@ package usecase
 import (
 	"context"
 	"errors"
-	"log/slog"
 
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/secmon-lab/swarm/pkg/domain/model"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
-	"github.com/secmon-lab/swarm/pkg/infra/policy"
 	"github.com/secmon-lab/swarm/pkg/utils"
 )
 
@@ -16,15 +14,10 @@ import (
 func (x *UseCase) Authorize(ctx context.Context, input *model.AuthPolicyInput) error {
 	var output model.AuthPolicyOutput
 
-	var p policy.RegoPrint = func(file string, row int, msg string) error {
-		utils.CtxLogger(ctx).Info(msg, slog.Group("rego",
-			"file", file,
-			"row", row,
-		))
-		return nil
-	}
+	printer := x.regoPrint.newPrinter(ctx)
+	defer printer.Flush()
 
-	if err := x.clients.Policy().Query(ctx, "data.auth", &input, &output, policy.WithRegoPrint(p)); err != nil {
+	if err := x.clients.Policy().Query(ctx, "data.auth", &input, &output, printer.Option()); err != nil {
 		if !errors.Is(err, types.ErrNoPolicyResult) {
 			return goerr.Wrap(err, "failed to evaluate policy", goerr.V("input", input))
 		}
@@ -2,6 +2,8 @@ package usecase
 
 import (
 	"context"
+	"slices"
+	"time"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/m-mizutani/bqs"
@@ -12,12 +14,50 @@ import (
 	"github.com/secmon-lab/swarm/pkg/utils"
 )
 
-func createOrUpdateTable(ctx context.Context, bq interfaces.BigQuery, datasetID types.BQDatasetID, tableID types.BQTableID, md *bigquery.TableMetadata) (bigquery.Schema, error) {
+// ensureDataset creates the dataset if it does not exist and automatic creation is configured. The dataset name must match the allow-list.
+func (x *UseCase) ensureDataset(ctx context.Context, datasetID types.BQDatasetID) error {
+	if x.datasetConfig == nil {
+		return nil
+	}
+	if _, ok := x.knownDatasets.Load(datasetID); ok {
+		return nil
+	}
+
+	md, err := x.clients.BigQuery().GetDataset(ctx, datasetID)
+	if err != nil {
+		return goerr.Wrap(err, "failed to get dataset", goerr.V("datasetID", datasetID))
+	}
+
+	if md == nil {
+		if !x.datasetConfig.IsAllowed(datasetID) {
+			return goerr.Wrap(types.ErrDatasetNotAllowed, "dataset does not exist and is not in allow-list",
+				goerr.V("datasetID", datasetID),
+				goerr.V("patterns", x.datasetConfig.AllowPatterns),
+			)
+		}
+
+		utils.CtxLogger(ctx).Info("creating new dataset", "datasetID", datasetID)
+		if err := x.clients.BigQuery().CreateDataset(ctx, datasetID, x.datasetConfig.Metadata()); err != nil {
+			return goerr.Wrap(err, "failed to create dataset", goerr.V("datasetID", datasetID))
+		}
+	}
+
+	x.knownDatasets.Store(datasetID, struct{}{})
+	return nil
+}
+
+// createOrUpdateTable creates a table with md if not exists. Otherwise, it merges schema of md into the table and reconciles table options with opts. opts can be nil.
+func createOrUpdateTable(ctx context.Context, bq interfaces.BigQuery, datasetID types.BQDatasetID, tableID types.BQTableID, md *bigquery.TableMetadata, opts *model.TableOptions) (bigquery.Schema, error) {
 	old, err := bq.GetMetadata(ctx, datasetID, tableID)
 	if err != nil {
 		return nil, goerr.Wrap(err, "Failed to get metadata", goerr.V("datasetID", datasetID), goerr.V("tableID", tableID))
 	}
 
+	return applyTableMetadata(ctx, bq, datasetID, tableID, old, md, opts)
+}
+
+// applyTableMetadata is same with createOrUpdateTable, but metadata of the current table is given as old. old is nil if the table does not exist.
+func applyTableMetadata(ctx context.Context, bq interfaces.BigQuery, datasetID types.BQDatasetID, tableID types.BQTableID, old, md *bigquery.TableMetadata, opts *model.TableOptions) (bigquery.Schema, error) {
 	if old == nil {
 		utils.CtxLogger(ctx).Info("creating new table", "datasetID", datasetID, "tableID", tableID)
 		return md.Schema, bq.CreateTable(ctx, datasetID, tableID, md)
@@ -27,16 +67,26 @@ func createOrUpdateTable(ctx context.Context, bq interfaces.BigQuery, datasetID
 	if err != nil {
 		return nil, goerr.Wrap(err, "Failed to merge schema", goerr.V("old", old.Schema), goerr.V("new", md.Schema))
 	}
+	// bqs.Merge overwrites old field by new field. Keep descriptions of existing columns if new schema does not have them.
+	merged = keepDescriptions(old.Schema, merged)
+
+	update, optionChanged := reconcileTableOptions(old, opts)
 
-	// If schema is not changed, do nothing
-	if bqs.Equal(old.Schema, merged) {
+	// If schema and options are not changed, do nothing
+	schemaChanged := !bqs.Equal(old.Schema, merged)
+	if !schemaChanged && !optionChanged {
 		return merged, nil
 	}
 
-	update := bigquery.TableMetadataToUpdate{
-		Schema: merged,
+	if schemaChanged {
+		update.Schema = merged
 	}
-	utils.CtxLogger(ctx).Info("updating table schema", "datasetID", datasetID, "tableID", tableID)
+	utils.CtxLogger(ctx).Info("updating table",
+		"datasetID", datasetID,
+		"tableID", tableID,
+		"schemaChanged", schemaChanged,
+		"optionChanged", optionChanged,
+	)
 
 	if err := bq.UpdateTable(ctx, datasetID, tableID, update, old.ETag); err != nil {
 		return nil, goerr.Wrap(err, "Failed to update table", goerr.V("datasetID", datasetID), goerr.V("tableID", tableID))
@@ -44,6 +94,72 @@ func createOrUpdateTable(ctx context.Context, bq interfaces.BigQuery, datasetID
 	return merged, nil
 }
 
+// keepDescriptions returns copy of merged schema with descriptions of old schema for fields that have no description.
+func keepDescriptions(old, merged bigquery.Schema) bigquery.Schema {
+	oldFields := make(map[string]*bigquery.FieldSchema, len(old))
+	for _, f := range old {
+		oldFields[f.Name] = f
+	}
+
+	result := make(bigquery.Schema, len(merged))
+	for i, f := range merged {
+		field := *f
+		if o, ok := oldFields[f.Name]; ok {
+			if field.Description == "" {
+				field.Description = o.Description
+			}
+			field.Schema = keepDescriptions(o.Schema, f.Schema)
+		} else if f.Schema != nil {
+			field.Schema = keepDescriptions(nil, f.Schema)
+		}
+		result[i] = &field
+	}
+	return result
+}
+
+// reconcileTableOptions returns update of table metadata for options that are specified in opts and different from current table.
+func reconcileTableOptions(old *bigquery.TableMetadata, opts *model.TableOptions) (bigquery.TableMetadataToUpdate, bool) {
+	var update bigquery.TableMetadataToUpdate
+	if opts == nil {
+		return update, false
+	}
+	changed := false
+
+	if len(opts.Clustering) > 0 && (old.Clustering == nil || !slices.Equal(old.Clustering.Fields, opts.Clustering)) {
+		update.Clustering = &bigquery.Clustering{Fields: opts.Clustering}
+		changed = true
+	}
+
+	if opts.PartitionExpirationDays > 0 && old.TimePartitioning != nil {
+		expiration := time.Duration(opts.PartitionExpirationDays) * 24 * time.Hour
+		if old.TimePartitioning.Expiration != expiration {
+			tp := *old.TimePartitioning
+			tp.Expiration = expiration
+			update.TimePartitioning = &tp
+			changed = true
+		}
+	}
+
+	if opts.RequirePartitionFilter != nil && old.RequirePartitionFilter != *opts.RequirePartitionFilter {
+		update.RequirePartitionFilter = *opts.RequirePartitionFilter
+		changed = true
+	}
+
+	if opts.Description != "" && old.Description != opts.Description {
+		update.Description = opts.Description
+		changed = true
+	}
+
+	for k, v := range opts.Labels {
+		if old.Labels[k] != v {
+			update.SetLabel(k, v)
+			changed = true
+		}
+	}
+
+	return update, changed
+}
+
 func inferSchema[T any](data []T) (bigquery.Schema, error) {
 	var merged bigquery.Schema
 	for _, d := range data {
@@ -61,6 +177,88 @@ func inferSchema[T any](data []T) (bigquery.Schema, error) {
 	return merged, nil
 }
 
+// inferTableSchema infers schema of records for the table after coercing values by declared schema, encoding values of JSON columns, applying guardrails and resolving type conflicts by the strategy in opts. Records are modified in place. old is metadata of the existing table and can be nil. opts and guard can be nil.
+func inferTableSchema(ctx context.Context, dst model.BigQueryDest, old *bigquery.TableMetadata, opts *model.TableOptions, guard *model.SchemaGuard, records []*model.LogRecord) (bigquery.Schema, []*model.SchemaConflict, error) {
+	logger := utils.CtxLogger(ctx)
+
+	var declared bigquery.Schema
+	var jsonPaths [][]string
+	strategy := types.ConflictNone
+	if opts != nil {
+		declared = model.DeclaredSchema(opts.Schema)
+		jsonPaths = jsonColumnPaths(opts.JSONColumns)
+		strategy = opts.Conflict
+	}
+	coerceRecords(ctx, dst, records, declared)
+	encodeJSONColumns(records, jsonPaths)
+
+	if guard != nil {
+		invalid, err := guardFieldNames(guard.FieldNameAction, records)
+		if err != nil {
+			return nil, nil, goerr.Wrap(err, "failed to check field names", goerr.V("dst", dst))
+		}
+		if len(invalid) > 0 {
+			logger.Warn("invalid field names are found", "dst", dst, "fields", invalid, "action", guard.FieldNameAction)
+		}
+
+		depthPaths, err := guardDepth(guard.MaxDepth, guard.LimitAction, records)
+		if err != nil {
+			return nil, nil, goerr.Wrap(err, "failed to check nesting depth", goerr.V("dst", dst))
+		}
+		if len(depthPaths) > 0 {
+			logger.Warn("deeply nested fields are stored as JSON", "dst", dst, "fields", depthPaths, "max_depth", guard.MaxDepth)
+			jsonPaths = append(jsonPaths, depthPaths...)
+		}
+	}
+
+	var table bigquery.Schema
+	if old != nil {
+		if field := lookupField(old.Schema, []string{dataFieldName}); field != nil {
+			table = field.Schema
+		}
+	}
+	conflicts := resolveConflicts(strategy, table, declared, records)
+
+	infer := func() (bigquery.Schema, error) {
+		schema, err := inferSchema(records)
+		if err != nil {
+			return nil, err
+		}
+		schema = overlayDataSchema(schema, declared)
+		for _, path := range jsonPaths {
+			schema = setJSONColumn(schema, append([]string{dataFieldName}, path...))
+		}
+		if lookupField(schema, []string{dataFieldName, overflowFieldName}) != nil {
+			schema = setJSONColumn(schema, []string{dataFieldName, overflowFieldName})
+		}
+		return schema, nil
+	}
+
+	schema, err := infer()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if guard != nil {
+		var current bigquery.Schema
+		if old != nil {
+			current = old.Schema
+		}
+		moved, err := guardColumns(guard.MaxColumns, guard.LimitAction, current, schema, records)
+		if err != nil {
+			return nil, nil, goerr.Wrap(err, "failed to check number of columns", goerr.V("dst", dst))
+		}
+		if len(moved) > 0 {
+			logger.Warn("fields exceeding column limit are stored in overflow column", "dst", dst, "fields", moved, "max_columns", guard.MaxColumns)
+			if schema, err = infer(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return schema, conflicts, nil
+}
+
 func setupLoadLogTable(ctx context.Context, bq interfaces.BigQuery, meta *model.MetadataConfig) (bigquery.Schema, error) {
 	schema, err := bqs.Infer(&model.LoadLog{
 		Sources: []*model.SourceLog{
@@ -69,7 +267,12 @@ func setupLoadLogTable(ctx context.Context, bq interfaces.BigQuery, meta *model.
 				Source: model.Source{},
 			},
 		},
-		Ingests: []*model.IngestLog{{}},
+		Ingests: []*model.IngestLog{
+			{
+				Conflicts: []*model.SchemaConflict{{}},
+				Sinks:     []*model.SinkLog{{}},
+			},
+		},
 	})
 	if err != nil {
 		return nil, goerr.Wrap(err, "failed to infer schema")
@@ -81,7 +284,26 @@ func setupLoadLogTable(ctx context.Context, bq interfaces.BigQuery, meta *model.
 			Type:  bigquery.MonthPartitioningType,
 		},
 	}
-	if _, err := createOrUpdateTable(ctx, bq, meta.Dataset(), meta.Table(), md); err != nil {
+	if _, err := createOrUpdateTable(ctx, bq, meta.Dataset(), meta.Table(), md, nil); err != nil {
+		return nil, goerr.Wrap(err, "failed to create or update table")
+	}
+
+	return schema, nil
+}
+
+func setupSchemaChangeTable(ctx context.Context, bq interfaces.BigQuery, meta *model.MetadataConfig) (bigquery.Schema, error) {
+	schema, err := bqs.Infer(&model.SchemaChangeLog{})
+	if err != nil {
+		return nil, goerr.Wrap(err, "failed to infer schema")
+	}
+	md := &bigquery.TableMetadata{
+		Schema: schema,
+		TimePartitioning: &bigquery.TimePartitioning{
+			Field: "changed_at",
+			Type:  bigquery.MonthPartitioningType,
+		},
+	}
+	if _, err := createOrUpdateTable(ctx, bq, meta.Dataset(), meta.SchemaChangeTable(), md, nil); err != nil {
 		return nil, goerr.Wrap(err, "failed to create or update table")
 	}
 
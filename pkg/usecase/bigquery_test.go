@@ -7,6 +7,7 @@ import (
 
 	"cloud.google.com/go/bigquery"
 	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 	"github.com/secmon-lab/swarm/pkg/infra/bq"
 	"github.com/secmon-lab/swarm/pkg/usecase"
@@ -32,7 +33,7 @@ func TestCreateOrUpdateTable(t *testing.T) {
 				{Name: "name", Type: bigquery.StringFieldType},
 				{Name: "age", Type: bigquery.IntegerFieldType},
 			},
-		})).NoError(t)
+		}, nil)).NoError(t)
 
 	// Update table
 	gt.R1(usecase.CreateOrUpdateTable(ctx,
@@ -44,5 +45,87 @@ func TestCreateOrUpdateTable(t *testing.T) {
 				{Name: "age", Type: bigquery.IntegerFieldType},
 				{Name: "address", Type: bigquery.StringFieldType},
 			},
-		})).NoError(t)
+		}, nil)).NoError(t)
+}
+
+func TestCreateOrUpdateTable_Options(t *testing.T) {
+	ctx := context.Background()
+	schema := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "timestamp", Type: bigquery.TimestampFieldType},
+		{Name: "data", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "src_addr", Type: bigquery.StringFieldType},
+		}},
+	}
+	requireFilter := true
+	opts := &model.TableOptions{
+		Clustering:              []string{"id"},
+		PartitionExpirationDays: 30,
+		RequirePartitionFilter:  &requireFilter,
+		Description:             "access log",
+		ColumnDescriptions:      map[string]string{"data.src_addr": "source address", "data.unknown": "ignored"},
+		Labels:                  map[string]string{"team": "security"},
+	}
+
+	t.Run("create table with options", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		md := gt.R1(usecase.BuildBQMetadata(schema, types.BQPartitionDay, opts)).NoError(t)
+		gt.R1(usecase.CreateOrUpdateTable(ctx, bqMock, "ds", "tbl", md, opts)).NoError(t)
+
+		gt.A(t, bqMock.CreatedTable).Length(1)
+		created := bqMock.CreatedTable[0].MD
+		gt.V(t, created.Clustering.Fields).Equal([]string{"id"})
+		gt.V(t, created.TimePartitioning.Expiration).Equal(30 * 24 * time.Hour)
+		gt.True(t, created.RequirePartitionFilter)
+		gt.V(t, created.Description).Equal("access log")
+		gt.V(t, created.Labels).Equal(map[string]string{"team": "security"})
+		gt.V(t, created.Schema[2].Schema[0].Description).Equal("source address")
+		// original schema is not modified
+		gt.V(t, schema[2].Schema[0].Description).Equal("")
+	})
+
+	t.Run("reconcile options of existing table", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		bqMock.Metadata = []*bigquery.TableMetadata{
+			{
+				Schema:           copySchema(schema),
+				TimePartitioning: &bigquery.TimePartitioning{Field: "timestamp", Type: bigquery.DayPartitioningType},
+				Labels:           map[string]string{"team": "security"},
+				ETag:             "etag",
+			},
+		}
+		md := gt.R1(usecase.BuildBQMetadata(schema, types.BQPartitionDay, opts)).NoError(t)
+		gt.R1(usecase.CreateOrUpdateTable(ctx, bqMock, "ds", "tbl", md, opts)).NoError(t)
+
+		gt.A(t, bqMock.UpdatedTable).Length(1)
+		update := bqMock.UpdatedTable[0].MD
+		gt.V(t, update.Clustering.Fields).Equal([]string{"id"})
+		gt.V(t, update.TimePartitioning.Expiration).Equal(30 * 24 * time.Hour)
+		gt.V(t, update.RequirePartitionFilter).Equal(true)
+		gt.V(t, update.Description).Equal("access log")
+		gt.V(t, update.Schema[2].Schema[0].Description).Equal("source address")
+		gt.V(t, bqMock.UpdatedTable[0].ETag).Equal("etag")
+	})
+
+	t.Run("keep existing descriptions and do nothing if not changed", func(t *testing.T) {
+		described := copySchema(schema)
+		described[0].Description = "log ID"
+		bqMock := bq.NewGeneralMock()
+		bqMock.Metadata = []*bigquery.TableMetadata{{Schema: described}}
+
+		md := gt.R1(usecase.BuildBQMetadata(schema, types.BQPartitionNone, nil)).NoError(t)
+		merged := gt.R1(usecase.CreateOrUpdateTable(ctx, bqMock, "ds", "tbl", md, nil)).NoError(t)
+		gt.A(t, bqMock.UpdatedTable).Length(0)
+		gt.V(t, merged[0].Description).Equal("log ID")
+	})
+}
+
+func copySchema(schema bigquery.Schema) bigquery.Schema {
+	var result bigquery.Schema
+	for _, f := range schema {
+		field := *f
+		field.Schema = copySchema(f.Schema)
+		result = append(result, &field)
+	}
+	return result
 }
@@ -0,0 +1,276 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/utils"
+)
+
+// dataFieldName is a column name of LogRecord.Data in BigQuery table.
+const dataFieldName = "data"
+
+// overlaySchema returns copy of base schema that fields are replaced by fields of overlay with the same name. If both fields are RECORD, sub fields are overlaid recursively, and fields only in base are kept.
+func overlaySchema(base, overlay bigquery.Schema) bigquery.Schema {
+	result := copySchema(base)
+
+	for _, o := range overlay {
+		replaced := false
+		for i, b := range result {
+			if b.Name != o.Name {
+				continue
+			}
+
+			field := *o
+			if o.Type == bigquery.RecordFieldType && b.Type == bigquery.RecordFieldType {
+				field.Schema = overlaySchema(b.Schema, o.Schema)
+			} else {
+				field.Schema = copySchema(o.Schema)
+			}
+			result[i] = &field
+			replaced = true
+			break
+		}
+
+		if !replaced {
+			field := *o
+			field.Schema = copySchema(o.Schema)
+			result = append(result, &field)
+		}
+	}
+
+	return result
+}
+
+// overlayDataSchema overlays schema of LogRecord.Data in record schema.
+func overlayDataSchema(schema, data bigquery.Schema) bigquery.Schema {
+	if len(data) == 0 {
+		return schema
+	}
+
+	return overlaySchema(schema, bigquery.Schema{
+		{Name: dataFieldName, Type: bigquery.RecordFieldType, Schema: data},
+	})
+}
+
+// coerceError is an error of value coercion for a field. Errors are aggregated by field path to avoid flooding error reports.
+type coerceError struct {
+	path  string
+	count int
+	err   error
+}
+
+// coerceRecords converts values of LogRecord.Data to types of declared schema in place. A value that can not be converted is removed from the record, and the failure is reported as an error.
+func coerceRecords(ctx context.Context, dst model.BigQueryDest, records []*model.LogRecord, declared bigquery.Schema) {
+	if len(declared) == 0 {
+		return
+	}
+
+	errs := map[string]*coerceError{}
+	var paths []string
+	for _, record := range records {
+		data, ok := record.Data.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		coerceObject("", data, declared, func(path string, err error) {
+			if e, ok := errs[path]; ok {
+				e.count++
+				return
+			}
+			errs[path] = &coerceError{path: path, count: 1, err: err}
+			paths = append(paths, path)
+		})
+	}
+
+	for _, path := range paths {
+		e := errs[path]
+		utils.HandleError(ctx, "failed to coerce value to declared type", goerr.Wrap(e.err, "value is removed",
+			goerr.V("dst", dst),
+			goerr.V("field", e.path),
+			goerr.V("count", e.count),
+		))
+	}
+}
+
+func coerceObject(prefix string, data map[string]any, schema bigquery.Schema, onError func(path string, err error)) {
+	for _, field := range schema {
+		v, ok := data[field.Name]
+		if !ok || v == nil {
+			continue
+		}
+		path := prefix + field.Name
+
+		converted, err := coerceField(path, v, field, onError)
+		if err != nil {
+			delete(data, field.Name)
+			onError(path, err)
+			continue
+		}
+		data[field.Name] = converted
+	}
+}
+
+func coerceField(path string, v any, field *bigquery.FieldSchema, onError func(path string, err error)) (any, error) {
+	if !field.Repeated {
+		return coerceValue(path, v, field, onError)
+	}
+
+	arr, ok := v.([]any)
+	if !ok {
+		// Single value is regarded as an array with one element
+		arr = []any{v}
+	}
+
+	result := make([]any, 0, len(arr))
+	for _, elem := range arr {
+		if elem == nil {
+			continue
+		}
+		converted, err := coerceValue(path, elem, field, onError)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, converted)
+	}
+	return result, nil
+}
+
+func coerceValue(path string, v any, field *bigquery.FieldSchema, onError func(path string, err error)) (any, error) {
+	switch field.Type {
+	case bigquery.StringFieldType:
+		return coerceString(v)
+	case bigquery.IntegerFieldType:
+		return coerceInteger(v)
+	case bigquery.FloatFieldType:
+		return coerceFloat(v)
+	case bigquery.BooleanFieldType:
+		return coerceBoolean(v)
+	case bigquery.TimestampFieldType:
+		return coerceTimestamp(v)
+	case bigquery.RecordFieldType:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, goerr.New("value is not object", goerr.V("value", v))
+		}
+		coerceObject(path+".", obj, field.Schema, onError)
+		return obj, nil
+	case bigquery.JSONFieldType:
+		return encodeJSONValue(v), nil
+	default:
+		return nil, goerr.Wrap(types.ErrAssertion, "unsupported declared type", goerr.V("type", field.Type))
+	}
+}
+
+func coerceString(v any) (any, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	case int64:
+		return strconv.FormatInt(t, 10), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	default:
+		raw, err := json.Marshal(t)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to marshal value", goerr.V("value", v))
+		}
+		return string(raw), nil
+	}
+}
+
+func coerceInteger(v any) (any, error) {
+	switch t := v.(type) {
+	case int64:
+		return t, nil
+	case float64:
+		if t != math.Trunc(t) || math.IsInf(t, 0) || math.IsNaN(t) {
+			return nil, goerr.New("number is not integer", goerr.V("value", v))
+		}
+		return int64(t), nil
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(t), 10, 64)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to parse integer", goerr.V("value", v))
+		}
+		return n, nil
+	default:
+		return nil, goerr.New("value can not be converted to integer", goerr.V("value", v))
+	}
+}
+
+func coerceFloat(v any) (any, error) {
+	switch t := v.(type) {
+	case float64:
+		return t, nil
+	case int64:
+		return float64(t), nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to parse float", goerr.V("value", v))
+		}
+		return n, nil
+	default:
+		return nil, goerr.New("value can not be converted to float", goerr.V("value", v))
+	}
+}
+
+func coerceBoolean(v any) (any, error) {
+	switch t := v.(type) {
+	case bool:
+		return t, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(t))
+		if err != nil {
+			return nil, goerr.Wrap(err, "failed to parse boolean", goerr.V("value", v))
+		}
+		return b, nil
+	default:
+		return nil, goerr.New("value can not be converted to boolean", goerr.V("value", v))
+	}
+}
+
+// timestampLayouts is a list of layouts to parse timestamp string.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// coerceTimestamp converts value to UNIX time in microseconds. It is the format of TIMESTAMP for BigQuery Storage Write API. A number is regarded as UNIX time in seconds.
+func coerceTimestamp(v any) (any, error) {
+	switch t := v.(type) {
+	case float64:
+		return int64(t * 1e6), nil
+	case int64:
+		return t * 1e6, nil
+	case string:
+		s := strings.TrimSpace(t)
+		for _, layout := range timestampLayouts {
+			if ts, err := time.Parse(layout, s); err == nil {
+				return ts.UnixMicro(), nil
+			}
+		}
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return int64(n * 1e6), nil
+		}
+		return nil, goerr.New("failed to parse timestamp", goerr.V("value", v))
+	default:
+		return nil, goerr.New("value can not be converted to timestamp", goerr.V("value", v))
+	}
+}
@@ -0,0 +1,327 @@
+package usecase
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/bqs"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+)
+
+// overflowFieldName is a column name in LogRecord.Data to store conflicted values in JSON by overflow strategy.
+const overflowFieldName = "_overflow"
+
+// conflictResolver resolves type conflicts of fields in LogRecord.Data. Fields of the existing table and declared schema are fixed, and conflicts with them are always resolved by the strategy. Other fields are typed by the first value.
+type conflictResolver struct {
+	strategy types.ConflictStrategy
+	fixed    bigquery.Schema
+	merged   bigquery.Schema
+	widened  [][]string
+
+	conflicts []*model.SchemaConflict
+	counts    map[string]*model.SchemaConflict
+}
+
+// resolveConflicts modifies records in place to avoid type conflicts by the strategy. table is schema of `data` field of the existing table, and can be nil. It returns resolved conflicts aggregated by field and strategy.
+func resolveConflicts(strategy types.ConflictStrategy, table, declared bigquery.Schema, records []*model.LogRecord) []*model.SchemaConflict {
+	if strategy == types.ConflictNone {
+		return nil
+	}
+
+	fixed := overlaySchema(table, declared)
+	x := &conflictResolver{
+		strategy: strategy,
+		fixed:    fixed,
+		merged:   copySchema(fixed),
+		counts:   map[string]*model.SchemaConflict{},
+	}
+
+	for _, record := range records {
+		data, ok := record.Data.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		overflow := map[string]any{}
+		x.merged = x.resolveObject(nil, data, x.merged, overflow)
+		addOverflow(data, overflow)
+	}
+
+	// Widened fields are converted after all records are checked, because a field can be widened by a later record.
+	sort.SliceStable(x.widened, func(i, j int) bool {
+		return len(x.widened[i]) < len(x.widened[j])
+	})
+	for _, record := range records {
+		data, ok := record.Data.(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, path := range x.widened {
+			convertPath(data, path, func(v any) any { return toJSONString(v) })
+		}
+	}
+
+	return x.conflicts
+}
+
+func (x *conflictResolver) resolveObject(path []string, data map[string]any, merged bigquery.Schema, overflow map[string]any) bigquery.Schema {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if len(path) == 0 && key == overflowFieldName {
+			continue
+		}
+		merged = x.resolveField(path, key, data, merged, overflow, false)
+	}
+	return merged
+}
+
+func (x *conflictResolver) resolveField(path []string, key string, data map[string]any, merged bigquery.Schema, overflow map[string]any, renamed bool) bigquery.Schema {
+	fieldPath := append(slices.Clone(path), key)
+	v := data[key]
+
+	var inferred *bigquery.FieldSchema
+	if schema, err := bqs.Infer(map[string]any{key: v}); err == nil {
+		if len(schema) == 0 {
+			// Type can not be determined, e.g. empty array
+			return merged
+		}
+		inferred = schema[0]
+	}
+
+	idx := slices.IndexFunc(merged, func(f *bigquery.FieldSchema) bool { return f.Name == key })
+	if idx < 0 {
+		if inferred != nil {
+			return append(merged, inferred)
+		}
+	} else if inferred != nil {
+		if field, ok := x.mergeField(fieldPath, merged[idx], inferred, v, overflow); ok {
+			merged[idx] = field
+			return merged
+		}
+	}
+
+	// Type conflict, or type of value can not be determined (e.g. array with mixed types)
+	strategy := x.strategy
+	if renamed {
+		strategy = types.ConflictOverflow
+	}
+	if strategy == types.ConflictWiden && !x.widen(fieldPath, &merged, idx) {
+		strategy = types.ConflictRename
+	}
+	x.count(fieldPath, strategy)
+
+	switch strategy {
+	case types.ConflictRename:
+		newKey := key + "__" + typeSuffix(inferred)
+		delete(data, key)
+		if inferred == nil {
+			data[newKey] = toJSONString(v)
+		} else {
+			data[newKey] = v
+		}
+		return x.resolveField(path, newKey, data, merged, overflow, true)
+
+	case types.ConflictOverflow:
+		delete(data, key)
+		overflow[strings.Join(fieldPath, ".")] = v
+	}
+
+	return merged
+}
+
+// mergeField merges inferred field into current field. It returns false if the types conflict.
+func (x *conflictResolver) mergeField(path []string, current, inferred *bigquery.FieldSchema, v any, overflow map[string]any) (*bigquery.FieldSchema, bool) {
+	if x.isWidened(path) {
+		// All values of widened field will be converted to string
+		if inferred.Type != bigquery.StringFieldType || inferred.Repeated {
+			x.count(path, types.ConflictWiden)
+		}
+		return current, true
+	}
+
+	if current.Repeated != inferred.Repeated {
+		return nil, false
+	}
+
+	switch {
+	case current.Type == bigquery.RecordFieldType && inferred.Type == bigquery.RecordFieldType:
+		field := *current
+		switch t := v.(type) {
+		case map[string]any:
+			field.Schema = x.resolveObject(path, t, current.Schema, overflow)
+		case []any:
+			for _, elem := range t {
+				if obj, ok := elem.(map[string]any); ok {
+					field.Schema = x.resolveObject(path, obj, field.Schema, overflow)
+				}
+			}
+		}
+		return &field, true
+
+	case current.Type == bigquery.TimestampFieldType && inferred.Type == bigquery.IntegerFieldType:
+		// Values of declared TIMESTAMP are already coerced to UNIX time in microseconds
+		return current, true
+
+	case current.Type == bigquery.JSONFieldType && inferred.Type == bigquery.StringFieldType:
+		// Values of JSON column are already encoded to JSON string
+		return current, true
+	}
+
+	merged, err := bqs.Merge(bigquery.Schema{current}, bigquery.Schema{inferred})
+	if err != nil || len(merged) != 1 {
+		return nil, false
+	}
+	return merged[0], true
+}
+
+// widen changes the field to STRING. It returns false if the field is fixed and not STRING.
+func (x *conflictResolver) widen(path []string, merged *bigquery.Schema, idx int) bool {
+	if fixed := lookupField(x.fixed, path); fixed != nil {
+		if fixed.Type != bigquery.StringFieldType || fixed.Repeated {
+			return false
+		}
+	} else if idx >= 0 {
+		(*merged)[idx] = &bigquery.FieldSchema{
+			Name:        (*merged)[idx].Name,
+			Type:        bigquery.StringFieldType,
+			Description: (*merged)[idx].Description,
+		}
+	} else {
+		*merged = append(*merged, &bigquery.FieldSchema{
+			Name: path[len(path)-1],
+			Type: bigquery.StringFieldType,
+		})
+	}
+
+	if !x.isWidened(path) {
+		x.widened = append(x.widened, path)
+	}
+	return true
+}
+
+func (x *conflictResolver) isWidened(path []string) bool {
+	return slices.ContainsFunc(x.widened, func(p []string) bool { return slices.Equal(p, path) })
+}
+
+func (x *conflictResolver) count(path []string, strategy types.ConflictStrategy) {
+	field := strings.Join(path, ".")
+	key := field + "/" + string(strategy)
+	if c, ok := x.counts[key]; ok {
+		c.Count++
+		return
+	}
+
+	c := &model.SchemaConflict{Field: field, Strategy: strategy, Count: 1}
+	x.counts[key] = c
+	x.conflicts = append(x.conflicts, c)
+}
+
+// addOverflow merges entries into `_overflow` field of data. The field has a JSON string of an object that keys are dot separated paths of values.
+func addOverflow(data map[string]any, entries map[string]any) {
+	if len(entries) == 0 {
+		return
+	}
+
+	merged := map[string]any{}
+	if current, ok := data[overflowFieldName].(string); ok {
+		_ = json.Unmarshal([]byte(current), &merged)
+	}
+	for k, v := range entries {
+		merged[k] = v
+	}
+
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return
+	}
+	data[overflowFieldName] = string(raw)
+}
+
+// lookupField returns a field of schema by path. It returns nil if not found.
+func lookupField(schema bigquery.Schema, path []string) *bigquery.FieldSchema {
+	for _, f := range schema {
+		if f.Name != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return f
+		}
+		return lookupField(f.Schema, path[1:])
+	}
+	return nil
+}
+
+// typeSuffix returns suffix of field name for rename strategy.
+func typeSuffix(field *bigquery.FieldSchema) string {
+	if field == nil {
+		return "str"
+	}
+
+	var suffix string
+	switch field.Type {
+	case bigquery.StringFieldType:
+		suffix = "str"
+	case bigquery.IntegerFieldType:
+		suffix = "int"
+	case bigquery.FloatFieldType:
+		suffix = "float"
+	case bigquery.BooleanFieldType:
+		suffix = "bool"
+	case bigquery.RecordFieldType:
+		suffix = "rec"
+	case bigquery.TimestampFieldType:
+		suffix = "ts"
+	default:
+		suffix = strings.ToLower(string(field.Type))
+	}
+
+	if field.Repeated {
+		suffix += "_arr"
+	}
+	return suffix
+}
+
+// convertPath replaces a value at path with the result of fn. Arrays in the middle of path are traversed.
+func convertPath(data map[string]any, path []string, fn func(v any) any) {
+	v, ok := data[path[0]]
+	if !ok || v == nil {
+		return
+	}
+
+	if len(path) == 1 {
+		data[path[0]] = fn(v)
+		return
+	}
+
+	switch t := v.(type) {
+	case map[string]any:
+		convertPath(t, path[1:], fn)
+	case []any:
+		for _, elem := range t {
+			if obj, ok := elem.(map[string]any); ok {
+				convertPath(obj, path[1:], fn)
+			}
+		}
+	}
+}
+
+// toJSONString converts a value to string. A string is returned as it is, and other values are encoded to JSON.
+func toJSONString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
@@ -3,32 +3,85 @@ package usecase
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
-	"cloud.google.com/go/storage"
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
 	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/utils"
 	"google.golang.org/api/iterator"
 )
 
+// Enqueue lists objects under URLs of the request and publishes them to Pub/Sub topic as model.SwarmMessage. Only objects matched with the filter of the request are published. If DryRun is true, objects are listed and counted without publishing.
+//
+// If checkpoint store is available, progress is saved as model.EnqueueCheckpoint after each publish. If Resume is true, listing continues after the last published object of the checkpoint.
 func (x *UseCase) Enqueue(ctx context.Context, req *model.EnqueueRequest) (*model.EnqueueResponse, error) {
 	startedAt := time.Now()
 	var (
 		totalCount int64
 		totalSize  int64
-		sizeLimit = int64(x.enqueueSizeLimit * 1024 * 1024) // MiB
+		batches    int64
+		sizeLimit  = int64(x.enqueueSizeLimit * 1024 * 1024) // MiB
 	)
 
+	if req.Filter != nil {
+		if err := req.Filter.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	checkpoint, err := x.setupEnqueueCheckpoint(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	store := x.clients.CheckpointStore()
+	if req.DryRun {
+		store = nil
+	}
+
+	// lastURL and lastName are position of the last object in objects to advance checkpoint on publish
+	var (
+		lastURL  int
+		lastName types.CSObjectID
+	)
+	publish := func(objects []*model.Object) error {
+		if req.DryRun {
+			return nil
+		}
+		if err := enqueueObjects(ctx, x.clients.PubSub(), objects); err != nil {
+			return err
+		}
+		batches++
+
+		checkpoint.Advance(lastURL, lastName)
+		return saveEnqueueCheckpoint(ctx, store, checkpoint)
+	}
+
+	var prefixes []*model.EnqueuePrefix
 	var objects []*model.Object
-	for _, url := range req.URLs {
+	for i, url := range req.URLs {
+		prefix := &model.EnqueuePrefix{URL: url}
+		prefixes = append(prefixes, prefix)
+
+		progress := checkpoint.Prefixes[i]
+		if progress.Completed {
+			utils.CtxLogger(ctx).Info("skip URL completed by previous run", "url", url)
+			continue
+		}
+
 		bucket, objPrefix, err := url.ParseAsCloudStorage()
 		if err != nil {
 			return nil, err
 		}
 
-		query := &storage.Query{
-			Prefix: objPrefix.String(),
+		query := req.Filter.Query(objPrefix)
+		if progress.LastObject != "" {
+			// Resume listing right after the last published object. StartOffset is inclusive, then the smallest name after it is used.
+			if next := progress.LastObject.String() + "\x00"; query.StartOffset < next {
+				query.StartOffset = next
+			}
 		}
 
 		it := x.clients.CloudStorage().List(ctx, bucket, query)
@@ -41,37 +94,100 @@ func (x *UseCase) Enqueue(ctx context.Context, req *model.EnqueueRequest) (*mode
 				return nil, goerr.Wrap(err, "failed to list objects")
 			}
 
+			if progress.LastObject != "" && attrs.Name <= progress.LastObject.String() {
+				continue
+			}
+			if !req.Filter.Match(attrs) {
+				continue
+			}
+
 			obj := model.NewObjectFromCloudStorageAttrs(attrs)
 			if obj.Size != nil {
 				totalSize += *obj.Size
+				prefix.Size += *obj.Size
 			}
 			totalCount++
+			prefix.Count++
 
-			if sumObjectSize(&obj, objects...) > int64(sizeLimit) ||
-				len(objects) >= x.enqueueCountLimit {
-				if err := enqueueObjects(ctx, x.clients.PubSub(), objects); err != nil {
+			if len(objects) > 0 && (sumObjectSize(&obj, objects...) > sizeLimit ||
+				len(objects) >= x.enqueueCountLimit) {
+				if err := publish(objects); err != nil {
 					return nil, err
 				}
 				objects = nil
 			}
 
 			objects = append(objects, &obj)
+			lastURL, lastName = i, obj.CS.Name
 		}
 	}
 
 	if len(objects) > 0 {
-		if err := enqueueObjects(ctx, x.clients.PubSub(), objects); err != nil {
+		if err := publish(objects); err != nil {
 			return nil, err
 		}
 	}
 
+	checkpoint.Complete()
+	if err := saveEnqueueCheckpoint(ctx, store, checkpoint); err != nil {
+		return nil, err
+	}
+
 	return &model.EnqueueResponse{
-		Elapsed: time.Since(startedAt),
-		Count:   totalCount,
-		Size:    totalSize,
+		Elapsed:  time.Since(startedAt),
+		Count:    totalCount,
+		Size:     totalSize,
+		Batches:  batches,
+		Prefixes: prefixes,
 	}, nil
 }
 
+// setupEnqueueCheckpoint returns the checkpoint saved by the previous run if Resume is true. Otherwise, or if no checkpoint is saved yet, it returns a new checkpoint.
+func (x *UseCase) setupEnqueueCheckpoint(ctx context.Context, req *model.EnqueueRequest) (*model.EnqueueCheckpoint, error) {
+	if !req.Resume {
+		return model.NewEnqueueCheckpoint(req), nil
+	}
+
+	store := x.clients.CheckpointStore()
+	if store == nil {
+		return nil, goerr.Wrap(types.ErrInvalidOption, "checkpoint store is required to resume enqueue")
+	}
+
+	checkpoint, err := store.GetEnqueueCheckpoint(ctx, req.CheckpointID())
+	if errors.Is(err, types.ErrCheckpointNotFound) {
+		checkpoint = model.NewEnqueueCheckpoint(req)
+		utils.CtxLogger(ctx).Info("no checkpoint to resume, start enqueue from the beginning", "checkpoint", checkpoint)
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !checkpoint.Match(req) {
+		return nil, goerr.Wrap(types.ErrCheckpointMismatch, "checkpoint is saved for another request",
+			goerr.V("id", checkpoint.ID),
+			goerr.V("prefixes", checkpoint.Prefixes),
+			goerr.V("filter", checkpoint.Filter),
+			goerr.V("urls", req.URLs),
+		)
+	}
+
+	utils.CtxLogger(ctx).Info("resume enqueue from checkpoint", "checkpoint", checkpoint)
+	return checkpoint, nil
+}
+
+// saveEnqueueCheckpoint saves the checkpoint if store is available.
+func saveEnqueueCheckpoint(ctx context.Context, store interfaces.CheckpointStore, checkpoint *model.EnqueueCheckpoint) error {
+	if store == nil {
+		return nil
+	}
+
+	checkpoint.UpdatedAt = time.Now()
+	if err := store.PutEnqueueCheckpoint(ctx, checkpoint); err != nil {
+		return goerr.Wrap(err, "failed to save checkpoint of enqueue", goerr.V("id", checkpoint.ID))
+	}
+	return nil
+}
+
 func sumObjectSize(newOjb *model.Object, objects ...*model.Object) int64 {
 	var sum int64
 	if newOjb.Size != nil {
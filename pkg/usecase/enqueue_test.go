@@ -3,7 +3,11 @@ package usecase_test
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"path/filepath"
+	"regexp"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/m-mizutani/gt"
@@ -11,6 +15,7 @@ import (
 	"github.com/secmon-lab/swarm/pkg/domain/model"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 	"github.com/secmon-lab/swarm/pkg/infra"
+	"github.com/secmon-lab/swarm/pkg/infra/checkpoint"
 	"github.com/secmon-lab/swarm/pkg/infra/cs"
 	"github.com/secmon-lab/swarm/pkg/infra/pubsub"
 	"github.com/secmon-lab/swarm/pkg/usecase"
@@ -58,3 +63,275 @@ func TestEnqueue(t *testing.T) {
 	})
 	gt.V(t, calledList).Equal(1)
 }
+
+func TestEnqueue_Filter(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	objects := []*storage.ObjectAttrs{
+		{Bucket: "bucket", Name: "logs/a.json", Size: 100, Created: base, Updated: base, StorageClass: "STANDARD"},
+		{Bucket: "bucket", Name: "logs/b.json", Size: 2000, Created: base.Add(24 * time.Hour), Updated: base.Add(24 * time.Hour), StorageClass: "STANDARD"},
+		{Bucket: "bucket", Name: "logs/c.txt", Size: 300, Created: base.Add(48 * time.Hour), Updated: base.Add(48 * time.Hour), StorageClass: "NEARLINE"},
+	}
+
+	var queries []*storage.Query
+	csMock := &cs.Mock{
+		MockList: func(ctx context.Context, bucket types.CSBucket, query *storage.Query) interfaces.CSObjectIterator {
+			queries = append(queries, query)
+			return &cs.MockObjectIterator{Attrs: objects}
+		},
+	}
+
+	testCases := map[string]struct {
+		filter *model.EnqueueFilter
+		names  []string
+	}{
+		"no filter": {
+			names: []string{"logs/a.json", "logs/b.json", "logs/c.txt"},
+		},
+		"offset": {
+			filter: &model.EnqueueFilter{StartOffset: "logs/b", EndOffset: "logs/c"},
+			names:  []string{"logs/b.json"},
+		},
+		"regex": {
+			filter: &model.EnqueueFilter{Regex: regexp.MustCompile(`\.json$`)},
+			names:  []string{"logs/a.json", "logs/b.json"},
+		},
+		"size": {
+			filter: &model.EnqueueFilter{MinSize: 200, MaxSize: 1000},
+			names:  []string{"logs/c.txt"},
+		},
+		"created time": {
+			filter: &model.EnqueueFilter{CreatedAfter: base.Add(time.Hour), CreatedBefore: base.Add(48 * time.Hour)},
+			names:  []string{"logs/b.json"},
+		},
+		"updated time": {
+			filter: &model.EnqueueFilter{UpdatedAfter: base.Add(24 * time.Hour)},
+			names:  []string{"logs/b.json", "logs/c.txt"},
+		},
+		"storage class": {
+			filter: &model.EnqueueFilter{StorageClasses: []string{"nearline"}},
+			names:  []string{"logs/c.txt"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			queries = nil
+			pubsubMock := pubsub.NewMock()
+			uc := usecase.New(infra.New(
+				infra.WithCloudStorage(csMock),
+				infra.WithPubSubTopic(pubsubMock),
+			))
+
+			resp := gt.R1(uc.Enqueue(context.Background(), &model.EnqueueRequest{
+				URLs:   []types.ObjectURL{"gs://bucket/logs/"},
+				Filter: tc.filter,
+			})).NoError(t)
+			gt.V(t, resp.Count).Equal(int64(len(tc.names)))
+
+			var names []string
+			for _, result := range pubsubMock.Results {
+				var msg model.SwarmMessage
+				gt.NoError(t, json.Unmarshal(result.Data, &msg))
+				for _, obj := range msg.Objects {
+					names = append(names, string(obj.CS.Name))
+				}
+			}
+			gt.Equal(t, names, tc.names)
+
+			gt.A(t, queries).Length(1).At(0, func(t testing.TB, v *storage.Query) {
+				gt.Equal(t, v.Prefix, "logs/")
+				if tc.filter != nil {
+					gt.Equal(t, v.StartOffset, tc.filter.StartOffset)
+					gt.Equal(t, v.EndOffset, tc.filter.EndOffset)
+				}
+			})
+		})
+	}
+
+	t.Run("glob is passed to query", func(t *testing.T) {
+		queries = nil
+		uc := usecase.New(infra.New(
+			infra.WithCloudStorage(csMock),
+			infra.WithPubSubTopic(pubsub.NewMock()),
+		))
+		gt.R1(uc.Enqueue(context.Background(), &model.EnqueueRequest{
+			URLs:   []types.ObjectURL{"gs://bucket/logs/"},
+			Filter: &model.EnqueueFilter{Glob: "logs/**/*.json"},
+		})).NoError(t)
+		gt.A(t, queries).Length(1).At(0, func(t testing.TB, v *storage.Query) {
+			gt.Equal(t, v.MatchGlob, "logs/**/*.json")
+		})
+	})
+
+	t.Run("dry run reports matched objects without publishing", func(t *testing.T) {
+		pubsubMock := pubsub.NewMock()
+		uc := usecase.New(infra.New(
+			infra.WithCloudStorage(csMock),
+			infra.WithPubSubTopic(pubsubMock),
+		))
+
+		resp := gt.R1(uc.Enqueue(context.Background(), &model.EnqueueRequest{
+			URLs:   []types.ObjectURL{"gs://bucket/logs/", "gs://bucket/other/"},
+			Filter: &model.EnqueueFilter{Regex: regexp.MustCompile(`\.json$`)},
+			DryRun: true,
+		})).NoError(t)
+
+		gt.A(t, pubsubMock.Results).Length(0)
+		gt.V(t, resp.Count).Equal(4)
+		gt.V(t, resp.Size).Equal(4200)
+		gt.A(t, resp.Prefixes).Length(2).At(0, func(t testing.TB, v *model.EnqueuePrefix) {
+			gt.Equal(t, v.URL, "gs://bucket/logs/")
+			gt.V(t, v.Count).Equal(2)
+			gt.V(t, v.Size).Equal(2100)
+		})
+	})
+
+	t.Run("invalid filter", func(t *testing.T) {
+		uc := usecase.New(infra.New(
+			infra.WithCloudStorage(csMock),
+			infra.WithPubSubTopic(pubsub.NewMock()),
+		))
+		_, err := uc.Enqueue(context.Background(), &model.EnqueueRequest{
+			URLs:   []types.ObjectURL{"gs://bucket/logs/"},
+			Filter: &model.EnqueueFilter{MinSize: 1000, MaxSize: 100},
+		})
+		gt.Error(t, err).Is(types.ErrInvalidOption)
+	})
+}
+
+func TestEnqueue_Resume(t *testing.T) {
+	ctx := context.Background()
+	listed := map[types.CSBucket][]string{
+		"bucket-a": {"a1", "a2", "a3", "a4", "a5"},
+		"bucket-b": {"b1", "b2"},
+	}
+	var queries []*storage.Query
+	csMock := &cs.Mock{
+		MockList: func(ctx context.Context, bucket types.CSBucket, query *storage.Query) interfaces.CSObjectIterator {
+			queries = append(queries, query)
+			var attrs []*storage.ObjectAttrs
+			for _, name := range listed[bucket] {
+				attrs = append(attrs, &storage.ObjectAttrs{Bucket: string(bucket), Name: name, Size: 1})
+			}
+			return &cs.MockObjectIterator{Attrs: attrs}
+		},
+	}
+
+	var published []string
+	newTopic := func(failAt int) *pubsub.Mock {
+		var calls int
+		return &pubsub.Mock{
+			MockPublish: func(ctx context.Context, data []byte, options ...model.PublishOption) (types.PubSubMessageID, error) {
+				calls++
+				if calls == failAt {
+					return "", io.ErrUnexpectedEOF
+				}
+				var msg model.SwarmMessage
+				gt.NoError(t, json.Unmarshal(data, &msg))
+				for _, obj := range msg.Objects {
+					published = append(published, string(obj.CS.Name))
+				}
+				return "", nil
+			},
+		}
+	}
+
+	store := checkpoint.NewFile(filepath.Join(t.TempDir(), "checkpoint.json"))
+	newUseCase := func(topic *pubsub.Mock) *usecase.UseCase {
+		return usecase.New(infra.New(
+			infra.WithCloudStorage(csMock),
+			infra.WithPubSubTopic(topic),
+			infra.WithCheckpointStore(store),
+		), usecase.WithEnqueueCountLimit(2))
+	}
+	req := &model.EnqueueRequest{
+		URLs: []types.ObjectURL{"gs://bucket-a/", "gs://bucket-b/"},
+	}
+
+	// The third batch [a5, b1] fails
+	_, err := newUseCase(newTopic(3)).Enqueue(ctx, req)
+	gt.Error(t, err).Is(io.ErrUnexpectedEOF)
+	gt.Equal(t, published, []string{"a1", "a2", "a3", "a4"})
+
+	saved := gt.R1(store.GetEnqueueCheckpoint(ctx, req.CheckpointID())).NoError(t)
+	gt.Equal(t, saved.BatchCount, 2)
+	gt.Equal(t, saved.Prefixes[0].LastObject, "a4")
+	gt.False(t, saved.Completed)
+
+	// Resume publishes only objects after the checkpoint
+	queries = nil
+	resumeReq := *req
+	resumeReq.Resume = true
+	resp := gt.R1(newUseCase(newTopic(0)).Enqueue(ctx, &resumeReq)).NoError(t)
+	gt.Equal(t, published, []string{"a1", "a2", "a3", "a4", "a5", "b1", "b2"})
+	gt.V(t, resp.Count).Equal(3)
+	gt.V(t, resp.Batches).Equal(2)
+	gt.A(t, queries).Length(2).At(0, func(t testing.TB, v *storage.Query) {
+		gt.Equal(t, v.StartOffset, "a4\x00")
+	})
+
+	saved = gt.R1(store.GetEnqueueCheckpoint(ctx, req.CheckpointID())).NoError(t)
+	gt.Equal(t, saved.BatchCount, 4)
+	gt.True(t, saved.Completed)
+
+	// Completed enqueue publishes nothing by resume
+	resp = gt.R1(newUseCase(newTopic(0)).Enqueue(ctx, &resumeReq)).NoError(t)
+	gt.V(t, resp.Count).Equal(0)
+	gt.A(t, published).Length(7)
+
+	t.Run("checkpoint of another request is not resumed", func(t *testing.T) {
+		otherReq := &model.EnqueueRequest{
+			URLs:   []types.ObjectURL{"gs://bucket-a/"},
+			Resume: true,
+		}
+		_, err := newUseCase(newTopic(0)).Enqueue(ctx, otherReq)
+		gt.Error(t, err).Is(types.ErrCheckpointMismatch)
+	})
+
+	t.Run("checkpoint with different prefixes or filter is not resumed", func(t *testing.T) {
+		store := checkpoint.NewFile(filepath.Join(t.TempDir(), "checkpoint.json"))
+		uc := usecase.New(infra.New(
+			infra.WithCloudStorage(csMock),
+			infra.WithPubSubTopic(newTopic(0)),
+			infra.WithCheckpointStore(store),
+		))
+
+		differentURL := model.NewEnqueueCheckpoint(req)
+		differentURL.Prefixes[1].URL = "gs://bucket-c/"
+		gt.NoError(t, store.PutEnqueueCheckpoint(ctx, differentURL))
+		_, err := uc.Enqueue(ctx, &resumeReq)
+		gt.Error(t, err).Is(types.ErrCheckpointMismatch)
+
+		differentFilter := model.NewEnqueueCheckpoint(req)
+		differentFilter.Filter = (&model.EnqueueFilter{Glob: "*.json"}).Fingerprint()
+		gt.NoError(t, store.PutEnqueueCheckpoint(ctx, differentFilter))
+		_, err = uc.Enqueue(ctx, &resumeReq)
+		gt.Error(t, err).Is(types.ErrCheckpointMismatch)
+	})
+
+	t.Run("resume without checkpoint starts from the beginning", func(t *testing.T) {
+		published = nil
+		store := checkpoint.NewFile(filepath.Join(t.TempDir(), "checkpoint.json"))
+		uc := usecase.New(infra.New(
+			infra.WithCloudStorage(csMock),
+			infra.WithPubSubTopic(newTopic(0)),
+			infra.WithCheckpointStore(store),
+		), usecase.WithEnqueueCountLimit(2))
+
+		resp := gt.R1(uc.Enqueue(ctx, &resumeReq)).NoError(t)
+		gt.Equal(t, published, []string{"a1", "a2", "a3", "a4", "a5", "b1", "b2"})
+		gt.V(t, resp.Count).Equal(7)
+
+		saved := gt.R1(store.GetEnqueueCheckpoint(ctx, req.CheckpointID())).NoError(t)
+		gt.True(t, saved.Completed)
+	})
+
+	t.Run("resume requires checkpoint store", func(t *testing.T) {
+		uc := usecase.New(infra.New(
+			infra.WithCloudStorage(csMock),
+			infra.WithPubSubTopic(newTopic(0)),
+		))
+		_, err := uc.Enqueue(ctx, &resumeReq)
+		gt.Error(t, err).Is(types.ErrInvalidOption)
+	})
+}
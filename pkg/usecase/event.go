@@ -2,6 +2,7 @@ package usecase
 
 import (
 	"context"
+	"log/slog"
 
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/secmon-lab/swarm/pkg/domain/model"
@@ -9,8 +10,11 @@ import (
 )
 
 func (x *UseCase) ObjectToSources(ctx context.Context, obj model.Object) ([]*model.Source, error) {
+	printer := x.regoPrint.newPrinter(ctx, slog.Any("object", objectURL(obj)))
+	defer printer.Flush()
+
 	var event model.EventPolicyOutput
-	if err := x.clients.Policy().Query(ctx, "data.event", obj, &event); err != nil {
+	if err := x.clients.Policy().Query(ctx, "data.event", obj, &event, printer.Option()); err != nil {
 		return nil, err
 	}
 	if len(event.Sources) == 0 {
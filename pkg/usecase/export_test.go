@@ -1,7 +1,11 @@
 package usecase
 
 var (
+	BuildBQMetadata     = buildBQMetadata
 	CloneWithoutNil     = cloneWithoutNil
 	CreateOrUpdateTable = createOrUpdateTable
+	DiffSchema          = diffSchema
 	IngestRecords       = ingestRecords
+
+	WithJobLeaseExtension = withJobLeaseExtension
 )
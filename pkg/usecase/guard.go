@@ -0,0 +1,364 @@
+package usecase
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/utils"
+)
+
+// validFieldName is a pattern of column name that can be used in BigQuery and Storage Write API.
+var validFieldName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,299}$`)
+
+// invalidFieldNameChar is a pattern of characters that can not be used in column name.
+var invalidFieldNameChar = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// sanitizeFieldName replaces characters that can not be used in column name with `_`.
+func sanitizeFieldName(name string) string {
+	name = invalidFieldNameChar.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	if len(name) > 300 {
+		name = name[:300]
+	}
+	return name
+}
+
+// guardFieldNames checks field names of LogRecord.Data and applies the action to invalid names. It returns dot separated paths of invalid fields.
+func guardFieldNames(action types.GuardAction, records []*model.LogRecord) ([]string, error) {
+	if action == types.GuardNone {
+		return nil, nil
+	}
+
+	var invalid []string
+	for _, record := range records {
+		data, ok := record.Data.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		overflow := map[string]any{}
+		if err := guardObjectFieldNames(action, nil, data, overflow, &invalid); err != nil {
+			return nil, err
+		}
+		addOverflow(data, overflow)
+	}
+
+	return invalid, nil
+}
+
+func guardObjectFieldNames(action types.GuardAction, path []string, data map[string]any, overflow map[string]any, invalid *[]string) error {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v := data[key]
+		fieldPath := append(slices.Clone(path), key)
+
+		if !validFieldName.MatchString(key) {
+			field := strings.Join(fieldPath, ".")
+			if !slices.Contains(*invalid, field) {
+				*invalid = append(*invalid, field)
+			}
+
+			switch action {
+			case types.GuardReject:
+				return goerr.Wrap(types.ErrInvalidFieldName, "field name can not be used as column name", goerr.V("field", field))
+
+			case types.GuardJSON:
+				delete(data, key)
+				overflow[field] = v
+				continue
+
+			case types.GuardRename:
+				newKey := sanitizeFieldName(key)
+				for {
+					if _, exists := data[newKey]; !exists {
+						break
+					}
+					newKey += "_"
+				}
+				delete(data, key)
+				data[newKey] = v
+				fieldPath[len(fieldPath)-1] = newKey
+			}
+		}
+
+		switch t := v.(type) {
+		case map[string]any:
+			if err := guardObjectFieldNames(action, fieldPath, t, overflow, invalid); err != nil {
+				return err
+			}
+		case []any:
+			// Values removed from elements are gathered into an array for each path as with removePath
+			gathered := map[string][]any{}
+			for _, elem := range t {
+				if obj, ok := elem.(map[string]any); ok {
+					elemOverflow := map[string]any{}
+					if err := guardObjectFieldNames(action, fieldPath, obj, elemOverflow, invalid); err != nil {
+						return err
+					}
+					for field, removed := range elemOverflow {
+						gathered[field] = append(gathered[field], removed)
+					}
+				}
+			}
+			for field, values := range gathered {
+				overflow[field] = values
+			}
+		}
+	}
+
+	return nil
+}
+
+// guardDepth applies the action to objects at maxDepth in LogRecord.Data. With GuardJSON, the objects are encoded to JSON string and it returns paths of them relative to LogRecord.Data. Depth of fields in LogRecord.Data starts from 2 because `data` itself is depth 1.
+func guardDepth(maxDepth int, action types.GuardAction, records []*model.LogRecord) ([][]string, error) {
+	if maxDepth < 2 {
+		return nil, nil
+	}
+
+	var paths [][]string
+	for _, record := range records {
+		data, ok := record.Data.(map[string]any)
+		if !ok {
+			continue
+		}
+		if err := guardObjectDepth(maxDepth, action, nil, data, &paths); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+func guardObjectDepth(maxDepth int, action types.GuardAction, path []string, data map[string]any, paths *[][]string) error {
+	for key, v := range data {
+		fieldPath := append(slices.Clone(path), key)
+		depth := len(fieldPath) + 1
+
+		if depth < maxDepth {
+			switch t := v.(type) {
+			case map[string]any:
+				if err := guardObjectDepth(maxDepth, action, fieldPath, t, paths); err != nil {
+					return err
+				}
+			case []any:
+				for _, elem := range t {
+					if obj, ok := elem.(map[string]any); ok {
+						if err := guardObjectDepth(maxDepth, action, fieldPath, obj, paths); err != nil {
+							return err
+						}
+					}
+				}
+			}
+			continue
+		}
+
+		if !hasObject(v) {
+			continue
+		}
+		if action == types.GuardReject {
+			return goerr.Wrap(types.ErrSchemaLimitExceeded, "nesting depth exceeds limit",
+				goerr.V("field", strings.Join(fieldPath, ".")),
+				goerr.V("max_depth", maxDepth),
+			)
+		}
+
+		data[key] = encodeJSONValue(v)
+		if !slices.ContainsFunc(*paths, func(p []string) bool { return slices.Equal(p, fieldPath) }) {
+			*paths = append(*paths, fieldPath)
+		}
+	}
+	return nil
+}
+
+// hasObject returns true if v is an object or an array including an object. Such a value creates nested columns.
+func hasObject(v any) bool {
+	switch t := v.(type) {
+	case map[string]any:
+		return true
+	case []any:
+		return slices.ContainsFunc(t, func(elem any) bool {
+			_, ok := elem.(map[string]any)
+			return ok
+		})
+	}
+	return false
+}
+
+// countColumns returns number of columns including nested fields.
+func countColumns(schema bigquery.Schema) int {
+	n := 0
+	for _, f := range schema {
+		n += 1 + countColumns(f.Schema)
+	}
+	return n
+}
+
+// newColumn is a field in schema that does not exist in the table.
+type newColumn struct {
+	path  []string
+	count int
+}
+
+// newColumns returns top-most fields of schema that do not exist in base. Fields of `data` are returned individually even if `data` itself is new.
+func newColumns(base, schema bigquery.Schema, prefix []string) []newColumn {
+	var columns []newColumn
+	for _, f := range schema {
+		path := append(slices.Clone(prefix), f.Name)
+		idx := slices.IndexFunc(base, func(b *bigquery.FieldSchema) bool { return b.Name == f.Name })
+
+		switch {
+		case len(prefix) == 0 && f.Name == dataFieldName && f.Type == bigquery.RecordFieldType:
+			var sub bigquery.Schema
+			if idx >= 0 {
+				sub = base[idx].Schema
+			} else {
+				columns = append(columns, newColumn{path: path, count: 1})
+			}
+			columns = append(columns, newColumns(sub, f.Schema, path)...)
+
+		case idx < 0:
+			columns = append(columns, newColumn{path: path, count: 1 + countColumns(f.Schema)})
+
+		case f.Type == bigquery.RecordFieldType && base[idx].Type == bigquery.RecordFieldType:
+			columns = append(columns, newColumns(base[idx].Schema, f.Schema, path)...)
+		}
+	}
+	return columns
+}
+
+// guardColumns checks number of columns of the table after merging schema. With GuardJSON, values of new fields that exceed the limit are moved to `_overflow` column, and it returns paths of moved fields relative to LogRecord.Data. table can be nil.
+func guardColumns(maxColumns int, action types.GuardAction, table, schema bigquery.Schema, records []*model.LogRecord) ([]string, error) {
+	if maxColumns <= 0 {
+		return nil, nil
+	}
+
+	columns := newColumns(table, schema, nil)
+	total := countColumns(table)
+	for _, c := range columns {
+		total += c.count
+	}
+	if total <= maxColumns {
+		return nil, nil
+	}
+
+	if action == types.GuardReject {
+		return nil, goerr.Wrap(types.ErrSchemaLimitExceeded, "number of columns exceeds limit",
+			goerr.V("columns", total),
+			goerr.V("max_columns", maxColumns),
+		)
+	}
+
+	// Columns out of `data` are always required. Fields of `data` are added in order of name while the number of columns is in the limit.
+	budget := maxColumns - countColumns(table)
+	var dataColumns []newColumn
+	for _, c := range columns {
+		if c.path[0] == dataFieldName && len(c.path) > 1 {
+			dataColumns = append(dataColumns, c)
+		} else {
+			budget -= c.count
+		}
+	}
+	if lookupField(table, []string{dataFieldName, overflowFieldName}) == nil {
+		budget--
+	}
+
+	sort.Slice(dataColumns, func(i, j int) bool {
+		return strings.Join(dataColumns[i].path, ".") < strings.Join(dataColumns[j].path, ".")
+	})
+
+	var moved [][]string
+	for _, c := range dataColumns {
+		if c.count <= budget {
+			budget -= c.count
+			continue
+		}
+		moved = append(moved, c.path[1:])
+	}
+
+	var fields []string
+	for _, path := range moved {
+		fields = append(fields, strings.Join(path, "."))
+	}
+
+	for _, record := range records {
+		data, ok := record.Data.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		overflow := map[string]any{}
+		for i, path := range moved {
+			if v, ok := removePath(data, path); ok {
+				overflow[fields[i]] = v
+			}
+		}
+		addOverflow(data, overflow)
+	}
+
+	return fields, nil
+}
+
+// removePath removes a value at path and returns it. If an array is in the middle of path, values of each element are returned as an array.
+func removePath(data map[string]any, path []string) (any, bool) {
+	v, ok := data[path[0]]
+	if !ok {
+		return nil, false
+	}
+
+	if len(path) == 1 {
+		delete(data, path[0])
+		return v, true
+	}
+
+	switch t := v.(type) {
+	case map[string]any:
+		return removePath(t, path[1:])
+	case []any:
+		var values []any
+		for _, elem := range t {
+			if obj, ok := elem.(map[string]any); ok {
+				if v, ok := removePath(obj, path[1:]); ok {
+					values = append(values, v)
+				}
+			}
+		}
+		return values, len(values) > 0
+	}
+	return nil, false
+}
+
+// warnSchemaGrowth reports a warning if number of columns grows beyond the threshold of guard.
+func warnSchemaGrowth(ctx context.Context, guard *model.SchemaGuard, dst model.BigQueryDest, old *bigquery.TableMetadata, merged bigquery.Schema) {
+	if guard == nil || guard.GrowthWarning <= 0 {
+		return
+	}
+
+	var before int
+	if old != nil {
+		before = countColumns(old.Schema)
+	}
+	after := countColumns(merged)
+	if after <= before || after <= guard.GrowthWarning {
+		return
+	}
+
+	utils.HandleWarning(ctx, "table schema grows beyond threshold",
+		"dst", dst,
+		"before", before,
+		"after", after,
+		"threshold", guard.GrowthWarning,
+	)
+}
@@ -3,114 +3,436 @@ package usecase
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
 	"github.com/m-mizutani/goerr/v2"
 	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
 	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
 	"github.com/secmon-lab/swarm/pkg/utils"
+	"golang.org/x/sync/errgroup"
 )
 
-func (x *UseCase) RunWithSubscriptions(ctx context.Context, subscriptions []string) error {
+// jobConfig is configuration of the worker pulling messages from Pub/Sub subscriptions.
+type jobConfig struct {
+	// concurrency is number of messages processed concurrently for each subscription.
+	concurrency int
+	// pullSize is max number of messages pulled at once.
+	pullSize int
+	// maxOutstandingMessages and maxOutstandingBytes are limits of messages that are pulled but not acknowledged yet. Zero maxOutstandingBytes means no limit.
+	maxOutstandingMessages int
+	maxOutstandingBytes    int
+	// idleTimeout is a duration to stop the worker if no message is available. Zero means the worker runs until canceled.
+	idleTimeout time.Duration
+	// drainTimeout is a duration to wait for in-flight messages after the worker is stopped. Zero means waiting until all of them are completed.
+	drainTimeout time.Duration
+	// leaseExtension is ack deadline set to pulled messages, and extended periodically until they are acknowledged.
+	leaseExtension time.Duration
+	// pullTimeout is max duration of a pull request waiting for messages.
+	pullTimeout time.Duration
+	// nackDelay is a delay of redelivery of a message that failed to be processed. It is doubled for each delivery attempt up to maxNackDelay.
+	nackDelay time.Duration
+}
+
+// releaseMessageTimeout is a timeout to acknowledge or nack a message.
+const releaseMessageTimeout = 10 * time.Second
+
+// maxNackDelay is the max ack deadline of Pub/Sub.
+const maxNackDelay = 600 * time.Second
+
+// errJobIdle is a cause to stop the worker when no message is available for idleTimeout.
+var errJobIdle = errors.New("subscription is idle")
+
+func (x *UseCase) RunWithSubscriptions(ctx context.Context, subscriptions []*model.Subscription) error {
 	utils.CtxLogger(ctx).Info("starting job", "subscriptions", subscriptions)
 
-	for _, subName := range subscriptions {
-		if err := x.runWithSubscription(ctx, subName); err != nil {
-			return err
-		}
+	eg, ctx := errgroup.WithContext(ctx)
+	for _, sub := range subscriptions {
+		eg.Go(func() error {
+			return x.runWithSubscription(ctx, sub)
+		})
+	}
+
+	return eg.Wait()
+}
+
+// pulledMessage is a message that is pulled from the subscription and not acknowledged yet. Its lease is extended until release is called.
+type pulledMessage struct {
+	msg       *pubsubpb.ReceivedMessage
+	stopLease context.CancelFunc
+	leaseDone chan struct{}
+}
+
+func (x *pulledMessage) size() int {
+	return len(x.msg.GetMessage().GetData())
+}
+
+// runWithSubscription pulls and processes messages of the subscription until ctx is canceled or the subscription is idle for idleTimeout. A message that failed to be processed is returned to the subscription with delay, and the worker continues. After stop of pulling, messages in-flight are completed and messages waiting in the queue are returned to the subscription.
+func (x *UseCase) runWithSubscription(ctx context.Context, sub *model.Subscription) error {
+	subName := sub.Name
+	logger := utils.CtxLogger(ctx).With("subscription", subName)
+	logger.Info("starting job")
+
+	client := x.clients.PubSubSubscription()
+	cfg := x.job
+
+	// procCtx is not canceled with ctx to complete in-flight messages after stop of pulling
+	procCtx, cancelProc := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelProc()
+
+	pullCtx, stopPull := context.WithCancelCause(ctx)
+	defer stopPull(nil)
+
+	flow := newFlowControl(cfg.maxOutstandingMessages, cfg.maxOutstandingBytes)
+	queue := make(chan *pulledMessage, cfg.maxOutstandingMessages)
+
+	var wg sync.WaitGroup
+	for range cfg.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range queue {
+				if pullCtx.Err() != nil {
+					x.releaseMessage(procCtx, client, subName, m, false, 0)
+					flow.release(m.size())
+					continue
+				}
+
+				if err := x.processPulledMessage(procCtx, sub.Schema, m.msg); errors.Is(err, types.ErrBlockingPubSub) {
+					delay := nackDelay(x.job.nackDelay, m.msg.GetDeliveryAttempt())
+					logger.Info("message is being processed by another process, retry later",
+						"messageID", m.msg.GetMessage().GetMessageId(),
+						"nackDelay", delay,
+						"error", err,
+					)
+					x.releaseMessage(procCtx, client, subName, m, false, delay)
+				} else if err != nil && procCtx.Err() != nil {
+					// Canceled by drain timeout. The message is returned to be redelivered immediately
+					logger.Warn("message is canceled by drain timeout, returning it",
+						"messageID", m.msg.GetMessage().GetMessageId(),
+						"error", err,
+					)
+					x.releaseMessage(procCtx, client, subName, m, false, 0)
+				} else if err != nil {
+					delay := nackDelay(x.job.nackDelay, m.msg.GetDeliveryAttempt())
+					utils.HandleError(procCtx, "failed to process message", goerr.Wrap(err, "failed to process message",
+						goerr.V("subscription", subName),
+						goerr.V("messageID", m.msg.GetMessage().GetMessageId()),
+						goerr.V("deliveryAttempt", m.msg.GetDeliveryAttempt()),
+						goerr.V("nackDelay", delay),
+					))
+					x.releaseMessage(procCtx, client, subName, m, false, delay)
+				} else {
+					x.releaseMessage(procCtx, client, subName, m, true, 0)
+				}
+				flow.release(m.size())
+			}
+		}()
+	}
+
+	pullErr := x.pullMessages(pullCtx, client, subName, flow, queue, stopPull)
+	close(queue)
+
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	var drainTimeout <-chan time.Time
+	if cfg.drainTimeout > 0 {
+		timer := time.NewTimer(cfg.drainTimeout)
+		defer timer.Stop()
+		drainTimeout = timer.C
+	}
+	select {
+	case <-drained:
+	case <-drainTimeout:
+		logger.Warn("drain timeout exceeded, canceling in-flight messages", "timeout", cfg.drainTimeout)
+		cancelProc()
+		<-drained
 	}
 
+	if pullErr != nil {
+		return pullErr
+	}
+	logger.Info("job stopped")
 	return nil
 }
 
-func (x *UseCase) runWithSubscription(ctx context.Context, subName string) error {
-	utils.CtxLogger(ctx).Info("starting job", "subscription", subName)
+// pullMessages pulls messages within limits of flow control and puts them into queue until ctx is done. It stops the worker by stop if the subscription is idle for idleTimeout.
+func (x *UseCase) pullMessages(ctx context.Context, client interfaces.PubSubSubscription, subName string, flow *flowControl, queue chan<- *pulledMessage, stop context.CancelCauseFunc) error {
+	cfg := x.job
+	pullTimeout := cfg.pullTimeout
+	if cfg.idleTimeout > 0 && cfg.idleTimeout < pullTimeout {
+		pullTimeout = cfg.idleTimeout
+	}
 
-	pullClient := x.clients.PubSubSubscription()
 	for {
-		resp, err := pullClient.Pull(ctx, subName)
+		n, err := flow.wait(ctx, cfg.pullSize)
 		if err != nil {
-			return err
+			return nil
 		}
-		if len(resp) == 0 {
-			utils.CtxLogger(ctx).Info("no message in subscription", "subscription", subName)
+
+		pullCtx, cancel := context.WithTimeout(ctx, pullTimeout)
+		msgs, err := client.Pull(pullCtx, subName, n)
+		timedOut := pullCtx.Err() != nil
+		cancel()
+
+		if ctx.Err() != nil {
+			// Messages pulled just before stop are returned to the subscription
+			for _, msg := range msgs {
+				if err := client.ModifyAckDeadline(context.WithoutCancel(ctx), subName, msg.AckId, 0); err != nil {
+					utils.HandleError(ctx, "failed to nack message", err)
+				}
+			}
 			return nil
 		}
+		if err != nil && !timedOut {
+			return goerr.Wrap(err, "failed to pull messages", goerr.V("subscription", subName))
+		}
 
-		for _, msg := range resp {
-			ctx, cancel := context.WithCancel(ctx)
-			defer cancel()
+		if len(msgs) == 0 {
+			if cfg.idleTimeout > 0 && flow.idleFor() >= cfg.idleTimeout {
+				utils.CtxLogger(ctx).Info("no message in subscription, stopping job", "subscription", subName, "idle", cfg.idleTimeout)
+				stop(errJobIdle)
+				return nil
+			}
+			continue
+		}
 
+		for _, msg := range msgs {
+			leaseCtx, stopLease := context.WithCancel(context.WithoutCancel(ctx))
+			m := &pulledMessage{
+				msg:       msg,
+				stopLease: stopLease,
+				leaseDone: make(chan struct{}),
+			}
 			go func() {
-				if err := loopExtendPubSubMessageDeadline(ctx, pullClient, subName, msg.AckId); err != nil {
-					utils.CtxLogger(ctx).Error("failed to extend deadline", "error", err)
+				defer close(m.leaseDone)
+				if err := extendPubSubMessageLease(leaseCtx, client, subName, msg.AckId, cfg.leaseExtension); err != nil {
+					utils.HandleError(ctx, "failed to extend deadline", err)
 				}
 			}()
 
-			if err := x.processPubSubMessage(ctx, msg); err != nil {
-				return err
-			}
+			flow.acquire(m.size())
+			queue <- m
+		}
+	}
+}
 
-			if err := pullClient.Acknowledge(ctx, subName, msg.AckId); err != nil {
-				return err
-			}
+// releaseMessage stops lease extension of the message, and acknowledges it if ack is true. Otherwise, the message is returned to the subscription and redelivered after delay.
+//
+// The message is released with a context that is not canceled by ctx, because messages are also released after in-flight processing is canceled by drain timeout.
+func (x *UseCase) releaseMessage(ctx context.Context, client interfaces.PubSubSubscription, subName string, m *pulledMessage, ack bool, delay time.Duration) {
+	m.stopLease()
+	<-m.leaseDone
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseMessageTimeout)
+	defer cancel()
+
+	if ack {
+		if err := client.Acknowledge(ctx, subName, m.msg.AckId); err != nil {
+			utils.HandleError(ctx, "failed to acknowledge message", err)
 		}
+		return
+	}
+
+	if err := client.ModifyAckDeadline(ctx, subName, m.msg.AckId, delay); err != nil {
+		utils.HandleError(ctx, "failed to nack message", err)
 	}
 }
 
-func loopExtendPubSubMessageDeadline(ctx context.Context, client interfaces.PubSubSubscription, subName string, ackID string) error {
-	tickInterval := 60 * time.Second
-	extendDuration := 90 * time.Second
+// nackDelay returns delay of redelivery for the delivery attempt. The attempt is zero if dead lettering is not enabled on the subscription, and then base is used.
+func nackDelay(base time.Duration, attempt int32) time.Duration {
+	delay := base
+	for i := int32(1); i < attempt && delay < maxNackDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxNackDelay)
+}
 
-	tick := time.NewTicker(tickInterval)
+// extendPubSubMessageLease sets ack deadline of the message to extension, and extends it periodically until ctx is canceled.
+func extendPubSubMessageLease(ctx context.Context, client interfaces.PubSubSubscription, subName string, ackID string, extension time.Duration) error {
+	if err := client.ModifyAckDeadline(ctx, subName, ackID, extension); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	tick := time.NewTicker(extension * 2 / 3)
 	defer tick.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			if ctx.Err() == context.Canceled {
-				return nil
-			}
-			return ctx.Err()
+			return nil
 
 		case <-tick.C:
-			utils.CtxLogger(ctx).Info("extend deadline", "subscription", subName, "ackID", ackID)
-			if err := client.ModifyAckDeadline(ctx, subName, ackID, extendDuration); err != nil {
+			utils.CtxLogger(ctx).Debug("extend deadline", "subscription", subName, "ackID", ackID)
+			if err := client.ModifyAckDeadline(ctx, subName, ackID, extension); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
 				return err
 			}
 		}
 	}
 }
 
-func (x *UseCase) processPubSubMessage(ctx context.Context, msg *pubsubpb.ReceivedMessage) error {
-	logger := utils.CtxLogger(ctx)
-	logger.Info("processing message", "message", msg)
+// flowControl limits number and total size of outstanding messages. Size of messages is known only after pulling, so the total size can exceed the limit by one pull.
+type flowControl struct {
+	maxMessages int
+	maxBytes    int
 
-	// Decode message
-	var event model.CloudStorageEvent
-	if err := json.Unmarshal(msg.Message.Data, &event); err != nil {
-		return err
+	mutex      sync.Mutex
+	messages   int
+	bytes      int
+	lastActive time.Time
+	released   chan struct{}
+}
+
+func newFlowControl(maxMessages, maxBytes int) *flowControl {
+	return &flowControl{
+		maxMessages: maxMessages,
+		maxBytes:    maxBytes,
+		lastActive:  time.Now(),
+		released:    make(chan struct{}, 1),
 	}
-	logger.Info("decoded message", "event", event)
+}
 
-	obj := event.ToObject()
-	sources, err := x.ObjectToSources(ctx, obj)
-	if err != nil {
-		return goerr.Wrap(err, "failed to convert event to sources", goerr.V("event", event))
+// wait blocks until a message can be pulled, and returns number of messages that can be pulled up to limit.
+func (x *flowControl) wait(ctx context.Context, limit int) (int, error) {
+	for {
+		x.mutex.Lock()
+		available := x.maxMessages - x.messages
+		bytesOK := x.maxBytes <= 0 || x.bytes < x.maxBytes
+		x.mutex.Unlock()
+
+		if available > 0 && bytesOK {
+			return min(available, limit), nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-x.released:
+		}
 	}
+}
+
+func (x *flowControl) acquire(size int) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.messages++
+	x.bytes += size
+	x.lastActive = time.Now()
+}
+
+func (x *flowControl) release(size int) {
+	x.mutex.Lock()
+	x.messages--
+	x.bytes -= size
+	x.lastActive = time.Now()
+	x.mutex.Unlock()
+
+	select {
+	case x.released <- struct{}{}:
+	default:
+	}
+}
 
-	loadReq := make([]*model.LoadRequest, len(sources))
-	for i := range sources {
-		loadReq[i] = &model.LoadRequest{
-			Object: event.ToObject(),
-			Source: *sources[i],
+// idleFor returns duration since the last message is pulled or released. It returns zero if any message is outstanding.
+func (x *flowControl) idleFor() time.Duration {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.messages > 0 {
+		return 0
+	}
+	return time.Since(x.lastActive)
+}
+
+// processPulledMessage processes the message with state keyed on its message ID, that is the same as the HTTP server. Then the message is processed once even if it is delivered to both of the server and job by overlapping subscriptions. It returns nil without processing if the message is already completed, and types.ErrBlockingPubSub if the message is being processed by another process. Unlike the server, it does not wait for the other process to avoid occupying a worker, and the message is redelivered after delay instead.
+func (x *UseCase) processPulledMessage(ctx context.Context, schema types.MsgSchema, msg *pubsubpb.ReceivedMessage) error {
+	msgID := msg.GetMessage().GetMessageId()
+
+	state, acquired, err := x.GetOrCreateState(ctx, types.MsgPubSub, msgID)
+	if err != nil {
+		return goerr.Wrap(err, "failed to get or create state for pubsub", goerr.V("messageID", msgID))
+	}
+	if !acquired {
+		if state.State == types.MsgCompleted {
+			utils.CtxLogger(ctx).Info("skip pubsub message because it's already completed", "messageID", msgID)
+			return nil
 		}
+		return goerr.Wrap(types.ErrBlockingPubSub, "pubsub message is already acquired",
+			goerr.V("messageID", msgID),
+			goerr.V("expiresAt", state.ExpiresAt),
+		)
 	}
 
-	if err := x.Load(ctx, loadReq); err != nil {
-		return goerr.Wrap(err, "failed to load", goerr.V("event", event))
+	msgState := types.MsgFailed
+	defer func() {
+		if err := x.UpdateState(ctx, types.MsgPubSub, msgID, msgState); err != nil {
+			utils.HandleError(ctx, "failed to update state", err)
+		}
+	}()
+
+	if err := x.processPubSubMessage(ctx, schema, msg); err != nil {
+		return err
 	}
+	msgState = types.MsgCompleted
 
 	return nil
 }
+
+// processPubSubMessage loads objects indicated by the message. If schema is auto, it is detected from the message.
+func (x *UseCase) processPubSubMessage(ctx context.Context, schema types.MsgSchema, msg *pubsubpb.ReceivedMessage) error {
+	utils.CtxLogger(ctx).Info("processing message", "message", msg)
+
+	if schema == types.MsgSchemaAuto {
+		schema = detectMsgSchema(msg)
+	}
+
+	switch schema {
+	case types.MsgSchemaCS:
+		return x.HandleCloudStorageEvent(ctx, msg.GetMessage().GetData())
+	case types.MsgSchemaSwarm:
+		return x.HandleSwarmMessage(ctx, msg.GetMessage().GetData())
+	default:
+		return goerr.Wrap(types.ErrInvalidRequest, "unknown schema of message", goerr.V("data", string(msg.GetMessage().GetData())))
+	}
+}
+
+// detectMsgSchema detects schema of the message. Cloud Storage notification has attributes of the object, and model.SwarmMessage has `objects` field. It returns types.MsgSchemaAuto if unknown.
+func detectMsgSchema(msg *pubsubpb.ReceivedMessage) types.MsgSchema {
+	if _, ok := msg.GetMessage().GetAttributes()["bucketId"]; ok {
+		return types.MsgSchemaCS
+	}
+
+	var probe struct {
+		Objects json.RawMessage `json:"objects"`
+		Bucket  string          `json:"bucket"`
+	}
+	if err := json.Unmarshal(msg.GetMessage().GetData(), &probe); err != nil {
+		return types.MsgSchemaAuto
+	}
+	switch {
+	case probe.Objects != nil:
+		return types.MsgSchemaSwarm
+	case probe.Bucket != "":
+		return types.MsgSchemaCS
+	}
+	return types.MsgSchemaAuto
+}
+
+// withJobLeaseExtension sets ack deadline of pulled messages. It is for testing.
+func withJobLeaseExtension(d time.Duration) Option {
+	return func(uc *UseCase) {
+		uc.job.leaseExtension = d
+	}
+}
@@ -0,0 +1,391 @@
+package usecase_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra"
+	"github.com/secmon-lab/swarm/pkg/infra/cs"
+	"github.com/secmon-lab/swarm/pkg/infra/memory"
+	"github.com/secmon-lab/swarm/pkg/infra/policy"
+	"github.com/secmon-lab/swarm/pkg/infra/pubsub"
+	"github.com/secmon-lab/swarm/pkg/usecase"
+)
+
+func csEventMessage(t *testing.T, name string) []byte {
+	return gt.R1(json.Marshal(model.CloudStorageEvent{
+		Bucket: "cloudtrail-logs",
+		Name:   types.CSObjectID("logs/" + name + ".log"),
+		Kind:   "storage#object",
+	})).NoError(t)
+}
+
+// stateDB is interfaces.Database keeping states in memory.
+type stateDB struct {
+	mutex  sync.Mutex
+	states map[types.MsgType]map[string]*model.State
+}
+
+func newStateDB() *stateDB {
+	return &stateDB{states: make(map[types.MsgType]map[string]*model.State)}
+}
+
+func (x *stateDB) put(msgType types.MsgType, state *model.State) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.states[msgType] == nil {
+		x.states[msgType] = make(map[string]*model.State)
+	}
+	copied := *state
+	x.states[msgType][state.ID] = &copied
+}
+
+func (x *stateDB) GetOrCreateState(ctx context.Context, msgType types.MsgType, input *model.State) (*model.State, bool, error) {
+	if state, err := x.GetState(ctx, msgType, input.ID); err == nil && !state.Acquired(input.CreatedAt) {
+		return state, false, nil
+	}
+	x.put(msgType, input)
+	return input, true, nil
+}
+
+func (x *stateDB) GetState(ctx context.Context, msgType types.MsgType, id string) (*model.State, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	state, ok := x.states[msgType][id]
+	if !ok {
+		return nil, types.ErrStateNotFound
+	}
+	copied := *state
+	return &copied, nil
+}
+
+func (x *stateDB) UpdateState(ctx context.Context, msgType types.MsgType, id string, state types.MsgState, now time.Time) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if s, ok := x.states[msgType][id]; ok {
+		s.State = state
+		s.UpdatedAt = now
+	}
+	return nil
+}
+
+var _ interfaces.Database = &stateDB{}
+
+func TestRunWithSubscriptions(t *testing.T) {
+	pClient := gt.R1(policy.New(policy.WithDir("testdata/policy"))).NoError(t)
+
+	newUseCase := func(sub *pubsub.SubscriptionMock, csClient *cs.Mock, options ...usecase.Option) (*usecase.UseCase, *memory.Client) {
+		bqClient := memory.New(memory.WithImplicitDataset())
+		return usecase.New(
+			infra.New(
+				infra.WithBigQuery(bqClient),
+				infra.WithCloudStorage(csClient),
+				infra.WithPolicy(pClient),
+				infra.WithPubSubSubscription(sub),
+			),
+			options...,
+		), bqClient
+	}
+	newUseCaseWithDB := func(sub *pubsub.SubscriptionMock, csClient *cs.Mock, db *stateDB, options ...usecase.Option) (*usecase.UseCase, *memory.Client) {
+		bqClient := memory.New(memory.WithImplicitDataset())
+		return usecase.New(
+			infra.New(
+				infra.WithBigQuery(bqClient),
+				infra.WithCloudStorage(csClient),
+				infra.WithPolicy(pClient),
+				infra.WithPubSubSubscription(sub),
+				infra.WithDatabase(db),
+			),
+			options...,
+		), bqClient
+	}
+
+	// openBlocking returns cs.Mock that counts concurrent reads and blocks each read for wait.
+	openBlocking := func(wait time.Duration, active, maxActive *atomic.Int64) *cs.Mock {
+		return &cs.Mock{
+			MockOpen: func(ctx context.Context, obj model.CloudStorageObject) (io.ReadCloser, error) {
+				n := active.Add(1)
+				defer active.Add(-1)
+				for {
+					cur := maxActive.Load()
+					if n <= cur || maxActive.CompareAndSwap(cur, n) {
+						break
+					}
+				}
+				time.Sleep(wait)
+				return io.NopCloser(bytes.NewReader(cloudTrailExampleRaw)), nil
+			},
+		}
+	}
+
+	t.Run("process all messages and exit when idle", func(t *testing.T) {
+		var active, maxActive atomic.Int64
+		sub := pubsub.NewSubscriptionMock(
+			csEventMessage(t, "a"),
+			csEventMessage(t, "b"),
+			csEventMessage(t, "c"),
+			csEventMessage(t, "d"),
+			csEventMessage(t, "e"),
+		)
+		uc, bqClient := newUseCase(sub, openBlocking(20*time.Millisecond, &active, &maxActive),
+			usecase.WithJobConcurrency(2),
+			usecase.WithJobPullSize(3),
+			usecase.WithJobIdleTimeout(100*time.Millisecond),
+		)
+
+		gt.NoError(t, uc.RunWithSubscriptions(context.Background(), []*model.Subscription{{Name: "projects/p/subscriptions/s"}}))
+		gt.A(t, sub.Acked).Length(5)
+		gt.Equal(t, maxActive.Load(), 2)
+
+		rows := gt.R1(bqClient.Rows("my_dataset", "cloudtrail")).NoError(t)
+		gt.A(t, rows).Length(20)
+	})
+
+	t.Run("outstanding messages are limited", func(t *testing.T) {
+		var active, maxActive atomic.Int64
+		sub := pubsub.NewSubscriptionMock(
+			csEventMessage(t, "a"),
+			csEventMessage(t, "b"),
+			csEventMessage(t, "c"),
+		)
+		uc, _ := newUseCase(sub, openBlocking(10*time.Millisecond, &active, &maxActive),
+			usecase.WithJobConcurrency(4),
+			usecase.WithJobMaxOutstandingMessages(1),
+			usecase.WithJobIdleTimeout(100*time.Millisecond),
+		)
+
+		gt.NoError(t, uc.RunWithSubscriptions(context.Background(), []*model.Subscription{{Name: "projects/p/subscriptions/s"}}))
+		gt.A(t, sub.Acked).Length(3)
+		gt.Equal(t, maxActive.Load(), 1)
+	})
+
+	t.Run("lease of message is extended while processing", func(t *testing.T) {
+		var active, maxActive atomic.Int64
+		sub := pubsub.NewSubscriptionMock(csEventMessage(t, "a"))
+		uc, _ := newUseCase(sub, openBlocking(100*time.Millisecond, &active, &maxActive),
+			usecase.WithJobIdleTimeout(50*time.Millisecond),
+			usecase.WithJobLeaseExtension(30*time.Millisecond),
+		)
+
+		gt.NoError(t, uc.RunWithSubscriptions(context.Background(), []*model.Subscription{{Name: "projects/p/subscriptions/s"}}))
+		gt.A(t, sub.Acked).Length(1)
+		gt.N(t, len(sub.Deadlines["ack-0"])).Greater(1)
+	})
+
+	t.Run("failed message is nacked and others are processed", func(t *testing.T) {
+		var active, maxActive atomic.Int64
+		sub := pubsub.NewSubscriptionMock(
+			[]byte("not json"),
+			csEventMessage(t, "a"),
+		)
+		sub.Messages[0].DeliveryAttempt = 3
+		uc, bqClient := newUseCase(sub, openBlocking(0, &active, &maxActive),
+			usecase.WithJobIdleTimeout(100*time.Millisecond),
+			usecase.WithJobNackDelay(5*time.Second),
+		)
+
+		gt.NoError(t, uc.RunWithSubscriptions(context.Background(), []*model.Subscription{{Name: "projects/p/subscriptions/s"}}))
+		gt.A(t, sub.Acked).Length(1).At(0, func(t testing.TB, v string) {
+			gt.Equal(t, v, "ack-1")
+		})
+
+		// Delay is doubled for each delivery attempt
+		delay, ok := sub.LastDeadline("ack-0")
+		gt.True(t, ok)
+		gt.Equal(t, delay, 20*time.Second)
+
+		rows := gt.R1(bqClient.Rows("my_dataset", "cloudtrail")).NoError(t)
+		gt.A(t, rows).Length(4)
+	})
+
+	t.Run("swarm message", func(t *testing.T) {
+		var active, maxActive atomic.Int64
+		swarmMsg := gt.R1(json.Marshal(model.SwarmMessage{
+			Objects: []*model.Object{
+				{CS: &model.CloudStorageObject{Bucket: "cloudtrail-logs", Name: "logs/a.log"}, Data: map[string]any{"kind": "storage#object"}},
+				{CS: &model.CloudStorageObject{Bucket: "cloudtrail-logs", Name: "logs/b.log"}, Data: map[string]any{"kind": "storage#object"}},
+			},
+		})).NoError(t)
+
+		testCases := map[string]*model.Subscription{
+			"detected":  {Name: "projects/p/subscriptions/s"},
+			"specified": {Name: "projects/p/subscriptions/s", Schema: types.MsgSchemaSwarm},
+		}
+		for name, subscription := range testCases {
+			t.Run(name, func(t *testing.T) {
+				sub := pubsub.NewSubscriptionMock(swarmMsg, csEventMessage(t, "c"))
+				uc, bqClient := newUseCase(sub, openBlocking(0, &active, &maxActive),
+					usecase.WithJobIdleTimeout(100*time.Millisecond),
+				)
+
+				gt.NoError(t, uc.RunWithSubscriptions(context.Background(), []*model.Subscription{subscription}))
+				gt.A(t, sub.Acked).Length(2)
+				rows := gt.R1(bqClient.Rows("my_dataset", "cloudtrail")).NoError(t)
+				if subscription.Schema == types.MsgSchemaSwarm {
+					// Cloud Storage event is handled as swarm message without objects
+					gt.A(t, rows).Length(8)
+				} else {
+					gt.A(t, rows).Length(12)
+				}
+			})
+		}
+	})
+
+	t.Run("in-flight messages are drained when canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var once sync.Once
+		csClient := &cs.Mock{
+			MockOpen: func(_ context.Context, obj model.CloudStorageObject) (io.ReadCloser, error) {
+				once.Do(cancel)
+				time.Sleep(50 * time.Millisecond)
+				return io.NopCloser(bytes.NewReader(cloudTrailExampleRaw)), nil
+			},
+		}
+		sub := pubsub.NewSubscriptionMock(
+			csEventMessage(t, "a"),
+			csEventMessage(t, "b"),
+			csEventMessage(t, "c"),
+		)
+		uc, bqClient := newUseCase(sub, csClient, usecase.WithJobConcurrency(1))
+
+		gt.NoError(t, uc.RunWithSubscriptions(ctx, []*model.Subscription{{Name: "projects/p/subscriptions/s"}}))
+
+		// The first message is completed, and others waiting in the queue are returned
+		gt.A(t, sub.Acked).Length(1)
+		for _, ackID := range []string{"ack-1", "ack-2"} {
+			delay, ok := sub.LastDeadline(ackID)
+			gt.True(t, ok)
+			gt.Equal(t, delay, 0)
+		}
+		rows := gt.R1(bqClient.Rows("my_dataset", "cloudtrail")).NoError(t)
+		gt.A(t, rows).Length(4)
+	})
+
+	t.Run("in-flight message is returned when drain times out", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		csClient := &cs.Mock{
+			MockOpen: func(ctx context.Context, obj model.CloudStorageObject) (io.ReadCloser, error) {
+				cancel()
+				// Block until processing is canceled by drain timeout
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		}
+		sub := pubsub.NewSubscriptionMock(csEventMessage(t, "a"))
+		uc, _ := newUseCase(sub, csClient,
+			usecase.WithJobConcurrency(1),
+			usecase.WithJobDrainTimeout(50*time.Millisecond),
+			usecase.WithJobNackDelay(5*time.Second),
+		)
+
+		gt.NoError(t, uc.RunWithSubscriptions(ctx, []*model.Subscription{{Name: "projects/p/subscriptions/s"}}))
+		gt.A(t, sub.Acked).Length(0)
+		delay, ok := sub.LastDeadline("ack-0")
+		gt.True(t, ok)
+		gt.Equal(t, delay, 0)
+	})
+
+	t.Run("state of message", func(t *testing.T) {
+		now := time.Now()
+
+		t.Run("completed message is acknowledged without processing", func(t *testing.T) {
+			var active, maxActive atomic.Int64
+			db := newStateDB()
+			db.put(types.MsgPubSub, &model.State{ID: "0", State: types.MsgCompleted, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+
+			sub := pubsub.NewSubscriptionMock(csEventMessage(t, "a"), csEventMessage(t, "b"))
+			uc, bqClient := newUseCaseWithDB(sub, openBlocking(0, &active, &maxActive), db,
+				usecase.WithJobIdleTimeout(100*time.Millisecond),
+			)
+
+			gt.NoError(t, uc.RunWithSubscriptions(context.Background(), []*model.Subscription{{Name: "projects/p/subscriptions/s"}}))
+			gt.A(t, sub.Acked).Length(2)
+			rows := gt.R1(bqClient.Rows("my_dataset", "cloudtrail")).NoError(t)
+			gt.A(t, rows).Length(4)
+
+			state := gt.R1(db.GetState(context.Background(), types.MsgPubSub, "1")).NoError(t)
+			gt.Equal(t, state.State, types.MsgCompleted)
+		})
+
+		t.Run("message acquired by another process is redelivered later", func(t *testing.T) {
+			var active, maxActive atomic.Int64
+			db := newStateDB()
+			db.put(types.MsgPubSub, &model.State{ID: "0", State: types.MsgRunning, CreatedAt: now, ExpiresAt: now.Add(time.Hour)})
+
+			sub := pubsub.NewSubscriptionMock(csEventMessage(t, "a"), csEventMessage(t, "b"))
+			uc, bqClient := newUseCaseWithDB(sub, openBlocking(0, &active, &maxActive), db,
+				usecase.WithJobIdleTimeout(100*time.Millisecond),
+				usecase.WithJobNackDelay(5*time.Second),
+			)
+
+			gt.NoError(t, uc.RunWithSubscriptions(context.Background(), []*model.Subscription{{Name: "projects/p/subscriptions/s"}}))
+			gt.A(t, sub.Acked).Length(1).At(0, func(t testing.TB, v string) {
+				gt.Equal(t, v, "ack-1")
+			})
+			delay, ok := sub.LastDeadline("ack-0")
+			gt.True(t, ok)
+			gt.Equal(t, delay, 5*time.Second)
+
+			rows := gt.R1(bqClient.Rows("my_dataset", "cloudtrail")).NoError(t)
+			gt.A(t, rows).Length(4)
+		})
+
+		t.Run("failed message can be processed again", func(t *testing.T) {
+			var active, maxActive atomic.Int64
+			db := newStateDB()
+			sub := pubsub.NewSubscriptionMock([]byte("not json"))
+			uc, _ := newUseCaseWithDB(sub, openBlocking(0, &active, &maxActive), db,
+				usecase.WithJobIdleTimeout(100*time.Millisecond),
+			)
+
+			gt.NoError(t, uc.RunWithSubscriptions(context.Background(), []*model.Subscription{{Name: "projects/p/subscriptions/s"}}))
+			gt.A(t, sub.Acked).Length(0)
+			state := gt.R1(db.GetState(context.Background(), types.MsgPubSub, "0")).NoError(t)
+			gt.Equal(t, state.State, types.MsgFailed)
+		})
+	})
+
+	t.Run("state of object", func(t *testing.T) {
+		swarmMsg := gt.R1(json.Marshal(model.SwarmMessage{
+			Objects: []*model.Object{
+				{CS: &model.CloudStorageObject{Bucket: "cloudtrail-logs", Name: "logs/a.log"}, Data: map[string]any{"kind": "storage#object"}},
+			},
+		})).NoError(t)
+
+		testCases := map[string]struct {
+			objectState bool
+			rows        int
+		}{
+			"enabled":  {objectState: true, rows: 4},
+			"disabled": {objectState: false, rows: 8},
+		}
+		for name, tc := range testCases {
+			t.Run(name, func(t *testing.T) {
+				var active, maxActive atomic.Int64
+				db := newStateDB()
+				// Cloud Storage notification and swarm message notify the same object
+				sub := pubsub.NewSubscriptionMock(csEventMessage(t, "a"), swarmMsg)
+				uc, bqClient := newUseCaseWithDB(sub, openBlocking(0, &active, &maxActive), db,
+					usecase.WithJobConcurrency(1),
+					usecase.WithJobIdleTimeout(100*time.Millisecond),
+					usecase.WithObjectState(tc.objectState),
+				)
+
+				gt.NoError(t, uc.RunWithSubscriptions(context.Background(), []*model.Subscription{{Name: "projects/p/subscriptions/s"}}))
+				gt.A(t, sub.Acked).Length(2)
+				rows := gt.R1(bqClient.Rows("my_dataset", "cloudtrail")).NoError(t)
+				gt.A(t, rows).Length(tc.rows)
+			})
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package usecase
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+)
+
+// jsonColumnPaths converts dot separated paths of JSON columns to paths relative to LogRecord.Data. An empty path means LogRecord.Data itself.
+func jsonColumnPaths(columns []string) [][]string {
+	var paths [][]string
+	for _, column := range columns {
+		parts := strings.Split(column, ".")
+		if parts[0] != dataFieldName {
+			continue
+		}
+		paths = append(paths, parts[1:])
+	}
+	return paths
+}
+
+// encodeJSONColumns encodes values of JSON columns to JSON string in place. BigQuery Storage Write API requires JSON column value as string.
+func encodeJSONColumns(records []*model.LogRecord, paths [][]string) {
+	for _, record := range records {
+		for _, path := range paths {
+			if len(path) == 0 {
+				if record.Data != nil {
+					record.Data = encodeJSONValue(record.Data)
+				}
+				continue
+			}
+
+			if data, ok := record.Data.(map[string]any); ok {
+				convertPath(data, path, encodeJSONValue)
+			}
+		}
+	}
+}
+
+// setJSONColumn returns copy of schema that the field of path is replaced with JSON type. Parent RECORD fields are created if not exist.
+func setJSONColumn(schema bigquery.Schema, path []string) bigquery.Schema {
+	result := copySchema(schema)
+	idx := slices.IndexFunc(result, func(f *bigquery.FieldSchema) bool { return f.Name == path[0] })
+
+	if len(path) == 1 {
+		field := &bigquery.FieldSchema{Name: path[0], Type: bigquery.JSONFieldType}
+		if idx < 0 {
+			return append(result, field)
+		}
+		field.Description = result[idx].Description
+		result[idx] = field
+		return result
+	}
+
+	if idx < 0 {
+		result = append(result, &bigquery.FieldSchema{Name: path[0], Type: bigquery.RecordFieldType})
+		idx = len(result) - 1
+	} else if result[idx].Type != bigquery.RecordFieldType {
+		// Parent is not an object, and there is no value to be JSON column
+		return result
+	}
+
+	result[idx].Schema = setJSONColumn(result[idx].Schema, path[1:])
+	return result
+}
+
+// encodeJSONValue encodes a value to JSON string.
+func encodeJSONValue(v any) any {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return string(raw)
+}
@@ -4,6 +4,7 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"log/slog"
 	"math"
 	"runtime"
 	"sync"
@@ -52,11 +53,18 @@ func (x *UseCase) LoadDataByObject(ctx context.Context, url types.CSUrl) error {
 }
 
 type ingestRequest struct {
-	dst     model.BigQueryDest
-	records []*model.LogRecord
+	dst   model.BigQueryDest
+	group *model.LogRecordGroup
 }
 
 func (x *UseCase) Load(ctx context.Context, requests []*model.LoadRequest) error {
+	if x.objectState {
+		return x.loadWithObjectState(ctx, requests)
+	}
+	return x.load(ctx, requests)
+}
+
+func (x *UseCase) load(ctx context.Context, requests []*model.LoadRequest) error {
 	defer runtime.GC()
 	reqID, ctx := utils.CtxRequestID(ctx)
 
@@ -66,6 +74,9 @@ func (x *UseCase) Load(ctx context.Context, requests []*model.LoadRequest) error
 	}
 
 	if x.metadata != nil {
+		if err := x.ensureDataset(ctx, x.metadata.Dataset()); err != nil {
+			return err
+		}
 		schema, err := setupLoadLogTable(ctx, x.clients.BigQuery(), x.metadata)
 		if err != nil {
 			return err
@@ -76,6 +87,7 @@ func (x *UseCase) Load(ctx context.Context, requests []*model.LoadRequest) error
 		}
 
 		defer func() {
+			defer utils.SafeClose(s)
 			if err := s.Insert(ctx, []any{loadLog.Raw()}); err != nil {
 				utils.HandleError(ctx, "failed to insert request log", err)
 			}
@@ -86,7 +98,7 @@ func (x *UseCase) Load(ctx context.Context, requests []*model.LoadRequest) error
 		utils.CtxLogger(ctx).Info("request handled", "req", requests, "proc.log", loadLog)
 	}()
 
-	logRecords, srcLogs, err := importLogRecords(ctx, x.clients, requests, x.readObjectConcurrency)
+	logRecords, srcLogs, err := importLogRecords(ctx, x.clients, requests, x.readObjectConcurrency, x.regoPrint)
 	loadLog.Sources = srcLogs
 	if err != nil {
 		loadLog.Error = err.Error()
@@ -95,7 +107,7 @@ func (x *UseCase) Load(ctx context.Context, requests []*model.LoadRequest) error
 
 	reqCh := make(chan ingestRequest, len(logRecords))
 	for dst := range logRecords {
-		reqCh <- ingestRequest{dst: dst, records: logRecords[dst]}
+		reqCh <- ingestRequest{dst: dst, group: logRecords[dst]}
 	}
 	close(reqCh)
 
@@ -108,10 +120,9 @@ func (x *UseCase) Load(ctx context.Context, requests []*model.LoadRequest) error
 			defer wg.Done()
 
 			for req := range reqCh {
-				log, err := ingestRecords(ctx, x.clients.BigQuery(), req.dst, req.records, x.ingestRecordConcurrency)
+				log, err := x.ingestGroup(ctx, req.dst, req.group)
 				logCh <- log
 				if err != nil {
-					log.Error = err.Error()
 					errCh <- err
 				}
 			}
@@ -121,9 +132,14 @@ func (x *UseCase) Load(ctx context.Context, requests []*model.LoadRequest) error
 	wg.Wait()
 
 	close(logCh)
+	var changes []*model.SchemaChangeLog
 	for log := range logCh {
 		loadLog.Ingests = append(loadLog.Ingests, log)
+		if log.SchemaChange != nil {
+			changes = append(changes, log.SchemaChange)
+		}
 	}
+	x.recordSchemaChanges(ctx, changes)
 
 	close(errCh)
 	for err := range errCh {
@@ -140,7 +156,7 @@ type importSourceResponse struct {
 	log    *model.SourceLog
 }
 
-func importLogRecords(ctx context.Context, clients *infra.Clients, requests []*model.LoadRequest, concurrency int) (model.LogRecordSet, []*model.SourceLog, *multierror.Error) {
+func importLogRecords(ctx context.Context, clients *infra.Clients, requests []*model.LoadRequest, concurrency int, printCfg regoPrintConfig) (model.LogRecordSet, []*model.SourceLog, *multierror.Error) {
 	var logs []*model.SourceLog
 	dstMap := model.LogRecordSet{}
 
@@ -154,7 +170,7 @@ func importLogRecords(ctx context.Context, clients *infra.Clients, requests []*m
 		go func() {
 			defer wg.Done()
 			for req := range reqCh {
-				result, err := importSource(ctx, clients, req)
+				result, err := importSource(ctx, clients, req, printCfg)
 				if err != nil {
 					utils.HandleError(ctx, "failed to import source", err)
 					errCh <- err
@@ -185,7 +201,7 @@ func importLogRecords(ctx context.Context, clients *infra.Clients, requests []*m
 	return dstMap, logs, mErr
 }
 
-func importSource(ctx context.Context, clients *infra.Clients, req *model.LoadRequest) (*importSourceResponse, error) {
+func importSource(ctx context.Context, clients *infra.Clients, req *model.LoadRequest, printCfg regoPrintConfig) (*importSourceResponse, error) {
 	result := &importSourceResponse{
 		dstMap: model.LogRecordSet{},
 		log: &model.SourceLog{
@@ -204,15 +220,21 @@ func importSource(ctx context.Context, clients *infra.Clients, req *model.LoadRe
 		return result, err
 	}
 
-	for _, row := range rows {
-		result.log.RowCount++
+	printer := printCfg.newPrinter(ctx,
+		slog.Any("schema", req.Source.Schema),
+		slog.Any("object", objectURL(req.Object)),
+	)
+	defer printer.Flush()
 
-		var output model.SchemaPolicyOutput
-		query := req.Source.Schema.Query()
-		if err := clients.Policy().Query(ctx, query, row, &output); err != nil {
-			return result, err
-		}
+	var outputs []model.SchemaPolicyOutput
+	query := req.Source.Schema.Query()
+	result.log.RowCount = len(rows)
+	if err := clients.Policy().QueryBatch(ctx, query, rows, &outputs, printer.Option()); err != nil {
+		return result, err
+	}
 
+	for i, output := range outputs {
+		row := rows[i]
 		if len(output.Logs) == 0 {
 			utils.CtxLogger(ctx).Warn("No log data in schema policy", "req", req, "record", row, "query", query)
 			continue
@@ -238,12 +260,15 @@ func importSource(ctx context.Context, clients *infra.Clients, req *model.LoadRe
 				ID:         log.ID,
 				Timestamp:  time.Unix(int64(log.Timestamp), int64(tsNano)),
 				IngestedAt: time.Now(),
+				Sinks:      log.Sinks,
+				Notify:     log.Notify,
 
 				// If there is a field that has nil value in the log.Data, the field can not be estimated field type by bqs.Infer. It will cause an error when inserting data to BigQuery. So, remove nil value from log.Data.
 				Data: newData,
 			}
 
-			result.dstMap[log.BigQueryDest] = append(result.dstMap[log.BigQueryDest], record)
+			result.dstMap.Add(log.BigQueryDest, log.TableOptions, record)
+			result.dstMap[log.BigQueryDest].AddObjects(objectURL(req.Object))
 		}
 	}
 
@@ -281,7 +306,7 @@ func downloadCloudStorageObject(ctx context.Context, csClient interfaces.CloudSt
 	return records, nil
 }
 
-func ingestRecords(ctx context.Context, bq interfaces.BigQuery, bqDst model.BigQueryDest, records []*model.LogRecord, concurrency int) (*model.IngestLog, error) {
+func ingestRecords(ctx context.Context, bq interfaces.BigQuery, bqDst model.BigQueryDest, opts *model.TableOptions, guard *model.SchemaGuard, records []*model.LogRecord, concurrency int) (*model.IngestLog, error) {
 	ingestID, ctx := utils.CtxIngestID(ctx)
 
 	result := &model.IngestLog{
@@ -296,20 +321,39 @@ func ingestRecords(ctx context.Context, bq interfaces.BigQuery, bqDst model.BigQ
 		result.FinishedAt = time.Now()
 	}()
 
-	schema, err := inferSchema(records)
+	old, err := bq.GetMetadata(ctx, bqDst.Dataset, bqDst.Table)
+	if err != nil {
+		return result, goerr.Wrap(err, "failed to get metadata", goerr.V("dst", bqDst))
+	}
+
+	schema, conflicts, err := inferTableSchema(ctx, bqDst, old, opts, guard, records)
 	if err != nil {
 		return result, err
 	}
+	if len(conflicts) > 0 {
+		result.Conflicts = conflicts
+		utils.CtxLogger(ctx).Info("resolved schema conflicts", "dst", bqDst, "conflicts", conflicts)
+	}
 
-	md, err := buildBQMetadata(schema, bqDst.Partition)
+	md, err := buildBQMetadata(schema, bqDst.Partition, opts)
 	if err != nil {
 		return result, err
 	}
 
-	finalized, err := createOrUpdateTable(ctx, bq, bqDst.Dataset, bqDst.Table, md)
+	finalized, err := applyTableMetadata(ctx, bq, bqDst.Dataset, bqDst.Table, old, md, opts)
 	if err != nil {
 		return result, goerr.Wrap(err, "failed to update schema", goerr.V("dst", bqDst))
 	}
+	warnSchemaGrowth(ctx, guard, bqDst, old, finalized)
+
+	change, err := newSchemaChangeLog(ctx, bqDst, old, finalized)
+	if err != nil {
+		return result, err
+	}
+	if change != nil {
+		change.IngestID = ingestID
+		result.SchemaChange = change
+	}
 
 	jsonSchema, err := schemaToJSON(schema)
 	if err != nil {
@@ -5,9 +5,11 @@ import (
 	"context"
 	_ "embed"
 	"io"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"cloud.google.com/go/bigquery"
 	"github.com/google/uuid"
 	"github.com/m-mizutani/gt"
 	"github.com/secmon-lab/swarm/pkg/domain/model"
@@ -15,6 +17,8 @@ import (
 	"github.com/secmon-lab/swarm/pkg/infra"
 	"github.com/secmon-lab/swarm/pkg/infra/bq"
 	"github.com/secmon-lab/swarm/pkg/infra/cs"
+	"github.com/secmon-lab/swarm/pkg/infra/lake"
+	"github.com/secmon-lab/swarm/pkg/infra/memory"
 	"github.com/secmon-lab/swarm/pkg/infra/policy"
 	"github.com/secmon-lab/swarm/pkg/usecase"
 	"github.com/secmon-lab/swarm/pkg/utils"
@@ -129,6 +133,173 @@ func TestLoadData(t *testing.T) {
 	}
 }
 
+func TestLoad_SchemaChange(t *testing.T) {
+	ctx := context.Background()
+	bqClient := bq.NewGeneralMock()
+	csClient := &cs.Mock{
+		MockOpen: func(ctx context.Context, obj model.CloudStorageObject) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(cloudTrailExampleRaw)), nil
+		},
+	}
+	pClient := gt.R1(policy.New(policy.WithDir("testdata/policy"))).NoError(t)
+	meta := model.NewMetadataConfig("test-dataset", "test-table")
+
+	uc := usecase.New(
+		infra.New(
+			infra.WithBigQuery(bqClient),
+			infra.WithCloudStorage(csClient),
+			infra.WithPolicy(pClient),
+		),
+		usecase.WithMetadata(meta),
+	)
+
+	req := &model.LoadRequest{
+		Source: model.Source{
+			Parser:   types.JSONParser,
+			Schema:   "cloudtrail",
+			Compress: types.NoCompress,
+		},
+		Object: model.Object{
+			CS: &model.CloudStorageObject{
+				Bucket: "test-bucket",
+				Name:   "cloudtrail_example.log",
+			},
+		},
+	}
+	gt.NoError(t, uc.Load(ctx, []*model.LoadRequest{req}))
+
+	idx := -1
+	for i, s := range bqClient.OpenedStream {
+		if s.Table == "test-table_schema_change" {
+			idx = i
+		}
+	}
+	gt.N(t, idx).Greater(-1)
+	gt.Equal(t, bqClient.OpenedStream[idx].Dataset, "test-dataset")
+
+	gt.A(t, bqClient.Streams[idx].Inserted).Length(1)
+	gt.A(t, bqClient.Streams[idx].Inserted[0]).Length(1)
+	change := gt.Cast[*model.SchemaChangeLogRaw](t, bqClient.Streams[idx].Inserted[0][0])
+	gt.True(t, change.Created)
+	gt.Equal(t, change.OldSchema, "")
+	gt.NotEqual(t, change.NewSchema, "")
+	gt.NotEqual(t, change.RequestID, "")
+	gt.NotEqual(t, change.IngestID, "")
+	gt.A(t, change.AddedFields).Has("data").Has("id")
+	gt.A(t, change.Objects).Length(1).At(0, func(t testing.TB, v string) {
+		gt.Equal(t, v, "gs://test-bucket/cloudtrail_example.log")
+	})
+
+	// Schema is not changed by the same data
+	bqClient = bq.NewGeneralMock()
+	bqClient.Metadata = []*bigquery.TableMetadata{
+		nil,
+		{Schema: gt.R1(bigquery.SchemaFromJSON([]byte(change.NewSchema))).NoError(t)},
+	}
+	uc = usecase.New(
+		infra.New(
+			infra.WithBigQuery(bqClient),
+			infra.WithCloudStorage(csClient),
+			infra.WithPolicy(pClient),
+		),
+		usecase.WithMetadata(meta),
+	)
+	gt.NoError(t, uc.Load(ctx, []*model.LoadRequest{req}))
+	for _, s := range bqClient.OpenedStream {
+		gt.NotEqual(t, s.Table, "test-table_schema_change")
+	}
+}
+
+func TestLoad_Memory(t *testing.T) {
+	ctx := context.Background()
+	bqClient := memory.New(memory.WithImplicitDataset())
+	csClient := &cs.Mock{
+		MockOpen: func(ctx context.Context, obj model.CloudStorageObject) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(cloudTrailExampleRaw)), nil
+		},
+	}
+	pClient := gt.R1(policy.New(policy.WithDir("testdata/policy"))).NoError(t)
+	meta := model.NewMetadataConfig("test-dataset", "test-table")
+
+	uc := usecase.New(
+		infra.New(
+			infra.WithBigQuery(bqClient),
+			infra.WithCloudStorage(csClient),
+			infra.WithPolicy(pClient),
+		),
+		usecase.WithMetadata(meta),
+	)
+
+	req := &model.LoadRequest{
+		Source: model.Source{
+			Parser:   types.JSONParser,
+			Schema:   "cloudtrail",
+			Compress: types.NoCompress,
+		},
+		Object: model.Object{
+			CS: &model.CloudStorageObject{
+				Bucket: "test-bucket",
+				Name:   "cloudtrail_example.log",
+			},
+		},
+	}
+	gt.NoError(t, uc.Load(ctx, []*model.LoadRequest{req}))
+	gt.NoError(t, uc.Load(ctx, []*model.LoadRequest{req}))
+
+	rows := gt.R1(bqClient.Rows("my_dataset", "cloudtrail")).NoError(t)
+	gt.A(t, rows).Length(8)
+
+	iter := gt.R1(bqClient.Query(ctx, "SELECT COUNT(*) AS n FROM `test-dataset.test-table` WHERE success = TRUE")).NoError(t)
+	var result struct {
+		N int64 `json:"n"`
+	}
+	gt.NoError(t, iter.Next(&result))
+	gt.Equal(t, result.N, 2)
+
+	changes := gt.R1(bqClient.Rows("test-dataset", "test-table_schema_change")).NoError(t)
+	gt.A(t, changes).Length(1)
+}
+
+func TestLoad_Lake(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	csClient := &cs.Mock{
+		MockOpen: func(ctx context.Context, obj model.CloudStorageObject) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(cloudTrailExampleRaw)), nil
+		},
+	}
+	pClient := gt.R1(policy.New(policy.WithDir("testdata/policy"))).NoError(t)
+
+	uc := usecase.New(
+		infra.New(
+			infra.WithBigQuery(lake.New(root)),
+			infra.WithCloudStorage(csClient),
+			infra.WithPolicy(pClient),
+		),
+		usecase.WithMetadata(model.NewMetadataConfig("test-dataset", "test-table")),
+	)
+
+	req := &model.LoadRequest{
+		Source: model.Source{
+			Parser:   types.JSONParser,
+			Schema:   "cloudtrail",
+			Compress: types.NoCompress,
+		},
+		Object: model.Object{
+			CS: &model.CloudStorageObject{
+				Bucket: "test-bucket",
+				Name:   "cloudtrail_example.log",
+			},
+		},
+	}
+	gt.NoError(t, uc.Load(ctx, []*model.LoadRequest{req}))
+
+	files := gt.R1(filepath.Glob(filepath.Join(root, "my_dataset", "cloudtrail", "dt=*", "*.parquet"))).NoError(t)
+	gt.A(t, files).Longer(0)
+	logs := gt.R1(filepath.Glob(filepath.Join(root, "test-dataset", "test-table", "dt=*", "*.parquet"))).NoError(t)
+	gt.A(t, logs).Length(1)
+}
+
 func TestIngestRecordBigNum(t *testing.T) {
 	bqMock := bq.NewGeneralMock()
 	ctx := context.Background()
@@ -150,7 +321,7 @@ func TestIngestRecordBigNum(t *testing.T) {
 		})
 	}
 
-	resp := gt.R1(usecase.IngestRecords(ctx, bqMock, dst, records, 32)).NoError(t)
+	resp := gt.R1(usecase.IngestRecords(ctx, bqMock, dst, nil, nil, records, 32)).NoError(t)
 	gt.True(t, resp.Success)
 
 	/*
@@ -163,3 +334,473 @@ func TestIngestRecordBigNum(t *testing.T) {
 		})
 	*/
 }
+
+func TestLoadData_CreateDataset(t *testing.T) {
+	testCases := map[string]struct {
+		patterns []string
+		datasets map[types.BQDatasetID]*bigquery.DatasetMetadata
+		created  []types.BQDatasetID
+		err      error
+	}{
+		"create allowed dataset": {
+			patterns: []string{"my_*"},
+			datasets: map[types.BQDatasetID]*bigquery.DatasetMetadata{},
+			created:  []types.BQDatasetID{"my_dataset"},
+		},
+		"not create existing dataset": {
+			patterns: []string{"my_*"},
+			datasets: map[types.BQDatasetID]*bigquery.DatasetMetadata{"my_dataset": {}},
+		},
+		"not allowed dataset": {
+			patterns: []string{"logs_*"},
+			datasets: map[types.BQDatasetID]*bigquery.DatasetMetadata{},
+			err:      types.ErrDatasetNotAllowed,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			bqClient := bq.NewGeneralMock()
+			bqClient.Datasets = tc.datasets
+			csClient := &cs.Mock{
+				MockOpen: func(ctx context.Context, obj model.CloudStorageObject) (io.ReadCloser, error) {
+					return io.NopCloser(bytes.NewReader(cloudTrailExampleRaw)), nil
+				},
+			}
+			pClient := gt.R1(policy.New(policy.WithDir("testdata/policy"))).NoError(t)
+
+			uc := usecase.New(
+				infra.New(
+					infra.WithBigQuery(bqClient),
+					infra.WithCloudStorage(csClient),
+					infra.WithPolicy(pClient),
+				),
+				usecase.WithDatasetConfig(&model.DatasetConfig{
+					AllowPatterns: tc.patterns,
+					Location:      "asia-northeast1",
+					Labels:        map[string]string{"managed-by": "swarm"},
+					KMSKeyName:    "projects/p/locations/l/keyRings/r/cryptoKeys/k",
+				}),
+			)
+
+			req := &model.LoadRequest{
+				Source: model.Source{
+					Parser: types.JSONParser,
+					Schema: "cloudtrail",
+				},
+				Object: model.Object{
+					CS: &model.CloudStorageObject{Bucket: "test-bucket", Name: "test.json"},
+				},
+			}
+
+			err := uc.Load(ctx, []*model.LoadRequest{req})
+			if tc.err != nil {
+				gt.Error(t, err).Is(tc.err)
+				gt.A(t, bqClient.CreatedTable).Length(0)
+				return
+			}
+			gt.NoError(t, err)
+
+			gt.A(t, bqClient.CreatedDataset).Length(len(tc.created))
+			for i, dataset := range tc.created {
+				gt.V(t, bqClient.CreatedDataset[i].Dataset).Equal(dataset)
+				md := bqClient.CreatedDataset[i].MD
+				gt.V(t, md.Location).Equal("asia-northeast1")
+				gt.V(t, md.Labels["managed-by"]).Equal("swarm")
+				gt.V(t, md.DefaultEncryptionConfig.KMSKeyName).Equal("projects/p/locations/l/keyRings/r/cryptoKeys/k")
+			}
+		})
+	}
+}
+
+func TestIngestRecords_DeclaredSchema(t *testing.T) {
+	ctx := context.Background()
+	bqMock := bq.NewGeneralMock()
+	dst := model.BigQueryDest{
+		Dataset: "test-dataset",
+		Table:   "test-table",
+	}
+	opts := &model.TableOptions{
+		Schema: []*model.DeclaredField{
+			{Name: "src_port", Type: "INTEGER"},
+			{Name: "user_id", Type: "STRING"},
+			{Name: "event_time", Type: "TIMESTAMP"},
+			{Name: "tags", Type: "STRING", Mode: "REPEATED"},
+			{Name: "client", Type: "RECORD", Fields: []*model.DeclaredField{
+				{Name: "secure", Type: "BOOLEAN"},
+			}},
+			{Name: "not_in_data", Type: "FLOAT", Description: "declared only"},
+		},
+	}
+	records := []*model.LogRecord{
+		{
+			ID:        "log-1",
+			Timestamp: time.Now(),
+			Data: map[string]any{
+				"src_port":   "443",
+				"user_id":    float64(1234),
+				"event_time": "2024-01-02T03:04:05Z",
+				"tags":       "web",
+				"client":     map[string]any{"secure": "true", "ua": "curl"},
+				"extra":      "inferred",
+			},
+		},
+		{
+			ID:        "log-2",
+			Timestamp: time.Now(),
+			Data: map[string]any{
+				"src_port": "invalid",
+				"user_id":  "alice",
+			},
+		},
+	}
+
+	resp := gt.R1(usecase.IngestRecords(ctx, bqMock, dst, opts, nil, records, 1)).NoError(t)
+	gt.True(t, resp.Success)
+
+	gt.A(t, bqMock.CreatedTable).Length(1)
+	schema := bqMock.CreatedTable[0].MD.Schema
+	var dataSchema bigquery.Schema
+	for _, field := range schema {
+		if field.Name == "data" {
+			dataSchema = field.Schema
+		}
+	}
+	fields := map[string]*bigquery.FieldSchema{}
+	for _, field := range dataSchema {
+		fields[field.Name] = field
+	}
+	gt.V(t, fields["src_port"].Type).Equal(bigquery.IntegerFieldType)
+	gt.V(t, fields["user_id"].Type).Equal(bigquery.StringFieldType)
+	gt.V(t, fields["event_time"].Type).Equal(bigquery.TimestampFieldType)
+	gt.True(t, fields["tags"].Repeated)
+	gt.A(t, fields["client"].Schema).Length(2)
+	for _, field := range fields["client"].Schema {
+		if field.Name == "secure" {
+			gt.V(t, field.Type).Equal(bigquery.BooleanFieldType)
+		}
+	}
+	gt.V(t, fields["extra"].Type).Equal(bigquery.StringFieldType)
+	gt.V(t, fields["not_in_data"].Description).Equal("declared only")
+
+	data1 := records[0].Data.(map[string]any)
+	gt.V(t, data1["src_port"]).Equal(int64(443))
+	gt.V(t, data1["user_id"]).Equal("1234")
+	gt.V(t, data1["event_time"]).Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).UnixMicro())
+	gt.V(t, data1["tags"]).Equal([]any{"web"})
+	gt.V(t, data1["client"].(map[string]any)["secure"]).Equal(true)
+
+	// value that can not be coerced is removed
+	data2 := records[1].Data.(map[string]any)
+	_, ok := data2["src_port"]
+	gt.False(t, ok)
+	gt.V(t, data2["user_id"]).Equal("alice")
+
+	gt.A(t, bqMock.Inserted).Length(1)
+	gt.A(t, bqMock.Inserted[0].Data).Length(2)
+}
+
+func TestIngestRecords_Conflict(t *testing.T) {
+	dst := model.BigQueryDest{
+		Dataset: "test-dataset",
+		Table:   "test-table",
+	}
+	newRecords := func() []*model.LogRecord {
+		return []*model.LogRecord{
+			{ID: "log-1", Timestamp: time.Now(), Data: map[string]any{"port": float64(443), "user": map[string]any{"id": "alice"}}},
+			{ID: "log-2", Timestamp: time.Now(), Data: map[string]any{"port": "https", "user": map[string]any{"id": float64(1)}}},
+			{ID: "log-3", Timestamp: time.Now(), Data: map[string]any{"port": float64(80)}},
+		}
+	}
+	dataSchema := func(t *testing.T, schema bigquery.Schema) map[string]*bigquery.FieldSchema {
+		fields := map[string]*bigquery.FieldSchema{}
+		for _, field := range schema {
+			if field.Name == "data" {
+				for _, f := range field.Schema {
+					fields[f.Name] = f
+				}
+			}
+		}
+		return fields
+	}
+
+	t.Run("fail without strategy", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		_, err := usecase.IngestRecords(context.Background(), bqMock, dst, &model.TableOptions{}, nil, newRecords(), 1)
+		gt.Error(t, err)
+	})
+
+	t.Run("widen", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		records := newRecords()
+		resp := gt.R1(usecase.IngestRecords(context.Background(), bqMock, dst, &model.TableOptions{Conflict: types.ConflictWiden}, nil, records, 1)).NoError(t)
+		gt.True(t, resp.Success)
+
+		fields := dataSchema(t, bqMock.CreatedTable[0].MD.Schema)
+		gt.V(t, fields["port"].Type).Equal(bigquery.StringFieldType)
+		gt.V(t, fields["user"].Schema[0].Type).Equal(bigquery.StringFieldType)
+
+		gt.V(t, records[0].Data.(map[string]any)["port"]).Equal("443")
+		gt.V(t, records[1].Data.(map[string]any)["port"]).Equal("https")
+		gt.V(t, records[2].Data.(map[string]any)["port"]).Equal("80")
+		gt.V(t, records[1].Data.(map[string]any)["user"].(map[string]any)["id"]).Equal("1")
+
+		gt.A(t, resp.Conflicts).Length(2)
+		gt.V(t, *resp.Conflicts[0]).Equal(model.SchemaConflict{Field: "port", Strategy: types.ConflictWiden, Count: 2})
+		gt.V(t, *resp.Conflicts[1]).Equal(model.SchemaConflict{Field: "user.id", Strategy: types.ConflictWiden, Count: 1})
+	})
+
+	t.Run("widen falls back to rename for existing column", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		bqMock.Metadata = []*bigquery.TableMetadata{
+			{
+				Schema: bigquery.Schema{
+					{Name: "data", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+						{Name: "port", Type: bigquery.FloatFieldType},
+					}},
+				},
+			},
+		}
+		records := newRecords()
+		records[1].Data.(map[string]any)["user"] = map[string]any{"id": "bob"}
+		resp := gt.R1(usecase.IngestRecords(context.Background(), bqMock, dst, &model.TableOptions{Conflict: types.ConflictWiden}, nil, records, 1)).NoError(t)
+		gt.True(t, resp.Success)
+
+		data := records[1].Data.(map[string]any)
+		gt.V(t, data["port__str"]).Equal("https")
+		_, ok := data["port"]
+		gt.False(t, ok)
+		gt.V(t, resp.Conflicts[0].Strategy).Equal(types.ConflictRename)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		records := newRecords()
+		resp := gt.R1(usecase.IngestRecords(context.Background(), bqMock, dst, &model.TableOptions{Conflict: types.ConflictRename}, nil, records, 1)).NoError(t)
+		gt.True(t, resp.Success)
+
+		fields := dataSchema(t, bqMock.CreatedTable[0].MD.Schema)
+		gt.V(t, fields["port"].Type).Equal(bigquery.FloatFieldType)
+		gt.V(t, fields["port__str"].Type).Equal(bigquery.StringFieldType)
+
+		data := records[1].Data.(map[string]any)
+		gt.V(t, data["port__str"]).Equal("https")
+		gt.V(t, data["user"].(map[string]any)["id__float"]).Equal(float64(1))
+
+		gt.A(t, resp.Conflicts).Length(2)
+		gt.V(t, *resp.Conflicts[0]).Equal(model.SchemaConflict{Field: "port", Strategy: types.ConflictRename, Count: 1})
+		gt.V(t, *resp.Conflicts[1]).Equal(model.SchemaConflict{Field: "user.id", Strategy: types.ConflictRename, Count: 1})
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		records := newRecords()
+		resp := gt.R1(usecase.IngestRecords(context.Background(), bqMock, dst, &model.TableOptions{Conflict: types.ConflictOverflow}, nil, records, 1)).NoError(t)
+		gt.True(t, resp.Success)
+
+		fields := dataSchema(t, bqMock.CreatedTable[0].MD.Schema)
+		gt.V(t, fields["port"].Type).Equal(bigquery.FloatFieldType)
+		gt.V(t, fields["_overflow"].Type).Equal(bigquery.JSONFieldType)
+
+		data := records[1].Data.(map[string]any)
+		_, ok := data["port"]
+		gt.False(t, ok)
+		gt.V(t, data["_overflow"]).Equal(`{"port":"https","user.id":1}`)
+		gt.A(t, resp.Conflicts).Length(2)
+	})
+}
+
+func TestIngestRecords_JSONColumns(t *testing.T) {
+	dst := model.BigQueryDest{
+		Dataset: "test-dataset",
+		Table:   "test-table",
+	}
+	newRecords := func() []*model.LogRecord {
+		return []*model.LogRecord{
+			{ID: "log-1", Timestamp: time.Now(), Data: map[string]any{
+				"user":    "alice",
+				"request": map[string]any{"path": "/", "headers": map[string]any{"host": "example.com"}},
+			}},
+			{ID: "log-2", Timestamp: time.Now(), Data: map[string]any{
+				"user":    "bob",
+				"request": map[string]any{"path": "/login", "headers": map[string]any{"x-custom": float64(1)}},
+			}},
+		}
+	}
+
+	t.Run("sub path", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		records := newRecords()
+		opts := &model.TableOptions{JSONColumns: []string{"data.request.headers", "data.not_found.field"}}
+		resp := gt.R1(usecase.IngestRecords(context.Background(), bqMock, dst, opts, nil, records, 1)).NoError(t)
+		gt.True(t, resp.Success)
+
+		schema := bqMock.CreatedTable[0].MD.Schema
+		var data *bigquery.FieldSchema
+		for _, f := range schema {
+			if f.Name == "data" {
+				data = f
+			}
+		}
+		gt.NotEqual(t, data, nil)
+		for _, f := range data.Schema {
+			switch f.Name {
+			case "user":
+				gt.V(t, f.Type).Equal(bigquery.StringFieldType)
+			case "request":
+				gt.V(t, f.Type).Equal(bigquery.RecordFieldType)
+				for _, sub := range f.Schema {
+					if sub.Name == "headers" {
+						gt.V(t, sub.Type).Equal(bigquery.JSONFieldType)
+						gt.A(t, sub.Schema).Length(0)
+					}
+				}
+			case "not_found":
+				gt.V(t, f.Schema[0].Type).Equal(bigquery.JSONFieldType)
+			}
+		}
+
+		request := records[1].Data.(map[string]any)["request"].(map[string]any)
+		gt.V(t, request["headers"]).Equal(`{"x-custom":1}`)
+		gt.V(t, request["path"]).Equal("/login")
+	})
+
+	t.Run("whole data", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		records := newRecords()
+		opts := &model.TableOptions{JSONColumns: []string{"data"}}
+		resp := gt.R1(usecase.IngestRecords(context.Background(), bqMock, dst, opts, nil, records, 1)).NoError(t)
+		gt.True(t, resp.Success)
+
+		for _, f := range bqMock.CreatedTable[0].MD.Schema {
+			if f.Name == "data" {
+				gt.V(t, f.Type).Equal(bigquery.JSONFieldType)
+				gt.A(t, f.Schema).Length(0)
+			}
+		}
+		gt.V(t, records[0].Data).Equal(`{"request":{"headers":{"host":"example.com"},"path":"/"},"user":"alice"}`)
+	})
+}
+
+func TestIngestRecords_SchemaGuard(t *testing.T) {
+	dst := model.BigQueryDest{
+		Dataset: "test-dataset",
+		Table:   "test-table",
+	}
+	newRecords := func() []*model.LogRecord {
+		return []*model.LogRecord{
+			{ID: "log-1", Timestamp: time.Now(), Data: map[string]any{
+				"user":   "alice",
+				"@type":  "login",
+				"client": map[string]any{"ip": "10.0.0.1", "geo": map[string]any{"country": "JP"}},
+			}},
+		}
+	}
+	dataSchema := func(t *testing.T, bqMock *bq.GeneralMock) map[string]*bigquery.FieldSchema {
+		gt.A(t, bqMock.CreatedTable).Length(1)
+		fields := map[string]*bigquery.FieldSchema{}
+		for _, field := range bqMock.CreatedTable[0].MD.Schema {
+			if field.Name == "data" {
+				for _, f := range field.Schema {
+					fields[f.Name] = f
+				}
+			}
+		}
+		return fields
+	}
+
+	t.Run("rename invalid field name", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		records := newRecords()
+		guard := &model.SchemaGuard{FieldNameAction: types.GuardRename, LimitAction: types.GuardReject}
+		gt.R1(usecase.IngestRecords(context.Background(), bqMock, dst, nil, guard, records, 1)).NoError(t)
+
+		fields := dataSchema(t, bqMock)
+		gt.V(t, fields["_type"].Type).Equal(bigquery.StringFieldType)
+		gt.V(t, records[0].Data.(map[string]any)["_type"]).Equal("login")
+	})
+
+	t.Run("reject invalid field name", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		guard := &model.SchemaGuard{FieldNameAction: types.GuardReject, LimitAction: types.GuardReject}
+		_, err := usecase.IngestRecords(context.Background(), bqMock, dst, nil, guard, newRecords(), 1)
+		gt.Error(t, err).Is(types.ErrInvalidFieldName)
+		gt.A(t, bqMock.CreatedTable).Length(0)
+	})
+
+	t.Run("invalid field name to JSON", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		records := newRecords()
+		guard := &model.SchemaGuard{FieldNameAction: types.GuardJSON, LimitAction: types.GuardReject}
+		gt.R1(usecase.IngestRecords(context.Background(), bqMock, dst, nil, guard, records, 1)).NoError(t)
+
+		fields := dataSchema(t, bqMock)
+		gt.V(t, fields["_overflow"].Type).Equal(bigquery.JSONFieldType)
+		gt.V(t, records[0].Data.(map[string]any)["_overflow"]).Equal(`{"@type":"login"}`)
+	})
+
+	t.Run("invalid field name in array of objects to JSON", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		records := []*model.LogRecord{
+			{ID: "log-1", Timestamp: time.Now(), Data: map[string]any{
+				"items": []any{
+					map[string]any{"name": "x", "a@b": 1},
+					map[string]any{"name": "y"},
+					map[string]any{"name": "z", "a@b": 3},
+				},
+			}},
+		}
+		guard := &model.SchemaGuard{FieldNameAction: types.GuardJSON, LimitAction: types.GuardReject}
+		gt.R1(usecase.IngestRecords(context.Background(), bqMock, dst, nil, guard, records, 1)).NoError(t)
+
+		gt.V(t, records[0].Data.(map[string]any)["_overflow"]).Equal(`{"items.a@b":[1,3]}`)
+	})
+
+	t.Run("nested object beyond max depth to JSON", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		records := newRecords()
+		guard := &model.SchemaGuard{MaxDepth: 3, LimitAction: types.GuardJSON}
+		gt.R1(usecase.IngestRecords(context.Background(), bqMock, dst, nil, guard, records, 1)).NoError(t)
+
+		fields := dataSchema(t, bqMock)
+		gt.V(t, fields["client"].Type).Equal(bigquery.RecordFieldType)
+		for _, f := range fields["client"].Schema {
+			if f.Name == "geo" {
+				gt.V(t, f.Type).Equal(bigquery.JSONFieldType)
+			}
+		}
+		client := records[0].Data.(map[string]any)["client"].(map[string]any)
+		gt.V(t, client["geo"]).Equal(`{"country":"JP"}`)
+	})
+
+	t.Run("reject nested object beyond max depth", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		guard := &model.SchemaGuard{MaxDepth: 3, LimitAction: types.GuardReject}
+		_, err := usecase.IngestRecords(context.Background(), bqMock, dst, nil, guard, newRecords(), 1)
+		gt.Error(t, err).Is(types.ErrSchemaLimitExceeded)
+	})
+
+	t.Run("fields exceeding max columns to JSON", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		records := newRecords()
+		// id, ingest_id, timestamp, ingested_at, data, data._overflow and 2 fields
+		guard := &model.SchemaGuard{MaxColumns: 8, LimitAction: types.GuardJSON}
+		gt.R1(usecase.IngestRecords(context.Background(), bqMock, dst, nil, guard, records, 1)).NoError(t)
+
+		fields := dataSchema(t, bqMock)
+		gt.V(t, fields["@type"].Type).Equal(bigquery.StringFieldType)
+		gt.V(t, fields["user"].Type).Equal(bigquery.StringFieldType)
+		gt.V(t, fields["_overflow"].Type).Equal(bigquery.JSONFieldType)
+		_, ok := fields["client"]
+		gt.False(t, ok)
+		gt.V(t, records[0].Data.(map[string]any)["_overflow"]).Equal(`{"client":{"geo":{"country":"JP"},"ip":"10.0.0.1"}}`)
+	})
+
+	t.Run("reject exceeding max columns", func(t *testing.T) {
+		bqMock := bq.NewGeneralMock()
+		guard := &model.SchemaGuard{MaxColumns: 8, LimitAction: types.GuardReject}
+		_, err := usecase.IngestRecords(context.Background(), bqMock, dst, nil, guard, newRecords(), 1)
+		gt.Error(t, err).Is(types.ErrSchemaLimitExceeded)
+	})
+}
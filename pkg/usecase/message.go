@@ -1,4 +1,4 @@
-package server
+package usecase
 
 import (
 	"context"
@@ -9,7 +9,18 @@ import (
 	"github.com/secmon-lab/swarm/pkg/domain/model"
 )
 
-func handleSwarmEvent(ctx context.Context, uc interfaces.UseCase, data []byte) error {
+// HandleSwarmMessage implements interfaces.UseCase. It loads objects in model.SwarmMessage published by enqueue.
+func (x *UseCase) HandleSwarmMessage(ctx context.Context, data []byte) error {
+	return handleSwarmMessage(ctx, x, data)
+}
+
+// HandleCloudStorageEvent implements interfaces.UseCase. It loads the object of model.CloudStorageEvent notified by Cloud Storage.
+func (x *UseCase) HandleCloudStorageEvent(ctx context.Context, data []byte) error {
+	return handleCloudStorageEvent(ctx, x, data)
+}
+
+// handleSwarmMessage is shared by UseCase and Mock so that the message is handled with ObjectToSources and Load of uc.
+func handleSwarmMessage(ctx context.Context, uc interfaces.UseCase, data []byte) error {
 	var event model.SwarmMessage
 	if err := json.Unmarshal(data, &event); err != nil {
 		return goerr.Wrap(err, "failed to unmarshal data", goerr.V("data", string(data)))
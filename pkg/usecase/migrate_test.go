@@ -9,6 +9,7 @@ import (
 	"github.com/secmon-lab/swarm/pkg/domain/model"
 	"github.com/secmon-lab/swarm/pkg/infra"
 	"github.com/secmon-lab/swarm/pkg/infra/bq"
+	"github.com/secmon-lab/swarm/pkg/infra/memory"
 	"github.com/secmon-lab/swarm/pkg/usecase"
 )
 
@@ -153,3 +154,47 @@ func TestMigrate(t *testing.T) {
 		})
 	}
 }
+
+func TestMigrate_Memory(t *testing.T) {
+	ctx := context.Background()
+	client := memory.New(memory.WithImplicitDataset())
+
+	srcSchema := bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "age", Type: bigquery.IntegerFieldType},
+	}
+	gt.NoError(t, client.CreateTable(ctx, "src_dataset", "src_table", &bigquery.TableMetadata{Schema: srcSchema}))
+	gt.NoError(t, client.Insert(ctx, "src_dataset", "src_table", srcSchema, []any{
+		map[string]any{"name": "alice", "age": 20},
+		map[string]any{"name": "bob", "age": 30},
+	}))
+
+	dstSchema := bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "address", Type: bigquery.StringFieldType},
+	}
+	gt.NoError(t, client.CreateTable(ctx, "dst_dataset", "dst_table", &bigquery.TableMetadata{Schema: dstSchema}))
+
+	src := model.BigQueryDest{Dataset: "src_dataset", Table: "src_table"}
+	dst := model.BigQueryDest{Dataset: "dst_dataset", Table: "dst_table"}
+
+	uc := usecase.New(infra.New(infra.WithBigQuery(client)))
+	gt.NoError(t, uc.Migrate(ctx, &src, &dst, "INSERT `my-project.dst_dataset.dst_table` SELECT * FROM `my-project.src_dataset.src_table`"))
+
+	md := gt.R1(client.GetMetadata(ctx, "dst_dataset", "dst_table")).NoError(t)
+	gt.A(t, md.Schema).Length(3)
+	gt.Equal(t, md.NumRows, 2)
+
+	t.Run("conflict schema is rejected", func(t *testing.T) {
+		conflict := bigquery.Schema{
+			{Name: "age", Type: bigquery.StringFieldType},
+		}
+		gt.NoError(t, client.CreateTable(ctx, "dst_dataset", "conflict_table", &bigquery.TableMetadata{Schema: conflict}))
+
+		conflictDst := model.BigQueryDest{Dataset: "dst_dataset", Table: "conflict_table"}
+		gt.Error(t, uc.Migrate(ctx, &src, &conflictDst, "INSERT `dst_dataset.conflict_table` SELECT * FROM `src_dataset.src_table`"))
+
+		rows := gt.R1(client.Rows("dst_dataset", "conflict_table")).NoError(t)
+		gt.A(t, rows).Length(0)
+	})
+}
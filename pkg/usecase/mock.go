@@ -63,3 +63,11 @@ func (x Mock) WaitState(ctx context.Context, msgType types.MsgType, id string, e
 	}
 	return x.MockWaitState(ctx, msgType, id, expiresAt)
 }
+
+func (x *Mock) HandleSwarmMessage(ctx context.Context, data []byte) error {
+	return handleSwarmMessage(ctx, x, data)
+}
+
+func (x *Mock) HandleCloudStorageEvent(ctx context.Context, data []byte) error {
+	return handleCloudStorageEvent(ctx, x, data)
+}
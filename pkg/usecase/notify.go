@@ -0,0 +1,113 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// validateNotify returns error if a record of the group specifies a notify topic that is not configured. It is checked before writing records to avoid notifying only a part of the records.
+func (x *UseCase) validateNotify(group *model.LogRecordGroup) error {
+	for _, record := range group.Records {
+		if record.Notify == nil {
+			continue
+		}
+		if _, ok := x.notifyTopics[record.Notify.Topic]; !ok {
+			return goerr.Wrap(types.ErrInvalidPolicyResult, "notify topic is not configured", goerr.V("topic", record.Notify.Topic))
+		}
+	}
+	return nil
+}
+
+// snapshotNotifyRecords returns copies of records that have notify configuration.
+func snapshotNotifyRecords(records []*model.LogRecord) []*model.LogRecord {
+	var snapshot []*model.LogRecord
+	for _, record := range records {
+		if record.Notify == nil {
+			continue
+		}
+		copied := *record
+		copied.Data = cloneWithoutNil(record.Data)
+		snapshot = append(snapshot, &copied)
+	}
+	return snapshot
+}
+
+// notifyRecords publishes records that have notify configuration to Pub/Sub topics, and returns number of published messages. Records with the same topic and ordering key are published sequentially to keep the order, and others are published concurrently.
+func (x *UseCase) notifyRecords(ctx context.Context, dst model.BigQueryDest, records []*model.LogRecord) (int, error) {
+	type queueKey struct {
+		topic       types.NotifyTopic
+		orderingKey string
+	}
+
+	var queues [][]*model.LogRecord
+	index := make(map[queueKey]int)
+	for _, record := range records {
+		if record.Notify == nil {
+			continue
+		}
+
+		if record.Notify.OrderingKey == "" {
+			queues = append(queues, []*model.LogRecord{record})
+			continue
+		}
+
+		key := queueKey{topic: record.Notify.Topic, orderingKey: record.Notify.OrderingKey}
+		if i, ok := index[key]; ok {
+			queues[i] = append(queues[i], record)
+			continue
+		}
+		index[key] = len(queues)
+		queues = append(queues, []*model.LogRecord{record})
+	}
+
+	var count atomic.Int64
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(x.ingestRecordConcurrency)
+	for _, queue := range queues {
+		eg.Go(func() error {
+			for _, record := range queue {
+				if err := x.notifyRecord(ctx, dst, record); err != nil {
+					return err
+				}
+				count.Add(1)
+			}
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+	return int(count.Load()), err
+}
+
+func (x *UseCase) notifyRecord(ctx context.Context, dst model.BigQueryDest, record *model.LogRecord) error {
+	raw, err := json.Marshal(model.NewLogMessage(dst, record))
+	if err != nil {
+		return goerr.Wrap(err, "failed to marshal notify message", goerr.V("id", record.ID))
+	}
+
+	options := []model.PublishOption{
+		model.WithAttributes(map[string]string{
+			"dataset": dst.Dataset.String(),
+			"table":   dst.Table.String(),
+		}),
+		model.WithAttributes(record.Notify.Attributes),
+	}
+	if record.Notify.OrderingKey != "" {
+		options = append(options, model.WithOrderingKey(record.Notify.OrderingKey))
+	}
+
+	topic := x.notifyTopics[record.Notify.Topic]
+	if _, err := topic.Publish(ctx, raw, options...); err != nil {
+		return goerr.Wrap(err, "failed to publish notify message",
+			goerr.V("id", record.ID),
+			goerr.V("topic", record.Notify.Topic),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package usecase_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra"
+	"github.com/secmon-lab/swarm/pkg/infra/cs"
+	"github.com/secmon-lab/swarm/pkg/infra/memory"
+	"github.com/secmon-lab/swarm/pkg/infra/policy"
+	"github.com/secmon-lab/swarm/pkg/infra/pubsub"
+	"github.com/secmon-lab/swarm/pkg/usecase"
+)
+
+const notifySchemaPolicy = `package schema.cloudtrail
+
+log contains {
+	"dataset": "my_dataset",
+	"table": "cloudtrail",
+	"id": r.eventID,
+	"timestamp": time.parse_rfc3339_ns(r.eventTime) / 1000000000,
+	"data": r,
+	"notify": {
+		"topic": "alerts",
+		"ordering_key": r.requestParameters.bucketName,
+		"attributes": {"event": r.eventName},
+	},
+} if {
+	some i
+	r := input.Records[i]
+	i < 2
+}
+
+log contains {
+	"dataset": "my_dataset",
+	"table": "cloudtrail",
+	"id": r.eventID,
+	"timestamp": time.parse_rfc3339_ns(r.eventTime) / 1000000000,
+	"data": r,
+} if {
+	some i
+	r := input.Records[i]
+	i >= 2
+}
+`
+
+func TestLoad_Notify(t *testing.T) {
+	ctx := context.Background()
+	csClient := &cs.Mock{
+		MockOpen: func(ctx context.Context, obj model.CloudStorageObject) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(cloudTrailExampleRaw)), nil
+		},
+	}
+	req := &model.LoadRequest{
+		Source: model.Source{
+			Parser:   types.JSONParser,
+			Schema:   "cloudtrail",
+			Compress: types.NoCompress,
+		},
+		Object: model.Object{
+			CS: &model.CloudStorageObject{
+				Bucket: "test-bucket",
+				Name:   "cloudtrail_example.log",
+			},
+		},
+	}
+	pClient := gt.R1(policy.New(policy.WithPolicyData("schema.rego", notifySchemaPolicy))).NoError(t)
+
+	newUseCase := func(bqClient *memory.Client, options ...usecase.Option) *usecase.UseCase {
+		return usecase.New(
+			infra.New(
+				infra.WithBigQuery(bqClient),
+				infra.WithCloudStorage(csClient),
+				infra.WithPolicy(pClient),
+			),
+			append([]usecase.Option{
+				usecase.WithMetadata(model.NewMetadataConfig("test-dataset", "test-table")),
+			}, options...)...,
+		)
+	}
+
+	t.Run("records are published after insertion", func(t *testing.T) {
+		outDir := t.TempDir()
+		bqClient := memory.New(memory.WithImplicitDataset())
+		uc := newUseCase(bqClient, usecase.WithNotifyTopic("alerts", pubsub.NewDumper(outDir)))
+		gt.NoError(t, uc.Load(ctx, []*model.LoadRequest{req}))
+
+		rows := gt.R1(bqClient.Rows("my_dataset", "cloudtrail")).NoError(t)
+		gt.A(t, rows).Length(4)
+
+		msgFiles := gt.R1(filepath.Glob(filepath.Join(outDir, "*.msg"))).NoError(t)
+		gt.A(t, msgFiles).Length(2)
+		var msg model.LogMessage
+		gt.NoError(t, json.Unmarshal(gt.R1(os.ReadFile(msgFiles[0])).NoError(t), &msg))
+		gt.Equal(t, msg.Dataset, "my_dataset")
+		gt.Equal(t, msg.Table, "cloudtrail")
+
+		attrFiles := gt.R1(filepath.Glob(filepath.Join(outDir, "*.attrs.json"))).NoError(t)
+		gt.A(t, attrFiles).Length(2)
+		var attrs struct {
+			OrderingKey string            `json:"ordering_key"`
+			Attributes  map[string]string `json:"attributes"`
+		}
+		gt.NoError(t, json.Unmarshal(gt.R1(os.ReadFile(attrFiles[0])).NoError(t), &attrs))
+		gt.NotEqual(t, attrs.OrderingKey, "")
+		gt.Equal(t, attrs.Attributes["event"], "PutObject")
+		gt.Equal(t, attrs.Attributes["dataset"], "my_dataset")
+		gt.Equal(t, attrs.Attributes["table"], "cloudtrail")
+
+		iter := gt.R1(bqClient.Query(ctx, "SELECT * FROM `test-dataset.test-table`")).NoError(t)
+		var log model.LoadLog
+		gt.NoError(t, iter.Next(&log))
+		gt.A(t, log.Ingests).Length(1)
+		gt.Equal(t, log.Ingests[0].NotifyCount, 2)
+		gt.A(t, log.Ingests[0].Sinks).Length(0)
+	})
+
+	t.Run("records are not published if insertion fails", func(t *testing.T) {
+		topic := pubsub.NewMock()
+		bqClient := memory.New()
+		uc := newUseCase(bqClient, usecase.WithNotifyTopic("alerts", topic))
+		gt.Error(t, uc.Load(ctx, []*model.LoadRequest{req}))
+		gt.A(t, topic.Results).Length(0)
+	})
+
+	t.Run("publish failure fails the request", func(t *testing.T) {
+		topic := &pubsub.Mock{
+			MockPublish: func(ctx context.Context, data []byte, options ...model.PublishOption) (types.PubSubMessageID, error) {
+				return "", io.ErrUnexpectedEOF
+			},
+		}
+		uc := newUseCase(memory.New(memory.WithImplicitDataset()), usecase.WithNotifyTopic("alerts", topic))
+		gt.Error(t, uc.Load(ctx, []*model.LoadRequest{req})).Is(io.ErrUnexpectedEOF)
+	})
+
+	t.Run("unknown topic is rejected before insertion", func(t *testing.T) {
+		bqClient := memory.New(memory.WithImplicitDataset())
+		uc := newUseCase(bqClient)
+		gt.Error(t, uc.Load(ctx, []*model.LoadRequest{req})).Is(types.ErrInvalidPolicyResult)
+
+		_, err := bqClient.Rows("my_dataset", "cloudtrail")
+		gt.Error(t, err)
+	})
+}
+
+const notifyJSONColumnPolicy = `package schema.cloudtrail
+
+log contains {
+	"dataset": "my_dataset",
+	"table": "alerts",
+	"id": "alert-1",
+	"timestamp": 1700000000,
+	"data": {"a": {"b": 1}, "sev": "high"},
+	"json_columns": ["data.a"],
+	"notify": {"topic": "alerts"},
+} if {
+	input.Records[0]
+}
+`
+
+func TestLoad_NotifyOriginalData(t *testing.T) {
+	csClient := &cs.Mock{
+		MockOpen: func(ctx context.Context, obj model.CloudStorageObject) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(cloudTrailExampleRaw)), nil
+		},
+	}
+	pClient := gt.R1(policy.New(policy.WithPolicyData("schema.rego", notifyJSONColumnPolicy))).NoError(t)
+	bqClient := memory.New(memory.WithImplicitDataset())
+	topic := pubsub.NewMock()
+	uc := usecase.New(
+		infra.New(
+			infra.WithBigQuery(bqClient),
+			infra.WithCloudStorage(csClient),
+			infra.WithPolicy(pClient),
+		),
+		usecase.WithNotifyTopic("alerts", topic),
+	)
+
+	req := &model.LoadRequest{
+		Source: model.Source{
+			Parser:   types.JSONParser,
+			Schema:   "cloudtrail",
+			Compress: types.NoCompress,
+		},
+		Object: model.Object{
+			CS: &model.CloudStorageObject{Bucket: "test-bucket", Name: "cloudtrail_example.log"},
+		},
+	}
+	gt.NoError(t, uc.Load(context.Background(), []*model.LoadRequest{req}))
+
+	// Data published to the topic is what the policy emitted, not the value converted for BigQuery
+	gt.A(t, topic.Results).Length(1).At(0, func(t testing.TB, v *pubsub.MockResult) {
+		var msg struct {
+			Data map[string]any `json:"data"`
+		}
+		gt.NoError(t, json.Unmarshal(v.Data, &msg))
+		gt.Equal(t, msg.Data, map[string]any{
+			"a":   map[string]any{"b": float64(1)},
+			"sev": "high",
+		})
+	})
+}
@@ -0,0 +1,32 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/utils"
+)
+
+// CheckPolicy validates policies statically and returns found issues. It returns ErrInvalidPolicy if one or more error level issues are found. Warning level issues are only logged.
+func (x *UseCase) CheckPolicy(ctx context.Context) ([]*model.PolicyIssue, error) {
+	issues := x.clients.Policy().Check()
+
+	var errCount int
+	for _, issue := range issues {
+		switch issue.Severity {
+		case types.PolicyIssueError:
+			errCount++
+			utils.CtxLogger(ctx).Error("policy issue found", "issue", issue)
+		default:
+			utils.CtxLogger(ctx).Warn("policy issue found", "issue", issue)
+		}
+	}
+
+	if errCount > 0 {
+		return issues, goerr.Wrap(types.ErrInvalidPolicy, "policy check failed", goerr.V("error_count", errCount))
+	}
+
+	return issues, nil
+}
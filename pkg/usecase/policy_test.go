@@ -0,0 +1,33 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra"
+	"github.com/secmon-lab/swarm/pkg/infra/policy"
+	"github.com/secmon-lab/swarm/pkg/usecase"
+)
+
+func TestCheckPolicy(t *testing.T) {
+	t.Run("testdata policy has only warnings", func(t *testing.T) {
+		p := gt.R1(policy.New(policy.WithDir("testdata/policy"))).NoError(t)
+		uc := usecase.New(infra.New(infra.WithPolicy(p)))
+
+		issues := gt.R1(uc.CheckPolicy(context.Background())).NoError(t)
+		for _, issue := range issues {
+			gt.Equal(t, issue.Severity, types.PolicyIssueWarning)
+		}
+	})
+
+	t.Run("missing schema package", func(t *testing.T) {
+		p := gt.R1(policy.New(policy.WithFile("testdata/policy/event.rego"))).NoError(t)
+		uc := usecase.New(infra.New(infra.WithPolicy(p)))
+
+		_, err := uc.CheckPolicy(context.Background())
+		gt.True(t, errors.Is(err, types.ErrInvalidPolicy))
+	})
+}
@@ -0,0 +1,89 @@
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/infra/policy"
+	"github.com/secmon-lab/swarm/pkg/utils"
+)
+
+// regoPrintConfig controls output of `print` statement in Rego. Output is written to structured log.
+type regoPrintConfig struct {
+	// limit is max number of output lines for each evaluation scope (e.g. an object). Zero means unlimited.
+	limit int
+
+	// sample is sampling interval of output. Only 1 of every `sample` lines is written.
+	sample int
+}
+
+// regoPrinter writes `print` output of Rego with attributes, such as request ID and object URL. Output exceeding the limit or not sampled is dropped, and the number of dropped lines is reported by Flush.
+type regoPrinter struct {
+	cfg   regoPrintConfig
+	ctx   context.Context
+	attrs []any
+
+	mutex   sync.Mutex
+	count   int
+	written int
+	dropped int
+}
+
+func (x regoPrintConfig) newPrinter(ctx context.Context, attrs ...any) *regoPrinter {
+	reqID, _ := utils.CtxRequestID(ctx)
+	return &regoPrinter{
+		cfg:   x,
+		ctx:   ctx,
+		attrs: append([]any{slog.Any("request_id", reqID)}, attrs...),
+	}
+}
+
+func (x *regoPrinter) Print(file string, row int, msg string) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	x.count++
+	if x.cfg.sample > 1 && (x.count-1)%x.cfg.sample != 0 {
+		x.dropped++
+		return nil
+	}
+	if x.cfg.limit > 0 && x.written >= x.cfg.limit {
+		x.dropped++
+		return nil
+	}
+	x.written++
+
+	args := append([]any{slog.Group("rego",
+		"file", file,
+		"row", row,
+	)}, x.attrs...)
+	utils.CtxLogger(x.ctx).Info(msg, args...)
+	return nil
+}
+
+// Flush reports the number of dropped lines if any.
+func (x *regoPrinter) Flush() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if x.dropped > 0 {
+		args := append([]any{"dropped", x.dropped, "total", x.count}, x.attrs...)
+		utils.CtxLogger(x.ctx).Warn("rego print output is dropped by sampling or limit", args...)
+	}
+	x.dropped = 0
+}
+
+// objectURL returns URL of the object for logging. It returns empty string if the object is not on Cloud Storage.
+func objectURL(obj model.Object) string {
+	if obj.CS == nil {
+		return ""
+	}
+	return "gs://" + string(obj.CS.Bucket) + "/" + string(obj.CS.Name)
+}
+
+// Option returns policy.QueryOption to route `print` output to the printer.
+func (x *regoPrinter) Option() policy.QueryOption {
+	return policy.WithRegoPrint(x.Print)
+}
@@ -0,0 +1,90 @@
+package usecase_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/infra"
+	"github.com/secmon-lab/swarm/pkg/infra/policy"
+	"github.com/secmon-lab/swarm/pkg/usecase"
+	"github.com/secmon-lab/swarm/pkg/utils"
+)
+
+const regoPrintEventPolicy = `package event
+
+src contains {
+	"parser": "json",
+	"schema": "test",
+} if {
+	some i in numbers.range(1, 10)
+	print("hello", i)
+}
+`
+
+func TestRegoPrint(t *testing.T) {
+	testCases := map[string]struct {
+		options []usecase.Option
+		printed int
+		dropped bool
+	}{
+		"default": {
+			printed: 10,
+		},
+		"limit": {
+			options: []usecase.Option{usecase.WithRegoPrintLimit(3)},
+			printed: 3,
+			dropped: true,
+		},
+		"sample": {
+			options: []usecase.Option{usecase.WithRegoPrintSample(5)},
+			printed: 2,
+			dropped: true,
+		},
+		"unlimited": {
+			options: []usecase.Option{usecase.WithRegoPrintLimit(0)},
+			printed: 10,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			pClient := gt.R1(policy.New(policy.WithPolicyData("event.rego", regoPrintEventPolicy))).NoError(t)
+			uc := usecase.New(infra.New(infra.WithPolicy(pClient)), tc.options...)
+
+			var buf bytes.Buffer
+			ctx := utils.CtxWithLogger(context.Background(), slog.New(slog.NewJSONHandler(&buf, nil)))
+
+			obj := model.Object{
+				CS: &model.CloudStorageObject{
+					Bucket: "my-bucket",
+					Name:   "path/to/object.json",
+				},
+			}
+			gt.R1(uc.ObjectToSources(ctx, obj)).NoError(t)
+
+			var printed int
+			var dropped bool
+			for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+				var entry map[string]any
+				gt.NoError(t, json.Unmarshal([]byte(line), &entry))
+				gt.V(t, entry["object"]).Equal("gs://my-bucket/path/to/object.json")
+				gt.True(t, entry["request_id"] != "")
+
+				switch {
+				case strings.HasPrefix(entry["msg"].(string), "hello"):
+					printed++
+				case strings.Contains(entry["msg"].(string), "dropped"):
+					dropped = true
+				}
+			}
+			gt.V(t, printed).Equal(tc.printed)
+			gt.V(t, dropped).Equal(tc.dropped)
+		})
+	}
+}
@@ -2,8 +2,13 @@ package usecase
 
 import (
 	"context"
+	"slices"
+	"sort"
+	"strings"
 
+	"cloud.google.com/go/bigquery"
 	"cloud.google.com/go/storage"
+	"github.com/m-mizutani/goerr/v2"
 	"github.com/secmon-lab/swarm/pkg/domain/model"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 	"github.com/secmon-lab/swarm/pkg/utils"
@@ -11,6 +16,16 @@ import (
 )
 
 func (x *UseCase) ApplyInferredSchema(ctx context.Context, urls []types.CSUrl) error {
+	objects, err := x.listObjects(ctx, urls)
+	if err != nil {
+		return err
+	}
+
+	return x.applyInferredSchema(ctx, objects)
+}
+
+// listObjects returns Cloud Storage objects that have one of urls as prefix.
+func (x *UseCase) listObjects(ctx context.Context, urls []types.CSUrl) ([]model.Object, error) {
 	var objects []model.Object
 	logger := utils.CtxLogger(ctx)
 
@@ -18,7 +33,7 @@ func (x *UseCase) ApplyInferredSchema(ctx context.Context, urls []types.CSUrl) e
 		var tmp []model.Object
 		bucket, objPrefix, err := url.Parse()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		query := &storage.Query{
@@ -32,7 +47,7 @@ func (x *UseCase) ApplyInferredSchema(ctx context.Context, urls []types.CSUrl) e
 				break
 			}
 			if err != nil {
-				return err
+				return nil, err
 			}
 
 			obj := model.NewObjectFromCloudStorageAttrs(attrs)
@@ -43,16 +58,17 @@ func (x *UseCase) ApplyInferredSchema(ctx context.Context, urls []types.CSUrl) e
 		objects = append(objects, tmp...)
 	}
 
-	return x.applyInferredSchema(ctx, objects)
+	return objects, nil
 }
 
-func (x *UseCase) applyInferredSchema(ctx context.Context, objects []model.Object) error {
+// importObjects reads objects and converts them to log records by schema policy.
+func (x *UseCase) importObjects(ctx context.Context, objects []model.Object) (model.LogRecordSet, error) {
 	var requests []*model.LoadRequest
 
 	for _, obj := range objects {
 		sources, err := x.ObjectToSources(ctx, obj)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		for _, src := range sources {
@@ -65,26 +81,159 @@ func (x *UseCase) applyInferredSchema(ctx context.Context, objects []model.Objec
 
 	logger := utils.CtxLogger(ctx)
 	logger.Info("importing objects", "source.size", len(requests))
-	records, _, err := importLogRecords(ctx, x.clients, requests, x.readObjectConcurrency)
+	records, _, err := importLogRecords(ctx, x.clients, requests, x.readObjectConcurrency, x.regoPrint)
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func (x *UseCase) applyInferredSchema(ctx context.Context, objects []model.Object) error {
+	records, err := x.importObjects(ctx, objects)
 	if err != nil {
 		return err
 	}
 
-	for dst, records := range records {
-		schema, err := inferSchema(records)
+	var changes []*model.SchemaChangeLog
+	defer func() {
+		x.recordSchemaChanges(ctx, changes)
+	}()
+
+	for dst, group := range records {
+		if err := x.ensureDataset(ctx, dst.Dataset); err != nil {
+			return err
+		}
+
+		old, err := x.clients.BigQuery().GetMetadata(ctx, dst.Dataset, dst.Table)
 		if err != nil {
 			return err
 		}
 
-		md, err := buildBQMetadata(schema, dst.Partition)
+		schema, _, err := inferTableSchema(ctx, dst, old, &group.Options, x.schemaGuard, group.Records)
 		if err != nil {
 			return err
 		}
 
-		if _, err := createOrUpdateTable(ctx, x.clients.BigQuery(), dst.Dataset, dst.Table, md); err != nil {
+		md, err := buildBQMetadata(schema, dst.Partition, &group.Options)
+		if err != nil {
 			return err
 		}
+
+		merged, err := applyTableMetadata(ctx, x.clients.BigQuery(), dst.Dataset, dst.Table, old, md, &group.Options)
+		if err != nil {
+			return err
+		}
+		warnSchemaGrowth(ctx, x.schemaGuard, dst, old, merged)
+
+		change, err := newSchemaChangeLog(ctx, dst, old, merged)
+		if err != nil {
+			return err
+		}
+		if change != nil {
+			change.Objects = group.Objects
+			changes = append(changes, change)
+		}
 	}
 
 	return nil
 }
+
+// DiffInferredSchema infers schema from objects of urls and compares it with schema of the current tables without changing them. It returns diffs of destination tables, and ErrIncompatibleSchema if type of any existing field would be changed.
+func (x *UseCase) DiffInferredSchema(ctx context.Context, urls []types.CSUrl) ([]*model.SchemaDiff, error) {
+	objects, err := x.listObjects(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := x.importObjects(ctx, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []*model.SchemaDiff
+	var incompatible []string
+	for dst, group := range records {
+		old, err := x.clients.BigQuery().GetMetadata(ctx, dst.Dataset, dst.Table)
+		if err != nil {
+			return nil, err
+		}
+
+		schema, _, err := inferTableSchema(ctx, dst, old, &group.Options, x.schemaGuard, group.Records)
+		if err != nil {
+			return nil, err
+		}
+
+		md, err := buildBQMetadata(schema, dst.Partition, &group.Options)
+		if err != nil {
+			return nil, err
+		}
+
+		diff := &model.SchemaDiff{
+			DatasetID: dst.Dataset,
+			TableID:   dst.Table,
+			Created:   old == nil,
+		}
+		var base bigquery.Schema
+		if old != nil {
+			base = old.Schema
+		}
+		diffSchema(base, md.Schema, nil, diff)
+
+		if diff.Incompatible() {
+			incompatible = append(incompatible, dst.Dataset.String()+"."+dst.Table.String())
+		}
+		diffs = append(diffs, diff)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].DatasetID != diffs[j].DatasetID {
+			return diffs[i].DatasetID < diffs[j].DatasetID
+		}
+		return diffs[i].TableID < diffs[j].TableID
+	})
+
+	if len(incompatible) > 0 {
+		sort.Strings(incompatible)
+		return diffs, goerr.Wrap(types.ErrIncompatibleSchema, "schema can not be applied to table", goerr.V("tables", incompatible))
+	}
+
+	return diffs, nil
+}
+
+// diffSchema appends fields of schema that are added or changed from base to diff. Fields only in base are ignored because merging schema never removes them.
+func diffSchema(base, schema bigquery.Schema, prefix []string, diff *model.SchemaDiff) {
+	for _, f := range schema {
+		path := append(slices.Clone(prefix), f.Name)
+		field := strings.Join(path, ".")
+
+		idx := slices.IndexFunc(base, func(b *bigquery.FieldSchema) bool { return b.Name == f.Name })
+		if idx < 0 {
+			diff.Added = append(diff.Added, &model.FieldDiff{Field: field, NewType: fieldTypeString(f)})
+			diffSchema(nil, f.Schema, path, diff)
+			continue
+		}
+
+		current := base[idx]
+		if current.Type != f.Type || current.Repeated != f.Repeated {
+			diff.Changed = append(diff.Changed, &model.FieldDiff{
+				Field:   field,
+				OldType: fieldTypeString(current),
+				NewType: fieldTypeString(f),
+			})
+			continue
+		}
+
+		if f.Type == bigquery.RecordFieldType {
+			diffSchema(current.Schema, f.Schema, path, diff)
+		}
+	}
+}
+
+// fieldTypeString returns type name of field for schema diff.
+func fieldTypeString(f *bigquery.FieldSchema) string {
+	if f.Repeated {
+		return "REPEATED " + string(f.Type)
+	}
+	return string(f.Type)
+}
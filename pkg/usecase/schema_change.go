@@ -0,0 +1,100 @@
+package usecase
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/bqs"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/utils"
+)
+
+// newSchemaChangeLog returns a record of schema change from old table metadata to merged schema. It returns nil if the schema is not changed. old is nil if the table is created.
+func newSchemaChangeLog(ctx context.Context, dst model.BigQueryDest, old *bigquery.TableMetadata, merged bigquery.Schema) (*model.SchemaChangeLog, error) {
+	var base bigquery.Schema
+	if old != nil {
+		if bqs.Equal(old.Schema, merged) {
+			return nil, nil
+		}
+		base = old.Schema
+	}
+
+	reqID, _ := utils.CtxRequestID(ctx)
+	change := &model.SchemaChangeLog{
+		RequestID:   reqID,
+		ChangedAt:   time.Now(),
+		DatasetID:   dst.Dataset,
+		TableID:     dst.Table,
+		Created:     old == nil,
+		AddedFields: addedFields(base, merged, nil),
+	}
+
+	if old != nil {
+		oldSchema, err := schemaToJSON(old.Schema)
+		if err != nil {
+			return nil, err
+		}
+		change.OldSchema = oldSchema
+	}
+
+	newSchema, err := schemaToJSON(merged)
+	if err != nil {
+		return nil, err
+	}
+	change.NewSchema = newSchema
+
+	return change, nil
+}
+
+// addedFields returns dot separated paths of all fields in schema that do not exist in base, including sub fields of new RECORD.
+func addedFields(base, schema bigquery.Schema, prefix []string) []string {
+	var fields []string
+	for _, f := range schema {
+		path := append(slices.Clone(prefix), f.Name)
+		idx := slices.IndexFunc(base, func(b *bigquery.FieldSchema) bool { return b.Name == f.Name })
+
+		var sub bigquery.Schema
+		if idx < 0 {
+			fields = append(fields, strings.Join(path, "."))
+		} else {
+			sub = base[idx].Schema
+		}
+		fields = append(fields, addedFields(sub, f.Schema, path)...)
+	}
+	return fields
+}
+
+// recordSchemaChanges inserts schema changes into the schema change table of metadata dataset. It does nothing if metadata is not configured. Failure of recording is reported but not returned because the changes have been already applied.
+func (x *UseCase) recordSchemaChanges(ctx context.Context, changes []*model.SchemaChangeLog) {
+	if x.metadata == nil || len(changes) == 0 {
+		return
+	}
+
+	schema, err := setupSchemaChangeTable(ctx, x.clients.BigQuery(), x.metadata)
+	if err != nil {
+		utils.HandleError(ctx, "failed to setup schema change table", err)
+		return
+	}
+
+	s, err := x.clients.BigQuery().NewStream(ctx, x.metadata.Dataset(), x.metadata.SchemaChangeTable(), schema)
+	if err != nil {
+		utils.HandleError(ctx, "failed to create stream for schema change table", err)
+		return
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			utils.HandleError(ctx, "failed to close stream for schema change table", err)
+		}
+	}()
+
+	data := make([]any, len(changes))
+	for i, change := range changes {
+		data[i] = change.Raw()
+	}
+	if err := s.Insert(ctx, data); err != nil {
+		utils.HandleError(ctx, "failed to insert schema changes", err)
+	}
+}
@@ -0,0 +1,70 @@
+package usecase_test
+
+import (
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/usecase"
+)
+
+func TestDiffSchema(t *testing.T) {
+	base := bigquery.Schema{
+		{Name: "id", Type: bigquery.StringFieldType},
+		{Name: "data", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "name", Type: bigquery.StringFieldType},
+			{Name: "count", Type: bigquery.IntegerFieldType},
+			{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+			{Name: "removed", Type: bigquery.StringFieldType},
+		}},
+	}
+
+	t.Run("no change", func(t *testing.T) {
+		diff := &model.SchemaDiff{}
+		usecase.DiffSchema(base, base[:1], nil, diff)
+		gt.False(t, diff.HasChange())
+		gt.False(t, diff.Incompatible())
+	})
+
+	t.Run("added and changed fields", func(t *testing.T) {
+		schema := bigquery.Schema{
+			{Name: "id", Type: bigquery.StringFieldType},
+			{Name: "data", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+				{Name: "name", Type: bigquery.StringFieldType},
+				{Name: "count", Type: bigquery.StringFieldType},
+				{Name: "tags", Type: bigquery.StringFieldType},
+				{Name: "user", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+					{Name: "email", Type: bigquery.StringFieldType},
+				}},
+			}},
+		}
+
+		diff := &model.SchemaDiff{}
+		usecase.DiffSchema(base, schema, nil, diff)
+		gt.True(t, diff.HasChange())
+		gt.True(t, diff.Incompatible())
+		gt.A(t, diff.Added).Length(2).
+			At(0, func(t testing.TB, v *model.FieldDiff) {
+				gt.Equal(t, v, &model.FieldDiff{Field: "data.user", NewType: "RECORD"})
+			}).
+			At(1, func(t testing.TB, v *model.FieldDiff) {
+				gt.Equal(t, v, &model.FieldDiff{Field: "data.user.email", NewType: "STRING"})
+			})
+		gt.A(t, diff.Changed).Length(2).
+			At(0, func(t testing.TB, v *model.FieldDiff) {
+				gt.Equal(t, v, &model.FieldDiff{Field: "data.count", OldType: "INTEGER", NewType: "STRING"})
+			}).
+			At(1, func(t testing.TB, v *model.FieldDiff) {
+				gt.Equal(t, v, &model.FieldDiff{Field: "data.tags", OldType: "REPEATED STRING", NewType: "STRING"})
+			})
+	})
+
+	t.Run("new table", func(t *testing.T) {
+		diff := &model.SchemaDiff{Created: true}
+		usecase.DiffSchema(nil, base, nil, diff)
+		gt.True(t, diff.HasChange())
+		gt.False(t, diff.Incompatible())
+		gt.A(t, diff.Added).Length(6)
+	})
+}
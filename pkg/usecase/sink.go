@@ -0,0 +1,185 @@
+package usecase
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/utils"
+)
+
+// tableSink writes records to a table of BigQuery compatible destination with the same schema inference as the BigQuery table.
+type tableSink struct {
+	uc *UseCase
+	bq interfaces.BigQuery
+}
+
+var _ interfaces.Sink = &tableSink{}
+
+func (x *tableSink) Write(ctx context.Context, dst model.BigQueryDest, group *model.LogRecordGroup) error {
+	if _, err := ingestRecords(ctx, x.bq, dst, &group.Options, x.uc.schemaGuard, group.Records, x.uc.ingestRecordConcurrency); err != nil {
+		return err
+	}
+	return nil
+}
+
+// splitBySink splits records of group into groups for each sink. Records for sinks other than the BigQuery table are copied because ingestion into the table modifies records in place. It returns error if a record specifies a sink that is not configured.
+func (x *UseCase) splitBySink(group *model.LogRecordGroup) (map[types.SinkName]*model.LogRecordGroup, error) {
+	groups := make(map[types.SinkName]*model.LogRecordGroup)
+	for _, record := range group.Records {
+		sinks := []types.SinkName{types.BigQuerySink}
+		if len(record.Sinks) > 0 {
+			sinks = slices.Compact(slices.Sorted(slices.Values(record.Sinks)))
+		}
+
+		for _, name := range sinks {
+			if _, ok := x.sinks[name]; !ok && name != types.BigQuerySink {
+				return nil, goerr.Wrap(types.ErrInvalidPolicyResult, "sink is not configured", goerr.V("sink", name))
+			}
+
+			g, ok := groups[name]
+			if !ok {
+				g = &model.LogRecordGroup{
+					Options: group.Options,
+					Objects: group.Objects,
+				}
+				groups[name] = g
+			}
+
+			if name == types.BigQuerySink {
+				g.Records = append(g.Records, record)
+				continue
+			}
+			copied := *record
+			copied.Data = cloneWithoutNil(record.Data)
+			g.Records = append(g.Records, &copied)
+		}
+	}
+	return groups, nil
+}
+
+// ingestGroup writes records of the group to the BigQuery table and sinks specified by records, and then publishes records that have notify configuration. Result of each sink is recorded in IngestLog.Sinks if any record specifies sinks.
+func (x *UseCase) ingestGroup(ctx context.Context, dst model.BigQueryDest, group *model.LogRecordGroup) (*model.IngestLog, error) {
+	ingestID, ctx := utils.CtxIngestID(ctx)
+
+	groups, err := x.splitBySink(group)
+	if err == nil {
+		err = x.validateNotify(group)
+	}
+	if err != nil {
+		return &model.IngestLog{
+			ID:        ingestID,
+			DatasetID: dst.Dataset,
+			TableID:   dst.Table,
+			LogCount:  len(group.Records),
+			Error:     err.Error(),
+		}, err
+	}
+
+	// Records to notify are copied before ingestion modifies records in place, so that the message has data emitted by the policy
+	notifyTargets := snapshotNotifyRecords(group.Records)
+
+	var log *model.IngestLog
+	var ingestErr error
+	if bqGroup, ok := groups[types.BigQuerySink]; ok {
+		log, ingestErr = x.ingestBigQuery(ctx, dst, bqGroup)
+	} else {
+		log = &model.IngestLog{
+			ID:        ingestID,
+			StartedAt: time.Now(),
+			DatasetID: dst.Dataset,
+			TableID:   dst.Table,
+			Success:   true,
+		}
+	}
+
+	names := make([]types.SinkName, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	// Sink results are not recorded for the default destination to keep the load log same as before
+	if len(names) != 1 || names[0] != types.BigQuerySink {
+		if err := x.writeSinks(ctx, dst, groups, names, log, ingestErr); err != nil && ingestErr == nil {
+			ingestErr = err
+		}
+	}
+
+	// Records are notified only after all of them are written successfully
+	if ingestErr == nil {
+		count, err := x.notifyRecords(ctx, dst, notifyTargets)
+		log.NotifyCount = count
+		if err != nil {
+			utils.HandleError(ctx, "failed to notify records", err)
+			ingestErr = err
+		}
+	}
+
+	log.FinishedAt = time.Now()
+	log.LogCount = len(group.Records)
+	log.Success = ingestErr == nil
+	if ingestErr != nil && log.Error == "" {
+		log.Error = ingestErr.Error()
+	}
+	return log, ingestErr
+}
+
+// writeSinks writes records to sinks other than the BigQuery table, and records results of all sinks including the BigQuery table into log. It returns the first error of sinks.
+func (x *UseCase) writeSinks(ctx context.Context, dst model.BigQueryDest, groups map[types.SinkName]*model.LogRecordGroup, names []types.SinkName, log *model.IngestLog, bqErr error) error {
+	var sinkErr error
+	for _, name := range names {
+		sinkLog := &model.SinkLog{
+			Name:     name,
+			LogCount: len(groups[name].Records),
+		}
+		log.Sinks = append(log.Sinks, sinkLog)
+
+		if name == types.BigQuerySink {
+			sinkLog.Success = bqErr == nil
+			if bqErr != nil {
+				sinkLog.Error = bqErr.Error()
+			}
+			continue
+		}
+
+		if err := x.sinks[name].Write(ctx, dst, groups[name]); err != nil {
+			err = goerr.Wrap(err, "failed to write records to sink", goerr.V("sink", name), goerr.V("dst", dst))
+			sinkLog.Error = err.Error()
+			utils.HandleError(ctx, "failed to write records to sink", err)
+			if sinkErr == nil {
+				sinkErr = err
+			}
+			continue
+		}
+		sinkLog.Success = true
+	}
+	return sinkErr
+}
+
+// ingestBigQuery writes records to the BigQuery table.
+func (x *UseCase) ingestBigQuery(ctx context.Context, dst model.BigQueryDest, group *model.LogRecordGroup) (*model.IngestLog, error) {
+	if err := x.ensureDataset(ctx, dst.Dataset); err != nil {
+		ingestID, _ := utils.CtxIngestID(ctx)
+		return &model.IngestLog{
+			ID:        ingestID,
+			DatasetID: dst.Dataset,
+			TableID:   dst.Table,
+			LogCount:  len(group.Records),
+			Error:     err.Error(),
+		}, err
+	}
+
+	log, err := ingestRecords(ctx, x.clients.BigQuery(), dst, &group.Options, x.schemaGuard, group.Records, x.ingestRecordConcurrency)
+	if log.SchemaChange != nil {
+		log.SchemaChange.Objects = group.Objects
+	}
+	if err != nil {
+		log.Error = err.Error()
+	}
+	return log, err
+}
@@ -0,0 +1,163 @@
+package usecase_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/m-mizutani/gt"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
+	"github.com/secmon-lab/swarm/pkg/infra"
+	"github.com/secmon-lab/swarm/pkg/infra/cs"
+	"github.com/secmon-lab/swarm/pkg/infra/memory"
+	"github.com/secmon-lab/swarm/pkg/infra/policy"
+	"github.com/secmon-lab/swarm/pkg/infra/pubsub"
+	"github.com/secmon-lab/swarm/pkg/infra/sink"
+	"github.com/secmon-lab/swarm/pkg/usecase"
+)
+
+const sinkSchemaPolicy = `package schema.cloudtrail
+
+log contains {
+	"dataset": "my_dataset",
+	"table": "cloudtrail",
+	"id": r.eventID,
+	"timestamp": time.parse_rfc3339_ns(r.eventTime) / 1000000000,
+	"data": r,
+	"sink": sinks[i],
+} if {
+	some i
+	r := input.Records[i]
+	sinks[i]
+}
+
+log contains {
+	"dataset": "my_dataset",
+	"table": "cloudtrail",
+	"id": r.eventID,
+	"timestamp": time.parse_rfc3339_ns(r.eventTime) / 1000000000,
+	"data": r,
+} if {
+	some i
+	r := input.Records[i]
+	not sinks[i]
+}
+
+sinks := {
+	0: ["bigquery", "alert", "archive"],
+	1: ["alert"],
+	2: ["archive", "archive"],
+}
+`
+
+func TestLoad_Sink(t *testing.T) {
+	ctx := context.Background()
+	csClient := &cs.Mock{
+		MockOpen: func(ctx context.Context, obj model.CloudStorageObject) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(cloudTrailExampleRaw)), nil
+		},
+	}
+	req := &model.LoadRequest{
+		Source: model.Source{
+			Parser:   types.JSONParser,
+			Schema:   "cloudtrail",
+			Compress: types.NoCompress,
+		},
+		Object: model.Object{
+			CS: &model.CloudStorageObject{
+				Bucket: "test-bucket",
+				Name:   "cloudtrail_example.log",
+			},
+		},
+	}
+	pClient := gt.R1(policy.New(policy.WithPolicyData("schema.rego", sinkSchemaPolicy))).NoError(t)
+
+	t.Run("records are written to selected sinks", func(t *testing.T) {
+		bqClient := memory.New(memory.WithImplicitDataset())
+		archive := memory.New(memory.WithImplicitDataset())
+		topic := pubsub.NewMock()
+
+		uc := usecase.New(
+			infra.New(
+				infra.WithBigQuery(bqClient),
+				infra.WithCloudStorage(csClient),
+				infra.WithPolicy(pClient),
+			),
+			usecase.WithMetadata(model.NewMetadataConfig("test-dataset", "test-table")),
+			usecase.WithSink("alert", sink.NewPubSub(topic)),
+			usecase.WithTableSink("archive", archive),
+		)
+		gt.NoError(t, uc.Load(ctx, []*model.LoadRequest{req}))
+
+		// Record 0 and 3 are written to the BigQuery table
+		rows := gt.R1(bqClient.Rows("my_dataset", "cloudtrail")).NoError(t)
+		gt.A(t, rows).Length(2)
+
+		archived := gt.R1(archive.Rows("my_dataset", "cloudtrail")).NoError(t)
+		gt.A(t, archived).Length(2)
+
+		gt.A(t, topic.Results).Length(2)
+		var msg model.LogMessage
+		gt.NoError(t, json.Unmarshal(topic.Results[0].Data, &msg))
+		gt.Equal(t, msg.Dataset, "my_dataset")
+		gt.Equal(t, msg.Table, "cloudtrail")
+		gt.NotEqual(t, msg.ID, "")
+
+		iter := gt.R1(bqClient.Query(ctx, "SELECT * FROM `test-dataset.test-table`")).NoError(t)
+		var log model.LoadLog
+		gt.NoError(t, iter.Next(&log))
+		gt.A(t, log.Ingests).Length(1)
+		sinks := log.Ingests[0].Sinks
+		gt.A(t, sinks).Length(3)
+		gt.Equal(t, sinks[0].Name, "alert")
+		gt.Equal(t, sinks[0].LogCount, 2)
+		gt.True(t, sinks[0].Success)
+		gt.Equal(t, sinks[1].Name, "archive")
+		gt.Equal(t, sinks[1].LogCount, 2)
+		gt.Equal(t, sinks[2].Name, types.BigQuerySink)
+		gt.Equal(t, sinks[2].LogCount, 2)
+		gt.Equal(t, log.Ingests[0].LogCount, 4)
+	})
+
+	t.Run("sink failure is recorded", func(t *testing.T) {
+		bqClient := memory.New(memory.WithImplicitDataset())
+		topic := &pubsub.Mock{
+			MockPublish: func(ctx context.Context, data []byte, options ...model.PublishOption) (types.PubSubMessageID, error) {
+				return "", io.ErrUnexpectedEOF
+			},
+		}
+
+		uc := usecase.New(
+			infra.New(
+				infra.WithBigQuery(bqClient),
+				infra.WithCloudStorage(csClient),
+				infra.WithPolicy(pClient),
+			),
+			usecase.WithMetadata(model.NewMetadataConfig("test-dataset", "test-table")),
+			usecase.WithSink("alert", sink.NewPubSub(topic)),
+			usecase.WithTableSink("archive", memory.New(memory.WithImplicitDataset())),
+		)
+		gt.Error(t, uc.Load(ctx, []*model.LoadRequest{req}))
+
+		// BigQuery table is not affected by failure of other sink
+		rows := gt.R1(bqClient.Rows("my_dataset", "cloudtrail")).NoError(t)
+		gt.A(t, rows).Length(2)
+	})
+
+	t.Run("unknown sink is rejected", func(t *testing.T) {
+		bqClient := memory.New(memory.WithImplicitDataset())
+		uc := usecase.New(
+			infra.New(
+				infra.WithBigQuery(bqClient),
+				infra.WithCloudStorage(csClient),
+				infra.WithPolicy(pClient),
+			),
+			usecase.WithSink("alert", sink.NewPubSub(pubsub.NewMock())),
+		)
+		err := uc.Load(ctx, []*model.LoadRequest{req})
+		gt.Error(t, err).Is(types.ErrInvalidPolicyResult)
+	})
+}
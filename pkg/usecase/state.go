@@ -2,6 +2,8 @@ package usecase
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"time"
 
 	"github.com/m-mizutani/goerr/v2"
@@ -71,3 +73,81 @@ func (x *UseCase) WaitState(ctx context.Context, msgType types.MsgType, id strin
 		time.Sleep(x.stateCheckInterval)
 	}
 }
+
+// loadWithObjectState loads requests of objects whose state is acquired. Objects that are already completed are skipped. If any object is being processed by another process, it returns types.ErrBlockingPubSub after loading other objects to retry the message later.
+func (x *UseCase) loadWithObjectState(ctx context.Context, requests []*model.LoadRequest) error {
+	var targets []*model.LoadRequest
+	var stateIDs []string
+	var blocked []*model.CloudStorageObject
+	acquired := make(map[string]bool)
+
+	objState := types.MsgFailed
+	defer func() {
+		for _, id := range stateIDs {
+			if err := x.UpdateState(ctx, types.MsgObject, id, objState); err != nil {
+				utils.HandleError(ctx, "failed to update state of object", err)
+			}
+		}
+	}()
+
+	for _, req := range requests {
+		id, ok := objectStateID(req.Object)
+		if !ok {
+			targets = append(targets, req)
+			continue
+		}
+
+		// Requests of the same object with different sources share the state
+		if ok, exists := acquired[id]; exists {
+			if ok {
+				targets = append(targets, req)
+			}
+			continue
+		}
+
+		state, ok, err := x.GetOrCreateState(ctx, types.MsgObject, id)
+		if err != nil {
+			return goerr.Wrap(err, "failed to get or create state for object", goerr.V("object", req.Object.CS))
+		}
+		acquired[id] = ok
+
+		switch {
+		case ok:
+			stateIDs = append(stateIDs, id)
+			targets = append(targets, req)
+		case state.State == types.MsgCompleted:
+			utils.CtxLogger(ctx).Info("skip object because it's already completed", "object", req.Object.CS)
+		default:
+			blocked = append(blocked, req.Object.CS)
+		}
+	}
+
+	if len(targets) > 0 {
+		if err := x.load(ctx, targets); err != nil {
+			return err
+		}
+	}
+	objState = types.MsgCompleted
+
+	if len(blocked) > 0 {
+		return goerr.Wrap(types.ErrBlockingPubSub, "objects are being processed by another process", goerr.V("objects", blocked))
+	}
+	return nil
+}
+
+// objectStateID returns ID of state of the object. It is digest of the bucket, name and MD5 digest of the object to distinguish overwritten objects, because ID of Firestore document can not contain slash. Objects other than Cloud Storage have no state.
+func objectStateID(obj model.Object) (string, bool) {
+	if obj.CS == nil {
+		return "", false
+	}
+
+	key := "gs://" + string(obj.CS.Bucket) + "/" + string(obj.CS.Name)
+	for _, digest := range obj.Digests {
+		if digest.Alg == "md5" && digest.Value != "" {
+			key += "#md5:" + digest.Value
+		}
+	}
+
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:]), true
+}
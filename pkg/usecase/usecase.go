@@ -1,9 +1,12 @@
 package usecase
 
 import (
+	"sync"
 	"time"
 
+	"github.com/secmon-lab/swarm/pkg/domain/interfaces"
 	"github.com/secmon-lab/swarm/pkg/domain/model"
+	"github.com/secmon-lab/swarm/pkg/domain/types"
 	"github.com/secmon-lab/swarm/pkg/infra"
 )
 
@@ -11,11 +14,27 @@ type UseCase struct {
 	clients  *infra.Clients
 	metadata *model.MetadataConfig
 
+	// datasetConfig is configuration to create dataset automatically. If nil, dataset is not created.
+	datasetConfig *model.DatasetConfig
+	// knownDatasets is a set of datasets that are confirmed to exist. It avoids checking dataset for each ingestion.
+	knownDatasets sync.Map
+
+	// schemaGuard is configuration of guardrails for inferred table schema. If nil, no guardrail is applied.
+	schemaGuard *model.SchemaGuard
+
+	// sinks is output destinations of log records other than the BigQuery table. Records are sent to sinks specified by `sink` field of log output.
+	sinks map[types.SinkName]interfaces.Sink
+
+	// notifyTopics is Pub/Sub topics to publish log records after insertion. Records are published to the topic specified by `notify` field of log output.
+	notifyTopics map[types.NotifyTopic]interfaces.PubSubTopic
+
 	readObjectConcurrency   int
 	ingestTableConcurrency  int
 	ingestRecordConcurrency int
 	enqueueCountLimit       int
 	enqueueSizeLimit        int
+	regoPrint               regoPrintConfig
+	job                     jobConfig
 
 	// stateTimeout is a duration to wait for state transition. Even if the state is not changed, other process can acquire the state after this duration.
 	stateTimeout time.Duration
@@ -28,6 +47,9 @@ type UseCase struct {
 
 	// stateWaitTimeout is a duration to wait for state transition. This is used in WaitState method.
 	stateWaitTimeout time.Duration
+
+	// objectState enables state of each object in Load in addition to state of each message. It requires database.
+	objectState bool
 }
 
 const (
@@ -40,6 +62,16 @@ const (
 	defaultStateTTL                = 7 * 24 * time.Hour
 	defaultStateCheckInterval      = 10 * time.Second
 	defaultStateWaitTimeout        = 2 * time.Minute
+	defaultRegoPrintLimit          = 100
+	defaultRegoPrintSample         = 1
+	defaultJobConcurrency          = 8
+	defaultJobPullSize             = 10
+	defaultJobMaxOutstanding       = 16
+	defaultJobMaxOutstandingBytes  = 64 * 1024 * 1024
+	defaultJobDrainTimeout         = 30 * time.Second
+	defaultJobLeaseExtension       = 90 * time.Second
+	defaultJobPullTimeout          = 30 * time.Second
+	defaultJobNackDelay            = 10 * time.Second
 )
 
 func New(clients *infra.Clients, options ...Option) *UseCase {
@@ -54,6 +86,20 @@ func New(clients *infra.Clients, options ...Option) *UseCase {
 		stateTTL:                defaultStateTTL,
 		stateCheckInterval:      defaultStateCheckInterval,
 		stateWaitTimeout:        defaultStateWaitTimeout,
+		regoPrint: regoPrintConfig{
+			limit:  defaultRegoPrintLimit,
+			sample: defaultRegoPrintSample,
+		},
+		job: jobConfig{
+			concurrency:            defaultJobConcurrency,
+			pullSize:               defaultJobPullSize,
+			maxOutstandingMessages: defaultJobMaxOutstanding,
+			maxOutstandingBytes:    defaultJobMaxOutstandingBytes,
+			drainTimeout:           defaultJobDrainTimeout,
+			leaseExtension:         defaultJobLeaseExtension,
+			pullTimeout:            defaultJobPullTimeout,
+			nackDelay:              defaultJobNackDelay,
+		},
 	}
 
 	for _, option := range options {
@@ -71,6 +117,46 @@ func WithMetadata(metadata *model.MetadataConfig) Option {
 	}
 }
 
+// WithDatasetConfig enables automatic creation of dataset that does not exist.
+func WithDatasetConfig(cfg *model.DatasetConfig) Option {
+	return func(uc *UseCase) {
+		uc.datasetConfig = cfg
+	}
+}
+
+func WithSchemaGuard(guard *model.SchemaGuard) Option {
+	return func(uc *UseCase) {
+		uc.schemaGuard = guard
+	}
+}
+
+// WithSink adds an output destination of log records with the name. Log output of schema policy selects it by `sink` field.
+func WithSink(name types.SinkName, sink interfaces.Sink) Option {
+	return func(uc *UseCase) {
+		if uc.sinks == nil {
+			uc.sinks = make(map[types.SinkName]interfaces.Sink)
+		}
+		uc.sinks[name] = sink
+	}
+}
+
+// WithNotifyTopic adds a Pub/Sub topic with the name to publish log records after insertion. Log output of schema policy selects it by `notify.topic` field.
+func WithNotifyTopic(name types.NotifyTopic, topic interfaces.PubSubTopic) Option {
+	return func(uc *UseCase) {
+		if uc.notifyTopics == nil {
+			uc.notifyTopics = make(map[types.NotifyTopic]interfaces.PubSubTopic)
+		}
+		uc.notifyTopics[name] = topic
+	}
+}
+
+// WithTableSink adds an output destination that has tables in the same way as BigQuery, e.g. BigQuery of another project or data lake. Tables are created and updated with the same schema inference as the BigQuery table.
+func WithTableSink(name types.SinkName, bq interfaces.BigQuery) Option {
+	return func(uc *UseCase) {
+		WithSink(name, &tableSink{uc: uc, bq: bq})(uc)
+	}
+}
+
 func WithReadObjectConcurrency(n int) Option {
 	if n < 1 {
 		n = 1
@@ -116,6 +202,26 @@ func WithIngestRecordConcurrency(n int) Option {
 	}
 }
 
+// WithRegoPrintLimit sets max number of `print` output lines of Rego for each evaluation scope, such as an object. Zero means unlimited.
+func WithRegoPrintLimit(n int) Option {
+	if n < 0 {
+		n = 0
+	}
+	return func(uc *UseCase) {
+		uc.regoPrint.limit = n
+	}
+}
+
+// WithRegoPrintSample sets sampling interval of `print` output of Rego. Only 1 of every n lines is written to log.
+func WithRegoPrintSample(n int) Option {
+	if n < 1 {
+		n = 1
+	}
+	return func(uc *UseCase) {
+		uc.regoPrint.sample = n
+	}
+}
+
 func WithStateTimeout(d time.Duration) Option {
 	return func(uc *UseCase) {
 		uc.stateTimeout = d
@@ -133,3 +239,74 @@ func WithStateCheckInterval(d time.Duration) Option {
 		uc.stateCheckInterval = d
 	}
 }
+
+// WithObjectState enables state of each object identified by bucket, name and MD5 digest. An object that is already loaded is skipped even if it is notified by another message, such as both of Cloud Storage notification and enqueue.
+func WithObjectState(enabled bool) Option {
+	return func(uc *UseCase) {
+		uc.objectState = enabled
+	}
+}
+
+// WithJobConcurrency sets number of messages processed concurrently for each subscription by job.
+func WithJobConcurrency(n int) Option {
+	if n < 1 {
+		n = 1
+	}
+	return func(uc *UseCase) {
+		uc.job.concurrency = n
+	}
+}
+
+// WithJobPullSize sets max number of messages pulled from the subscription at once by job.
+func WithJobPullSize(n int) Option {
+	if n < 1 {
+		n = 1
+	}
+	return func(uc *UseCase) {
+		uc.job.pullSize = n
+	}
+}
+
+// WithJobMaxOutstandingMessages sets max number of messages that are pulled but not acknowledged yet for each subscription. Messages are not pulled while the limit is reached.
+func WithJobMaxOutstandingMessages(n int) Option {
+	if n < 1 {
+		n = 1
+	}
+	return func(uc *UseCase) {
+		uc.job.maxOutstandingMessages = n
+	}
+}
+
+// WithJobMaxOutstandingBytes sets max total size of messages that are pulled but not acknowledged yet for each subscription. Zero means no limit.
+func WithJobMaxOutstandingBytes(n int) Option {
+	if n < 0 {
+		n = 0
+	}
+	return func(uc *UseCase) {
+		uc.job.maxOutstandingBytes = n
+	}
+}
+
+// WithJobIdleTimeout makes job exit if no message is available for the duration. Zero means job runs until canceled.
+func WithJobIdleTimeout(d time.Duration) Option {
+	return func(uc *UseCase) {
+		uc.job.idleTimeout = d
+	}
+}
+
+// WithJobDrainTimeout sets a duration to wait for in-flight messages when job is stopped. Zero means waiting until all of them are completed.
+func WithJobDrainTimeout(d time.Duration) Option {
+	return func(uc *UseCase) {
+		uc.job.drainTimeout = d
+	}
+}
+
+// WithJobNackDelay sets a delay of redelivery of a message that failed to be processed by job. The delay is doubled for each delivery attempt if dead lettering is enabled on the subscription.
+func WithJobNackDelay(d time.Duration) Option {
+	if d < 0 {
+		d = 0
+	}
+	return func(uc *UseCase) {
+		uc.job.nackDelay = d
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"reflect"
+	"strings"
+	"time"
 	"unsafe"
 
 	"cloud.google.com/go/bigquery"
 	"github.com/m-mizutani/goerr/v2"
+	"github.com/secmon-lab/swarm/pkg/domain/model"
 	"github.com/secmon-lab/swarm/pkg/domain/types"
 )
 
@@ -167,7 +170,7 @@ func schemaToJSON(schema bigquery.Schema) (string, error) {
 	return out.String(), nil
 }
 
-func buildBQMetadata(schema bigquery.Schema, pt types.BQPartition) (*bigquery.TableMetadata, error) {
+func buildBQMetadata(schema bigquery.Schema, pt types.BQPartition, opts *model.TableOptions) (*bigquery.TableMetadata, error) {
 	tpMap := map[types.BQPartition]bigquery.TimePartitioningType{
 		types.BQPartitionHour:  bigquery.HourPartitioningType,
 		types.BQPartitionDay:   bigquery.DayPartitioningType,
@@ -190,5 +193,67 @@ func buildBQMetadata(schema bigquery.Schema, pt types.BQPartition) (*bigquery.Ta
 		}
 	}
 
+	if opts == nil {
+		return md, nil
+	}
+
+	if len(opts.Clustering) > 0 {
+		md.Clustering = &bigquery.Clustering{Fields: opts.Clustering}
+	}
+	if opts.PartitionExpirationDays > 0 && md.TimePartitioning != nil {
+		md.TimePartitioning.Expiration = time.Duration(opts.PartitionExpirationDays) * 24 * time.Hour
+	}
+	if opts.RequirePartitionFilter != nil {
+		md.RequirePartitionFilter = *opts.RequirePartitionFilter
+	}
+	md.Description = opts.Description
+	md.Labels = opts.Labels
+
+	if len(opts.ColumnDescriptions) > 0 {
+		md.Schema = setColumnDescriptions(schema, opts.ColumnDescriptions)
+	}
+
 	return md, nil
 }
+
+// setColumnDescriptions returns copy of schema with descriptions. The key of descriptions is dot separated column path, such as `data.src_addr`. Columns that are not in schema are ignored because records of a batch may not have all columns.
+func setColumnDescriptions(schema bigquery.Schema, descriptions map[string]string) bigquery.Schema {
+	result := copySchema(schema)
+
+	for path, desc := range descriptions {
+		fields := result
+		var target *bigquery.FieldSchema
+		for _, name := range strings.Split(path, ".") {
+			target = nil
+			for _, f := range fields {
+				if f.Name == name {
+					target = f
+					break
+				}
+			}
+			if target == nil {
+				break
+			}
+			fields = target.Schema
+		}
+
+		if target != nil {
+			target.Description = desc
+		}
+	}
+
+	return result
+}
+
+func copySchema(schema bigquery.Schema) bigquery.Schema {
+	if schema == nil {
+		return nil
+	}
+	result := make(bigquery.Schema, len(schema))
+	for i, f := range schema {
+		field := *f
+		field.Schema = copySchema(f.Schema)
+		result[i] = &field
+	}
+	return result
+}
@@ -21,3 +21,17 @@ func HandleError(ctx context.Context, msg string, err error) {
 
 	CtxLogger(ctx).Error(msg, ErrLog(err), "sentry.EventID", evID)
 }
+
+// HandleWarning reports an event that is not an error but should be noticed by operators. args are key-value pairs same as slog.
+func HandleWarning(ctx context.Context, msg string, args ...any) {
+	hub := sentry.CurrentHub().Clone()
+	hub.ConfigureScope(func(scope *sentry.Scope) {
+		scope.SetLevel(sentry.LevelWarning)
+		for i := 0; i+1 < len(args); i += 2 {
+			scope.SetAttributes(attribute.String(fmt.Sprintf("%v", args[i]), fmt.Sprintf("%v", args[i+1])))
+		}
+	})
+	evID := hub.CaptureMessage(msg)
+
+	CtxLogger(ctx).Warn(msg, append(args, "sentry.EventID", evID)...)
+}